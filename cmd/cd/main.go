@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
@@ -41,7 +45,11 @@ func main() {
 		panic(err)
 	}
 
-	if err := ctl.NewCDController(cfg).Run(addr); err != nil {
+	// cancel the in-flight reconciles on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := ctl.NewCDController(cfg).Run(ctx, addr); err != nil {
 		panic(err)
 	}
 }
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
@@ -13,7 +17,10 @@ func needInit() (*configure.InstallConfigure, error) {
 	if common.InCluster {
 		configure.SetTheAppRuntimeMode(configure.InCluster)
 	}
-	cfg, err := configure.NewInstallConfigure(k8s.NewResources(nil))
+	cfg, err := configure.NewInstallConfigure(k8s.NewResources([]string{
+		k8s.CD,
+		k8s.Stone,
+	}))
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +37,15 @@ func main() {
 		panic(err)
 	}
 
-	if err := ctl.NewCIController(cfg).Run(addr); err != nil {
+	// cancel the in-flight reconciles on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	controller, err := ctl.NewCIController(cfg)
+	if err != nil {
+		panic(err)
+	}
+	if err := controller.Run(ctx, addr); err != nil {
 		panic(err)
 	}
 }
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
@@ -14,7 +18,10 @@ func needInit() (*configure.InstallConfigure, error) {
 	if common.InCluster {
 		configure.SetTheAppRuntimeMode(configure.InCluster)
 	}
-	cfg, err := configure.NewInstallConfigure(k8s.NewResources(nil))
+	cfg, err := configure.NewInstallConfigure(k8s.NewResources([]string{
+		k8s.CD,
+		k8s.Stone,
+	}))
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +38,11 @@ func main() {
 		panic(err)
 	}
 	fmt.Println(addr)
-	if err := ctl.NewSonarController(cfg).Run(addr); err != nil {
+	// cancel the in-flight reconciles on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := ctl.NewSonarController(cfg).Run(ctx, addr); err != nil {
 		panic(err)
 	}
 }
@@ -7,6 +7,20 @@ import (
 const (
 	SuccessState = "SUCCESS"
 	FailState    = "FAIL"
+	// QueuedState the progress state of the request waiting for the build concurrency
+	QueuedState = "QUEUED"
+	// CancelledState the request superseded by a newer commit or the cancelled pipelineRun
+	CancelledState = "CANCELLED"
+	// RunningState the progress state of the request with the steps of the running pipelineRun
+	RunningState = "RUNNING"
+	// WaitingState the step waiting for the former steps of the task
+	WaitingState = "WAITING"
+)
+
+// the schedule phase of the CI request
+const (
+	QueuedPhase  = "QUEUED"
+	RunningPhase = "RUNNING"
 )
 
 // +genclient
@@ -29,6 +43,51 @@ type CISpec struct {
 	Output      *string `json:"output"`
 	ProjectPath string  `json:"projectPath"`
 	ProjectFile string  `json:"projectFile"`
+	// Builder the image builder of the request, kaniko|buildkit|buildah
+	Builder string `json:"builder"`
+	// Platforms the multi-arch build platforms, e.g. linux/amd64,linux/arm64
+	Platforms []string `json:"platforms"`
+	// ImageDigest the digest of the pushed image, the image index digest of the multi-arch build
+	ImageDigest string `json:"imageDigest"`
+	// Tags the tags pushed of the image
+	Tags []string `json:"tags"`
+	// SBOM the reference of the sbom artifact attached to the image digest by the build profile,
+	// e.g. harbor.ym/devops/app@sha256:...
+	SBOM string `json:"sbom"`
+	// Scan the vulnerabilities of the pushed images scanned by the -image-scan
+	Scan *ScanSummary `json:"scan"`
+	// BuildArgs the --build-arg of the image build, must not contain any secret
+	BuildArgs map[string]string `json:"buildArgs"`
+	// BuildSecrets the secrets of the ops namespace mounted into the image build
+	BuildSecrets []BuildSecret `json:"buildSecrets"`
+	// Priority the request of the higher priority is scheduled first when the builds are queued
+	Priority int32 `json:"priority"`
+	// RequestTime the RFC3339 time of the request, the queue order of the same priority
+	RequestTime string `json:"requestTime"`
+	// Phase the schedule phase of the request QUEUED|RUNNING, empty before scheduled
+	Phase string `json:"phase"`
+	// QueuePosition the 1-based position of the queued request
+	QueuePosition int32 `json:"queuePosition"`
+	// BuildAttempts the failed attempts to create the build of the admitted request
+	BuildAttempts int32 `json:"buildAttempts"`
+	// NextAttemptTime the RFC3339 time the failed request is built again, the retry backoff of the attempts
+	NextAttemptTime string `json:"nextAttemptTime"`
+	// PipelineRun the pipelineRun of the request, named by the commit
+	PipelineRun string `json:"pipelineRun"`
+	// Force build the image even it was built of the commit already
+	Force bool `json:"force"`
+	// Images the sub-projects of the monorepo built in one pipelineRun sharing the clone,
+	// the ProjectPath, ProjectFile and Output of the request are not used if set
+	Images []CIImage `json:"images"`
+	// WatchPaths the paths rebuild the image if changed besides the ProjectPath, e.g. the shared libraries
+	WatchPaths []string `json:"watchPaths"`
+	// Pod the timeout and the resources of the build pods, override the settings of the project. The placement
+	// of the build pods is set by the operator, the request with the placement is rejected
+	Pod *BuildPod `json:"pod"`
+	// Steps the progress of the steps of the pipelineRun tasks
+	Steps []StepState `json:"steps"`
+	// Diagnosis the classification of the failure of the pipelineRun
+	Diagnosis *Diagnosis `json:"diagnosis"`
 
 	Done bool `json:"done"`
 	// fsm request field
@@ -38,6 +97,101 @@ type CISpec struct {
 	UUID      *string  `json:"uuid"`
 }
 
+// StepState the state of a step of the pipelineRun task recorded from the TaskRun
+type StepState struct {
+	// Task the pipeline task of the step, e.g. the task of the image or the platform
+	Task string `json:"task"`
+	Name string `json:"name"`
+	// State WAITING|RUNNING|SUCCESS|FAIL
+	State      string `json:"state"`
+	StartTime  string `json:"startTime"`
+	FinishTime string `json:"finishTime"`
+	ExitCode   int32  `json:"exitCode"`
+	// Reason the reason of the terminated step, e.g. Completed, Error
+	Reason string `json:"reason"`
+	// Message the termination message of the step
+	Message string `json:"message"`
+}
+
+// Diagnosis the failure of the pipelineRun classified by the diagnosis rules
+type Diagnosis struct {
+	// Category the category of the rule matched, e.g. dockerfile-not-found, registry-auth, unknown
+	Category string `json:"category"`
+	// Summary the human-readable summary of the failure
+	Summary string `json:"summary"`
+	// Task the pipeline task of the failed step
+	Task string `json:"task"`
+	Step string `json:"step"`
+	// Reason the termination reason of the failed step or the taskRun
+	Reason   string `json:"reason"`
+	ExitCode int32  `json:"exitCode"`
+}
+
+// ScanSummary the vulnerability counts by severity of the scanned images
+type ScanSummary struct {
+	Critical int32 `json:"critical"`
+	High     int32 `json:"high"`
+	Medium   int32 `json:"medium"`
+	Low      int32 `json:"low"`
+	Unknown  int32 `json:"unknown"`
+	// Threshold the max vulnerabilities of the severities, e.g. CRITICAL=0 HIGH=10, empty report only
+	Threshold string `json:"threshold"`
+	// Passed the vulnerabilities not exceed the threshold
+	Passed bool `json:"passed"`
+	// Retained the image exceeding the threshold failed to be deleted from the registry, it must not be deployed
+	Retained bool `json:"retained"`
+}
+
+// BuildSecret reference the key of a Secret in the ops namespace, the value is
+// mounted as the build secret ID and never passed by the PipelineRun params
+type BuildSecret struct {
+	// ID the build secret id, e.g. RUN --mount=type=secret,id=npmrc
+	ID         string `json:"id"`
+	SecretName string `json:"secretName"`
+	// Key the key of the Secret data, the ID if not set
+	Key string `json:"key"`
+}
+
+// CIImage a sub-project image of the monorepo build and its result
+type CIImage struct {
+	ProjectPath string `json:"projectPath"`
+	ProjectFile string `json:"projectFile"`
+	// Output the image repository, the image is named by the base of the ProjectPath
+	Output string `json:"output"`
+	// WatchPaths the paths rebuild the image if changed besides the ProjectPath
+	WatchPaths []string `json:"watchPaths"`
+	// AckState the build result of the image SUCCESS|FAIL, empty before done
+	AckState    string   `json:"ackState"`
+	ImageDigest string   `json:"imageDigest"`
+	Tags        []string `json:"tags"`
+	// SBOM the reference of the sbom artifact attached to the image digest
+	SBOM string `json:"sbom"`
+}
+
+// BuildPod the timeout, the compute resources of the build steps and the node placement of the build pods,
+// the empty field use the settings of the project and the global defaults
+type BuildPod struct {
+	// Timeout the pipelineRun timeout, e.g. 1h30m
+	Timeout          string            `json:"timeout"`
+	CPURequests      string            `json:"cpuRequests"`
+	CPULimit         string            `json:"cpuLimit"`
+	MEMRequests      string            `json:"memRequests"`
+	MEMLimit         string            `json:"memLimit"`
+	NodeSelector     map[string]string `json:"nodeSelector"`
+	Tolerations      []Toleration      `json:"tolerations"`
+	RuntimeClassName string            `json:"runtimeClassName"`
+}
+
+// Toleration the toleration of the build pods to the taint of the nodes
+type Toleration struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+	Effect   string `json:"effect"`
+	// TolerationSeconds the seconds tolerate the NoExecute taint, forever if not set
+	TolerationSeconds *int64 `json:"tolerationSeconds"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type CIList struct {
 	metav1.TypeMeta `json:",inline"`
@@ -75,6 +229,8 @@ type CDSpec struct {
 	StepName        *string       `json:"stepName"`
 	AckStates       []string      `json:"ackStates"`
 	UUID            *string       `json:"uuid"`
+	// Diagnosis the reason of the rejected deploy, e.g. the image signature not trusted
+	Diagnosis *Diagnosis `json:"diagnosis"`
 }
 
 type ArtifactInfo struct {
@@ -135,6 +291,11 @@ type UnitSpec struct {
 	Version  *string `json:"version"`
 	Command  *string `json:"command"`
 
+	// Steps the progress of the steps of the pipelineRun tasks
+	Steps []StepState `json:"steps"`
+	// Diagnosis the classification of the failure of the pipelineRun
+	Diagnosis *Diagnosis `json:"diagnosis"`
+
 	Done bool `json:"done"`
 	// fsm request field
 	FlowId    *string  `json:"flowId"`
@@ -165,6 +326,11 @@ type SonarSpec struct {
 	Language    *string `json:"language"`
 	ServiceName string  `json:"serviceName"`
 
+	// Steps the progress of the steps of the pipelineRun tasks
+	Steps []StepState `json:"steps"`
+	// Diagnosis the classification of the failure of the pipelineRun
+	Diagnosis *Diagnosis `json:"diagnosis"`
+
 	Done bool `json:"done"`
 	// fsm request field
 	FlowId    *string  `json:"flowId"`
@@ -67,6 +67,52 @@ func (in *ArtifactInfo) DeepCopy() *ArtifactInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildPod) DeepCopyInto(out *BuildPod) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildPod.
+func (in *BuildPod) DeepCopy() *BuildPod {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildPod)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildSecret) DeepCopyInto(out *BuildSecret) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildSecret.
+func (in *BuildSecret) DeepCopy() *BuildSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CD) DeepCopyInto(out *CD) {
 	*out = *in
@@ -195,6 +241,11 @@ func (in *CDSpec) DeepCopyInto(out *CDSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Diagnosis != nil {
+		in, out := &in.Diagnosis, &out.Diagnosis
+		*out = new(Diagnosis)
+		**out = **in
+	}
 	return
 }
 
@@ -235,6 +286,32 @@ func (in *CI) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CIImage) DeepCopyInto(out *CIImage) {
+	*out = *in
+	if in.WatchPaths != nil {
+		in, out := &in.WatchPaths, &out.WatchPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CIImage.
+func (in *CIImage) DeepCopy() *CIImage {
+	if in == nil {
+		return nil
+	}
+	out := new(CIImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CIList) DeepCopyInto(out *CIList) {
 	*out = *in
@@ -306,6 +383,60 @@ func (in *CISpec) DeepCopyInto(out *CISpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Platforms != nil {
+		in, out := &in.Platforms, &out.Platforms
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Scan != nil {
+		in, out := &in.Scan, &out.Scan
+		*out = new(ScanSummary)
+		**out = **in
+	}
+	if in.BuildArgs != nil {
+		in, out := &in.BuildArgs, &out.BuildArgs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.BuildSecrets != nil {
+		in, out := &in.BuildSecrets, &out.BuildSecrets
+		*out = make([]BuildSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]CIImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.WatchPaths != nil {
+		in, out := &in.WatchPaths, &out.WatchPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Pod != nil {
+		in, out := &in.Pod, &out.Pod
+		*out = new(BuildPod)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepState, len(*in))
+		copy(*out, *in)
+	}
+	if in.Diagnosis != nil {
+		in, out := &in.Diagnosis, &out.Diagnosis
+		*out = new(Diagnosis)
+		**out = **in
+	}
 	if in.AckStates != nil {
 		in, out := &in.AckStates, &out.AckStates
 		*out = make([]string, len(*in))
@@ -366,6 +497,22 @@ func (in *ConfigVolumes) DeepCopy() *ConfigVolumes {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Diagnosis) DeepCopyInto(out *Diagnosis) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Diagnosis.
+func (in *Diagnosis) DeepCopy() *Diagnosis {
+	if in == nil {
+		return nil
+	}
+	out := new(Diagnosis)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Envs) DeepCopyInto(out *Envs) {
 	*out = *in
@@ -382,6 +529,22 @@ func (in *Envs) DeepCopy() *Envs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScanSummary) DeepCopyInto(out *ScanSummary) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScanSummary.
+func (in *ScanSummary) DeepCopy() *ScanSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ScanSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServicePorts) DeepCopyInto(out *ServicePorts) {
 	*out = *in
@@ -486,6 +649,16 @@ func (in *SonarSpec) DeepCopyInto(out *SonarSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepState, len(*in))
+		copy(*out, *in)
+	}
+	if in.Diagnosis != nil {
+		in, out := &in.Diagnosis, &out.Diagnosis
+		*out = new(Diagnosis)
+		**out = **in
+	}
 	if in.AckStates != nil {
 		in, out := &in.AckStates, &out.AckStates
 		*out = make([]string, len(*in))
@@ -509,6 +682,43 @@ func (in *SonarSpec) DeepCopy() *SonarSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StepState) DeepCopyInto(out *StepState) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StepState.
+func (in *StepState) DeepCopy() *StepState {
+	if in == nil {
+		return nil
+	}
+	out := new(StepState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Toleration) DeepCopyInto(out *Toleration) {
+	*out = *in
+	if in.TolerationSeconds != nil {
+		in, out := &in.TolerationSeconds, &out.TolerationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Toleration.
+func (in *Toleration) DeepCopy() *Toleration {
+	if in == nil {
+		return nil
+	}
+	out := new(Toleration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Unit) DeepCopyInto(out *Unit) {
 	*out = *in
@@ -612,6 +822,16 @@ func (in *UnitSpec) DeepCopyInto(out *UnitSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]StepState, len(*in))
+		copy(*out, *in)
+	}
+	if in.Diagnosis != nil {
+		in, out := &in.Diagnosis, &out.Diagnosis
+		*out = new(Diagnosis)
+		**out = **in
+	}
 	if in.AckStates != nil {
 		in, out := &in.AckStates, &out.AckStates
 		*out = make([]string, len(*in))
@@ -18,6 +18,8 @@ var (
 	YceCloudExtensionsOps = fmt.Sprintf("%s-%s", YceCloudExtensions, "ops")
 	// Echoer server Address
 	EchoerAddr = "http://127.0.0.1:8080/step"
+	// ExtraResources extra resources registered with discovery, name=group/version/resource,...
+	ExtraResources = ""
 )
 
 const (
@@ -29,6 +31,7 @@ const (
 func init() {
 	flag.BoolVar(&InCluster, "incluster", false, "-incluster true")
 	flag.StringVar(&EchoerAddr, "echoer", "http://127.0.0.1:8080/step", "-echoer http://127.0.0.1:8080/step")
+	flag.StringVar(&ExtraResources, "extra-resources", "", "-extra-resources tektonconfigs=operator.tekton.dev/v1alpha1/tektonconfigs")
 
 	if home := homedir.HomeDir(); home != "" {
 		KubeConfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// OperationTimeout deadline of a single kubernetes api or echoer call
+	OperationTimeout = 30 * time.Second
+)
+
+func init() {
+	flag.DurationVar(&OperationTimeout, "operation-timeout", OperationTimeout, "-operation-timeout 30s")
+}
+
+type contextKey string
+
+const (
+	flowIdKey   contextKey = "flowId"
+	stepNameKey contextKey = "stepName"
+	uuidKey     contextKey = "uuid"
+)
+
+// WithRequest attach the fsm request metadata to ctx for logging
+func WithRequest(ctx context.Context, flowId, stepName, uuid string) context.Context {
+	ctx = context.WithValue(ctx, flowIdKey, flowId)
+	ctx = context.WithValue(ctx, stepNameKey, stepName)
+	return context.WithValue(ctx, uuidKey, uuid)
+}
+
+// WithRequestRef same as WithRequest, the nil value is treated as empty
+func WithRequestRef(ctx context.Context, flowId, stepName, uuid *string) context.Context {
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return WithRequest(ctx, deref(flowId), deref(stepName), deref(uuid))
+}
+
+// WithOperationTimeout derive a ctx limited by OperationTimeout
+func WithOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, OperationTimeout)
+}
+
+func FlowId(ctx context.Context) string   { return stringValue(ctx, flowIdKey) }
+func StepName(ctx context.Context) string { return stringValue(ctx, stepNameKey) }
+func UUID(ctx context.Context) string     { return stringValue(ctx, uuidKey) }
+
+func stringValue(ctx context.Context, key contextKey) string {
+	value, _ := ctx.Value(key).(string)
+	return value
+}
+
+// Printf print the message with level and the request metadata carried by ctx
+// e.g. [ERROR] flowId=xx stepName=ci uuid=xx reconcile error
+func Printf(ctx context.Context, level, format string, args ...interface{}) {
+	fields := make([]string, 0)
+	for _, key := range []contextKey{flowIdKey, stepNameKey, uuidKey} {
+		if value := stringValue(ctx, key); value != "" {
+			fields = append(fields, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	prefix := level
+	if len(fields) > 0 {
+		prefix = fmt.Sprintf("%s %s", level, strings.Join(fields, " "))
+	}
+	fmt.Printf("%s %s", prefix, fmt.Sprintf(format, args...))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"k8s.io/client-go/discovery"
 	client "k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -57,6 +58,26 @@ func NewInstallConfigure(k8sResLister k8s.ResourceLister) (*InstallConfigure, er
 	default:
 		return nil, fmt.Errorf("not define the runtime mode")
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	extraResources, err := k8s.ParseResources(common.ExtraResources)
+	if err != nil {
+		return nil, err
+	}
+	for name, gvr := range extraResources {
+		k8sResLister.Register(name, gvr)
+	}
+
+	// resolve the served resource version before the informer start
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(resetConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := k8sResLister.Discover(discoveryClient); err != nil {
+		return nil, err
+	}
 
 	cacheInformerFactory, err := k8s.NewCacheInformerFactory(k8sResLister, resetConfig)
 	if err != nil {
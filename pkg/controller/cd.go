@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -30,13 +31,14 @@ type CDController struct {
 	proc        *proc.Proc
 }
 
-func (s *CDController) handle(cd *v1.CD) error {
+func (s *CDController) handle(ctx context.Context, cd *v1.CD) error {
 	resp := &resource.Response{
-		FlowId:   *cd.Spec.FlowId,
-		StepName: *cd.Spec.StepName,
-		AckState: cd.Spec.AckStates[0],
-		UUID:     *cd.Spec.UUID,
-		Done:     cd.Spec.Done,
+		FlowId:    *cd.Spec.FlowId,
+		StepName:  *cd.Spec.StepName,
+		AckState:  cd.Spec.AckStates[0],
+		UUID:      *cd.Spec.UUID,
+		Done:      cd.Spec.Done,
+		Diagnosis: diagnosis(cd.Spec.Diagnosis),
 	}
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
@@ -49,22 +51,22 @@ func (s *CDController) handle(cd *v1.CD) error {
 		return err
 	}
 
-	return s.response2echoer(data)
+	return s.response2echoer(ctx, data)
 }
 
-func (s *CDController) response2echoer(data map[string]interface{}) error {
+func (s *CDController) response2echoer(ctx context.Context, data map[string]interface{}) error {
 	request := s.Post(common.EchoerAddr)
 	for k, v := range data {
 		request.Params(k, v)
 	}
-	if err := request.Do(); err != nil {
+	if err := request.Do(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
-	list, err := s.List(common.YceCloudExtensions, k8s.CD, "", 0, 0, nil)
+func (s *CDController) recv(ctx context.Context, errC chan<- error) {
+	list, err := s.List(ctx, common.YceCloudExtensions, k8s.CD, "", 0, 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -77,7 +79,7 @@ func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
 			fmt.Printf("%s UnstructuredObjectToInstanceObj error (%s)\n", common.ERROR, err)
 			continue
 		}
-		if err := s.handle(cd); err != nil {
+		if err := s.handle(common.WithRequestRef(ctx, cd.Spec.FlowId, cd.Spec.StepName, cd.Spec.UUID), cd); err != nil {
 			fmt.Printf("%s handle cd error (%s)\n", common.ERROR, err)
 			continue
 		}
@@ -89,7 +91,7 @@ func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
 		return
 	}
 
-	eventChan, err := s.Watch(common.YceCloudExtensions, k8s.CD, cdList.GetResourceVersion(), 0, nil)
+	eventChan, err := s.Watch(ctx, common.YceCloudExtensions, k8s.CD, cdList.GetResourceVersion(), 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch error (%s)\n", common.ERROR, err)
 		errC <- err
@@ -100,7 +102,7 @@ func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s cd controller stop", common.INFO)
 			return
 
@@ -118,7 +120,7 @@ func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
 				continue
 			}
 
-			if err := s.handle(cd); err != nil {
+			if err := s.handle(common.WithRequestRef(ctx, cd.Spec.FlowId, cd.Spec.StepName, cd.Spec.UUID), cd); err != nil {
 				fmt.Printf("%s cd controller handle error (%s)\n", common.ERROR, err)
 				continue
 			}
@@ -128,7 +130,7 @@ func (s *CDController) recv(stop <-chan struct{}, errC chan<- error) {
 	}
 }
 
-func (s *CDController) Run(addr string) error {
+func (s *CDController) Run(ctx context.Context, addr string) error {
 	route := gin.New()
 	route.Use(gin.Logger())
 
@@ -149,6 +151,8 @@ func (s *CDController) Run(addr string) error {
 			requestErr(g, err)
 			return
 		}
+		// cancelled when the client disconnect
+		ctx := common.WithRequest(g.Request.Context(), request.FlowId, request.StepName, request.UUID)
 
 		artifactInfo := &v1.ArtifactInfo{
 			Command:       make([]string, 0),
@@ -216,24 +220,20 @@ func (s *CDController) Run(addr string) error {
 			return
 		}
 		// 写入CRD配置
-		obj, _, err := s.Apply(common.YceCloudExtensions, k8s.CD, name, unstructured, true)
+		obj, _, err := s.Apply(ctx, common.YceCloudExtensions, k8s.CD, name, unstructured, true)
 		if err != nil {
 			internalApplyErr(g, err)
-			fmt.Printf("cd controller apply (%s) error (%s)\n", name, err)
+			common.Printf(ctx, common.ERROR, "cd controller apply (%s) error (%s)\n", name, err)
 			return
 		}
 
 		g.JSON(http.StatusOK, obj)
 	})
 
-	go func() {
-		s.proc.Error() <- route.Run(addr)
-	}()
-
 	s.proc.Add(s.Start)
 	s.proc.Add(s.recv)
 
-	return <-s.proc.Start()
+	return run(ctx, addr, route, s.proc)
 }
 
 func NewCDController(cfg *configure.InstallConfigure) Interface {
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
@@ -16,10 +19,12 @@ import (
 	"github.com/laik/yce-cloud-extensions/pkg/resource"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
 	servicesci "github.com/laik/yce-cloud-extensions/pkg/services/ci"
+	"github.com/laik/yce-cloud-extensions/pkg/services/gc"
 	client "github.com/laik/yce-cloud-extensions/pkg/utils/http"
 	httpclient "github.com/laik/yce-cloud-extensions/pkg/utils/http"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
 type CIController struct {
@@ -28,34 +33,71 @@ type CIController struct {
 	client.IClient
 	services.IService
 	lastVersion string
+	// supersedePolicies the policy of the not done request of the same project and branch
+	supersedePolicies *servicesci.SupersedePolicies
 
 	proc *proc.Proc
 }
 
-func (s *CIController) response2echoer(data map[string]interface{}) error {
+func (s *CIController) response2echoer(ctx context.Context, data map[string]interface{}) error {
 	request := s.Post(common.EchoerAddr)
 	for k, v := range data {
 		request.Params(k, v)
 	}
-	if err := request.Do(); err != nil {
+	if err := request.Do(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *CIController) reconcile(ci *v1.CI) error {
-	if !ci.Spec.Done || len(ci.Spec.AckStates) == 0 {
+func (s *CIController) reconcile(ctx context.Context, ci *v1.CI) error {
+	var resp *resource.CIResponse
+	switch {
+	case ci.Spec.Done && len(ci.Spec.AckStates) > 0:
+		resp = &resource.CIResponse{
+			FlowId:      *ci.Spec.FlowId,
+			StepName:    *ci.Spec.StepName,
+			AckState:    ci.Spec.AckStates[0],
+			UUID:        *ci.Spec.UUID,
+			Done:        ci.Spec.Done,
+			ImageDigest: ci.Spec.ImageDigest,
+			Tags:        ci.Spec.Tags,
+			SBOM:        ci.Spec.SBOM,
+			Scan:        scanSummary(ci.Spec.Scan),
+			Steps:       stepStates(ci.Spec.Steps),
+			Diagnosis:   diagnosis(ci.Spec.Diagnosis),
+		}
+		for _, image := range ci.Spec.Images {
+			resp.Images = append(resp.Images, resource.ImageResult{
+				ProjectPath: image.ProjectPath,
+				ProjectFile: image.ProjectFile,
+				Output:      image.Output,
+				AckState:    image.AckState,
+				ImageDigest: image.ImageDigest,
+				Tags:        image.Tags,
+				SBOM:        image.SBOM,
+			})
+		}
+	case !ci.Spec.Done && ci.Spec.Phase == v1.QueuedPhase:
+		// the progress of the request waiting for the build concurrency
+		resp = &resource.CIResponse{
+			FlowId:        *ci.Spec.FlowId,
+			StepName:      *ci.Spec.StepName,
+			AckState:      v1.QueuedState,
+			UUID:          *ci.Spec.UUID,
+			QueuePosition: ci.Spec.QueuePosition,
+		}
+	case !ci.Spec.Done && ci.Spec.Phase == v1.RunningPhase && services.StepProgress && len(ci.Spec.Steps) > 0:
+		// the progress of the running steps
+		data, err := progressResponse(*ci.Spec.FlowId, *ci.Spec.StepName, *ci.Spec.UUID, ci.Spec.Steps)
+		if err != nil {
+			return err
+		}
+		return s.response2echoer(ctx, data)
+	default:
 		return nil
 	}
 
-	resp := &resource.Response{
-		FlowId:   *ci.Spec.FlowId,
-		StepName: *ci.Spec.StepName,
-		AckState: ci.Spec.AckStates[0],
-		UUID:     *ci.Spec.UUID,
-		Done:     ci.Spec.Done,
-	}
-
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
 		return err
@@ -67,11 +109,11 @@ func (s *CIController) reconcile(ci *v1.CI) error {
 		return err
 	}
 
-	return s.response2echoer(data)
+	return s.response2echoer(ctx, data)
 }
 
-func (s *CIController) recv(stop <-chan struct{}, errC chan<- error) {
-	list, err := s.List(common.YceCloudExtensionsOps, k8s.CI, "", 0, 0, nil)
+func (s *CIController) recv(ctx context.Context, errC chan<- error) {
+	list, err := s.List(ctx, common.YceCloudExtensionsOps, k8s.CI, "", 0, 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -84,7 +126,7 @@ func (s *CIController) recv(stop <-chan struct{}, errC chan<- error) {
 			fmt.Printf("%s UnstructuredObjectToInstanceObj error (%s)", common.ERROR, err)
 			continue
 		}
-		if err := s.reconcile(ci); err != nil {
+		if err := s.reconcile(common.WithRequestRef(ctx, ci.Spec.FlowId, ci.Spec.StepName, ci.Spec.UUID), ci); err != nil {
 			fmt.Printf("%s handle ci error (%s)\n", common.ERROR, err)
 			continue
 		}
@@ -96,7 +138,7 @@ func (s *CIController) recv(stop <-chan struct{}, errC chan<- error) {
 		return
 	}
 
-	eventChan, err := s.Watch(common.YceCloudExtensionsOps, k8s.CI, ciList.GetResourceVersion(), 0, nil)
+	eventChan, err := s.Watch(ctx, common.YceCloudExtensionsOps, k8s.CI, ciList.GetResourceVersion(), 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -106,7 +148,7 @@ func (s *CIController) recv(stop <-chan struct{}, errC chan<- error) {
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s ci controller stop\n", common.INFO)
 			return
 
@@ -123,20 +165,82 @@ func (s *CIController) recv(stop <-chan struct{}, errC chan<- error) {
 				fmt.Printf("%s RuntimeObjectToInstance error (%s)\n", common.WARN, err)
 				continue
 			}
+			// the deleted request is cleaned up by the service without response
+			if item.Type == watch.Deleted || ci.GetDeletionTimestamp() != nil {
+				continue
+			}
 
-			if err := s.reconcile(ci); err != nil {
+			if err := s.reconcile(common.WithRequestRef(ctx, ci.Spec.FlowId, ci.Spec.StepName, ci.Spec.UUID), ci); err != nil {
 				fmt.Printf("%s ci controller handle error (%s)\n", common.ERROR, err)
 				continue
 			}
 
-
 			s.lastVersion = ci.GetResourceVersion()
 		}
 	}
 }
 
-func (s *CIController) checkAndReconcileCi(name string) error {
-	obj, err := s.Get(common.YceCloudExtensionsOps, k8s.CI, name)
+// activeCis the not done requests of the same project and branch, the request created before
+// the branch label is named by the branch
+func (s *CIController) activeCis(ctx context.Context, branch string) ([]*v1.CI, error) {
+	list, err := s.List(ctx, common.YceCloudExtensionsOps, k8s.CI, "", 0, 0, fmt.Sprintf("%s=%s", servicesci.BranchLabel, branch))
+	if err != nil {
+		return nil, err
+	}
+	items := list.Items
+	if obj, err := s.Get(ctx, common.YceCloudExtensionsOps, k8s.CI, branch); err == nil && obj.GetLabels()[servicesci.BranchLabel] == "" {
+		items = append(items, *obj)
+	}
+	result := make([]*v1.CI, 0)
+	for _, item := range items {
+		value := item
+		ci := &v1.CI{}
+		if err := tools.UnstructuredObjectToInstanceObj(&value, ci); err != nil {
+			return nil, err
+		}
+		if !ci.Spec.Done {
+			result = append(result, ci)
+		}
+	}
+	return result, nil
+}
+
+// supersede handle the not done requests of the same project and branch by the supersede policy of
+// the project, return the name of the newer request. the cancel policy reuse the branch name, the
+// queue and the parallel policy name the newer request by the commit, the ci service queue it until
+// the older one finished by the queue policy
+func (s *CIController) supersede(ctx context.Context, branch, project, commitID string) (string, error) {
+	active, err := s.activeCis(ctx, branch)
+	if err != nil || len(active) == 0 {
+		return branch, err
+	}
+	policy := s.supersedePolicies.Policy(project)
+	if policy != servicesci.SupersedeCancel {
+		common.Printf(ctx, common.INFO, "ci %s superseded by the %s policy\n", branch, policy)
+		return reCheckName(fmt.Sprintf("%s-%s", branch, servicesci.ShortCommit(commitID))), nil
+	}
+	for _, ci := range active {
+		ci.Spec.AckStates = []string{v1.CancelledState}
+		ci.Spec.Done = true
+		ciUnstructured, err := tools.InstanceToUnstructured(ci)
+		if err != nil {
+			return branch, err
+		}
+		if _, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.CI, ci.GetName(), ciUnstructured, false); err != nil {
+			return branch, err
+		}
+		if ci.Spec.PipelineRun != "" {
+			if err := servicesci.CancelPipelineRun(ctx, s.IDataSource, ci.Spec.PipelineRun); err != nil {
+				return branch, err
+			}
+		}
+		common.Printf(ctx, common.INFO, "ci %s superseded, cancel the pipelineRun %s\n", ci.GetName(), ci.Spec.PipelineRun)
+	}
+	return branch, nil
+}
+
+func (s *CIController) checkAndReconcileCi(ctx context.Context, name string) error {
+	obj, err := s.Get(ctx, common.YceCloudExtensionsOps, k8s.CI, name)
 	if err != nil {
 		return err
 	}
@@ -151,14 +255,14 @@ func (s *CIController) checkAndReconcileCi(name string) error {
 		if err != nil {
 			return err
 		}
-		if _, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.CI, name, ciUnstructured, false); err != nil {
+		if _, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.CI, name, ciUnstructured, false); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *CIController) Run(addr string) error {
+func (s *CIController) Run(ctx context.Context, addr string) error {
 	gin.SetMode("debug")
 	route := gin.New()
 	route.Use(gin.Logger())
@@ -180,6 +284,8 @@ func (s *CIController) Run(addr string) error {
 			requestErr(g, err)
 			return
 		}
+		// cancelled when the client disconnect
+		ctx := common.WithRequest(g.Request.Context(), request.FlowId, request.StepName, request.UUID)
 
 		// {git-project-name}-{Branch}
 		project, err := tools.ExtractProject(request.GitUrl)
@@ -188,10 +294,15 @@ func (s *CIController) Run(addr string) error {
 			name = strings.ToLower(strings.Replace(fmt.Sprintf("%s-%s", request.ServiceName, name), "_", "-", -1))
 		}
 		name = reCheckName(name)
+		branch := name
 
-		err = s.checkAndReconcileCi(name)
+		name, err = s.supersede(ctx, branch, project, request.CommitID)
+		if err != nil {
+			common.Printf(ctx, common.WARN, "supersede last ci error (%s)\n", err)
+		}
+		err = s.checkAndReconcileCi(ctx, name)
 		if err != nil {
-			fmt.Printf("check last ci error%s", err)
+			common.Printf(ctx, common.WARN, "check last ci error (%s)\n", err)
 		}
 
 		// 构造一个CI的结构
@@ -203,6 +314,9 @@ func (s *CIController) Run(addr string) error {
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: common.YceCloudExtensionsOps,
+				Labels:    map[string]string{servicesci.BranchLabel: branch},
+				// the service clean up the tekton objects of the deleted request
+				Finalizers: []string{services.Finalizer},
 			},
 			Spec: v1.CISpec{
 				GitURL:      &request.GitUrl,
@@ -217,9 +331,42 @@ func (s *CIController) Run(addr string) error {
 				UUID:        &request.UUID,
 				ProjectPath: request.ProjectPath,
 				ProjectFile: request.ProjectFile,
+				Builder:     request.Builder,
+				Platforms:   request.Platforms,
+				BuildArgs:   request.BuildArgs,
+				Priority:    request.Priority,
+				Force:       request.Force,
+				WatchPaths:  request.WatchPaths,
+				RequestTime: time.Now().Format(time.RFC3339Nano),
 				Done:        false,
 			},
 		}
+		for _, secret := range request.BuildSecrets {
+			ci.Spec.BuildSecrets = append(ci.Spec.BuildSecrets, v1.BuildSecret{ID: secret.ID, SecretName: secret.SecretName, Key: secret.Key})
+		}
+		for _, image := range request.Images {
+			ci.Spec.Images = append(ci.Spec.Images, v1.CIImage{ProjectPath: image.ProjectPath, ProjectFile: image.ProjectFile, Output: image.Output, WatchPaths: image.WatchPaths})
+		}
+		if pod := request.Pod; pod != nil {
+			ci.Spec.Pod = &v1.BuildPod{
+				Timeout:          pod.Timeout,
+				CPURequests:      pod.CPURequests,
+				CPULimit:         pod.CPULimit,
+				MEMRequests:      pod.MEMRequests,
+				MEMLimit:         pod.MEMLimit,
+				NodeSelector:     pod.NodeSelector,
+				RuntimeClassName: pod.RuntimeClassName,
+			}
+			for _, toleration := range pod.Tolerations {
+				ci.Spec.Pod.Tolerations = append(ci.Spec.Pod.Tolerations, v1.Toleration{
+					Key:               toleration.Key,
+					Operator:          toleration.Operator,
+					Value:             toleration.Value,
+					Effect:            toleration.Effect,
+					TolerationSeconds: toleration.TolerationSeconds,
+				})
+			}
+		}
 		// 转换成unstructured 类型
 		unstructured, err := tools.InstanceToUnstructured(ci)
 		if err != nil {
@@ -227,36 +374,89 @@ func (s *CIController) Run(addr string) error {
 			return
 		}
 		// 写入CRD配置
-		obj, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.CI, name, unstructured, true)
+		obj, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.CI, name, unstructured, true)
 		if err != nil {
 			internalApplyErr(g, err)
-			fmt.Printf("ci controller apply (%s) error (%s)\n", name, err)
+			common.Printf(ctx, common.ERROR, "ci controller apply (%s) error (%s)\n", name, err)
 			return
 		}
 
 		g.JSON(http.StatusOK, obj)
 	})
 
-	go func() {
-		s.proc.Error() <- route.Run(addr)
-	}()
+	// the requests waiting for the build concurrency in the queue order
+	route.GET("/queue", func(g *gin.Context) {
+		queue, err := s.queue(g.Request.Context())
+		if err != nil {
+			internalApplyErr(g, err)
+			return
+		}
+		g.JSON(http.StatusOK, queue)
+	})
 
 	s.proc.Add(s.Start)
 	s.proc.Add(s.recv)
+	s.proc.Add(gc.NewCollector(s.IDataSource, s.ResourceLister, "ci", servicesci.CILabel).Start)
 
-	return <-s.proc.Start()
+	return run(ctx, addr, route, s.proc)
 }
 
-func NewCIController(cfg *configure.InstallConfigure) Interface {
+func (s *CIController) queue(ctx context.Context) ([]*resource.QueueItem, error) {
+	list, err := s.List(ctx, common.YceCloudExtensionsOps, k8s.CI, "", 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	ciList := &v1.CIList{}
+	if err := tools.UnstructuredListObjectToInstanceObjectList(list, ciList); err != nil {
+		return nil, err
+	}
+	queue := make([]*resource.QueueItem, 0)
+	for _, ci := range ciList.Items {
+		if ci.Spec.Done || ci.Spec.Phase != v1.QueuedPhase {
+			continue
+		}
+		queue = append(queue, &resource.QueueItem{
+			Name:     ci.GetName(),
+			FlowId:   stringValue(ci.Spec.FlowId),
+			StepName: stringValue(ci.Spec.StepName),
+			UUID:     stringValue(ci.Spec.UUID),
+			GitUrl:   stringValue(ci.Spec.GitURL),
+			Branch:   stringValue(ci.Spec.Branch),
+			Priority: ci.Spec.Priority,
+			Position: ci.Spec.QueuePosition,
+		})
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].Position < queue[j].Position })
+	return queue, nil
+}
+
+func NewCIController(cfg *configure.InstallConfigure) (Interface, error) {
 	drs := datasource.NewIDataSource(cfg)
+	supersede, err := servicesci.NewSupersedePolicies(services.SupersedePolicy, services.ProjectSupersedePolicies)
+	if err != nil {
+		fmt.Printf("%s ci controller parse supersede policies error (%s)\n", common.ERROR, err)
+	}
+	service, err := servicesci.NewService(cfg, drs)
+	if err != nil {
+		return nil, err
+	}
 	return &CIController{
 		InstallConfigure: cfg,
-		IService:         servicesci.NewService(cfg, drs),
+		IService:         service,
 		IClient:          httpclient.NewIClient(),
 		IDataSource:      drs,
 
+		supersedePolicies: supersede,
+
 		proc: proc.NewProc(),
+	}, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
 	}
+	return *s
 }
 
 func reCheckName(name string) string {
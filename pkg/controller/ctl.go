@@ -1,9 +1,43 @@
 package controller
 
+import (
+	"context"
+	"net/http"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/proc"
+)
+
 var _ Interface = &CIController{}
 var _ Interface = &CDController{}
 
 // Interface ....
 type Interface interface {
-	Run(addr string) error
+	// Run serve until ctx is done or any of the service failed
+	Run(ctx context.Context, addr string) error
+}
+
+// run serve the handler on addr and start the proc funcs, when ctx is done
+// or a proc func report error the http server is shutdown gracefully
+func run(ctx context.Context, addr string, handler http.Handler, p *proc.Proc) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			p.Error() <- err
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-p.Start(ctx):
+	case <-ctx.Done():
+	}
+	p.Stop()
+
+	shutdownCtx, cancel := common.WithOperationTimeout(context.Background())
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	return err
 }
@@ -1,8 +1,12 @@
 package controller
 
 import (
-	"github.com/gin-gonic/gin"
+	"encoding/json"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/resource"
 )
 
 type message struct {
@@ -19,3 +23,72 @@ func internalApplyErr(g *gin.Context, err error) {
 	g.JSON(http.StatusInternalServerError, &message{Data: err.Error(), Msg: "apply the resource error"})
 	g.Abort()
 }
+
+// stepStates the steps of the request in the echoer response
+func stepStates(steps []v1.StepState) []resource.StepState {
+	result := make([]resource.StepState, 0, len(steps))
+	for _, step := range steps {
+		result = append(result, resource.StepState{
+			Task:       step.Task,
+			Name:       step.Name,
+			State:      step.State,
+			StartTime:  step.StartTime,
+			FinishTime: step.FinishTime,
+			ExitCode:   step.ExitCode,
+			Reason:     step.Reason,
+			Message:    step.Message,
+		})
+	}
+	return result
+}
+
+// diagnosis the diagnosis of the failed request in the echoer response
+func diagnosis(value *v1.Diagnosis) *resource.Diagnosis {
+	if value == nil {
+		return nil
+	}
+	return &resource.Diagnosis{
+		Category: value.Category,
+		Summary:  value.Summary,
+		Task:     value.Task,
+		Step:     value.Step,
+		Reason:   value.Reason,
+		ExitCode: value.ExitCode,
+	}
+}
+
+// scanSummary the vulnerabilities of the scanned images in the echoer response
+func scanSummary(value *v1.ScanSummary) *resource.ScanSummary {
+	if value == nil {
+		return nil
+	}
+	return &resource.ScanSummary{
+		Critical:  value.Critical,
+		High:      value.High,
+		Medium:    value.Medium,
+		Low:       value.Low,
+		Unknown:   value.Unknown,
+		Threshold: value.Threshold,
+		Passed:    value.Passed,
+		Retained:  value.Retained,
+	}
+}
+
+// progressResponse the RUNNING response of the steps of the request pushed by the -step-progress
+func progressResponse(flowId, stepName, uuid string, steps []v1.StepState) (map[string]interface{}, error) {
+	respBytes, err := json.Marshal(&resource.Response{
+		FlowId:   flowId,
+		StepName: stepName,
+		AckState: v1.RunningState,
+		UUID:     uuid,
+		Steps:    stepStates(steps),
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(respBytes, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -12,11 +13,13 @@ import (
 	"github.com/laik/yce-cloud-extensions/pkg/proc"
 	"github.com/laik/yce-cloud-extensions/pkg/resource"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/gc"
 	servicessonar "github.com/laik/yce-cloud-extensions/pkg/services/sonar"
 	client "github.com/laik/yce-cloud-extensions/pkg/utils/http"
 	httpclient "github.com/laik/yce-cloud-extensions/pkg/utils/http"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"net/http"
 	"strings"
 )
@@ -31,29 +34,39 @@ type SonarController struct {
 	proc *proc.Proc
 }
 
-func (s *SonarController) response2echoer(data map[string]interface{}) error {
+func (s *SonarController) response2echoer(ctx context.Context, data map[string]interface{}) error {
 	request := s.Post(common.EchoerAddr)
 	for k, v := range data {
 		request.Params(k, v)
 	}
-	if err := request.Do(); err != nil {
+	if err := request.Do(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
 
-func (s *SonarController) reconcile(sonar *v1.Sonar) error {
+func (s *SonarController) reconcile(ctx context.Context, sonar *v1.Sonar) error {
+	if !sonar.Spec.Done && services.StepProgress && len(sonar.Spec.Steps) > 0 {
+		// the progress of the running steps
+		data, err := progressResponse(*sonar.Spec.FlowId, *sonar.Spec.StepName, *sonar.Spec.UUID, sonar.Spec.Steps)
+		if err != nil {
+			return err
+		}
+		return s.response2echoer(ctx, data)
+	}
 	if !sonar.Spec.Done || len(sonar.Spec.AckStates) == 0 {
 		return nil
 	}
 
 	resp := &resource.Response{
-		FlowId:   *sonar.Spec.FlowId,
-		StepName: *sonar.Spec.StepName,
-		AckState: sonar.Spec.AckStates[0],
-		UUID:     *sonar.Spec.UUID,
-		Done:     sonar.Spec.Done,
+		FlowId:    *sonar.Spec.FlowId,
+		StepName:  *sonar.Spec.StepName,
+		AckState:  sonar.Spec.AckStates[0],
+		UUID:      *sonar.Spec.UUID,
+		Done:      sonar.Spec.Done,
+		Steps:     stepStates(sonar.Spec.Steps),
+		Diagnosis: diagnosis(sonar.Spec.Diagnosis),
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -67,11 +80,11 @@ func (s *SonarController) reconcile(sonar *v1.Sonar) error {
 		return err
 	}
 
-	return s.response2echoer(data)
+	return s.response2echoer(ctx, data)
 }
 
-func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
-	list, err := s.List(common.YceCloudExtensionsOps, k8s.SONAR, "", 0, 0, nil)
+func (s *SonarController) recv(ctx context.Context, errC chan<- error) {
+	list, err := s.List(ctx, common.YceCloudExtensionsOps, k8s.SONAR, "", 0, 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -84,7 +97,7 @@ func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
 			fmt.Printf("%s UnstructuredObjectToInstanceObj error (%s)", common.ERROR, err)
 			continue
 		}
-		if err := s.reconcile(unit); err != nil {
+		if err := s.reconcile(common.WithRequestRef(ctx, unit.Spec.FlowId, unit.Spec.StepName, unit.Spec.UUID), unit); err != nil {
 			fmt.Printf("%s handle sonar error (%s)\n", common.ERROR, err)
 			continue
 		}
@@ -96,7 +109,7 @@ func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
 		return
 	}
 
-	eventChan, err := s.Watch(common.YceCloudExtensionsOps, k8s.SONAR, sonarList.GetResourceVersion(), 0, nil)
+	eventChan, err := s.Watch(ctx, common.YceCloudExtensionsOps, k8s.SONAR, sonarList.GetResourceVersion(), 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -106,7 +119,7 @@ func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s sonar controller stop\n", common.INFO)
 			return
 
@@ -123,8 +136,12 @@ func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
 				fmt.Printf("%s RuntimeObjectToInstance error (%s)\n", common.WARN, err)
 				continue
 			}
+			// the deleted request is cleaned up by the service without response
+			if item.Type == watch.Deleted || sonar.GetDeletionTimestamp() != nil {
+				continue
+			}
 
-			if err := s.reconcile(sonar); err != nil {
+			if err := s.reconcile(common.WithRequestRef(ctx, sonar.Spec.FlowId, sonar.Spec.StepName, sonar.Spec.UUID), sonar); err != nil {
 				fmt.Printf("%s sonar controller handle error (%s)\n", common.ERROR, err)
 				continue
 			}
@@ -134,8 +151,8 @@ func (s *SonarController) recv(stop <-chan struct{}, errC chan<- error) {
 	}
 }
 
-func (s *SonarController) checkAndReconcileSonar(name string) error {
-	obj, err := s.Get(common.YceCloudExtensionsOps, k8s.SONAR, name)
+func (s *SonarController) checkAndReconcileSonar(ctx context.Context, name string) error {
+	obj, err := s.Get(ctx, common.YceCloudExtensionsOps, k8s.SONAR, name)
 	if err != nil {
 		return err
 	}
@@ -150,14 +167,14 @@ func (s *SonarController) checkAndReconcileSonar(name string) error {
 		if err != nil {
 			return err
 		}
-		if _, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.SONAR, name, sonarUnstructured, false); err != nil {
+		if _, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.SONAR, name, sonarUnstructured, false); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *SonarController) Run(addr string) error {
+func (s *SonarController) Run(ctx context.Context, addr string) error {
 	route := gin.New()
 	route.Use(gin.Logger())
 
@@ -178,6 +195,8 @@ func (s *SonarController) Run(addr string) error {
 			requestErr(g, err)
 			return
 		}
+		// cancelled when the client disconnect
+		ctx := common.WithRequest(g.Request.Context(), request.FlowId, request.StepName, request.UUID)
 
 		// {git-project-name}-{Branch}
 		project, err := tools.ExtractProject(request.GitUrl)
@@ -188,7 +207,7 @@ func (s *SonarController) Run(addr string) error {
 
 		name = sonarPipelineRunName(name)
 
-		err = s.checkAndReconcileSonar(name)
+		err = s.checkAndReconcileSonar(ctx, name)
 		if err != nil {
 			fmt.Printf("check last sonar error %s", err)
 		}
@@ -202,6 +221,8 @@ func (s *SonarController) Run(addr string) error {
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: common.YceCloudExtensionsOps,
+				// the service clean up the tekton objects of the deleted request
+				Finalizers: []string{services.Finalizer},
 			},
 			Spec: v1.SonarSpec{
 				GitURL:   &request.GitUrl,
@@ -222,24 +243,21 @@ func (s *SonarController) Run(addr string) error {
 			return
 		}
 		// 写入CRD配置
-		obj, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.SONAR, name, unstructured, true)
+		obj, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.SONAR, name, unstructured, true)
 		if err != nil {
 			internalApplyErr(g, err)
-			fmt.Printf("sonar controller apply (%s) error (%s)\n", name, err)
+			common.Printf(ctx, common.ERROR, "sonar controller apply (%s) error (%s)\n", name, err)
 			return
 		}
 
 		g.JSON(http.StatusOK, obj)
 	})
 
-	go func() {
-		s.proc.Error() <- route.Run(addr)
-	}()
-
 	s.proc.Add(s.Start)
 	s.proc.Add(s.recv)
+	s.proc.Add(gc.NewCollector(s.IDataSource, s.ResourceLister, "sonar", "tekton.dev/pipeline="+services.SonarPipelineName).Start)
 
-	return <-s.proc.Start()
+	return run(ctx, addr, route, s.proc)
 }
 
 func NewSonarController(cfg *configure.InstallConfigure) Interface {
@@ -14,6 +14,7 @@ import (
 	"github.com/laik/yce-cloud-extensions/pkg/proc"
 	"github.com/laik/yce-cloud-extensions/pkg/resource"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/gc"
 	servicesunit "github.com/laik/yce-cloud-extensions/pkg/services/unit"
 	client "github.com/laik/yce-cloud-extensions/pkg/utils/http"
 	httpclient "github.com/laik/yce-cloud-extensions/pkg/utils/http"
@@ -22,6 +23,7 @@ import (
 	"io"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"net/http"
 	"strings"
 )
@@ -36,20 +38,20 @@ type UnitController struct {
 	proc *proc.Proc
 }
 
-func (s *UnitController) response2echoer(data map[string]interface{}) error {
+func (s *UnitController) response2echoer(ctx context.Context, data map[string]interface{}) error {
 	request := s.Post(common.EchoerAddr)
 	for k, v := range data {
 		request.Params(k, v)
 	}
-	if err := request.Do(); err != nil {
+	if err := request.Do(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *UnitController) getLog(unit *v1.Unit) (string, error) {
+func (s *UnitController) getLog(ctx context.Context, unit *v1.Unit) (string, error) {
 
-	pipelineRun, err := s.Get(common.YceCloudExtensionsOps, k8s.PipelineRun, unit.Name)
+	pipelineRun, err := s.Get(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, unit.Name)
 	if err != nil {
 		return "", err
 	}
@@ -61,7 +63,7 @@ func (s *UnitController) getLog(unit *v1.Unit) (string, error) {
 	req := s.Clientset.CoreV1().Pods(common.YceCloudExtensionsOps).GetLogs(podName, &corev1.PodLogOptions{
 		Container: "step-step2",
 	})
-	podLogs, err := req.Stream(context.Background())
+	podLogs, err := req.Stream(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -76,19 +78,29 @@ func (s *UnitController) getLog(unit *v1.Unit) (string, error) {
 	return buf.String(), nil
 }
 
-func (s *UnitController) reconcile(unit *v1.Unit) error {
+func (s *UnitController) reconcile(ctx context.Context, unit *v1.Unit) error {
+	if !unit.Spec.Done && services.StepProgress && len(unit.Spec.Steps) > 0 {
+		// the progress of the running steps
+		data, err := progressResponse(*unit.Spec.FlowId, *unit.Spec.StepName, *unit.Spec.UUID, unit.Spec.Steps)
+		if err != nil {
+			return err
+		}
+		return s.response2echoer(ctx, data)
+	}
 	if !unit.Spec.Done || len(unit.Spec.AckStates) == 0 {
 		return nil
 	}
 
-	bufString, err := s.getLog(unit)
+	bufString, err := s.getLog(ctx, unit)
 	resp := &resource.UnitResponse{
-		FlowId:   *unit.Spec.FlowId,
-		StepName: *unit.Spec.StepName,
-		AckState: unit.Spec.AckStates[0],
-		UUID:     *unit.Spec.UUID,
-		Done:     unit.Spec.Done,
-		Data:     bufString,
+		FlowId:    *unit.Spec.FlowId,
+		StepName:  *unit.Spec.StepName,
+		AckState:  unit.Spec.AckStates[0],
+		UUID:      *unit.Spec.UUID,
+		Done:      unit.Spec.Done,
+		Data:      bufString,
+		Steps:     stepStates(unit.Spec.Steps),
+		Diagnosis: diagnosis(unit.Spec.Diagnosis),
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -102,11 +114,11 @@ func (s *UnitController) reconcile(unit *v1.Unit) error {
 		return err
 	}
 
-	return s.response2echoer(data)
+	return s.response2echoer(ctx, data)
 }
 
-func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
-	list, err := s.List(common.YceCloudExtensionsOps, k8s.UNIT, "", 0, 0, nil)
+func (s *UnitController) recv(ctx context.Context, errC chan<- error) {
+	list, err := s.List(ctx, common.YceCloudExtensionsOps, k8s.UNIT, "", 0, 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -119,7 +131,7 @@ func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
 			fmt.Printf("%s UnstructuredObjectToInstanceObj error (%s)", common.ERROR, err)
 			continue
 		}
-		if err := s.reconcile(unit); err != nil {
+		if err := s.reconcile(common.WithRequestRef(ctx, unit.Spec.FlowId, unit.Spec.StepName, unit.Spec.UUID), unit); err != nil {
 			fmt.Printf("%s handle unit error (%s)\n", common.ERROR, err)
 			continue
 		}
@@ -131,7 +143,7 @@ func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
 		return
 	}
 
-	eventChan, err := s.Watch(common.YceCloudExtensionsOps, k8s.UNIT, unitList.GetResourceVersion(), 0, nil)
+	eventChan, err := s.Watch(ctx, common.YceCloudExtensionsOps, k8s.UNIT, unitList.GetResourceVersion(), 0, nil)
 	if err != nil {
 		errC <- err
 		return
@@ -141,7 +153,7 @@ func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s unit controller stop\n", common.INFO)
 			return
 
@@ -158,8 +170,12 @@ func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
 				fmt.Printf("%s RuntimeObjectToInstance error (%s)\n", common.WARN, err)
 				continue
 			}
+			// the deleted request is cleaned up by the service without response
+			if item.Type == watch.Deleted || unit.GetDeletionTimestamp() != nil {
+				continue
+			}
 
-			if err := s.reconcile(unit); err != nil {
+			if err := s.reconcile(common.WithRequestRef(ctx, unit.Spec.FlowId, unit.Spec.StepName, unit.Spec.UUID), unit); err != nil {
 				fmt.Printf("%s unit controller handle error (%s)\n", common.ERROR, err)
 				continue
 			}
@@ -169,8 +185,8 @@ func (s *UnitController) recv(stop <-chan struct{}, errC chan<- error) {
 	}
 }
 
-func (s *UnitController) checkAndReconcileUnit(name string) error {
-	obj, err := s.Get(common.YceCloudExtensionsOps, k8s.UNIT, name)
+func (s *UnitController) checkAndReconcileUnit(ctx context.Context, name string) error {
+	obj, err := s.Get(ctx, common.YceCloudExtensionsOps, k8s.UNIT, name)
 	if err != nil {
 		return err
 	}
@@ -185,14 +201,14 @@ func (s *UnitController) checkAndReconcileUnit(name string) error {
 		if err != nil {
 			return err
 		}
-		if _, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.UNIT, name, unitUnstructured, false); err != nil {
+		if _, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.UNIT, name, unitUnstructured, false); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *UnitController) Run(addr string) error {
+func (s *UnitController) Run(ctx context.Context, addr string) error {
 	route := gin.New()
 	route.Use(gin.Logger())
 
@@ -213,6 +229,8 @@ func (s *UnitController) Run(addr string) error {
 			requestErr(g, err)
 			return
 		}
+		// cancelled when the client disconnect
+		ctx := common.WithRequest(g.Request.Context(), request.FlowId, request.StepName, request.UUID)
 
 		// {git-project-name}-{Branch}
 		project, err := tools.ExtractProject(request.GitUrl)
@@ -223,9 +241,9 @@ func (s *UnitController) Run(addr string) error {
 
 		name = pipelineRunName(name)
 
-		err = s.checkAndReconcileUnit(name)
+		err = s.checkAndReconcileUnit(ctx, name)
 		if err != nil {
-			fmt.Printf("check last unit error%s", err)
+			common.Printf(ctx, common.WARN, "check last unit error (%s)\n", err)
 		}
 
 		// 构造一个UNIT的结构
@@ -237,6 +255,8 @@ func (s *UnitController) Run(addr string) error {
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      name,
 				Namespace: common.YceCloudExtensionsOps,
+				// the service clean up the tekton objects of the deleted request
+				Finalizers: []string{services.Finalizer},
 			},
 			Spec: v1.UnitSpec{
 				GitURL:   &request.GitUrl,
@@ -260,24 +280,21 @@ func (s *UnitController) Run(addr string) error {
 			return
 		}
 		// 写入CRD配置
-		obj, _, err := s.Apply(common.YceCloudExtensionsOps, k8s.UNIT, name, unstructured, true)
+		obj, _, err := s.Apply(ctx, common.YceCloudExtensionsOps, k8s.UNIT, name, unstructured, true)
 		if err != nil {
 			internalApplyErr(g, err)
-			fmt.Printf("unit controller apply (%s) error (%s)\n", name, err)
+			common.Printf(ctx, common.ERROR, "unit controller apply (%s) error (%s)\n", name, err)
 			return
 		}
 
 		g.JSON(http.StatusOK, obj)
 	})
 
-	go func() {
-		s.proc.Error() <- route.Run(addr)
-	}()
-
 	s.proc.Add(s.Start)
 	s.proc.Add(s.recv)
+	s.proc.Add(gc.NewCollector(s.IDataSource, s.ResourceLister, "unit", "tekton.dev/pipeline="+services.UnitPipelineName).Start)
 
-	return <-s.proc.Start()
+	return run(ctx, addr, route, s.proc)
 }
 
 func NewUnitController(cfg *configure.InstallConfigure) Interface {
@@ -0,0 +1,122 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+)
+
+// the credentials used by the services
+const (
+	Git      = "git"
+	Registry = "registry"
+)
+
+// Credential the account of a git server or an image registry
+type Credential struct {
+	Username string
+	Password string
+}
+
+func (c *Credential) equal(o *Credential) bool {
+	if c == nil || o == nil {
+		return c == o
+	}
+	return *c == *o
+}
+
+// Provider load the credential by name, the value is read on each Get so the rotated one take effect.
+// the backend store the username and the password as <name>-username and <name>-password,
+// e.g. git-username, registry-password
+type Provider interface {
+	// Get the credential of the name, nil if the provider has no such credential
+	Get(ctx context.Context, name string) (*Credential, error)
+}
+
+func usernameKey(name string) string { return fmt.Sprintf("%s-username", name) }
+
+func passwordKey(name string) string { return fmt.Sprintf("%s-password", name) }
+
+func newCredential(username, password string) *Credential {
+	username, password = strings.TrimRight(username, "\r\n"), strings.TrimRight(password, "\r\n")
+	if username == "" && password == "" {
+		return nil
+	}
+	return &Credential{Username: username, Password: password}
+}
+
+var _ Provider = Static{}
+
+// Static the credentials of the command line flags
+type Static map[string]*Credential
+
+func (s Static) Get(_ context.Context, name string) (*Credential, error) {
+	credential, exist := s[name]
+	if !exist || credential == nil || (credential.Username == "" && credential.Password == "") {
+		return nil, nil
+	}
+	return credential, nil
+}
+
+var _ Provider = Chain{}
+
+// Chain the credential of the first provider has it
+type Chain []Provider
+
+func (c Chain) Get(ctx context.Context, name string) (*Credential, error) {
+	for _, provider := range c {
+		credential, err := provider.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if credential != nil {
+			return credential, nil
+		}
+	}
+	return nil, nil
+}
+
+// Watch call the fn when the credential of the names changed, the first load is a change too.
+// the credentials are checked every interval until ctx is done, the error keep the last credential
+func Watch(ctx context.Context, provider Provider, names []string, interval time.Duration, fn func(name string, credential *Credential)) {
+	last := make(map[string]*Credential, len(names))
+	loaded := make(map[string]bool, len(names))
+	check := func() {
+		for _, name := range names {
+			credential, err := provider.Get(ctx, name)
+			if err != nil {
+				fmt.Printf("%s credentials load %s error (%s)\n", common.WARN, name, err)
+				continue
+			}
+			if loaded[name] && credential.equal(last[name]) {
+				continue
+			}
+			last[name], loaded[name] = credential, true
+			fn(name, credential)
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// Account the username and the password of the credential, empty if the provider has no such credential
+func Account(ctx context.Context, provider Provider, name string) (string, string, error) {
+	credential, err := provider.Get(ctx, name)
+	if err != nil || credential == nil {
+		return "", "", err
+	}
+	return credential.Username, credential.Password, nil
+}
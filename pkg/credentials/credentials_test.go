@@ -0,0 +1,219 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "git-username"), []byte("ci\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "git-password"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &File{Dir: dir}
+	credential, err := provider.Get(context.Background(), Git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == nil || credential.Username != "ci" || credential.Password != "secret" {
+		t.Fatalf("expected git credential ci, got %v", credential)
+	}
+
+	credential, err = provider.Get(context.Background(), Registry)
+	if err != nil || credential != nil {
+		t.Fatalf("expected no registry credential, got %v (%v)", credential, err)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("YCE_REGISTRY_USERNAME", "robot")
+	t.Setenv("YCE_REGISTRY_PASSWORD", "token")
+
+	provider := &Env{Prefix: "YCE_"}
+	credential, err := provider.Get(context.Background(), Registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == nil || credential.Username != "robot" || credential.Password != "token" {
+		t.Fatalf("expected registry credential robot, got %v", credential)
+	}
+	if credential, _ := provider.Get(context.Background(), Git); credential != nil {
+		t.Fatalf("expected no git credential, got %v", credential)
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	provider := &Secret{
+		Name: "credentials",
+		Getter: func(_ context.Context, name string) (*unstructured.Unstructured, error) {
+			if name != "credentials" {
+				return nil, errors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+			}
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{
+					"git-username": encode("ci"),
+					"git-password": encode("secret"),
+				},
+			}}, nil
+		},
+	}
+	credential, err := provider.Get(context.Background(), Git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == nil || credential.Username != "ci" || credential.Password != "secret" {
+		t.Fatalf("expected git credential ci, got %v", credential)
+	}
+
+	provider.Name = "not-exist"
+	credential, err = provider.Get(context.Background(), Git)
+	if err != nil || credential != nil {
+		t.Fatalf("expected no credential of not found secret, got %v (%v)", credential, err)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/yce":
+			fmt.Fprint(w, `{"data":{"data":{"git-username":"ci","git-password":"secret"},"metadata":{"version":2}}}`)
+		case "/v1/kv/yce":
+			fmt.Fprint(w, `{"data":{"registry-username":"robot","registry-password":"token"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("root\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	credential, err := (&Vault{Addr: server.URL, Path: "secret/data/yce", TokenFile: tokenFile}).Get(ctx, Git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == nil || credential.Username != "ci" || credential.Password != "secret" {
+		t.Fatalf("expected kv v2 git credential ci, got %v", credential)
+	}
+
+	t.Setenv("VAULT_TOKEN", "root")
+	credential, err = (&Vault{Addr: server.URL + "/", Path: "/kv/yce"}).Get(ctx, Registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == nil || credential.Username != "robot" || credential.Password != "token" {
+		t.Fatalf("expected kv v1 registry credential robot, got %v", credential)
+	}
+
+	credential, err = (&Vault{Addr: server.URL, Path: "secret/data/none"}).Get(ctx, Git)
+	if err != nil || credential != nil {
+		t.Fatalf("expected no credential of not found path, got %v (%v)", credential, err)
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := (&Vault{Addr: server.URL, Path: "secret/data/yce"}).Get(ctx, Git); err == nil {
+		t.Fatal("expected error of forbidden token")
+	}
+}
+
+func TestChainProvider(t *testing.T) {
+	chain := Chain{
+		Static{Git: {Username: "file", Password: "file-secret"}},
+		Static{Git: {Username: "flag", Password: "flag-secret"}, Registry: {Username: "flag", Password: "flag-token"}},
+	}
+	git, _ := chain.Get(context.Background(), Git)
+	registry, _ := chain.Get(context.Background(), Registry)
+	if git == nil || git.Username != "file" {
+		t.Fatalf("expected git credential of the first provider, got %v", git)
+	}
+	if registry == nil || registry.Username != "flag" {
+		t.Fatalf("expected registry credential of the fallback provider, got %v", registry)
+	}
+	if credential, _ := chain.Get(context.Background(), "none"); credential != nil {
+		t.Fatalf("expected no credential, got %v", credential)
+	}
+}
+
+type rotatingProvider struct {
+	sync.Mutex
+	credential *Credential
+}
+
+func (r *rotatingProvider) Get(_ context.Context, _ string) (*Credential, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.credential, nil
+}
+
+func (r *rotatingProvider) rotate(credential *Credential) {
+	r.Lock()
+	defer r.Unlock()
+	r.credential = credential
+}
+
+func TestWatch(t *testing.T) {
+	provider := &rotatingProvider{credential: &Credential{Username: "ci", Password: "v1"}}
+	changed := make(chan string, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, provider, []string{Git}, 10*time.Millisecond, func(name string, credential *Credential) {
+		changed <- credential.Password
+	})
+
+	expect := func(password string) {
+		select {
+		case got := <-changed:
+			if got != password {
+				t.Fatalf("expected credential %s, got %s", password, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected credential %s not reloaded", password)
+		}
+	}
+	expect("v1")
+
+	select {
+	case got := <-changed:
+		t.Fatalf("unexpected reload of the unchanged credential %s", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	provider.rotate(&Credential{Username: "ci", Password: "v2"})
+	expect("v2")
+}
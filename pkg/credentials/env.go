@@ -0,0 +1,23 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+var _ Provider = &Env{}
+
+// Env read the credentials from the environment variables, e.g. YCE_GIT_USERNAME and YCE_GIT_PASSWORD
+// with the prefix YCE_, the variables can be set from a Secret by the secretKeyRef of the pod
+type Env struct {
+	Prefix string
+}
+
+func (e *Env) Get(_ context.Context, name string) (*Credential, error) {
+	return newCredential(os.Getenv(e.variable(usernameKey(name))), os.Getenv(e.variable(passwordKey(name)))), nil
+}
+
+func (e *Env) variable(key string) string {
+	return strings.ToUpper(e.Prefix + strings.Replace(key, "-", "_", -1))
+}
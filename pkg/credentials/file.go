@@ -0,0 +1,41 @@
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ Provider = &File{}
+
+// File read the credentials from the files of a directory, e.g. the mounted Secret volume
+//
+//	/etc/yce-cloud-extensions/credentials/git-username
+//	/etc/yce-cloud-extensions/credentials/git-password
+type File struct {
+	Dir string
+}
+
+func (f *File) Get(_ context.Context, name string) (*Credential, error) {
+	username, err := f.read(usernameKey(name))
+	if err != nil {
+		return nil, err
+	}
+	password, err := f.read(passwordKey(name))
+	if err != nil {
+		return nil, err
+	}
+	return newCredential(username, password), nil
+}
+
+func (f *File) read(key string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(f.Dir, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
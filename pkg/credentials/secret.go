@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ Provider = &Secret{}
+
+// SecretGetter get the secret by name, e.g. the Get of the datasource bound to the namespace
+type SecretGetter func(ctx context.Context, name string) (*unstructured.Unstructured, error)
+
+// Secret read the credentials from the data of a Kubernetes Secret, e.g.
+//
+//	data:
+//	  git-username: ...
+//	  git-password: ...
+type Secret struct {
+	Name   string
+	Getter SecretGetter
+}
+
+func (s *Secret) Get(ctx context.Context, name string) (*Credential, error) {
+	obj, err := s.Getter(ctx, s.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get credentials secret %s error (%s)", s.Name, err)
+	}
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return nil, fmt.Errorf("credentials secret %s illegal data", s.Name)
+	}
+	username, err := base64.StdEncoding.DecodeString(data[usernameKey(name)])
+	if err != nil {
+		return nil, fmt.Errorf("credentials secret %s illegal %s", s.Name, usernameKey(name))
+	}
+	password, err := base64.StdEncoding.DecodeString(data[passwordKey(name)])
+	if err != nil {
+		return nil, fmt.Errorf("credentials secret %s illegal %s", s.Name, passwordKey(name))
+	}
+	return newCredential(string(username), string(password)), nil
+}
@@ -0,0 +1,76 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
+)
+
+// vaultTimeout used when the ctx passed to Get has no deadline
+const vaultTimeout = 10 * time.Second
+
+var _ Provider = &Vault{}
+
+// Vault read the credentials from the secret of a HashiCorp Vault compatible HTTP API, e.g.
+// GET http://127.0.0.1:8200/v1/secret/data/yce-cloud-extensions with the X-Vault-Token header,
+// both the kv v2 {"data":{"data":{...}}} and the kv v1 {"data":{...}} response are supported
+type Vault struct {
+	Addr string
+	Path string
+	// TokenFile the file of the token re-read on each Get, the VAULT_TOKEN environment variable if not set
+	TokenFile string
+}
+
+func (v *Vault) token() (string, error) {
+	if v.TokenFile == "" {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+	data, err := ioutil.ReadFile(v.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read vault token error (%s)", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (v *Vault) Get(ctx context.Context, name string) (*Credential, error) {
+	token, err := v.token()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vaultTimeout)
+		defer cancel()
+	}
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(v.Addr, "/"), strings.TrimLeft(v.Path, "/"))
+	response, err := resty.New().
+		NewRequest().
+		SetContext(ctx).
+		SetHeader("X-Vault-Token", token).
+		SetHeader("Accept", "application/json").
+		Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("get vault secret %s error (%s)", v.Path, err)
+	}
+	switch response.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		// the body may echo the secret, only the status is reported
+		return nil, fmt.Errorf("get vault secret %s response code (%d)", v.Path, response.StatusCode())
+	}
+
+	data := gjson.GetBytes(response.Body(), "data.data")
+	if !data.IsObject() {
+		data = gjson.GetBytes(response.Body(), "data")
+	}
+	return newCredential(data.Get(usernameKey(name)).String(), data.Get(passwordKey(name)).String()), nil
+}
@@ -3,6 +3,7 @@ package datasource
 import (
 	"context"
 	"fmt"
+	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,11 +18,14 @@ import (
 var _ IDataSource = &IDataSourceImpl{}
 
 type IDataSource interface {
-	List(namespace, resource, flag string, pos, size int64, selector interface{}) (*unstructured.UnstructuredList, error)
-	Get(namespace, resource, name string, subresources ...string) (*unstructured.Unstructured, error)
-	Apply(namespace, resource, name string, obj *unstructured.Unstructured, forceUpdate bool) (*unstructured.Unstructured, bool, error)
-	Delete(namespace, resource, name string) error
-	Watch(namespace string, resource, resourceVersion string, timeoutSeconds int64, selector interface{}) (<-chan watch.Event, error)
+	List(ctx context.Context, namespace, resource, flag string, pos, size int64, selector interface{}) (*unstructured.UnstructuredList, error)
+	Get(ctx context.Context, namespace, resource, name string, subresources ...string) (*unstructured.Unstructured, error)
+	Apply(ctx context.Context, namespace, resource, name string, obj *unstructured.Unstructured, forceUpdate bool) (*unstructured.Unstructured, bool, error)
+	// Update the object of its resourceVersion, the conflict error is returned when the object was changed since read
+	Update(ctx context.Context, namespace, resource string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Delete(ctx context.Context, namespace, resource, name string) error
+	// Watch the returned channel is closed when ctx is done
+	Watch(ctx context.Context, namespace string, resource, resourceVersion string, timeoutSeconds int64, selector interface{}) (<-chan watch.Event, error)
 }
 
 func NewIDataSource(cfg *configure.InstallConfigure) IDataSource {
@@ -32,7 +36,7 @@ type IDataSourceImpl struct {
 	*configure.InstallConfigure
 }
 
-func (i *IDataSourceImpl) List(namespace, resource, flag string, pos, size int64, selector interface{}) (*unstructured.UnstructuredList, error) {
+func (i *IDataSourceImpl) List(ctx context.Context, namespace, resource, flag string, pos, size int64, selector interface{}) (*unstructured.UnstructuredList, error) {
 	var err error
 	var items *unstructured.UnstructuredList
 	opts := metav1.ListOptions{}
@@ -59,11 +63,13 @@ func (i *IDataSourceImpl) List(namespace, resource, flag string, pos, size int64
 	if err != nil {
 		return nil, err
 	}
+	ctx, cancel := common.WithOperationTimeout(ctx)
+	defer cancel()
 	items, err = i.CacheInformerFactory.
 		Interface.
 		Resource(gvr).
 		Namespace(namespace).
-		List(context.Background(), opts)
+		List(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -71,29 +77,33 @@ func (i *IDataSourceImpl) List(namespace, resource, flag string, pos, size int64
 	return items, nil
 }
 
-func (i *IDataSourceImpl) Get(namespace, resource, name string, subresources ...string) (*unstructured.Unstructured, error) {
+func (i *IDataSourceImpl) Get(ctx context.Context, namespace, resource, name string, subresources ...string) (*unstructured.Unstructured, error) {
 	gvr, err := i.GetGvr(resource)
 	if err != nil {
 		return nil, err
 	}
+	ctx, cancel := common.WithOperationTimeout(ctx)
+	defer cancel()
 	object, err := i.CacheInformerFactory.
 		Interface.
 		Resource(gvr).
 		Namespace(namespace).
-		Get(context.Background(), name, metav1.GetOptions{}, subresources...)
+		Get(ctx, name, metav1.GetOptions{}, subresources...)
 	if err != nil {
 		return nil, err
 	}
 	return object, nil
 }
 
-func (i *IDataSourceImpl) Apply(namespace, resource, name string, obj *unstructured.Unstructured, forceUpdate bool) (result *unstructured.Unstructured, isUpdate bool, err error) {
+func (i *IDataSourceImpl) Apply(ctx context.Context, namespace, resource, name string, obj *unstructured.Unstructured, forceUpdate bool) (result *unstructured.Unstructured, isUpdate bool, err error) {
+	// the whole get/create/update retry loop share one deadline
+	ctx, cancel := common.WithOperationTimeout(ctx)
+	defer cancel()
 	retryErr := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		gvr, err := i.GetGvr(resource)
 		if err != nil {
 			return err
 		}
-		ctx := context.Background()
 		getObj, getErr := i.CacheInformerFactory.
 			Interface.
 			Resource(gvr).
@@ -132,21 +142,37 @@ func (i *IDataSourceImpl) Apply(namespace, resource, name string, obj *unstructu
 	return
 }
 
-func (i *IDataSourceImpl) Delete(namespace, resource, name string) error {
+func (i *IDataSourceImpl) Update(ctx context.Context, namespace, resource string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvr, err := i.GetGvr(resource)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := common.WithOperationTimeout(ctx)
+	defer cancel()
+	return i.CacheInformerFactory.
+		Interface.
+		Resource(gvr).
+		Namespace(namespace).
+		Update(ctx, obj, metav1.UpdateOptions{})
+}
+
+func (i *IDataSourceImpl) Delete(ctx context.Context, namespace, resource, name string) error {
 	gvr, err := i.GetGvr(resource)
 	if err != nil {
 		return err
 	}
+	ctx, cancel := common.WithOperationTimeout(ctx)
+	defer cancel()
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		return i.CacheInformerFactory.
 			Interface.
 			Resource(gvr).
 			Namespace(namespace).
-			Delete(context.Background(), name, metav1.DeleteOptions{})
+			Delete(ctx, name, metav1.DeleteOptions{})
 	})
 }
 
-func (i *IDataSourceImpl) Watch(namespace string, resource, resourceVersion string, timeoutSeconds int64, selector interface{}) (<-chan watch.Event, error) {
+func (i *IDataSourceImpl) Watch(ctx context.Context, namespace string, resource, resourceVersion string, timeoutSeconds int64, selector interface{}) (<-chan watch.Event, error) {
 	opts := metav1.ListOptions{}
 	var err error
 
@@ -177,11 +203,17 @@ func (i *IDataSourceImpl) Watch(namespace string, resource, resourceVersion stri
 		Interface.
 		Resource(gvr).
 		Namespace(namespace).
-		Watch(context.Background(), opts)
+		Watch(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	// the watch is long running, so it is bound to ctx instead of OperationTimeout
+	go func() {
+		<-ctx.Done()
+		recv.Stop()
+	}()
+
 	return recv.ResultChan(), nil
 }
 
@@ -271,5 +303,9 @@ func compareMetadataLabelsOrAnnotation(old, new map[string]interface{}) map[stri
 	if exist {
 		old["ownerReferences"] = newOwnerReferences
 	}
+	newFinalizers, exist := new["finalizers"]
+	if exist {
+		old["finalizers"] = newFinalizers
+	}
 	return old
 }
@@ -0,0 +1,139 @@
+// Package fake the in-memory datasource of the unit tests
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var _ datasource.IDataSource = &DataSource{}
+
+// DataSource the objects keyed by the resource and the name, the namespace is ignored.
+// The applied, the updated and the deleted objects are recorded in order
+type DataSource struct {
+	objects map[string]map[string]*unstructured.Unstructured
+	// Applied the objects of the Apply and the Update
+	Applied []*unstructured.Unstructured
+	// Deleted the resource/name of the deleted objects
+	Deleted []string
+	// Conflicts the next updates failed by the concurrent writers
+	Conflicts int
+}
+
+// NewDataSource the empty datasource
+func NewDataSource() *DataSource {
+	return &DataSource{objects: make(map[string]map[string]*unstructured.Unstructured)}
+}
+
+// Add store the objects of the resource, replace the one of the same name, panic if the object can't be stored
+func (f *DataSource) Add(resource string, objects ...*unstructured.Unstructured) *DataSource {
+	for _, obj := range objects {
+		if err := f.set(resource, obj); err != nil {
+			panic(err)
+		}
+	}
+	return f
+}
+
+// Object the stored object of the resource, nil if not exist
+func (f *DataSource) Object(resource, name string) *unstructured.Unstructured {
+	return f.objects[resource][name]
+}
+
+func (f *DataSource) List(_ context.Context, _, resource, _ string, _, _ int64, selector interface{}) (*unstructured.UnstructuredList, error) {
+	matcher := labels.Everything()
+	switch value := selector.(type) {
+	case labels.Selector:
+		matcher = value
+	case string:
+		parsed, err := labels.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		matcher = parsed
+	}
+	names := make([]string, 0, len(f.objects[resource]))
+	for name := range f.objects[resource] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := &unstructured.UnstructuredList{}
+	for _, name := range names {
+		if obj := f.objects[resource][name]; matcher.Matches(labels.Set(obj.GetLabels())) {
+			list.Items = append(list.Items, *obj.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+func (f *DataSource) Get(_ context.Context, _, resource, name string, _ ...string) (*unstructured.Unstructured, error) {
+	obj, exist := f.objects[resource][name]
+	if !exist {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (f *DataSource) Apply(_ context.Context, _, resource, name string, obj *unstructured.Unstructured, _ bool) (*unstructured.Unstructured, bool, error) {
+	_, exist := f.objects[resource][name]
+	if err := f.set(resource, obj); err != nil {
+		return nil, false, err
+	}
+	f.Applied = append(f.Applied, obj)
+	return obj, exist, nil
+}
+
+func (f *DataSource) Update(_ context.Context, _, resource string, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if _, exist := f.objects[resource][obj.GetName()]; !exist {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: resource}, obj.GetName())
+	}
+	if f.Conflicts > 0 {
+		f.Conflicts--
+		return nil, errors.NewConflict(schema.GroupResource{Resource: resource}, obj.GetName(), fmt.Errorf("the object has been modified"))
+	}
+	if err := f.set(resource, obj); err != nil {
+		return nil, err
+	}
+	f.Applied = append(f.Applied, obj)
+	return obj, nil
+}
+
+func (f *DataSource) Delete(_ context.Context, _, resource, name string) error {
+	if _, exist := f.objects[resource][name]; !exist {
+		return errors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+	}
+	delete(f.objects[resource], name)
+	f.Deleted = append(f.Deleted, resource+"/"+name)
+	return nil
+}
+
+func (f *DataSource) Watch(_ context.Context, _ string, resource, _ string, _ int64, _ interface{}) (<-chan watch.Event, error) {
+	return nil, fmt.Errorf("watch %s not supported", resource)
+}
+
+// set store the json copy of the object like the api server, the object converted from the typed
+// instance may contain the values unstructured can't deep copy
+func (f *DataSource) set(resource string, obj *unstructured.Unstructured) error {
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	stored := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, &stored.Object); err != nil {
+		return err
+	}
+	if f.objects[resource] == nil {
+		f.objects[resource] = make(map[string]*unstructured.Unstructured)
+	}
+	f.objects[resource][obj.GetName()] = stored
+	return nil
+}
@@ -2,20 +2,30 @@ package k8s
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 )
 
 type ResourceLister interface {
 	Ranges(d dynamicinformer.DynamicSharedInformerFactory, stop <-chan struct{})
 	GetGvr(string) (schema.GroupVersionResource, error)
+	// Register add an extra resource, it is verified by Discover
+	Register(name string, gvr schema.GroupVersionResource)
+	// Discover pick the best version the cluster served for each resource,
+	// return error when a required resource is not served
+	Discover(d discovery.DiscoveryInterface) error
 }
 
 const (
 	// CI && CD YameCloudExtensions resources
-	CI   = "cis"
-	CD   = "cds"
-	UNIT = "units"
+	CI    = "cis"
+	CD    = "cds"
+	UNIT  = "units"
 	SONAR = "sonars"
 
 	// Tekton resources
@@ -37,18 +47,30 @@ const (
 	ServiceAccount = "serviceaccounts"
 	Namespace      = "namespaces"
 	Pod            = "pods"
+	// PersistentVolumeClaim the volumes of the dependency caches
+	PersistentVolumeClaim = "persistentvolumeclaims"
 )
 
+// candidate the logical resource, versions is ordered by preference
+type candidate struct {
+	group    string
+	resource string
+	versions []string
+	required bool
+}
+
 type Resources struct {
-	excluded []string
+	excluded   []string
+	candidates map[string]*candidate
 
 	Data map[string]schema.GroupVersionResource
 }
 
 func NewResources(excluded []string) *Resources {
 	rs := &Resources{
-		excluded: excluded,
-		Data:     make(map[string]schema.GroupVersionResource),
+		excluded:   excluded,
+		candidates: make(map[string]*candidate),
+		Data:       make(map[string]schema.GroupVersionResource),
 	}
 
 	rsInit(rs)
@@ -56,11 +78,98 @@ func NewResources(excluded []string) *Resources {
 	return rs
 }
 
-func (m *Resources) register(s string, resource schema.GroupVersionResource) {
-	if _, exist := m.Data[s]; exist {
+// register the most preferred version is used until Discover is called
+func (m *Resources) register(s, group, resource string, required bool, versions ...string) {
+	if _, exist := m.candidates[s]; exist {
 		return
 	}
-	m.Data[s] = resource
+	m.candidates[s] = &candidate{group: group, resource: resource, versions: versions, required: required}
+	m.Data[s] = schema.GroupVersionResource{Group: group, Version: versions[0], Resource: resource}
+}
+
+func (m *Resources) Register(s string, gvr schema.GroupVersionResource) {
+	required := false
+	if item, exist := m.candidates[s]; exist {
+		required = item.required
+	}
+	m.candidates[s] = &candidate{group: gvr.Group, resource: gvr.Resource, versions: []string{gvr.Version}, required: required}
+	m.Data[s] = gvr
+}
+
+func (m *Resources) isExcluded(s string) bool {
+	for _, v := range m.excluded {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Resources) Discover(d discovery.DiscoveryInterface) error {
+	groups, err := d.ServerGroups()
+	if err != nil {
+		return fmt.Errorf("discovery server groups error (%s)", err)
+	}
+	served := make(map[string]bool)
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			served[version.GroupVersion] = true
+		}
+	}
+
+	resources := make(map[string]map[string]bool)
+	serveResource := func(groupVersion, resource string) (bool, error) {
+		if !served[groupVersion] {
+			return false, nil
+		}
+		if _, exist := resources[groupVersion]; !exist {
+			list, err := d.ServerResourcesForGroupVersion(groupVersion)
+			if err != nil {
+				return false, fmt.Errorf("discovery (%s) resources error (%s)", groupVersion, err)
+			}
+			resources[groupVersion] = make(map[string]bool)
+			for _, item := range list.APIResources {
+				resources[groupVersion][item.Name] = true
+			}
+		}
+		return resources[groupVersion][resource], nil
+	}
+
+	missing := make([]string, 0)
+	for name, item := range m.candidates {
+		if m.isExcluded(name) {
+			continue
+		}
+		found := false
+		for _, version := range item.versions {
+			groupVersion := schema.GroupVersion{Group: item.group, Version: version}.String()
+			ok, err := serveResource(groupVersion, item.resource)
+			if err != nil {
+				return err
+			}
+			if ok {
+				m.Data[name] = schema.GroupVersionResource{Group: item.group, Version: version, Resource: item.resource}
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		wanted := fmt.Sprintf("%s (%s/%s)", item.resource, item.group, strings.Join(item.versions, "|"))
+		if item.required {
+			missing = append(missing, wanted)
+			continue
+		}
+		fmt.Printf("%s resource %s not served by the cluster, skip it\n", common.WARN, wanted)
+		delete(m.Data, name)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("required api not served by the cluster: %s", strings.Join(missing, ", "))
+	}
+	return nil
 }
 
 func (m *Resources) Ranges(d dynamicinformer.DynamicSharedInformerFactory, stop <-chan struct{}) {
@@ -82,30 +191,63 @@ func (m *Resources) GetGvr(s string) (schema.GroupVersionResource, error) {
 	return item, nil
 }
 
+// ParseResources parse the extra resources configure
+// e.g. "tektonconfigs=operator.tekton.dev/v1alpha1/tektonconfigs,events=v1/events"
+func ParseResources(s string) (map[string]schema.GroupVersionResource, error) {
+	result := make(map[string]schema.GroupVersionResource)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal resource (%s) expect name=group/version/resource", item)
+		}
+		parts := strings.Split(kv[1], "/")
+		var gvr schema.GroupVersionResource
+		switch len(parts) {
+		case 2:
+			gvr = schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}
+		case 3:
+			gvr = schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}
+		default:
+			return nil, fmt.Errorf("illegal resource (%s) expect name=group/version/resource", item)
+		}
+		if gvr.Version == "" || gvr.Resource == "" {
+			return nil, fmt.Errorf("illegal resource (%s) expect name=group/version/resource", item)
+		}
+		result[kv[0]] = gvr
+	}
+	return result, nil
+}
+
 func rsInit(rs *Resources) {
-	rs.register(CI, schema.GroupVersionResource{Group: "yamecloud.io", Version: "v1", Resource: CI})
-	rs.register(CD, schema.GroupVersionResource{Group: "yamecloud.io", Version: "v1", Resource: CD})
-	rs.register(UNIT, schema.GroupVersionResource{Group: "yamecloud.io", Version: "v1", Resource: UNIT})
-	rs.register(SONAR, schema.GroupVersionResource{Group: "yamecloud.io", Version: "v1", Resource: SONAR})
+	rs.register(CI, "yamecloud.io", CI, true, "v1")
+	rs.register(CD, "yamecloud.io", CD, true, "v1")
+	rs.register(UNIT, "yamecloud.io", UNIT, true, "v1")
+	rs.register(SONAR, "yamecloud.io", SONAR, true, "v1")
 
-	rs.register(Stone, schema.GroupVersionResource{Group: "nuwa.nip.io", Version: "v1", Resource: Stone})
+	rs.register(Stone, "nuwa.nip.io", Stone, true, "v1")
 
-	// tekton.dev resource view
-	rs.register(Pipeline, schema.GroupVersionResource{Group: "tekton.dev", Version: "v1alpha1", Resource: Pipeline})
-	rs.register(PipelineRun, schema.GroupVersionResource{Group: "tekton.dev", Version: "v1alpha1", Resource: PipelineRun})
-	rs.register(Task, schema.GroupVersionResource{Group: "tekton.dev", Version: "v1alpha1", Resource: Task})
-	rs.register(TaskRun, schema.GroupVersionResource{Group: "tekton.dev", Version: "v1alpha1", Resource: TaskRun})
-	rs.register(PipelineResource, schema.GroupVersionResource{Group: "tekton.dev", Version: "v1alpha1", Resource: PipelineResource})
+	// tekton.dev resource view, the newest version served is preferred
+	rs.register(Pipeline, "tekton.dev", Pipeline, true, "v1", "v1beta1", "v1alpha1")
+	rs.register(PipelineRun, "tekton.dev", PipelineRun, true, "v1", "v1beta1", "v1alpha1")
+	rs.register(Task, "tekton.dev", Task, true, "v1", "v1beta1", "v1alpha1")
+	rs.register(TaskRun, "tekton.dev", TaskRun, true, "v1", "v1beta1", "v1alpha1")
+	// PipelineResource was removed since tekton v1beta1
+	rs.register(PipelineResource, "tekton.dev", PipelineResource, false, "v1alpha1")
 
 	// tekton graph
-	rs.register(TektonGraph, schema.GroupVersionResource{Group: "fuxi.nip.io", Version: "v1", Resource: TektonGraph})
-	rs.register(TektonConfig, schema.GroupVersionResource{Group: "", Version: "v1", Resource: TektonConfig})
+	rs.register(TektonGraph, "fuxi.nip.io", TektonGraph, true, "v1")
+	rs.register(TektonConfig, "", TektonConfig, true, "v1")
 
 	// kubernetes
-	rs.register(ServiceAccount, schema.GroupVersionResource{Group: "", Version: "v1", Resource: ServiceAccount})
-	rs.register(Namespace, schema.GroupVersionResource{Group: "", Version: "v1", Resource: Namespace})
-	rs.register(Pod, schema.GroupVersionResource{Group: "", Version: "v1", Resource: Pod})
+	rs.register(ServiceAccount, "", ServiceAccount, true, "v1")
+	rs.register(Namespace, "", Namespace, true, "v1")
+	rs.register(Pod, "", Pod, true, "v1")
+	rs.register(PersistentVolumeClaim, "", PersistentVolumeClaim, true, "v1")
 
-	rs.register(ConfigMap, schema.GroupVersionResource{Group: "", Version: "v1", Resource: ConfigMap})
+	rs.register(ConfigMap, "", ConfigMap, true, "v1")
 
 }
@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func apiResources(groupVersion string, names ...string) *metav1.APIResourceList {
+	list := &metav1.APIResourceList{GroupVersion: groupVersion}
+	for _, name := range names {
+		list.APIResources = append(list.APIResources, metav1.APIResource{Name: name})
+	}
+	return list
+}
+
+func fakeDiscovery(lists ...*metav1.APIResourceList) *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: lists}}
+}
+
+func TestDiscoverTektonVersion(t *testing.T) {
+	rs := NewResources(nil)
+	err := rs.Discover(fakeDiscovery(
+		apiResources("v1", TektonConfig, ServiceAccount, Namespace, Pod, PersistentVolumeClaim, ConfigMap),
+		apiResources("yamecloud.io/v1", CI, CD, UNIT, SONAR),
+		apiResources("nuwa.nip.io/v1", Stone),
+		apiResources("fuxi.nip.io/v1", TektonGraph),
+		apiResources("tekton.dev/v1beta1", Pipeline, PipelineRun, Task, TaskRun),
+		apiResources("tekton.dev/v1", Pipeline, PipelineRun, Task, TaskRun),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gvr, err := rs.GetGvr(PipelineRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gvr.Version != "v1" {
+		t.Fatalf("expect tekton version v1, got %s", gvr.Version)
+	}
+	if _, err := rs.GetGvr(PipelineResource); err == nil {
+		t.Fatal("expect pipelineresources not served")
+	}
+}
+
+func TestDiscoverRequiredMissing(t *testing.T) {
+	rs := NewResources([]string{CD})
+	err := rs.Discover(fakeDiscovery(
+		apiResources("v1", TektonConfig, ServiceAccount, Namespace, Pod, PersistentVolumeClaim, ConfigMap),
+		apiResources("yamecloud.io/v1", CI, UNIT, SONAR),
+		apiResources("tekton.dev/v1alpha1", Pipeline, PipelineRun, Task, TaskRun, PipelineResource),
+	))
+	if err == nil {
+		t.Fatal("expect required api missing error")
+	}
+	for _, expected := range []string{Stone, TektonGraph} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expect %s in report (%s)", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), CD) {
+		t.Fatalf("excluded resource reported (%s)", err)
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	result, err := ParseResources("tektonconfigs=operator.tekton.dev/v1alpha1/tektonconfigs, events=v1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["tektonconfigs"].Group != "operator.tekton.dev" || result["events"].Version != "v1" {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if _, err := ParseResources("events"); err == nil {
+		t.Fatal("expect illegal resource error")
+	}
+}
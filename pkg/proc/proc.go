@@ -1,10 +1,12 @@
 package proc
 
-type ProcFunc func(<-chan struct{}, chan<- error)
+import "context"
+
+type ProcFunc func(context.Context, chan<- error)
 
 type Proc struct {
 	funcs  []ProcFunc
-	stopCs []chan struct{}
+	cancel context.CancelFunc
 	errC   chan error
 }
 
@@ -16,16 +18,22 @@ func NewProc() *Proc {
 	return proc
 }
 
-func (p *Proc) Start() <-chan error {
-	p.stopCs = make([]chan struct{}, 0)
+// Start run all funcs with a ctx derived from the parent, they are all
+// cancelled when the parent is done or Stop is called
+func (p *Proc) Start(ctx context.Context) <-chan error {
+	ctx, p.cancel = context.WithCancel(ctx)
 	for _, _func := range p.funcs {
-		stopC := make(chan struct{})
-		go _func(stopC, p.errC)
-		p.stopCs = append(p.stopCs, stopC)
+		go _func(ctx, p.errC)
 	}
 	return p.errC
 }
 
+func (p *Proc) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
 func (p *Proc) Add(_func ProcFunc) { p.funcs = append(p.funcs, _func) }
 
 func (p *Proc) Error() chan<- error { return p.errC }
@@ -0,0 +1,321 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// dockerHubEndpoint the registry v2 api of the docker.io images
+	dockerHubEndpoint = "registry-1.docker.io"
+	registryTimeout   = 30 * time.Second
+)
+
+// the manifest media types accepted from the registry, the index of the multi-arch build first
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ImageRef the repository of the registry v2 api, e.g. harbor.ym/devops/app:v1
+type ImageRef struct {
+	Host       string
+	Repository string
+	Tag        string
+}
+
+// NewImageRef the image of the project pushed to the repository url, e.g. harbor.ym/devops + app
+func NewImageRef(repoUrl, name, tag string) *ImageRef {
+	repoUrl = strings.TrimSpace(repoUrl)
+	if i := strings.Index(repoUrl, "://"); i >= 0 {
+		repoUrl = repoUrl[i+3:]
+	}
+	repoUrl = strings.Trim(repoUrl, "/")
+	host := Host(repoUrl)
+	path := repoUrl
+	if parts := strings.SplitN(repoUrl, "/", 2); strings.ToLower(parts[0]) == host {
+		path = ""
+		if len(parts) == 2 {
+			path = parts[1]
+		}
+	}
+	repository := strings.Trim(path+"/"+name, "/")
+	if host == dockerHubRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return &ImageRef{Host: host, Repository: repository, Tag: tag}
+}
+
+func (r *ImageRef) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Host, r.Repository, r.Tag)
+}
+
+// endpoint the host of the registry v2 api
+func (r *ImageRef) endpoint() string {
+	if r.Host == dockerHubRegistry {
+		return dockerHubEndpoint
+	}
+	return r.Host
+}
+
+// Client the registry v2 api client with the basic and the bearer token auth, the credential is
+// sent only to answer the auth challenge of the registry. The https endpoint is verified unless the host
+// is insecure, only the insecure host falls back to http
+type Client struct {
+	credential *Credential
+	insecure   map[string]bool
+	client     *resty.Client
+	// skipVerify the client of the insecure hosts
+	skipVerify *resty.Client
+	scheme     string
+	// basic the registry challenged the basic auth, tokens the bearer tokens by the scope
+	basic  bool
+	tokens map[string]string
+}
+
+// NewClient the client of the credential, the insecure hosts e.g. harbor.ym,127.0.0.1:5000
+func NewClient(credential *Credential, insecure []string) *Client {
+	r := &Client{
+		credential: credential,
+		insecure:   make(map[string]bool),
+		client:     resty.New().SetTimeout(registryTimeout),
+		skipVerify: resty.New().SetTimeout(registryTimeout).SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true}),
+		tokens:     make(map[string]string),
+	}
+	for _, host := range insecure {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			r.insecure[host] = true
+		}
+	}
+	return r
+}
+
+func (r *Client) clientOf(host string) *resty.Client {
+	if r.insecure[strings.ToLower(host)] {
+		return r.skipVerify
+	}
+	return r.client
+}
+
+func (r *Client) do(ctx context.Context, ref *ImageRef, method, path string, prepare func(*resty.Request)) (*resty.Response, error) {
+	// the existence and the signature checks pull only
+	scope := "pull"
+	if method != http.MethodGet && method != http.MethodHead {
+		scope = "pull,push"
+	}
+	send := func(scheme string) (*resty.Response, error) {
+		request := r.clientOf(ref.endpoint()).NewRequest().SetContext(ctx)
+		if prepare != nil {
+			prepare(request)
+		}
+		switch {
+		case r.tokens[scope] != "":
+			request.SetAuthToken(r.tokens[scope])
+		case r.basic:
+			request.SetBasicAuth(r.credential.Username, r.credential.Password)
+		}
+		return request.Execute(method, fmt.Sprintf("%s://%s/v2/%s%s", scheme, ref.endpoint(), ref.Repository, path))
+	}
+
+	schemes := []string{"https"}
+	if r.scheme != "" {
+		schemes = []string{r.scheme}
+	} else if r.insecure[strings.ToLower(ref.endpoint())] {
+		schemes = append(schemes, "http")
+	}
+	var response *resty.Response
+	var err error
+	for _, scheme := range schemes {
+		if response, err = send(scheme); err == nil {
+			r.scheme = scheme
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("request registry %s error (%s)", ref.Host, err)
+	}
+	if response.StatusCode() != http.StatusUnauthorized || r.tokens[scope] != "" || r.basic {
+		return response, nil
+	}
+	// answer the challenge, the credential is never sent before
+	challenge := response.Header().Get("WWW-Authenticate")
+	switch {
+	case strings.HasPrefix(strings.ToLower(challenge), "bearer "):
+		if err := r.login(ctx, ref, challenge, scope); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(strings.ToLower(challenge), "basic") && r.credential != nil:
+		r.basic = true
+	}
+	if r.tokens[scope] == "" && !r.basic {
+		return response, nil
+	}
+	return send(r.scheme)
+}
+
+// trustedRealms the token realm hosts of the registries served by another host
+var trustedRealms = map[string]string{dockerHubRegistry: "auth.docker.io"}
+
+// login get the token of the scope by the bearer challenge, e.g.
+// Bearer realm="https://harbor.ym/service/token",service="harbor-registry",scope="repository:app:pull".
+// The realm must be the https of the registry host unless the realm host is insecure.
+func (r *Client) login(ctx context.Context, ref *ImageRef, challenge, scope string) error {
+	params := make(map[string]string)
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if params["realm"] == "" || err != nil || realm.Host == "" {
+		return fmt.Errorf("registry %s illegal auth challenge", ref.Host)
+	}
+	realmHost := strings.ToLower(realm.Host)
+	trusted := realm.Scheme == "https" && (realmHost == strings.ToLower(ref.endpoint()) || realmHost == trustedRealms[ref.Host])
+	if !trusted && !r.insecure[realmHost] {
+		return fmt.Errorf("registry %s untrusted token realm %s://%s", ref.Host, realm.Scheme, realm.Host)
+	}
+	request := r.clientOf(realmHost).NewRequest().
+		SetContext(ctx).
+		SetQueryParam("scope", fmt.Sprintf("repository:%s:%s", ref.Repository, scope))
+	if params["service"] != "" {
+		request.SetQueryParam("service", params["service"])
+	}
+	if r.credential != nil {
+		request.SetBasicAuth(r.credential.Username, r.credential.Password)
+	}
+	response, err := request.Get(realm.String())
+	if err != nil {
+		return fmt.Errorf("get registry %s token error (%s)", ref.Host, err)
+	}
+	if response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("get registry %s token response code (%d)", ref.Host, response.StatusCode())
+	}
+	token := &struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(response.Body(), token); err != nil {
+		return fmt.Errorf("registry %s illegal token response", ref.Host)
+	}
+	r.tokens[scope] = token.Token
+	if token.Token == "" {
+		r.tokens[scope] = token.AccessToken
+	}
+	return nil
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// manifest get the manifest of the reference, nil if not found
+func (r *Client) manifest(ctx context.Context, ref *ImageRef, reference string) (body []byte, mediaType, digest string, err error) {
+	response, err := r.do(ctx, ref, http.MethodGet, "/manifests/"+reference, func(request *resty.Request) {
+		request.SetHeader("Accept", strings.Join(manifestMediaTypes, ", "))
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	switch response.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", "", nil
+	default:
+		return nil, "", "", fmt.Errorf("get manifest %s response code (%d)", ref, response.StatusCode())
+	}
+	body = response.Body()
+	digest = response.Header().Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	mediaType = strings.TrimSpace(strings.Split(response.Header().Get("Content-Type"), ";")[0])
+	return body, mediaType, digest, nil
+}
+
+// PutManifest tag the manifest
+func (r *Client) PutManifest(ctx context.Context, ref *ImageRef, tag string, body []byte, mediaType string) error {
+	response, err := r.do(ctx, ref, http.MethodPut, "/manifests/"+tag, func(request *resty.Request) {
+		request.SetHeader("Content-Type", mediaType).SetBody(body)
+	})
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusCreated && response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("put manifest %s:%s response code (%d)", ref.Repository, tag, response.StatusCode())
+	}
+	return nil
+}
+
+// imageLabels the labels of the image config, the first image of the index
+func (r *Client) imageLabels(ctx context.Context, ref *ImageRef, body []byte) (map[string]string, error) {
+	m := &manifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("illegal manifest of %s", ref)
+	}
+	if len(m.Manifests) > 0 {
+		imageBody, _, _, err := r.manifest(ctx, ref, m.Manifests[0].Digest)
+		if err != nil || imageBody == nil {
+			return nil, fmt.Errorf("get image manifest of %s error (%v)", ref, err)
+		}
+		m = &manifest{}
+		if err := json.Unmarshal(imageBody, m); err != nil {
+			return nil, fmt.Errorf("illegal image manifest of %s", ref)
+		}
+	}
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("image %s has no config", ref)
+	}
+	response, err := r.do(ctx, ref, http.MethodGet, "/blobs/"+m.Config.Digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("get image config of %s response code (%d)", ref, response.StatusCode())
+	}
+	config := &struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}{}
+	if err := json.Unmarshal(response.Body(), config); err != nil {
+		return nil, fmt.Errorf("illegal image config of %s", ref)
+	}
+	return config.Config.Labels, nil
+}
+
+// BuiltImage the manifest of the image tag built with the labels, the digest is empty if not found
+func (r *Client) BuiltImage(ctx context.Context, ref *ImageRef, labels map[string]string) (body []byte, mediaType, digest string, err error) {
+	body, mediaType, digest, err = r.manifest(ctx, ref, ref.Tag)
+	if err != nil || body == nil {
+		return nil, "", "", err
+	}
+	imageLabels, err := r.imageLabels(ctx, ref, body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	for key, value := range labels {
+		if imageLabels[key] != value {
+			return nil, "", "", nil
+		}
+	}
+	return body, mediaType, digest, nil
+}
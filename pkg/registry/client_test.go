@@ -0,0 +1,276 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// registryStub a registry v2 api serve the manifests and the blobs of a repository with the bearer token auth
+type registryStub struct {
+	sync.Mutex
+	repository string
+	manifests  map[string][]byte
+	mediaTypes map[string]string
+	blobs      map[string][]byte
+	token      string
+	tokenAuth  string
+	requests   []string
+	// leaked the credential sent to the registry api without the challenge
+	leaked bool
+}
+
+func newRegistryStub(repository string) *registryStub {
+	return &registryStub{
+		repository: repository,
+		manifests:  make(map[string][]byte),
+		mediaTypes: make(map[string]string),
+		blobs:      make(map[string][]byte),
+		token:      "registry-token",
+	}
+}
+
+// commitLabels the labels of the image built of the commit, the project path and the project file
+func commitLabels(commitID, projectPath, projectFile string) map[string]string {
+	return map[string]string{
+		"yce-cloud-extensions.commit":       commitID,
+		"yce-cloud-extensions.project-path": projectPath,
+		"yce-cloud-extensions.project-file": projectFile,
+	}
+}
+
+func digestOf(data []byte) string { return fmt.Sprintf("sha256:%x", sha256.Sum256(data)) }
+
+// pushImage store the config, the manifest and the tags, return the manifest digest
+func (s *registryStub) pushImage(labels map[string]string, tags ...string) string {
+	config, _ := json.Marshal(map[string]interface{}{"config": map[string]interface{}{"Labels": labels}})
+	s.blobs[digestOf(config)] = config
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.docker.distribution.manifest.v2+json",
+		"config":        map[string]interface{}{"digest": digestOf(config)},
+	})
+	digest := digestOf(manifest)
+	for _, reference := range append(tags, digest) {
+		s.manifests[reference] = manifest
+		s.mediaTypes[reference] = "application/vnd.docker.distribution.manifest.v2+json"
+	}
+	return digest
+}
+
+// pushIndex store an image index of the image manifest digests
+func (s *registryStub) pushIndex(digests []string, tags ...string) string {
+	manifests := make([]map[string]interface{}, 0)
+	for _, digest := range digests {
+		manifests = append(manifests, map[string]interface{}{"digest": digest})
+	}
+	index, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests":     manifests,
+	})
+	digest := digestOf(index)
+	for _, reference := range append(tags, digest) {
+		s.manifests[reference] = index
+		s.mediaTypes[reference] = "application/vnd.oci.image.index.v1+json"
+	}
+	return digest
+}
+
+func (s *registryStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if r.URL.Path == "/token" {
+		username, password, _ := r.BasicAuth()
+		if username != "ci" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.tokenAuth = r.URL.Query().Get("scope")
+		fmt.Fprintf(w, `{"token":%q}`, s.token)
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+		s.leaked = true
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="stub"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := fmt.Sprintf("/v2/%s/", s.repository)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, prefix), "/", 2)
+	if len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch {
+	case parts[0] == "manifests" && r.Method == http.MethodGet:
+		manifest, exist := s.manifests[parts[1]]
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", s.mediaTypes[parts[1]])
+		w.Header().Set("Docker-Content-Digest", digestOf(manifest))
+		w.Write(manifest)
+	case parts[0] == "manifests" && r.Method == http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		s.manifests[parts[1]] = body
+		s.mediaTypes[parts[1]] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	case parts[0] == "blobs" && r.Method == http.MethodGet:
+		blob, exist := s.blobs[parts[1]]
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(blob)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestNewImageRef(t *testing.T) {
+	for _, tc := range []struct {
+		repoUrl, name, expected string
+	}{
+		{"harbor.ym/yce-cloud-extensions", "app", "harbor.ym/yce-cloud-extensions/app:v1"},
+		{"http://127.0.0.1:5000/", "app", "127.0.0.1:5000/app:v1"},
+		{"laik", "app", "docker.io/laik/app:v1"},
+		{"", "nginx", "docker.io/library/nginx:v1"},
+	} {
+		if ref := NewImageRef(tc.repoUrl, tc.name, "v1"); ref.String() != tc.expected {
+			t.Fatalf("expected image ref %s, got %s", tc.expected, ref)
+		}
+	}
+	if endpoint := NewImageRef("", "nginx", "v1").endpoint(); endpoint != dockerHubEndpoint {
+		t.Fatalf("expected docker hub endpoint, got %s", endpoint)
+	}
+}
+
+func TestBuiltImage(t *testing.T) {
+	stub := newRegistryStub("devops/app")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	labels := commitLabels("b8f3c2a1d4e5", "service-a", "Dockerfile")
+	digest := stub.pushImage(labels, "b8f3c2a1d4e5")
+	stub.pushImage(commitLabels("c1d2e3f4", "service-b", "Dockerfile"), "c1d2e3f4")
+
+	ctx := context.Background()
+	credential := &Credential{Username: "ci", Password: "secret"}
+	ref := NewImageRef(server.URL+"/devops", "app", "b8f3c2a1d4e5")
+	insecure := []string{ref.Host}
+
+	client := NewClient(credential, insecure)
+	_, mediaType, found, err := client.BuiltImage(ctx, ref, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != digest || mediaType != "application/vnd.docker.distribution.manifest.v2+json" {
+		t.Fatalf("expected the built image %s, got %s (%s)", digest, found, mediaType)
+	}
+	if stub.tokenAuth != "repository:devops/app:pull" || stub.leaked {
+		t.Fatalf("unexpected token scope %s or the credential sent without the challenge", stub.tokenAuth)
+	}
+	if !strings.HasPrefix(stub.requests[0], "GET /v2/") {
+		t.Fatalf("expected the anonymous request first, got %v", stub.requests)
+	}
+
+	// the same commit built of another project path is not reused
+	if _, _, found, err := NewClient(credential, insecure).BuiltImage(ctx, ref, commitLabels("b8f3c2a1d4e5", "service-b", "Dockerfile")); err != nil || found != "" {
+		t.Fatalf("expected no image of the other project path, got %s (%v)", found, err)
+	}
+	// not pushed
+	ref.Tag = "0000000"
+	if _, _, found, err := NewClient(credential, insecure).BuiltImage(ctx, ref, labels); err != nil || found != "" {
+		t.Fatalf("expected no image of the not pushed tag, got %s (%v)", found, err)
+	}
+	// the wrong credential
+	ref.Tag = "b8f3c2a1d4e5"
+	if _, _, _, err := NewClient(&Credential{Username: "ci", Password: "wrong"}, insecure).BuiltImage(ctx, ref, labels); err == nil {
+		t.Fatal("expected error of the wrong credential")
+	}
+	// the http registry not listed as insecure
+	if _, _, _, err := NewClient(credential, nil).BuiltImage(ctx, ref, labels); err == nil {
+		t.Fatal("expected error of the http registry not insecure")
+	}
+}
+
+func TestRegistryTokenRealm(t *testing.T) {
+	stub := newRegistryStub("devops/app")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	stub.pushImage(commitLabels("b8f3c2a1d4e5", "", ""), "b8f3c2a1d4e5")
+
+	ctx := context.Background()
+	credential := &Credential{Username: "ci", Password: "secret"}
+	ref := NewImageRef(server.URL+"/devops", "app", "b8f3c2a1d4e5")
+	client := NewClient(credential, []string{ref.Host})
+	for _, challenge := range []string{
+		`Bearer realm="http://auth.example.com/token",service="stub"`,
+		`Bearer realm="https://auth.example.com/token",service="stub"`,
+	} {
+		if err := client.login(ctx, ref, challenge, "pull"); err == nil || !strings.Contains(err.Error(), "untrusted token realm") {
+			t.Fatalf("expected the realm of %s refused, got %v", challenge, err)
+		}
+	}
+	// the http realm of the registry host not listed as insecure
+	https := NewImageRef("harbor.ym/devops", "app", "v1")
+	challenge := fmt.Sprintf(`Bearer realm="http://%s/token"`, https.Host)
+	if err := NewClient(credential, nil).login(ctx, https, challenge, "pull"); err == nil || !strings.Contains(err.Error(), "untrusted token realm") {
+		t.Fatalf("expected the http realm refused, got %v", err)
+	}
+	if len(stub.requests) != 0 {
+		t.Fatalf("expected no credential sent to the refused realms, got %v", stub.requests)
+	}
+}
+
+func TestBuiltImageIndex(t *testing.T) {
+	stub := newRegistryStub("app")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	labels := commitLabels("b8f3c2a1d4e5", "", "")
+	amd64 := stub.pushImage(labels)
+	arm64 := stub.pushImage(labels)
+	index := stub.pushIndex([]string{amd64, arm64}, "b8f3c2a1d4e5")
+
+	ctx := context.Background()
+	ref := NewImageRef(server.URL, "app", "b8f3c2a1d4e5")
+	client := NewClient(&Credential{Username: "ci", Password: "secret"}, []string{ref.Host})
+	body, mediaType, digest, err := client.BuiltImage(ctx, ref, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != index || mediaType != "application/vnd.oci.image.index.v1+json" {
+		t.Fatalf("expected the image index digest %s, got %s (%s)", index, digest, mediaType)
+	}
+
+	// the extra tags point to the same index
+	if err := client.PutManifest(ctx, ref, "latest", body, mediaType); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stub.manifests["latest"], stub.manifests["b8f3c2a1d4e5"]) || stub.mediaTypes["latest"] != mediaType {
+		t.Fatal("expected the latest tag of the image index")
+	}
+	if stub.tokenAuth != "repository:app:pull,push" {
+		t.Fatalf("expected the push scope of the tag, got %s", stub.tokenAuth)
+	}
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/credentials"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The registry credential registry, the Secrets of the ops namespace labeled
+// yce-cloud-extensions/registry-credential=true, e.g.
+//
+//	metadata:
+//	  labels:
+//	    yce-cloud-extensions/registry-credential: "true"
+//	  annotations:
+//	    yce-cloud-extensions/registry-host: harbor.ym
+//	type: kubernetes.io/basic-auth
+//	data:
+//	  username: ...
+//	  password: ...
+//
+// the kubernetes.io/dockerconfigjson secret is supported too, the auth of the host is used.
+const (
+	CredentialLabel             = "yce-cloud-extensions/registry-credential"
+	HostAnnotation              = "yce-cloud-extensions/registry-host"
+	DockerConfigJSONSecretType  = "kubernetes.io/dockerconfigjson"
+	DockerConfigJSONKey         = ".dockerconfigjson"
+	basicAuthSecretType         = "kubernetes.io/basic-auth"
+	dockerHubRegistry           = "docker.io"
+	dockerHubConfigRegistryHost = "https://index.docker.io/v1/"
+)
+
+// Credential the account push the images to the registry host
+type Credential struct {
+	SecretName string
+	Host       string
+	Username   string
+	Password   string
+}
+
+// Host the registry of the image reference or the repository url,
+// e.g. harbor.ym/devops/app:v1 -> harbor.ym, http://harbor.ym -> harbor.ym, library/nginx -> docker.io
+func Host(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if i := strings.Index(ref, "://"); i >= 0 {
+		ref = ref[i+3:]
+	}
+	first := strings.SplitN(ref, "/", 2)[0]
+	if first == "" || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return dockerHubRegistry
+	}
+	return strings.ToLower(first)
+}
+
+func decodeBase64(value string) string {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// CredentialsFromSecrets the credentials of the labeled secrets, the secret without host,
+// of the type not supported or without the account of the host is ignored
+func CredentialsFromSecrets(items []unstructured.Unstructured) []*Credential {
+	result := make([]*Credential, 0, len(items))
+	for _, item := range items {
+		annotation := item.GetAnnotations()[HostAnnotation]
+		if annotation == "" {
+			continue
+		}
+		host := Host(annotation)
+		secretType, _, _ := unstructured.NestedString(item.Object, "type")
+		data, _, _ := unstructured.NestedStringMap(item.Object, "data")
+		credential := &Credential{SecretName: item.GetName(), Host: host}
+		switch secretType {
+		case basicAuthSecretType:
+			credential.Username, credential.Password = decodeBase64(data["username"]), decodeBase64(data["password"])
+		case DockerConfigJSONSecretType:
+			credential.Username, credential.Password = dockerConfigAccount(decodeBase64(data[DockerConfigJSONKey]), host)
+		default:
+			continue
+		}
+		if credential.Username == "" && credential.Password == "" {
+			continue
+		}
+		result = append(result, credential)
+	}
+	return result
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// dockerConfigAccount the account of the host in the docker config.json
+func dockerConfigAccount(configJSON, host string) (string, string) {
+	config := &dockerConfig{}
+	if err := json.Unmarshal([]byte(configJSON), config); err != nil {
+		return "", ""
+	}
+	for server, auth := range config.Auths {
+		if Host(server) != host && !(host == dockerHubRegistry && server == dockerHubConfigRegistryHost) {
+			continue
+		}
+		if auth.Username != "" || auth.Password != "" {
+			return auth.Username, auth.Password
+		}
+		if account := strings.SplitN(decodeBase64(auth.Auth), ":", 2); len(account) == 2 {
+			return account[0], account[1]
+		}
+	}
+	return "", ""
+}
+
+// MatchCredentials the credential of each host and the hosts without credential,
+// the first one sorted by the secret name is used if the host has more than one
+func MatchCredentials(items []*Credential, hosts []string) ([]*Credential, []string) {
+	sorted := append([]*Credential{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].SecretName < sorted[j].SecretName })
+
+	matched, missing := make([]*Credential, 0), make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, host := range hosts {
+		if _, exist := seen[host]; exist {
+			continue
+		}
+		seen[host] = struct{}{}
+		var found *Credential
+		for _, credential := range sorted {
+			if credential.Host == host {
+				found = credential
+				break
+			}
+		}
+		if found == nil {
+			missing = append(missing, host)
+			continue
+		}
+		matched = append(matched, found)
+	}
+	return matched, missing
+}
+
+// DockerConfigJSON the docker config.json of the credentials
+func DockerConfigJSON(items []*Credential) ([]byte, error) {
+	config := &dockerConfig{Auths: make(map[string]dockerConfigAuth, len(items))}
+	for _, credential := range items {
+		server := credential.Host
+		if server == dockerHubRegistry {
+			server = dockerHubConfigRegistryHost
+		}
+		config.Auths[server] = dockerConfigAuth{
+			Auth: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", credential.Username, credential.Password))),
+		}
+	}
+	return json.Marshal(config)
+}
+
+// LoadCredentials the credential of each host from the labeled secrets of the ops namespace, the registry
+// account of the provider is the credential of the registryUrl host, return the hosts without credential
+func LoadCredentials(ctx context.Context, drs datasource.IDataSource, provider credentials.Provider, registryUrl string, hosts []string) ([]*Credential, []string, error) {
+	list, err := drs.List(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, "", 0, 0, fmt.Sprintf("%s=true", CredentialLabel))
+	if err != nil {
+		return nil, nil, fmt.Errorf("list registry credentials error (%s)", err)
+	}
+	matched, missing := MatchCredentials(CredentialsFromSecrets(list.Items), hosts)
+	if len(missing) == 0 {
+		return matched, nil, nil
+	}
+	username, password, err := credentials.Account(ctx, provider, credentials.Registry)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load registry credential error (%s)", err)
+	}
+	fallback, missing := MatchCredentials([]*Credential{{
+		Host:     Host(registryUrl),
+		Username: username,
+		Password: password,
+	}}, missing)
+	return append(matched, fallback...), missing, nil
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHost(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"harbor.ym/yce-cloud-extensions":      "harbor.ym",
+		"http://Harbor.ym":                    "harbor.ym",
+		"registry.ym:5000/devops/app:v1":      "registry.ym:5000",
+		"localhost/app":                       "localhost",
+		"library/nginx":                       dockerHubRegistry,
+		"nginx":                               dockerHubRegistry,
+		dockerHubConfigRegistryHost + "nginx": "index.docker.io",
+	} {
+		if host := Host(ref); host != expected {
+			t.Fatalf("expect %s registry %s, got %s", ref, expected, host)
+		}
+	}
+}
+
+func registrySecret(name, secretType, host string, data map[string]interface{}) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"type": secretType, "data": data}}
+	obj.SetName(name)
+	obj.SetAnnotations(map[string]string{HostAnnotation: host})
+	return obj
+}
+
+func encode(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+func TestCredentialsFromSecrets(t *testing.T) {
+	dockerConfig := `{"auths":{"https://index.docker.io/v1/":{"auth":"` + encode("hub:hub-token") + `"}}}`
+	credentials := CredentialsFromSecrets([]unstructured.Unstructured{
+		registrySecret("harbor", basicAuthSecretType, "http://harbor.ym", map[string]interface{}{"username": encode("ci"), "password": encode("secret")}),
+		registrySecret("docker-hub", DockerConfigJSONSecretType, "docker.io", map[string]interface{}{DockerConfigJSONKey: encode(dockerConfig)}),
+		registrySecret("quay", DockerConfigJSONSecretType, "quay.io", map[string]interface{}{DockerConfigJSONKey: encode(dockerConfig)}),
+		registrySecret("opaque", "Opaque", "harbor.ym", map[string]interface{}{"username": encode("ci")}),
+	})
+	if len(credentials) != 2 {
+		t.Fatalf("expect the secret without the account of the host ignored, got %d", len(credentials))
+	}
+	if credentials[0].Host != "harbor.ym" || credentials[0].Password != "secret" {
+		t.Fatalf("unexpected basic auth credential %+v", credentials[0])
+	}
+	if credentials[1].Host != dockerHubRegistry || credentials[1].Username != "hub" || credentials[1].Password != "hub-token" {
+		t.Fatalf("unexpected docker config credential %+v", credentials[1])
+	}
+
+	matched, missing := MatchCredentials(credentials, []string{"harbor.ym", "harbor.ym", "registry.ym:5000"})
+	if len(matched) != 1 || matched[0].SecretName != "harbor" {
+		t.Fatalf("unexpected matched %v", matched)
+	}
+	if len(missing) != 1 || missing[0] != "registry.ym:5000" {
+		t.Fatalf("unexpected missing %v", missing)
+	}
+}
+
+func TestDockerConfigJSON(t *testing.T) {
+	data, err := DockerConfigJSON([]*Credential{
+		{Host: "harbor.ym", Username: "ci", Password: "secret"},
+		{Host: dockerHubRegistry, Username: "hub", Password: "hub-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &dockerConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Auths["harbor.ym"].Auth != encode("ci:secret") || config.Auths[dockerHubConfigRegistryHost].Auth != encode("hub:hub-token") {
+		t.Fatalf("unexpected docker config %s", data)
+	}
+	if username, password := dockerConfigAccount(string(data), "harbor.ym"); username != "ci" || password != "secret" {
+		t.Fatalf("unexpected account %s %s", username, password)
+	}
+
+}
@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// the simple signing payload layer of the cosign signature manifest and the annotation of the signature
+	simpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	signatureAnnotation    = "dev.cosignproject.cosign/signature"
+	signatureTagSuffix     = ".sig"
+)
+
+var (
+	// ErrImageUnsigned the image digest has no signature
+	ErrImageUnsigned = errors.New("image not signed")
+	// ErrImageUntrusted none of the signatures of the image digest is verified by the public keys
+	ErrImageUntrusted = errors.New("image signature not trusted")
+)
+
+// ParsePublicKeys the PEM encoded public keys of the configmap data in the key order, e.g. cosign.pub
+func ParsePublicKeys(data map[string]string) ([]crypto.PublicKey, error) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := make([]crypto.PublicKey, 0, len(names))
+	for _, name := range names {
+		rest := []byte(data[name])
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("illegal public key %s (%s)", name, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public key found")
+	}
+	return keys, nil
+}
+
+// signaturePayload the simple signing payload of the cosign signature
+type signaturePayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+type signatureManifest struct {
+	Layers []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// ImageDigestRef the image referenced by the digest instead of the mutable tag, e.g. harbor.ym/devops/app@sha256:...
+func ImageDigestRef(image, digest string) string {
+	name := strings.TrimSpace(image)
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + "@" + digest
+}
+
+// parseImage the repository and the digest of the image, the tag is latest if not set,
+// e.g. harbor.ym/devops/app:v1, harbor.ym/devops/app@sha256:...
+func parseImage(image string) (*ImageRef, string) {
+	name, digest := strings.TrimSpace(image), ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	repoUrl, tag := "", "latest"
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		repoUrl, name = name[:i], name[i+1:]
+	}
+	return NewImageRef(repoUrl, name, tag), digest
+}
+
+// VerifyImageSignature verify the cosign signatures of the image by the public keys, the tag is resolved
+// to the digest first, the credential of the registry host is used if any, only the insecure hosts are
+// requested by http. The ErrImageUnsigned and the ErrImageUntrusted are wrapped when the image is rejected,
+// return the verified digest.
+func VerifyImageSignature(ctx context.Context, image string, credentials []*Credential, insecure []string, keys []crypto.PublicKey) (string, error) {
+	ref, digest := parseImage(image)
+	var credential *Credential
+	if matched, _ := MatchCredentials(credentials, []string{ref.Host}); len(matched) > 0 {
+		credential = matched[0]
+	}
+	client := NewClient(credential, insecure)
+	if digest == "" {
+		body, _, resolved, err := client.manifest(ctx, ref, ref.Tag)
+		if err != nil {
+			return "", err
+		}
+		if body == nil {
+			return "", fmt.Errorf("image %s not found", ref)
+		}
+		digest = resolved
+	}
+
+	// the signatures are pushed to the sha256-<hex>.sig tag of the repository
+	body, _, _, err := client.manifest(ctx, ref, strings.Replace(digest, ":", "-", 1)+signatureTagSuffix)
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		return "", fmt.Errorf("%w: no signature of %s@%s", ErrImageUnsigned, ref.Repository, digest)
+	}
+	m := &signatureManifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return "", fmt.Errorf("illegal signature manifest of %s@%s", ref.Repository, digest)
+	}
+	signatures := 0
+	for _, layer := range m.Layers {
+		signature := layer.Annotations[signatureAnnotation]
+		if layer.MediaType != simpleSigningMediaType || signature == "" {
+			continue
+		}
+		signatures++
+		payload, err := client.blob(ctx, ref, layer.Digest)
+		if err != nil {
+			return "", err
+		}
+		if verifySignature(payload, signature, digest, keys) {
+			return digest, nil
+		}
+	}
+	if signatures == 0 {
+		return "", fmt.Errorf("%w: no signature of %s@%s", ErrImageUnsigned, ref.Repository, digest)
+	}
+	return "", fmt.Errorf("%w: %d signatures of %s@%s not verified by the public keys", ErrImageUntrusted, signatures, ref.Repository, digest)
+}
+
+// verifySignature the payload signs the digest and the base64 signature of the payload verified by any key
+func verifySignature(payload []byte, signature, digest string, keys []crypto.PublicKey) bool {
+	p := &signaturePayload{}
+	if err := json.Unmarshal(payload, p); err != nil || p.Critical.Image.DockerManifestDigest != digest {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	hashed := sha256.Sum256(payload)
+	for _, key := range keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hashed[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blob get the blob of the digest, the content is checked by the digest
+func (r *Client) blob(ctx context.Context, ref *ImageRef, digest string) ([]byte, error) {
+	response, err := r.do(ctx, ref, http.MethodGet, "/blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("get blob %s@%s response code (%d)", ref.Repository, digest, response.StatusCode())
+	}
+	if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(response.Body())); actual != digest {
+		return nil, fmt.Errorf("blob %s@%s digest mismatch", ref.Repository, digest)
+	}
+	return response.Body(), nil
+}
@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func publicKeyPEM(t *testing.T, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// pushSignature store the cosign signature manifest of the digest signed by the key
+func (s *registryStub) pushSignature(t *testing.T, key *ecdsa.PrivateKey, digest string) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]interface{}{"docker-reference": s.repository},
+			"image":    map[string]interface{}{"docker-manifest-digest": digest},
+			"type":     "cosign container image signature",
+		},
+		"optional": nil,
+	})
+	hashed := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs[digestOf(payload)] = payload
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers": []map[string]interface{}{{
+			"mediaType":   simpleSigningMediaType,
+			"digest":      digestOf(payload),
+			"annotations": map[string]string{signatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+		}},
+	})
+	tag := strings.Replace(digest, ":", "-", 1) + signatureTagSuffix
+	s.manifests[tag] = manifest
+	s.mediaTypes[tag] = "application/vnd.oci.image.manifest.v1+json"
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys, err := ParsePublicKeys(map[string]string{
+		"cosign.pub": publicKeyPEM(t, key),
+		"team.pub":   publicKeyPEM(t, other) + publicKeyPEM(t, key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || !reflect.DeepEqual(keys[1], &other.PublicKey) {
+		t.Fatalf("unexpected public keys %v", keys)
+	}
+	if _, err := ParsePublicKeys(map[string]string{"README": "the cosign public keys"}); err == nil {
+		t.Fatal("expected error of no public key")
+	}
+	bad := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("illegal")}))
+	if _, err := ParsePublicKeys(map[string]string{"cosign.pub": bad}); err == nil {
+		t.Fatal("expected error of the illegal public key")
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	for _, tc := range []struct {
+		image, expected, digest string
+	}{
+		{"harbor.ym/devops/app:v1", "harbor.ym/devops/app:v1", ""},
+		{"harbor.ym/devops/app@sha256:abc", "harbor.ym/devops/app:latest", "sha256:abc"},
+		{"127.0.0.1:5000/app:v1@sha256:abc", "127.0.0.1:5000/app:v1", "sha256:abc"},
+		{"nginx", "docker.io/library/nginx:latest", ""},
+	} {
+		if ref, digest := parseImage(tc.image); ref.String() != tc.expected || digest != tc.digest {
+			t.Fatalf("expected %s@%s of %s, got %s@%s", tc.expected, tc.digest, tc.image, ref, digest)
+		}
+	}
+}
+
+func TestImageDigestRef(t *testing.T) {
+	for image, expected := range map[string]string{
+		"harbor.ym/devops/app:v1":          "harbor.ym/devops/app@sha256:abc",
+		"harbor.ym/devops/app@sha256:old":  "harbor.ym/devops/app@sha256:abc",
+		"127.0.0.1:5000/app:v1@sha256:old": "127.0.0.1:5000/app@sha256:abc",
+		"127.0.0.1:5000/devops/app":        "127.0.0.1:5000/devops/app@sha256:abc",
+	} {
+		if ref := ImageDigestRef(image, "sha256:abc"); ref != expected {
+			t.Fatalf("expected %s of %s, got %s", expected, image, ref)
+		}
+	}
+}
+
+func TestVerifyImageSignature(t *testing.T) {
+	stub := newRegistryStub("devops/app")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	untrusted, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signed := stub.pushImage(commitLabels("b8f3c2a1", "", ""), "v1")
+	stub.pushSignature(t, key, signed)
+	unsigned := stub.pushImage(commitLabels("c1d2e3f4", "", ""), "v2")
+	other := stub.pushImage(commitLabels("d4e5f6a7", "", ""), "v3")
+	stub.pushSignature(t, untrusted, other)
+
+	ctx := context.Background()
+	host := strings.TrimPrefix(server.URL, "http://")
+	insecure := []string{host}
+	credentials := []*Credential{{Host: host, Username: "ci", Password: "secret"}}
+	keys, err := ParsePublicKeys(map[string]string{"cosign.pub": publicKeyPEM(t, key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, image := range []string{host + "/devops/app:v1", host + "/devops/app@" + signed} {
+		if digest, err := VerifyImageSignature(ctx, image, credentials, insecure, keys); err != nil || digest != signed {
+			t.Fatalf("expected the image %s verified, got %s (%v)", image, digest, err)
+		}
+	}
+	if _, err := VerifyImageSignature(ctx, host+"/devops/app:v2", credentials, insecure, keys); !errors.Is(err, ErrImageUnsigned) || !strings.Contains(err.Error(), unsigned) {
+		t.Fatalf("expected the unsigned image rejected, got %v", err)
+	}
+	if _, err := VerifyImageSignature(ctx, host+"/devops/app:v3", credentials, insecure, keys); !errors.Is(err, ErrImageUntrusted) {
+		t.Fatalf("expected the image signed by the untrusted key rejected, got %v", err)
+	}
+	// the signature of another digest is not accepted
+	stub.manifests[strings.Replace(unsigned, ":", "-", 1)+signatureTagSuffix] = stub.manifests[strings.Replace(signed, ":", "-", 1)+signatureTagSuffix]
+	if _, err := VerifyImageSignature(ctx, host+"/devops/app:v2", credentials, insecure, keys); !errors.Is(err, ErrImageUntrusted) {
+		t.Fatalf("expected the copied signature rejected, got %v", err)
+	}
+	if _, err := VerifyImageSignature(ctx, host+"/devops/app:v9", credentials, insecure, keys); err == nil || errors.Is(err, ErrImageUnsigned) {
+		t.Fatalf("expected the not found image error, got %v", err)
+	}
+}
@@ -25,6 +25,62 @@ type Request struct {
 	ProjectFile string `json:"projectFile"`
 	// ServiceName named by neZha server
 	ServiceName string `json:"serviceName"`
+	// Builder the image builder of the request, kaniko|buildkit|buildah
+	Builder string `json:"builder"`
+	// Platforms the multi-arch build platforms, e.g. linux/amd64,linux/arm64
+	Platforms []string `json:"platforms"`
+	// BuildArgs the --build-arg of the image build, must not contain any secret
+	BuildArgs map[string]string `json:"buildArgs"`
+	// BuildSecrets the secrets of the ops namespace mounted into the image build
+	BuildSecrets []BuildSecret `json:"buildSecrets"`
+	// Priority the request of the higher priority is scheduled first when the builds are queued
+	Priority int32 `json:"priority"`
+	// Force build the image even it was built of the commit already
+	Force bool `json:"force"`
+	// Images the sub-projects of the monorepo built together, the ProjectPath, ProjectFile and Output are not used if set
+	Images []Image `json:"images"`
+	// WatchPaths the paths rebuild the image if changed besides the ProjectPath, e.g. the shared libraries
+	WatchPaths []string `json:"watchPaths"`
+	// Pod the timeout, the resources and the placement of the build pods, override the settings of the project
+	Pod *BuildPod `json:"pod"`
+}
+
+// BuildPod the timeout, the compute resources of the build steps and the node placement of the build pods
+type BuildPod struct {
+	Timeout          string            `json:"timeout"`
+	CPURequests      string            `json:"cpuRequests"`
+	CPULimit         string            `json:"cpuLimit"`
+	MEMRequests      string            `json:"memRequests"`
+	MEMLimit         string            `json:"memLimit"`
+	NodeSelector     map[string]string `json:"nodeSelector"`
+	Tolerations      []Toleration      `json:"tolerations"`
+	RuntimeClassName string            `json:"runtimeClassName"`
+}
+
+// Toleration the toleration of the build pods to the taint of the nodes
+type Toleration struct {
+	Key               string `json:"key"`
+	Operator          string `json:"operator"`
+	Value             string `json:"value"`
+	Effect            string `json:"effect"`
+	TolerationSeconds *int64 `json:"tolerationSeconds"`
+}
+
+// Image a sub-project image of the monorepo build
+type Image struct {
+	ProjectPath string `json:"projectPath"`
+	ProjectFile string `json:"projectFile"`
+	// Output the image repository, the image is named by the base of the ProjectPath
+	Output string `json:"output"`
+	// WatchPaths the paths rebuild the image if changed besides the ProjectPath
+	WatchPaths []string `json:"watchPaths"`
+}
+
+// BuildSecret reference the key of a Secret in the ops namespace
+type BuildSecret struct {
+	ID         string `json:"id"`
+	SecretName string `json:"secretName"`
+	Key        string `json:"key"`
 }
 
 type RequestCd struct {
@@ -55,6 +111,93 @@ type Response struct {
 	AckState string `json:"ackState"`
 	UUID     string `json:"uuid"`
 	Done     bool   `json:"done"`
+	// Steps the progress of the steps of the pipelineRun, with the RUNNING ack state or the done state
+	Steps []StepState `json:"steps,omitempty"`
+	// Diagnosis the classification of the failure of the failed request
+	Diagnosis *Diagnosis `json:"diagnosis,omitempty"`
+}
+
+// StepState the state of a step of the pipelineRun task
+type StepState struct {
+	Task       string `json:"task"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	StartTime  string `json:"startTime"`
+	FinishTime string `json:"finishTime"`
+	ExitCode   int32  `json:"exitCode"`
+	Reason     string `json:"reason"`
+	Message    string `json:"message"`
+}
+
+// ScanSummary the vulnerability counts by severity of the scanned images
+type ScanSummary struct {
+	Critical  int32  `json:"critical"`
+	High      int32  `json:"high"`
+	Medium    int32  `json:"medium"`
+	Low       int32  `json:"low"`
+	Unknown   int32  `json:"unknown"`
+	Threshold string `json:"threshold"`
+	Passed    bool   `json:"passed"`
+	// Retained the image exceeding the threshold is still in the registry, it must not be deployed
+	Retained bool `json:"retained"`
+}
+
+// Diagnosis the category and the summary of the failure, without the logs of the failed step
+type Diagnosis struct {
+	Category string `json:"category"`
+	Summary  string `json:"summary"`
+	Task     string `json:"task"`
+	Step     string `json:"step"`
+	Reason   string `json:"reason"`
+	ExitCode int32  `json:"exitCode"`
+}
+
+type CIResponse struct {
+	FlowId   string `json:"flowId"`
+	StepName string `json:"stepName"`
+	AckState string `json:"ackState"`
+	UUID     string `json:"uuid"`
+	Done     bool   `json:"done"`
+	// ImageDigest the digest of the pushed image or image index
+	ImageDigest string `json:"imageDigest"`
+	// Tags the tags pushed of the image
+	Tags []string `json:"tags"`
+	// SBOM the reference of the sbom artifact attached to the image digest
+	SBOM string `json:"sbom,omitempty"`
+	// Scan the vulnerabilities of the pushed images, the run is failed when the threshold is exceeded
+	Scan *ScanSummary `json:"scan,omitempty"`
+	// QueuePosition the position of the request waiting for the build concurrency, with the QUEUED ack state
+	QueuePosition int32 `json:"queuePosition"`
+	// Images the result of each sub-project image of the monorepo build
+	Images []ImageResult `json:"images"`
+	// Steps the state of the steps of the pipelineRun, the failed step of the done request
+	Steps []StepState `json:"steps,omitempty"`
+	// Diagnosis the classification of the failure of the failed request
+	Diagnosis *Diagnosis `json:"diagnosis,omitempty"`
+}
+
+// ImageResult the build result of a sub-project image
+type ImageResult struct {
+	ProjectPath string   `json:"projectPath"`
+	ProjectFile string   `json:"projectFile"`
+	Output      string   `json:"output"`
+	AckState    string   `json:"ackState"`
+	ImageDigest string   `json:"imageDigest"`
+	Tags        []string `json:"tags"`
+	SBOM        string   `json:"sbom,omitempty"`
+}
+
+// QueueItem the CI request waiting for the build concurrency
+type QueueItem struct {
+	Name     string `json:"name"`
+	FlowId   string `json:"flowId"`
+	StepName string `json:"stepName"`
+	UUID     string `json:"uuid"`
+	GitUrl   string `json:"gitUrl"`
+	Branch   string `json:"branch"`
+	Priority int32  `json:"priority"`
+	// Position the 1-based position of the queue
+	Position int32 `json:"position"`
 }
 
 type UnitResponse struct {
@@ -64,6 +207,10 @@ type UnitResponse struct {
 	UUID     string `json:"uuid"`
 	Done     bool   `json:"done"`
 	Data     string `json:"data"`
+	// Steps the state of the steps of the pipelineRun, the failed step of the done request
+	Steps []StepState `json:"steps,omitempty"`
+	// Diagnosis the classification of the failure of the failed request
+	Diagnosis *Diagnosis `json:"diagnosis,omitempty"`
 }
 
 type RequestUnit struct {
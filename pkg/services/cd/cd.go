@@ -1,6 +1,7 @@
 package cd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/dict"
@@ -10,8 +11,10 @@ import (
 	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
+	"github.com/laik/yce-cloud-extensions/pkg/credentials"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
 	"github.com/tidwall/gjson"
@@ -26,15 +29,17 @@ type Service struct {
 	datasource.IDataSource
 	lastCDVersion    string
 	lastStoneVersion string
+	// credentials the registry account of the -credentials-provider pull the image signatures
+	credentials credentials.Provider
 }
 
-func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
-	cdChan, err := c.Watch(common.YceCloudExtensions, k8s.CD, c.lastCDVersion, 0, nil)
+func (c *Service) Start(ctx context.Context, errC chan<- error) {
+	cdChan, err := c.Watch(ctx, common.YceCloudExtensions, k8s.CD, c.lastCDVersion, 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch cd resource error (%s)\n", common.ERROR, err)
 		errC <- err
 	}
-	stoneChan, err := c.Watch("", k8s.Stone, c.lastStoneVersion, 0, "yce-cloud-extensions")
+	stoneChan, err := c.Watch(ctx, "", k8s.Stone, c.lastStoneVersion, 0, "yce-cloud-extensions")
 	if err != nil {
 		fmt.Printf("%s watch cd resource error (%s)\n", common.ERROR, err)
 		errC <- err
@@ -43,7 +48,7 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 	fmt.Printf("%s service cd start watch ci channel and pipeline run channel\n", common.INFO)
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s service cd get stop order\n", common.INFO)
 			return
 		case stoneEvent, ok := <-stoneChan:
@@ -57,7 +62,7 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 			}
 
 			stone := stoneEvent.Object
-			if err := c.reconcileStone(stone); err != nil {
+			if err := c.reconcileStone(ctx, stone); err != nil {
 				fmt.Printf("%s service cd reconcile stone error(%s)\n", common.ERROR, err)
 			}
 
@@ -82,8 +87,9 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 				continue
 			}
 
-			if err := c.reconcileCD(cd); err != nil {
-				fmt.Printf("%s service cd reconcile (%s) handle error (%s)\n", common.ERROR, cd.GetName(), err)
+			reconcileCtx := common.WithRequestRef(ctx, cd.Spec.FlowId, cd.Spec.StepName, cd.Spec.UUID)
+			if err := c.reconcileCD(reconcileCtx, cd); err != nil {
+				common.Printf(reconcileCtx, common.ERROR, "service cd reconcile (%s) handle error (%s)\n", cd.GetName(), err)
 				continue
 			}
 			// record watch version
@@ -100,7 +106,7 @@ func labelsToQuery(data map[string]string) string {
 	return strings.Join(result, ",")
 }
 
-func (c *Service) reconcileStone(stone runtime.Object) error {
+func (c *Service) reconcileStone(ctx context.Context, stone runtime.Object) error {
 	stoneBytes, err := json.Marshal(stone)
 	if err != nil {
 		return err
@@ -123,7 +129,7 @@ func (c *Service) reconcileStone(stone runtime.Object) error {
 	//
 	//// need compare expectedImages
 	//
-	//unstructuredPods, err := c.List(common.YceCloudExtensionsOps, k8s.Pod, "", 0, 0, labelsToQuery(labels))
+	//unstructuredPods, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.Pod, "", 0, 0, labelsToQuery(labels))
 	//if err != nil {
 	//	return err
 	//}
@@ -164,7 +170,7 @@ func (c *Service) reconcileStone(stone runtime.Object) error {
 	if name == "" {
 		return nil
 	}
-	unstructuredCD, err := c.Get(common.YceCloudExtensions, k8s.CD, name)
+	unstructuredCD, err := c.Get(ctx, common.YceCloudExtensions, k8s.CD, name)
 	if err != nil {
 		return nil
 	}
@@ -185,18 +191,18 @@ func (c *Service) reconcileStone(stone runtime.Object) error {
 		return err
 	}
 
-	if _, _, err := c.Apply(common.YceCloudExtensions, k8s.CD, name, newUnstructuredCD, false); err != nil {
+	if _, _, err := c.Apply(ctx, common.YceCloudExtensions, k8s.CD, name, newUnstructuredCD, false); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *Service) reconcileCD(cd *v1.CD) error {
+func (c *Service) reconcileCD(ctx context.Context, cd *v1.CD) error {
 	if cd.Spec.Done {
 		return nil
 	}
-	unstructuredNamespace, err := c.Get("", k8s.Namespace, *cd.Spec.DeployNamespace)
+	unstructuredNamespace, err := c.Get(ctx, "", k8s.Namespace, *cd.Spec.DeployNamespace)
 	if err != nil {
 		return fmt.Errorf("reconcile cd (%s) can't not get deploy namespace (%s) error (%s)",
 			cd.Name,
@@ -265,11 +271,22 @@ func (c *Service) reconcileCD(cd *v1.CD) error {
 		cd.Spec.Policy = &policy
 	}
 
+	// the image not signed by the trusted keys is rejected before the stone rendered, the verified
+	// digest is deployed so the tag pushed again after the verification is never deployed
+	image := *cd.Spec.ServiceImage
+	if services.VerifyImageSignature {
+		digest, diagnosis := c.verifyImage(ctx, image)
+		if diagnosis != nil {
+			return c.rejectCD(ctx, cd, diagnosis)
+		}
+		image = registry.ImageDigestRef(image, digest)
+	}
+
 	params := &params{
 		CDName:         cd.GetName(),
 		Namespace:      *cd.Spec.DeployNamespace,
 		Name:           *cd.Spec.ServiceName,
-		Image:          *cd.Spec.ServiceImage,
+		Image:          image,
 		CpuLimit:       *cd.Spec.CPULimit,
 		MemoryLimit:    *cd.Spec.MEMLimit,
 		Policy:         *cd.Spec.Policy,
@@ -304,7 +321,7 @@ func (c *Service) reconcileCD(cd *v1.CD) error {
 		dict.Set(configMap, "data", dataValue)
 		unstructuredConfigMap := &unstructured.Unstructured{Object: configMap}
 
-		_, _, err = c.Apply(*cd.Spec.DeployNamespace, k8s.ConfigMap, *cd.Spec.ServiceName, unstructuredConfigMap, true)
+		_, _, err = c.Apply(ctx, *cd.Spec.DeployNamespace, k8s.ConfigMap, *cd.Spec.ServiceName, unstructuredConfigMap, true)
 		if err != nil {
 			return fmt.Errorf("%s configMap apply error (%s)\n", common.ERROR, err)
 		}
@@ -315,7 +332,7 @@ func (c *Service) reconcileCD(cd *v1.CD) error {
 		return fmt.Errorf("stone render error (%s)", err)
 	}
 
-	_, _, err = c.Apply(*cd.Spec.DeployNamespace, k8s.Stone, *cd.Spec.ServiceName, unstructuredStone, true)
+	_, _, err = c.Apply(ctx, *cd.Spec.DeployNamespace, k8s.Stone, *cd.Spec.ServiceName, unstructuredStone, true)
 	if err != nil {
 		return fmt.Errorf("%s stone apply namespace (%s) stone (%s) \r\n error (%s)\r\n", common.ERROR, *cd.Spec.DeployNamespace, *cd.Spec.ServiceName, err)
 	}
@@ -323,7 +340,24 @@ func (c *Service) reconcileCD(cd *v1.CD) error {
 	return nil
 }
 
-func (c *Service) reconcileCDStorage(cd *v1.CD, storageClass string) (string, error) {
+// rejectCD done the cd with the FAIL state and the diagnosis of the rejection
+func (c *Service) rejectCD(ctx context.Context, cd *v1.CD, diagnosis *v1.Diagnosis) error {
+	common.Printf(ctx, common.WARN, "service cd reject (%s): %s\n", cd.GetName(), diagnosis.Summary)
+	cd.Spec.Done = true
+	cd.Spec.AckStates = []string{v1.FailState}
+	cd.Spec.Diagnosis = diagnosis
+
+	obj, err := tools.InstanceToUnstructured(cd)
+	if err != nil {
+		return err
+	}
+	if _, _, err := c.Apply(ctx, common.YceCloudExtensions, k8s.CD, cd.GetName(), obj, false); err != nil {
+		return fmt.Errorf("reject cd (%s) apply error (%s)", cd.GetName(), err)
+	}
+	return nil
+}
+
+func (c *Service) reconcileCDStorage(ctx context.Context, cd *v1.CD, storageClass string) (string, error) {
 	var isStorage string
 	for _, configVolumes := range cd.Spec.ArtifactInfo.ConfigVolumes {
 		if configVolumes.Kind == "storage" {
@@ -346,10 +380,15 @@ func (c *Service) reconcileCDStorage(cd *v1.CD, storageClass string) (string, er
 }
 
 func NewCDService(cfg *configure.InstallConfigure, dsrc datasource.IDataSource) *Service {
+	provider, err := services.NewCredentialsProvider(dsrc)
+	if err != nil {
+		fmt.Printf("%s service cd load credentials provider error (%s)\n", common.ERROR, err)
+	}
 	return &Service{
 		InstallConfigure: cfg,
 		IDataSource:      dsrc,
 		lastStoneVersion: "0",
 		lastCDVersion:    "0",
+		credentials:      provider,
 	}
 }
@@ -0,0 +1,61 @@
+package cd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// the diagnosis of the image rejected by the signature verification
+const (
+	unsignedImageCategory   = "unsigned-image"
+	untrustedImageCategory  = "untrusted-image"
+	signatureVerifyCategory = "signature-verification"
+	signatureRejectedReason = "SignatureRejected"
+)
+
+// verifyImage the verified digest of the image signed by any public key of the -sign-public-keys configmap,
+// the diagnosis of the image rejected otherwise. The image is rejected too when it can't be verified.
+func (c *Service) verifyImage(ctx context.Context, image string) (string, *v1.Diagnosis) {
+	digest, err := c.verifyImageSignature(ctx, image)
+	if err == nil {
+		common.Printf(ctx, common.INFO, "the signature of the image %s@%s verified\n", image, digest)
+		return digest, nil
+	}
+	category := signatureVerifyCategory
+	switch {
+	case errors.Is(err, registry.ErrImageUnsigned):
+		category = unsignedImageCategory
+	case errors.Is(err, registry.ErrImageUntrusted):
+		category = untrustedImageCategory
+	}
+	return "", &v1.Diagnosis{
+		Category: category,
+		Summary:  fmt.Sprintf("the image %s is rejected (%s)", image, err),
+		Reason:   signatureRejectedReason,
+	}
+}
+
+func (c *Service) verifyImageSignature(ctx context.Context, image string) (string, error) {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.SignPublicKeys)
+	if err != nil {
+		return "", fmt.Errorf("get the public keys configmap %s error (%s)", services.SignPublicKeys, err)
+	}
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	keys, err := registry.ParsePublicKeys(data)
+	if err != nil {
+		return "", fmt.Errorf("load the public keys of %s error (%s)", services.SignPublicKeys, err)
+	}
+	credentials, _, err := registry.LoadCredentials(ctx, c.IDataSource, c.credentials, services.ConfigRegistryUrl, []string{registry.Host(image)})
+	if err != nil {
+		return "", err
+	}
+	return registry.VerifyImageSignature(ctx, image, credentials, services.InsecureRegistryHosts(), keys)
+}
@@ -0,0 +1,37 @@
+package cd
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
+)
+
+func TestRejectCD(t *testing.T) {
+	drs := fake.NewDataSource()
+	c := &Service{IDataSource: drs}
+	// the image can't be verified without the public keys
+	digest, diagnosis := c.verifyImage(context.Background(), "harbor.ym/devops/app:v1")
+	if digest != "" || diagnosis == nil || diagnosis.Category != signatureVerifyCategory || diagnosis.Reason != signatureRejectedReason {
+		t.Fatalf("expected the image rejected, got %v", diagnosis)
+	}
+
+	cd := &v1.CD{Spec: v1.CDSpec{AckStates: []string{v1.SuccessState, v1.FailState}}}
+	cd.SetName("app-test")
+	if err := c.rejectCD(context.Background(), cd, diagnosis); err != nil {
+		t.Fatal(err)
+	}
+	if len(drs.Applied) != 1 {
+		t.Fatalf("expected the cd applied, got %v", drs.Applied)
+	}
+	applied := &v1.CD{}
+	if err := tools.UnstructuredObjectToInstanceObj(drs.Applied[0], applied); err != nil {
+		t.Fatal(err)
+	}
+	if !applied.Spec.Done || len(applied.Spec.AckStates) != 1 || applied.Spec.AckStates[0] != v1.FailState ||
+		applied.Spec.Diagnosis == nil || applied.Spec.Diagnosis.Summary != diagnosis.Summary {
+		t.Fatalf("expected the cd done with the FAIL state, got %v", applied.Spec)
+	}
+}
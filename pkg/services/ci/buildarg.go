@@ -0,0 +1,104 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// buildArgsParam the array param of the task expanded into the building step args
+	buildArgsParam = "$(params.build_args[*])"
+	// buildSecretsWorkspace the optional workspace bound to the build secret of the PipelineRun
+	buildSecretsWorkspace = "build-secrets"
+	// BuildSecretLabel only the Secrets of the ops namespace labeled yce-cloud-extensions/build-secret=true
+	// are mounted into the build, the credentials and the signing key are never mounted
+	BuildSecretLabel = "yce-cloud-extensions/build-secret"
+)
+
+var (
+	buildArgNameRegexp  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	buildSecretIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_][-._A-Za-z0-9]*$`)
+)
+
+// buildArgPairs the sorted KEY=VALUE of the build args
+func buildArgPairs(args map[string]string) ([]string, error) {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		if !buildArgNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("illegal build arg name (%s)", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, args[name]))
+	}
+	return pairs, nil
+}
+
+func validateBuildSecrets(secrets []v1.BuildSecret) error {
+	ids := make(map[string]struct{})
+	for _, secret := range secrets {
+		if !buildSecretIDRegexp.MatchString(secret.ID) {
+			return fmt.Errorf("illegal build secret id (%s)", secret.ID)
+		}
+		if secret.SecretName == "" {
+			return fmt.Errorf("build secret %s secret name is required", secret.ID)
+		}
+		if reservedBuildSecret(secret.SecretName) {
+			return fmt.Errorf("build secret %s is reserved", secret.SecretName)
+		}
+		if _, exist := ids[secret.ID]; exist {
+			return fmt.Errorf("duplicate build secret (%s)", secret.ID)
+		}
+		ids[secret.ID] = struct{}{}
+	}
+	return nil
+}
+
+// reservedBuildSecret the secrets of the credentials, the git and the docker config and the signing key
+func reservedBuildSecret(name string) bool {
+	switch name {
+	case services.SignKeySecret, services.CredentialsSecret, services.TektonGitConfigName, services.TektonDockerConfigName:
+		return true
+	}
+	return false
+}
+
+// buildSecretData copy the base64 encoded value of the referenced keys, keyed by the build secret id.
+// the error only names the secret and the key, the value must not be logged. The secret not labeled
+// as the build secret or labeled as the registry or the git credential is rejected
+func buildSecretData(secrets []v1.BuildSecret, get func(name string) (*unstructured.Unstructured, error)) (map[string]string, error) {
+	result := make(map[string]string, len(secrets))
+	for _, secret := range secrets {
+		obj, err := get(secret.SecretName)
+		if err != nil {
+			return nil, fmt.Errorf("get build secret %s error (%s)", secret.SecretName, err)
+		}
+		labels := obj.GetLabels()
+		if labels[BuildSecretLabel] != "true" || labels[registry.CredentialLabel] == "true" || labels[GitCredentialLabel] == "true" {
+			return nil, rejectf("secret %s is not a build secret, label it %s=true", secret.SecretName, BuildSecretLabel)
+		}
+		key := secret.Key
+		if key == "" {
+			key = secret.ID
+		}
+		value, exist, err := unstructured.NestedString(obj.Object, "data", key)
+		if err != nil || !exist {
+			return nil, rejectf("build secret %s key %s not found", secret.SecretName, key)
+		}
+		result[secret.ID] = value
+	}
+	return result, nil
+}
+
+func buildSecretName(pipelineRunName string) string {
+	return fmt.Sprintf("%s-%s", pipelineRunName, buildSecretsWorkspace)
+}
@@ -0,0 +1,163 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuildArgPairs(t *testing.T) {
+	pairs, err := buildArgPairs(map[string]string{"VERSION": "1.0", "GOPROXY": "https://goproxy.cn,direct"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pairs, []string{"GOPROXY=https://goproxy.cn,direct", "VERSION=1.0"}) {
+		t.Fatalf("unexpected pairs %v", pairs)
+	}
+	if _, err := buildArgPairs(map[string]string{"1VERSION": "1.0"}); err == nil {
+		t.Fatal("expect illegal build arg name error")
+	}
+
+	kaniko, _ := GetBuilder(Kaniko)
+	if args := kaniko.BuildArgs(pairs); args[1] != "--build-arg=VERSION=1.0" {
+		t.Fatalf("unexpected kaniko build args %v", args)
+	}
+	buildKit, _ := GetBuilder(BuildKit)
+	if args := buildKit.BuildArgs(pairs); args[1] != "--opt=build-arg:VERSION=1.0" {
+		t.Fatalf("unexpected buildkit build args %v", args)
+	}
+}
+
+func TestValidateBuildSecrets(t *testing.T) {
+	valid := []v1.BuildSecret{{ID: "npmrc", SecretName: "npm"}, {ID: "settings.xml", SecretName: "maven", Key: "settings"}}
+	if err := validateBuildSecrets(valid); err != nil {
+		t.Fatal(err)
+	}
+	for _, secrets := range [][]v1.BuildSecret{
+		{{ID: "../npmrc", SecretName: "npm"}},
+		{{ID: "npmrc"}},
+		{{ID: "npmrc", SecretName: "npm"}, {ID: "npmrc", SecretName: "yarn"}},
+		{{ID: "cosign.key", SecretName: services.SignKeySecret}},
+		{{ID: "config.json", SecretName: services.TektonDockerConfigName}},
+	} {
+		if err := validateBuildSecrets(secrets); err == nil {
+			t.Fatalf("expect illegal build secrets error %v", secrets)
+		}
+	}
+}
+
+func TestBuildSecretData(t *testing.T) {
+	secrets := map[string]map[string]interface{}{
+		"npm":      {BuildSecretLabel: "true"},
+		"internal": {},
+		"harbor":   {BuildSecretLabel: "true", registry.CredentialLabel: "true"},
+	}
+	get := func(name string) (*unstructured.Unstructured, error) {
+		labels, exist := secrets[name]
+		if !exist {
+			return nil, fmt.Errorf("secret %s not found", name)
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "labels": labels},
+			"data":     map[string]interface{}{"token": "czNjcjN0", "npmrc": "cmVnaXN0cnk="},
+		}}, nil
+	}
+	data, err := buildSecretData([]v1.BuildSecret{{ID: "npmrc", SecretName: "npm"}, {ID: "npm_token", SecretName: "npm", Key: "token"}}, get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"npmrc": "cmVnaXN0cnk=", "npm_token": "czNjcjN0"}) {
+		t.Fatalf("unexpected data %v", data)
+	}
+	if _, err := buildSecretData([]v1.BuildSecret{{ID: "npm_token", SecretName: "npm", Key: "password"}}, get); err == nil {
+		t.Fatal("expect key not found error")
+	}
+	if _, err := buildSecretData([]v1.BuildSecret{{ID: "settings", SecretName: "maven"}}, get); err == nil {
+		t.Fatal("expect secret not found error")
+	}
+	// only the secret opted in as the build secret is mounted
+	for _, name := range []string{"internal", "harbor"} {
+		if _, err := buildSecretData([]v1.BuildSecret{{ID: "npm_token", SecretName: name, Key: "token"}}, get); err == nil {
+			t.Fatalf("expect the secret %s rejected", name)
+		} else if _, ok := err.(*rejectedError); !ok {
+			t.Fatalf("expect the request rejected, got %v", err)
+		}
+	}
+
+	obj, err := services.Render(&params{Namespace: "test", Name: "test-build-secrets", SecretData: data}, secretTpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := unstructured.NestedString(obj.Object, "data", "npm_token"); value != "czNjcjN0" {
+		t.Fatalf("unexpected build secret %v", obj.Object["data"])
+	}
+}
+
+func TestBuildArgsStep(t *testing.T) {
+	opts := BuildOptions{Context: "/src", BuildArgs: true, SecretsDir: "$(workspaces.build-secrets.path)"}
+	kaniko, _ := GetBuilder(Kaniko)
+	if args := kaniko.Step(opts).Args; args[len(args)-1] != buildArgsParam {
+		t.Fatalf("expect the build args param expanded, got %v", args)
+	}
+	for _, name := range []string{BuildKit, Buildah} {
+		builder, _ := GetBuilder(name)
+		step := builder.Step(opts)
+		if !reflect.DeepEqual(step.Args, []string{buildArgsParam}) {
+			t.Fatalf("expect %s script args the build args param, got %v", name, step.Args)
+		}
+		if !strings.Contains(step.Script, `"$@"`) || !strings.Contains(step.Script, `--secret "id=$(basename "$file"),src=$file"`) {
+			t.Fatalf("expect %s build with the args and secrets, got %s", name, step.Script)
+		}
+	}
+	buildah, _ := GetBuilder(Buildah)
+	if step := buildah.Step(BuildOptions{Context: "/src"}); step.Args != nil || strings.Contains(step.Script, "$@") {
+		t.Fatalf("unexpected buildah step %v", step)
+	}
+	if kaniko.MountSecrets() || !buildah.MountSecrets() {
+		t.Fatal("expect the build secrets mounted by buildah and buildkit only")
+	}
+}
+
+func TestBuildArgsPipelineRunRender(t *testing.T) {
+	obj, err := services.Render(&params{
+		Namespace:       "test",
+		Name:            "test",
+		BuildArgs:       []string{"--build-arg=VERSION=1.0", `--build-arg=LABEL="a b"`},
+		BuildSecretName: "test-build-secrets",
+		TektonVersion:   "v1",
+	}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runParams, _, _ := unstructured.NestedSlice(obj.Object, "spec", "params")
+	var buildArgs interface{}
+	for _, item := range runParams {
+		if item.(map[string]interface{})["name"] == "build_args" {
+			buildArgs = item.(map[string]interface{})["value"]
+		}
+	}
+	if !reflect.DeepEqual(buildArgs, []interface{}{"--build-arg=VERSION=1.0", `--build-arg=LABEL="a b"`}) {
+		t.Fatalf("unexpected build args %v", buildArgs)
+	}
+	workspaces, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	if name, _, _ := unstructured.NestedString(workspaces[1].(map[string]interface{}), "secret", "secretName"); name != "test-build-secrets" {
+		t.Fatalf("expect the build secret bound, got %v", workspaces)
+	}
+
+	// without build args the param is an empty array
+	obj, err = services.Render(&params{Namespace: "test", Name: "test", TektonVersion: "v1"}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(obj.Object["spec"])
+	if !strings.Contains(string(data), `{"name":"build_args","value":[]}`) || strings.Contains(string(data), "build-secrets") {
+		t.Fatalf("unexpected pipelineRun spec %s", data)
+	}
+}
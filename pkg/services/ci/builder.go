@@ -0,0 +1,422 @@
+package ci
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	Kaniko   = "kaniko"
+	BuildKit = "buildkit"
+	Buildah  = "buildah"
+)
+
+const (
+	destination = "$(params.dest_repo_url)/$(params.project_name):$(params.project_version)"
+	cacheRepo   = "$(params.cache_repo_url)/$(params.project_name)-cache"
+	dockerfile  = "$(params.dockerfile)"
+)
+
+// BuildOptions the task layout the builder step work on
+type BuildOptions struct {
+	// Context the directory of the source
+	Context string
+	// DigestFile the file to write the pushed image digest, empty if the task has no result
+	DigestFile string
+	// LayerCache push and pull the image layer cache of the -cache-repo
+	LayerCache bool
+	// BuildArgs the task has the build_args param formatted by the builder
+	BuildArgs bool
+	// SecretsDir the directory of the build secret files named by the id, empty if not supported
+	SecretsDir string
+	// DockerConfig the directory of the docker config.json
+	DockerConfig string
+}
+
+// BuildStep the building step of the task, the image is passed by the build_tool_image param
+type BuildStep struct {
+	Command []string
+	Args    []string
+	Script  string
+	Env     []EnvVar
+	// RunAsUser run the step as the uid, zero keep the user of the image
+	RunAsUser int64
+	// Unconfined run the step without the seccomp profile, required by rootless BuildKit
+	Unconfined bool
+}
+
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// Builder generate the step build and push the image
+type Builder interface {
+	Name() string
+	// Image the default builder image
+	Image() string
+	Step(opts BuildOptions) *BuildStep
+	// BuildArgs format the KEY=VALUE pairs as the build args of the builder
+	BuildArgs(pairs []string) []string
+	// Labels format the KEY=VALUE pairs as the image labels of the builder, passed with the build args
+	Labels(pairs []string) []string
+	// MountSecrets the build secrets are mounted by the RUN --mount=type=secret of the Dockerfile
+	MountSecrets() bool
+}
+
+var builders = map[string]Builder{
+	Kaniko:   &kaniko{},
+	BuildKit: &buildKit{},
+	Buildah:  &buildah{},
+}
+
+// GetBuilder the builder registered with the name
+func GetBuilder(name string) (Builder, error) {
+	builder, exist := builders[name]
+	if !exist {
+		return nil, fmt.Errorf("builder %s not supported, available %s", name, strings.Join(BuilderNames(), ","))
+	}
+	return builder, nil
+}
+
+func BuilderNames() []string {
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseProjectBuilders parse the project builders, e.g. "project-a=buildah,project-b=buildkit"
+func ParseProjectBuilders(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal project builder (%s)", item)
+		}
+		if _, err := GetBuilder(kv[1]); err != nil {
+			return nil, err
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+type kaniko struct{}
+
+func (k *kaniko) Name() string  { return Kaniko }
+func (k *kaniko) Image() string { return services.BuildToolImage }
+
+func (k *kaniko) Step(opts BuildOptions) *BuildStep {
+	args := []string{
+		fmt.Sprintf("--dockerfile=%s/%s", opts.Context, dockerfile),
+		fmt.Sprintf("--context=%s", opts.Context),
+		"--insecure",
+		"--force",
+		fmt.Sprintf("--destination=%s", destination),
+		"--skip-tls-verify",
+		"--snapshotMode=time",
+		"--skip-unused-stages=true",
+	}
+	if opts.DigestFile != "" {
+		args = append(args, fmt.Sprintf("--digest-file=%s", opts.DigestFile))
+	}
+	if opts.LayerCache {
+		args = append(args, "--cache=true", fmt.Sprintf("--cache-repo=%s", cacheRepo))
+	}
+	// kaniko can't mount the build secrets, the request with the build secrets is rejected
+	if opts.BuildArgs {
+		args = append(args, buildArgsParam)
+	}
+	return &BuildStep{Args: args}
+}
+
+func (k *kaniko) BuildArgs(pairs []string) []string {
+	return prefixArgs("--build-arg=", pairs)
+}
+
+func (k *kaniko) Labels(pairs []string) []string {
+	return prefixArgs("--label=", pairs)
+}
+
+func (k *kaniko) MountSecrets() bool { return false }
+
+type buildKit struct{}
+
+func (b *buildKit) Name() string  { return BuildKit }
+func (b *buildKit) Image() string { return services.BuildKitImage }
+
+// the rootless buildkitd is started by buildctl-daemonless.sh in the step
+func (b *buildKit) Step(opts BuildOptions) *BuildStep {
+	args := []string{
+		"buildctl-daemonless.sh build",
+		"--frontend dockerfile.v0",
+		fmt.Sprintf(`--local context="%s"`, opts.Context),
+		fmt.Sprintf(`--local dockerfile="$(dirname "%s/%s")"`, opts.Context, dockerfile),
+		fmt.Sprintf(`--opt filename="$(basename "%s")"`, dockerfile),
+		fmt.Sprintf(`--output type=image,name="%s",push=true,registry.insecure=true`, destination),
+	}
+	if opts.LayerCache {
+		args = append(args,
+			fmt.Sprintf(`--export-cache type=registry,mode=max,ref="%s"`, cacheRepo),
+			fmt.Sprintf(`--import-cache type=registry,ref="%s"`, cacheRepo),
+		)
+	}
+	if opts.BuildArgs || opts.SecretsDir != "" {
+		args = append(args, `"$@"`)
+	}
+	script := "#!/bin/sh\nset -e\n" + secretArgsScript(opts.SecretsDir)
+	if opts.DigestFile != "" {
+		args = append(args, "--metadata-file /tmp/metadata.json")
+		script += strings.Join(args, " \\\n  ") + "\n"
+		script += fmt.Sprintf(`sed -n 's/.*"containerimage.digest": *"\([^"]*\)".*/\1/p' /tmp/metadata.json | tr -d '\n' > "%s"`, opts.DigestFile) + "\n"
+	} else {
+		script += strings.Join(args, " \\\n  ") + "\n"
+	}
+
+	return &BuildStep{
+		Args:   scriptArgs(opts),
+		Script: script,
+		Env: []EnvVar{
+			{Name: "BUILDKITD_FLAGS", Value: "--oci-worker-no-process-sandbox"},
+		},
+		RunAsUser:  1000,
+		Unconfined: true,
+	}
+}
+
+func (b *buildKit) BuildArgs(pairs []string) []string {
+	return prefixArgs("--opt=build-arg:", pairs)
+}
+
+func (b *buildKit) Labels(pairs []string) []string {
+	return prefixArgs("--opt=label:", pairs)
+}
+
+func (b *buildKit) MountSecrets() bool { return true }
+
+type buildah struct{}
+
+func (b *buildah) Name() string  { return Buildah }
+func (b *buildah) Image() string { return services.BuildahImage }
+
+// rootless buildah with the vfs storage and chroot isolation
+func (b *buildah) Step(opts BuildOptions) *BuildStep {
+	build := []string{
+		"buildah --storage-driver=vfs bud",
+		"--format=oci",
+		"--tls-verify=false",
+		"--layers",
+		fmt.Sprintf(`-f "%s/%s"`, opts.Context, dockerfile),
+		fmt.Sprintf(`-t "%s"`, destination),
+	}
+	if opts.LayerCache {
+		build = append(build,
+			fmt.Sprintf(`--cache-from "%s"`, cacheRepo),
+			fmt.Sprintf(`--cache-to "%s"`, cacheRepo),
+		)
+	}
+	if opts.BuildArgs || opts.SecretsDir != "" {
+		build = append(build, `"$@"`)
+	}
+	build = append(build, fmt.Sprintf(`"%s"`, opts.Context))
+
+	push := []string{
+		"buildah --storage-driver=vfs push",
+		"--tls-verify=false",
+	}
+	if opts.DigestFile != "" {
+		push = append(push, fmt.Sprintf(`--digestfile "%s"`, opts.DigestFile))
+	}
+	push = append(push, fmt.Sprintf(`"%s"`, destination), fmt.Sprintf(`"docker://%s"`, destination))
+
+	return &BuildStep{
+		Args: scriptArgs(opts),
+		Script: "#!/bin/sh\nset -e\n" + secretArgsScript(opts.SecretsDir) +
+			strings.Join(build, " \\\n  ") + "\n" +
+			strings.Join(push, " \\\n  ") + "\n",
+		Env: []EnvVar{
+			{Name: "BUILDAH_ISOLATION", Value: "chroot"},
+			{Name: "REGISTRY_AUTH_FILE", Value: opts.DockerConfig + "/config.json"},
+		},
+		RunAsUser: 1000,
+	}
+}
+
+func (b *buildah) BuildArgs(pairs []string) []string {
+	return prefixArgs("--build-arg=", pairs)
+}
+
+func (b *buildah) Labels(pairs []string) []string {
+	return prefixArgs("--label=", pairs)
+}
+
+func (b *buildah) MountSecrets() bool { return true }
+
+func prefixArgs(prefix string, items []string) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, prefix+item)
+	}
+	return result
+}
+
+// scriptArgs the args passed to the script of the step as "$@"
+func scriptArgs(opts BuildOptions) []string {
+	if !opts.BuildArgs {
+		return nil
+	}
+	return []string{buildArgsParam}
+}
+
+// secretArgsScript append a --secret id=<file name>,src=<file> to "$@" per file of the dir,
+// the dir is empty when the optional workspace is not bound
+func secretArgsScript(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return fmt.Sprintf(`if [ -d "%[1]s" ]; then
+  for file in "%[1]s"/*; do
+    if [ -f "$file" ]; then
+      set -- "$@" --secret "id=$(basename "$file"),src=$file"
+    fi
+  done
+fi
+`, dir)
+}
+
+// plan the build profile, the builder and the platforms selected for a ci request
+type plan struct {
+	// CIName the ci request of the build
+	CIName string
+	// BranchName the project and branch of the ci request, the runs of the branch are retained together by the gc
+	BranchName string
+	// Owner the ci request own the pipelineRun, nil if the request not created
+	Owner *metav1.OwnerReference
+	*Profile
+	Builder Builder
+	// Platforms the multi-arch build platforms, empty build the platform of the node
+	Platforms []Platform
+	// Images the sub-project images of the monorepo, empty build the image of the project
+	Images  []*ImageBuild
+	Tagging *Tagging
+	// BuildArgs the KEY=VALUE of the request build args, Labels the KEY=VALUE of the image labels
+	BuildArgs []string
+	Labels    []string
+	// BuildSecrets the secrets mounted into the build, the BuildSecretName holds the copied values
+	BuildSecrets    []v1.BuildSecret
+	BuildSecretName string
+	// GitCredentialName the git secret attached to the ServiceAccountName of the pipelineRun,
+	// DockerConfigName the docker config.json of the registries mounted into the build
+	GitCredentialName  string
+	DockerConfigName   string
+	ServiceAccountName string
+	// DependencyCache the volume bound to the dependency-cache workspace, nil cache in the emptyDir of the build
+	DependencyCache *DependencyCache
+	// Pod the timeout, the step resources and the placement of the build pods
+	Pod *v1.BuildPod
+	// SBOM the sbom format of the build profile attached to the pushed images, nil if not set
+	SBOM *SBOMFormat
+	// Scan scan the pushed images by the scan task after the build
+	Scan bool
+	// Sign sign the pushed images by the sign task after the build, after the scan gate if scanned
+	Sign bool
+}
+
+func (p *plan) TaskName() string {
+	return resourceName(p.Profile.Name, p.Builder.Name(), "task")
+}
+
+// BuildTaskNames the pipeline tasks run the build task of the plan
+func (p *plan) BuildTaskNames() []string {
+	result := make([]string, 0)
+	switch {
+	case len(p.Images) > 0:
+		for _, image := range p.Images {
+			result = append(result, image.TaskName())
+		}
+	case len(p.Platforms) > 0:
+		for _, platform := range p.Platforms {
+			result = append(result, platform.TaskName())
+		}
+	default:
+		result = append(result, p.TaskName())
+	}
+	return result
+}
+
+// PipelineName the multi-arch pipeline has a build task per platform, e.g.
+// yce-cloud-extensions-go-linux-amd64-linux-arm64-pipeline, the monorepo pipeline
+// has a build task per image, e.g. yce-cloud-extensions-go-images-3-pipeline
+func (p *plan) PipelineName() string {
+	if len(p.Images) > 0 {
+		return resourceName(p.Profile.Name, p.Builder.Name(), fmt.Sprintf("images-%d-pipeline", len(p.Images)))
+	}
+	if len(p.Platforms) > 0 {
+		return resourceName(p.Profile.Name, p.Builder.Name(), fmt.Sprintf("%s-pipeline", platformsSlug(p.Platforms)))
+	}
+	return resourceName(p.Profile.Name, p.Builder.Name(), "pipeline")
+}
+
+// registryHosts the registries the build push to, the images and the layer cache
+func (p *plan) registryHosts(outputUrl string) []string {
+	hosts := []string{registry.Host(outputUrl)}
+	for _, image := range p.Images {
+		hosts = append(hosts, registry.Host(image.DestRepoUrl))
+	}
+	if p.LayerCache {
+		hosts = append(hosts, registry.Host(services.CacheRepoUrl))
+	}
+	return hosts
+}
+
+func (p *plan) PipelineGraphName() string {
+	return resourceName(p.Profile.Name, p.Builder.Name(), "graph")
+}
+
+// BuilderImage the profile builder image apply to the builder of the profile only
+func (p *plan) BuilderImage() string {
+	profileBuilder := p.Profile.Builder
+	if profileBuilder == "" {
+		profileBuilder = Kaniko
+	}
+	if p.Profile.BuilderImage != "" && profileBuilder == p.Builder.Name() {
+		return p.Profile.BuilderImage
+	}
+	return p.Builder.Image()
+}
+
+// resourceName the kaniko task keep the name before the builder was pluggable
+// e.g. yce-cloud-extensions-task, yce-cloud-extensions-go-buildah-task
+func resourceName(profile, builder, kind string) string {
+	parts := []string{"yce-cloud-extensions"}
+	if profile != DefaultProfile {
+		parts = append(parts, profile)
+	}
+	if builder != Kaniko {
+		parts = append(parts, builder)
+	}
+	return strings.Join(append(parts, kind), "-")
+}
+
+// selectBuilder the first builder set, ordered by request, project, profile and the global
+func selectBuilder(names ...string) string {
+	for _, name := range names {
+		if name != "" {
+			return name
+		}
+	}
+	return Kaniko
+}
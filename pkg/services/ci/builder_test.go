@@ -0,0 +1,100 @@
+package ci
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuilderStep(t *testing.T) {
+	opts := BuildOptions{Context: "/workspace/git", DigestFile: "/tekton/results/image_digest", LayerCache: true}
+
+	args := strings.Join((&kaniko{}).Step(opts).Args, " ")
+	for _, expected := range []string{"--context=/workspace/git", "--digest-file=/tekton/results/image_digest", "--cache-repo="} {
+		if !strings.Contains(args, expected) {
+			t.Fatalf("expect %s in kaniko args (%s)", expected, args)
+		}
+	}
+
+	step := (&buildKit{}).Step(opts)
+	for _, expected := range []string{"buildctl-daemonless.sh build", "--export-cache type=registry", "/tekton/results/image_digest"} {
+		if !strings.Contains(step.Script, expected) {
+			t.Fatalf("expect %s in buildkit script (%s)", expected, step.Script)
+		}
+	}
+	if !step.Unconfined || step.RunAsUser == 0 {
+		t.Fatal("expect rootless buildkit")
+	}
+
+	step = (&buildah{}).Step(BuildOptions{Context: "/workspace/git"})
+	if strings.Contains(step.Script, "--digestfile") || strings.Contains(step.Script, "--cache-from") {
+		t.Fatalf("unexpected buildah script (%s)", step.Script)
+	}
+}
+
+func TestBuilderTaskRender(t *testing.T) {
+	builder, err := GetBuilder(Buildah)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := services.Render(&params{
+		Namespace:     "test",
+		Name:          "test",
+		BuildStep:     builder.Step(BuildOptions{Context: "$(workspaces.source.path)/git", DigestFile: "$(results.image_digest.path)"}),
+		TektonVersion: "v1",
+	}, taskV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, _, _ := unstructured.NestedSlice(obj.Object, "spec", "steps")
+	building := steps[len(steps)-2].(map[string]interface{})
+	if script, _ := building["script"].(string); !strings.Contains(script, `--digestfile "$(results.image_digest.path)"`) {
+		t.Fatalf("unexpected building script %v", building["script"])
+	}
+	if uid, _, _ := unstructured.NestedFieldNoCopy(building, "securityContext", "runAsUser"); fmt.Sprint(uid) != "1000" {
+		t.Fatalf("expect rootless buildah, got %v", building["securityContext"])
+	}
+	env, _, _ := unstructured.NestedSlice(building, "env")
+	if len(env) != 3 {
+		t.Fatalf("expect docker config and buildah env, got %v", env)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	profiles := NewProfiles()
+	buildah, _ := GetBuilder(Buildah)
+	kaniko, _ := GetBuilder(Kaniko)
+
+	p := &plan{Profile: profiles.Get("go"), Builder: buildah}
+	if p.TaskName() != "yce-cloud-extensions-go-buildah-task" {
+		t.Fatalf("unexpected task name %s", p.TaskName())
+	}
+	if p := (&plan{Profile: profiles.Get(""), Builder: kaniko}); p.PipelineName() != services.PipelineName {
+		t.Fatalf("expect kaniko keep the pipeline name, got %s", p.PipelineName())
+	}
+
+	p = &plan{Profile: &Profile{Name: "go", BuilderImage: "kaniko:debug"}, Builder: buildah}
+	if p.BuilderImage() != services.BuildahImage {
+		t.Fatalf("expect the kaniko profile image not used by buildah, got %s", p.BuilderImage())
+	}
+
+	if name := selectBuilder("", "buildkit", Buildah, Kaniko); name != BuildKit {
+		t.Fatalf("expect the project builder, got %s", name)
+	}
+}
+
+func TestParseProjectBuilders(t *testing.T) {
+	result, err := ParseProjectBuilders("project-a=buildah, project-b=buildkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result["project-a"] != Buildah || result["project-b"] != BuildKit {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if _, err := ParseProjectBuilders("project-a=docker"); err == nil {
+		t.Fatal("expect unsupported builder error")
+	}
+}
@@ -0,0 +1,198 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultBuildPod the key of the -build-pod-configmap applied to all the projects
+const DefaultBuildPod = "default"
+
+// tektonFeatureFlags the configmap of the tekton feature gates in the -tekton-namespace
+const tektonFeatureFlags = "feature-flags"
+
+// ParseNodeSelector parse the node labels, e.g. "node-role=build,disktype=ssd"
+func ParseNodeSelector(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal node selector (%s)", item)
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+// BuildPodsFromConfigMap each data key of the configmap is the project name or default, the value is
+// the yaml of the build pod settings, e.g.
+//
+//	timeout: 2h
+//	memRequests: 2Gi
+//	memLimit: 6Gi
+//	tolerations:
+//	  - key: dedicated
+//	    value: build
+//	    effect: NoSchedule
+func BuildPodsFromConfigMap(obj *unstructured.Unstructured) (map[string]*v1.BuildPod, error) {
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*v1.BuildPod)
+	for key, value := range data {
+		pod := &v1.BuildPod{}
+		if err := yaml.UnmarshalStrict([]byte(value), pod); err != nil {
+			return nil, fmt.Errorf("parse build pod %s error (%s)", key, err)
+		}
+		if err := validateBuildPod(pod); err != nil {
+			return nil, fmt.Errorf("build pod %s %s", key, err)
+		}
+		result[key] = pod
+	}
+	return result, nil
+}
+
+func validateBuildPod(pod *v1.BuildPod) error {
+	if pod.Timeout != "" {
+		if timeout, err := time.ParseDuration(pod.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("illegal timeout (%s)", pod.Timeout)
+		}
+	}
+	for _, quantity := range []string{pod.CPURequests, pod.CPULimit, pod.MEMRequests, pod.MEMLimit} {
+		if quantity == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return fmt.Errorf("illegal resource quantity (%s)", quantity)
+		}
+	}
+	for _, toleration := range pod.Tolerations {
+		switch toleration.Operator {
+		case "", "Equal", "Exists":
+		default:
+			return fmt.Errorf("illegal toleration operator (%s)", toleration.Operator)
+		}
+		switch toleration.Effect {
+		case "", "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			return fmt.Errorf("illegal toleration effect (%s)", toleration.Effect)
+		}
+	}
+	return nil
+}
+
+// validateRequestPod the request set the timeout and the compute resources only, the placement
+// of the build pods is set by the flags and the -build-pod-configmap of the operator
+func validateRequestPod(pod *v1.BuildPod) error {
+	if len(pod.NodeSelector) > 0 || len(pod.Tolerations) > 0 || pod.RuntimeClassName != "" {
+		return fmt.Errorf("nodeSelector, tolerations and runtimeClassName are set by the operator only")
+	}
+	return validateBuildPod(pod)
+}
+
+// stepResourcesEnabled the stepSpecs of the taskRunSpecs (stepOverrides before tekton v1) are
+// accepted by tekton with the enable-api-fields alpha or beta only
+func stepResourcesEnabled(apiFields string) bool {
+	return apiFields == "alpha" || apiFields == "beta"
+}
+
+// mergeBuildPods the settings of the later override the former field by field,
+// the node selector is merged by the label and the tolerations are replaced
+func mergeBuildPods(pods ...*v1.BuildPod) *v1.BuildPod {
+	result := &v1.BuildPod{NodeSelector: make(map[string]string)}
+	override := func(dest *string, value string) {
+		if value != "" {
+			*dest = value
+		}
+	}
+	for _, pod := range pods {
+		if pod == nil {
+			continue
+		}
+		override(&result.Timeout, pod.Timeout)
+		override(&result.CPURequests, pod.CPURequests)
+		override(&result.CPULimit, pod.CPULimit)
+		override(&result.MEMRequests, pod.MEMRequests)
+		override(&result.MEMLimit, pod.MEMLimit)
+		override(&result.RuntimeClassName, pod.RuntimeClassName)
+		for key, value := range pod.NodeSelector {
+			result.NodeSelector[key] = value
+		}
+		if len(pod.Tolerations) > 0 {
+			result.Tolerations = pod.Tolerations
+		}
+	}
+	return result
+}
+
+// podTimeout the pipelineRun timeout of the pod settings, e.g. 1h30m0s
+func podTimeout(pod *v1.BuildPod) string {
+	timeout, err := time.ParseDuration(pod.Timeout)
+	if err != nil || timeout <= 0 {
+		return ""
+	}
+	return timeout.String()
+}
+
+// podTemplate the json of the tekton pod template, empty if nothing placed
+func podTemplate(pod *v1.BuildPod) string {
+	template := make(map[string]interface{})
+	if len(pod.NodeSelector) > 0 {
+		template["nodeSelector"] = pod.NodeSelector
+	}
+	if len(pod.Tolerations) > 0 {
+		template["tolerations"] = pod.Tolerations
+	}
+	if pod.RuntimeClassName != "" {
+		template["runtimeClassName"] = pod.RuntimeClassName
+	}
+	if len(template) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(template)
+	return string(data)
+}
+
+// stepResources the json of the compute resources of the build steps, empty if not set
+func stepResources(pod *v1.BuildPod) string {
+	resources := make(map[string]map[string]string)
+	set := func(kind, name, quantity string) {
+		if quantity == "" {
+			return
+		}
+		if resources[kind] == nil {
+			resources[kind] = make(map[string]string)
+		}
+		resources[kind][name] = quantity
+	}
+	set("requests", "cpu", pod.CPURequests)
+	set("requests", "memory", pod.MEMRequests)
+	set("limits", "cpu", pod.CPULimit)
+	set("limits", "memory", pod.MEMLimit)
+	if len(resources) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(resources)
+	return string(data)
+}
+
+// resourceSteps the steps of the build task get the compute resources, the light steps keep the defaults
+func resourceSteps(preBuild []Step) []string {
+	result := make([]string, 0, len(preBuild)+1)
+	for _, step := range preBuild {
+		result = append(result, step.Name)
+	}
+	return append(result, "building")
+}
@@ -0,0 +1,180 @@
+package ci
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuildPodsFromConfigMap(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{
+		DefaultBuildPod: "timeout: 30m\nnodeSelector:\n  node-role: build\n",
+		"mall":          "timeout: 2h\nmemLimit: 6Gi\ntolerations:\n  - key: dedicated\n    value: build\n    effect: NoSchedule\n",
+	}}}
+	pods, err := BuildPodsFromConfigMap(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &v1.BuildPod{MEMLimit: "8Gi", NodeSelector: map[string]string{"disktype": "ssd"}}
+	pod := mergeBuildPods(&v1.BuildPod{Timeout: "1h", CPURequests: "500m"}, pods[DefaultBuildPod], pods["mall"], request)
+	expected := &v1.BuildPod{
+		Timeout:      "2h",
+		CPURequests:  "500m",
+		MEMLimit:     "8Gi",
+		NodeSelector: map[string]string{"node-role": "build", "disktype": "ssd"},
+		Tolerations:  []v1.Toleration{{Key: "dedicated", Value: "build", Effect: "NoSchedule"}},
+	}
+	if !reflect.DeepEqual(pod, expected) {
+		t.Fatalf("expected build pod %v, got %v", expected, pod)
+	}
+	if timeout := podTimeout(pod); timeout != "2h0m0s" {
+		t.Fatalf("unexpected timeout %s", timeout)
+	}
+
+	for _, value := range []string{"timeout: forever", "memLimit: lots", "cpu: 2", "tolerations:\n  - key: a\n    effect: NoRun"} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"mall": value}}}
+		if _, err := BuildPodsFromConfigMap(obj); err == nil {
+			t.Fatalf("expected error of the illegal build pod %s", value)
+		}
+	}
+	if _, err := ParseNodeSelector("node-role=build,=ssd"); err == nil {
+		t.Fatal("expected error of the illegal node selector")
+	}
+}
+
+func TestValidateRequestPod(t *testing.T) {
+	if err := validateRequestPod(&v1.BuildPod{Timeout: "2h", MEMLimit: "8Gi"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range []*v1.BuildPod{
+		{NodeSelector: map[string]string{"disktype": "ssd"}},
+		{Tolerations: []v1.Toleration{{Key: "dedicated", Operator: "Exists"}}},
+		{RuntimeClassName: "runc"},
+		{MEMLimit: "lots"},
+	} {
+		if err := validateRequestPod(pod); err == nil {
+			t.Fatalf("expected the build pod of the request rejected %v", pod)
+		}
+	}
+}
+
+func TestTektonAPIFields(t *testing.T) {
+	drs := fake.NewDataSource()
+	c := &Service{IDataSource: drs}
+	if apiFields, err := c.tektonAPIFields(context.Background()); err != nil || stepResourcesEnabled(apiFields) {
+		t.Fatalf("expected the step resources disabled without the feature flags, got %s (%v)", apiFields, err)
+	}
+	for apiFields, expected := range map[string]bool{"alpha": true, "beta": true, "stable": false} {
+		featureFlags := &unstructured.Unstructured{Object: map[string]interface{}{
+			"data": map[string]interface{}{"enable-api-fields": apiFields},
+		}}
+		featureFlags.SetName(tektonFeatureFlags)
+		drs.Add(k8s.ConfigMap, featureFlags)
+		if actual, err := c.tektonAPIFields(context.Background()); err != nil || stepResourcesEnabled(actual) != expected {
+			t.Fatalf("expected the step resources enabled %v by %s, got %s (%v)", expected, apiFields, actual, err)
+		}
+	}
+}
+
+func TestCheckLegacyFeatures(t *testing.T) {
+	dropped, err := checkLegacyFeatures([]legacyFeature{
+		{Name: "image scan", Required: true},
+		{Name: "multi-arch build", Used: true},
+		{Name: "tagging"},
+		{Name: "step resources", Used: true},
+	})
+	if err != nil || !reflect.DeepEqual(dropped, []string{"multi-arch build", "step resources"}) {
+		t.Fatalf("expected the used optional features dropped, got %v (%v)", dropped, err)
+	}
+	_, err = checkLegacyFeatures([]legacyFeature{
+		{Name: "sbom", Used: true, Required: true},
+		{Name: "image scan", Used: true, Required: true},
+		{Name: "image sign", Required: true},
+		{Name: "tagging", Used: true},
+	})
+	if _, ok := err.(*rejectedError); !ok || !strings.HasPrefix(err.Error(), "sbom, image scan not supported") {
+		t.Fatalf("expected the request of the required features rejected, got %v", err)
+	}
+}
+
+func TestBuildPodPipelineRunRender(t *testing.T) {
+	pod := &v1.BuildPod{
+		Timeout:          "2h",
+		MEMRequests:      "2Gi",
+		MEMLimit:         "6Gi",
+		NodeSelector:     map[string]string{"node-role": "build"},
+		RuntimeClassName: "gvisor",
+	}
+	if resources := stepResources(pod); resources != `{"limits":{"memory":"6Gi"},"requests":{"memory":"2Gi"}}` {
+		t.Fatalf("unexpected step resources %s", resources)
+	}
+	if stepResources(&v1.BuildPod{}) != "" || podTemplate(&v1.BuildPod{}) != "" {
+		t.Fatal("expected nothing rendered without the settings")
+	}
+	p := &params{
+		Namespace:      "test",
+		Name:           "test-run",
+		PipelineName:   "test-pipeline",
+		Timeout:        podTimeout(pod),
+		PodTemplate:    podTemplate(pod),
+		NodeSelector:   pod.NodeSelector,
+		StepResources:  stepResources(pod),
+		ResourceSteps:  resourceSteps([]Step{{Name: "test"}}),
+		BuildTaskNames: []string{"yce-cloud-extensions-go-task"},
+	}
+	for version, fields := range map[string][]string{
+		"v1":      {"taskRunTemplate", "podTemplate", "stepSpecs", "computeResources"},
+		"v1beta1": {"podTemplate", "", "stepOverrides", "resources"},
+	} {
+		p.TektonVersion = version
+		obj, err := services.Render(p, pipelineRunV1Tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := []string{"spec", fields[0], fields[1], "runtimeClassName"}
+		if fields[1] == "" {
+			path = []string{"spec", fields[0], "runtimeClassName"}
+		}
+		if runtimeClass, _, _ := unstructured.NestedString(obj.Object, path...); runtimeClass != "gvisor" {
+			t.Fatalf("expected the %s pod template, got %v", version, obj.Object["spec"])
+		}
+		specs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "taskRunSpecs")
+		if len(specs) != 1 || specs[0].(map[string]interface{})["pipelineTaskName"] != "yce-cloud-extensions-go-task" {
+			t.Fatalf("expected the taskRunSpec of the build task, got %v", specs)
+		}
+		steps, _, _ := unstructured.NestedSlice(specs[0].(map[string]interface{}), fields[2])
+		if len(steps) != 2 || steps[1].(map[string]interface{})["name"] != "building" {
+			t.Fatalf("expected the resources of the pre-build and the building steps, got %v", steps)
+		}
+		if limit, _, _ := unstructured.NestedString(steps[1].(map[string]interface{}), fields[3], "limits", "memory"); limit != "6Gi" {
+			t.Fatalf("unexpected %s step resources %v", version, steps[1])
+		}
+	}
+	p.TektonVersion = "v1beta1"
+	obj, err := services.Render(p, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout, _, _ := unstructured.NestedString(obj.Object, "spec", "timeout"); timeout != "2h0m0s" {
+		t.Fatalf("unexpected timeout %s", timeout)
+	}
+
+	p.TektonVersion = "v1"
+	p.Platforms, _ = ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	obj, err = services.Render(p, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "taskRunSpecs")
+	selector, _, _ := unstructured.NestedStringMap(specs[1].(map[string]interface{}), "podTemplate", "nodeSelector")
+	if len(specs) != 2 || !reflect.DeepEqual(selector, map[string]string{"node-role": "build", "kubernetes.io/os": "linux", "kubernetes.io/arch": "arm64"}) {
+		t.Fatalf("expected the node selector of the platform merged, got %v", specs)
+	}
+}
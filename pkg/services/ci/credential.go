@@ -0,0 +1,153 @@
+package ci
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The git credential registry, the Secrets of the ops namespace labeled
+// yce-cloud-extensions/git-credential=true, e.g.
+//
+//	metadata:
+//	  labels:
+//	    yce-cloud-extensions/git-credential: "true"
+//	  annotations:
+//	    yce-cloud-extensions/git-host: git.ym
+//	    yce-cloud-extensions/git-path-prefix: devops/backend
+//	type: kubernetes.io/ssh-auth
+//	data:
+//	  ssh-privatekey: ...
+//	  known_hosts: ...
+const (
+	GitCredentialLabel            = "yce-cloud-extensions/git-credential"
+	GitHostAnnotation             = "yce-cloud-extensions/git-host"
+	GitPathPrefixAnnotation       = "yce-cloud-extensions/git-path-prefix"
+	basicAuthSecretType           = "kubernetes.io/basic-auth"
+	sshAuthSecretType             = "kubernetes.io/ssh-auth"
+	knownHostsKey                 = "known_hosts"
+	gitCredentialSecretNameSuffix = "git-credential"
+)
+
+// GitCredential a basic-auth or ssh-auth secret of the git host, apply to the repositories under the path prefix
+type GitCredential struct {
+	SecretName string
+	Host       string
+	PathPrefix string
+	SSH        bool
+	// Data the base64 encoded data of the secret
+	Data map[string]string
+}
+
+// HasKnownHosts tekton skip the host key checking of the ssh credential without known_hosts
+func (g *GitCredential) HasKnownHosts() bool {
+	return g.Data[knownHostsKey] != ""
+}
+
+// gitRemote the host and the repository path of a git url
+type gitRemote struct {
+	Scheme string
+	Host   string
+	Path   string
+	SSH    bool
+}
+
+// TektonURL the url of the tekton.dev/git-0 annotation, the ssh host has no scheme
+func (r *gitRemote) TektonURL() string {
+	if r.SSH {
+		return r.Host
+	}
+	return fmt.Sprintf("%s://%s", r.Scheme, r.Host)
+}
+
+// parseGitURL support http(s)://host/path, ssh://user@host:port/path and the scp-like user@host:path
+func parseGitURL(gitURL string) (*gitRemote, error) {
+	gitURL = strings.TrimSpace(gitURL)
+	if !strings.Contains(gitURL, "://") {
+		at := strings.Index(gitURL, "@")
+		colon := strings.Index(gitURL, ":")
+		if colon < 0 || at > colon {
+			return nil, fmt.Errorf("illegal git url (%s)", gitURL)
+		}
+		return &gitRemote{
+			Scheme: "ssh",
+			Host:   strings.ToLower(gitURL[at+1 : colon]),
+			Path:   repositoryPath(gitURL[colon+1:]),
+			SSH:    true,
+		}, nil
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil {
+		return nil, fmt.Errorf("illegal git url (%s)", gitURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "ssh":
+	default:
+		return nil, fmt.Errorf("git url scheme %s not supported", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("illegal git url (%s)", gitURL)
+	}
+	return &gitRemote{
+		Scheme: u.Scheme,
+		Host:   strings.ToLower(u.Host),
+		Path:   repositoryPath(u.Path),
+		SSH:    u.Scheme == "ssh",
+	}, nil
+}
+
+func repositoryPath(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// GitCredentialsFromSecrets the credentials of the labeled secrets, the secret without host or
+// of the type not supported is ignored
+func GitCredentialsFromSecrets(items []unstructured.Unstructured) []*GitCredential {
+	result := make([]*GitCredential, 0, len(items))
+	for _, item := range items {
+		annotations := item.GetAnnotations()
+		host := strings.ToLower(strings.TrimSpace(annotations[GitHostAnnotation]))
+		if host == "" {
+			continue
+		}
+		secretType, _, _ := unstructured.NestedString(item.Object, "type")
+		if secretType != basicAuthSecretType && secretType != sshAuthSecretType {
+			continue
+		}
+		data, _, _ := unstructured.NestedStringMap(item.Object, "data")
+		result = append(result, &GitCredential{
+			SecretName: item.GetName(),
+			Host:       host,
+			PathPrefix: strings.Trim(annotations[GitPathPrefixAnnotation], "/"),
+			SSH:        secretType == sshAuthSecretType,
+			Data:       data,
+		})
+	}
+	return result
+}
+
+// matchGitCredential the credential of the same host and the auth type with the longest path prefix
+// of the repository, the prefix match the whole path segment, e.g. devops match devops/app but not devops2/app
+func matchGitCredential(credentials []*GitCredential, remote *gitRemote) *GitCredential {
+	var result *GitCredential
+	for _, credential := range credentials {
+		if credential.Host != remote.Host || credential.SSH != remote.SSH {
+			continue
+		}
+		prefix := credential.PathPrefix
+		if prefix != "" && remote.Path != prefix && !strings.HasPrefix(remote.Path, prefix+"/") {
+			continue
+		}
+		if result == nil || len(prefix) > len(result.PathPrefix) ||
+			(len(prefix) == len(result.PathPrefix) && credential.SecretName < result.SecretName) {
+			result = credential
+		}
+	}
+	return result
+}
+
+func gitCredentialSecretName(pipelineRunName string) string {
+	return fmt.Sprintf("%s-%s", pipelineRunName, gitCredentialSecretNameSuffix)
+}
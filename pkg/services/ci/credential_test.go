@@ -0,0 +1,142 @@
+package ci
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseGitURL(t *testing.T) {
+	for gitURL, expected := range map[string]gitRemote{
+		"https://Git.ym/devops/backend/app.git": {Scheme: "https", Host: "git.ym", Path: "devops/backend/app"},
+		"http://git.ym:8080/devops/app":         {Scheme: "http", Host: "git.ym:8080", Path: "devops/app"},
+		"ssh://git@git.ym:2222/devops/app.git":  {Scheme: "ssh", Host: "git.ym:2222", Path: "devops/app", SSH: true},
+		"git@git.ym:devops/app.git":             {Scheme: "ssh", Host: "git.ym", Path: "devops/app", SSH: true},
+	} {
+		remote, err := parseGitURL(gitURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *remote != expected {
+			t.Fatalf("unexpected remote %v of %s", remote, gitURL)
+		}
+	}
+	for _, gitURL := range []string{"git.ym/devops/app", "ftp://git.ym/devops/app"} {
+		if _, err := parseGitURL(gitURL); err == nil {
+			t.Fatalf("expect illegal git url %s", gitURL)
+		}
+	}
+
+	remote, _ := parseGitURL("git@git.ym:devops/app.git")
+	if remote.TektonURL() != "git.ym" {
+		t.Fatalf("unexpected ssh tekton url %s", remote.TektonURL())
+	}
+	remote, _ = parseGitURL("https://git.ym/devops/app.git")
+	if remote.TektonURL() != "https://git.ym" {
+		t.Fatalf("unexpected https tekton url %s", remote.TektonURL())
+	}
+}
+
+func credentialSecret(name, secretType, host, prefix string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"type": secretType,
+		"data": map[string]interface{}{"password": "cGFzc3dvcmQ="},
+	}}
+	obj.SetName(name)
+	obj.SetAnnotations(map[string]string{GitHostAnnotation: host, GitPathPrefixAnnotation: prefix})
+	return obj
+}
+
+func TestMatchGitCredential(t *testing.T) {
+	credentials := GitCredentialsFromSecrets([]unstructured.Unstructured{
+		credentialSecret("git-ym", basicAuthSecretType, "git.ym", ""),
+		credentialSecret("devops", basicAuthSecretType, "git.ym", "/devops/"),
+		credentialSecret("devops-backend", basicAuthSecretType, "git.ym", "devops/backend"),
+		credentialSecret("devops-deploy-key", sshAuthSecretType, "git.ym", "devops"),
+		credentialSecret("no-host", basicAuthSecretType, "", ""),
+		credentialSecret("opaque", "Opaque", "git.ym", ""),
+	})
+	if len(credentials) != 4 {
+		t.Fatalf("expect the secrets without host or of other types ignored, got %d", len(credentials))
+	}
+	for gitURL, expected := range map[string]string{
+		"https://git.ym/devops/backend/app.git": "devops-backend",
+		"https://git.ym/devops/frontend.git":    "devops",
+		"https://git.ym/devops2/app.git":        "git-ym",
+		"git@git.ym:devops/backend/app.git":     "devops-deploy-key",
+		"https://github.com/devops/app.git":     "",
+		"git@git.ym:ops/app.git":                "",
+	} {
+		remote, _ := parseGitURL(gitURL)
+		credential := matchGitCredential(credentials, remote)
+		name := ""
+		if credential != nil {
+			name = credential.SecretName
+		}
+		if name != expected {
+			t.Fatalf("expect %s match %q, got %q", gitURL, expected, name)
+		}
+	}
+}
+
+func TestGitCredentialRender(t *testing.T) {
+	obj, err := services.Render(&params{
+		Namespace:        "test",
+		Name:             gitCredentialSecretName("test"),
+		SecretType:       sshAuthSecretType,
+		SecretData:       map[string]string{"ssh-privatekey": "a2V5", knownHostsKey: "aG9zdHM="},
+		GitCredentialUrl: "git.ym:2222",
+	}, gitCredentialTpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetAnnotations()["tekton.dev/git-0"] != "git.ym:2222" || obj.GetName() != "test-git-credential" {
+		t.Fatalf("unexpected git credential %v", obj.Object["metadata"])
+	}
+	if value, _, _ := unstructured.NestedString(obj.Object, "data", knownHostsKey); value != "aG9zdHM=" {
+		t.Fatalf("unexpected git credential data %v", obj.Object["data"])
+	}
+
+	obj, err = services.Render(&params{
+		Namespace:             "test",
+		Name:                  "test",
+		ServiceAccountSecrets: []string{"test-git-credential", services.TektonDockerConfigName},
+	}, serviceAccountTpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets, _, _ := unstructured.NestedSlice(obj.Object, "secrets"); len(secrets) != 2 {
+		t.Fatalf("unexpected service account secrets %v", obj.Object["secrets"])
+	}
+	run, err := services.Render(&params{Namespace: "test", Name: "test", ServiceAccountName: "test", TektonVersion: "v1"}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa, _, _ := unstructured.NestedString(run.Object, "spec", "taskRunTemplate", "serviceAccountName"); sa != "test" {
+		t.Fatalf("expect the pipelineRun service account, got %v", run.Object["spec"])
+	}
+}
+
+func TestServiceAccountSecretsApplied(t *testing.T) {
+	stale := &unstructured.Unstructured{Object: map[string]interface{}{
+		"secrets": []interface{}{map[string]interface{}{"name": "rotated-git-credential"}},
+	}}
+	stale.SetName("demo-master")
+	drs := fake.NewDataSource().Add(k8s.ServiceAccount, stale)
+	c := &Service{IDataSource: drs}
+	if _, err := c.checkAndRecreateServiceAccount(context.Background(), "demo-master", []string{"demo-git-credential"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(drs.Applied) != 1 {
+		t.Fatalf("expected the existing service account applied, got %d", len(drs.Applied))
+	}
+	secrets, _, _ := unstructured.NestedSlice(drs.Applied[0].Object, "secrets")
+	if !reflect.DeepEqual(secrets, []interface{}{map[string]interface{}{"name": "demo-git-credential"}}) {
+		t.Fatalf("expected the desired secrets only, got %v", secrets)
+	}
+}
@@ -0,0 +1,142 @@
+package ci
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// the -dependency-cache volume shared by the builds of a project or of a profile
+const (
+	CacheScopeProject = "project"
+	CacheScopeProfile = "profile"
+)
+
+const (
+	// DependencyCacheLabel the label of the dependency cache volumes collected by the gc
+	DependencyCacheLabel = "yce-cloud-extensions/dependency-cache"
+	// CacheProfileLabel the profile of the cache paths stored in the volume
+	CacheProfileLabel = "yce-cloud-extensions/cache-profile"
+	// LastUsedAnnotation the time of the last build bound the volume, the least recently used is deleted first
+	LastUsedAnnotation = "yce-cloud-extensions/last-used"
+)
+
+// the access modes of the dependency cache volume, the builds on the different nodes share the ReadWriteMany volume only
+const (
+	CacheReadWriteOnce = "ReadWriteOnce"
+	CacheReadWriteMany = "ReadWriteMany"
+)
+
+const (
+	dependencyCacheWorkspace = "dependency-cache"
+	// dependencyCacheGCInterval the interval of the volumes collected over the -dependency-cache-total-size
+	dependencyCacheGCInterval = 10 * time.Minute
+	// dependencyCacheMinIdle the volume used within the pipelineRun timeout may be bound by a running build
+	dependencyCacheMinIdle = 2 * time.Hour
+	// dependencyCacheUsage the percentage of the volume kept by the cache entries, the rest for the entry being saved
+	dependencyCacheUsage = 90
+)
+
+// DependencyCache the volume of the dependency caches bound to the dependency-cache workspace of the build,
+// the cache paths are restored from and saved to the entry keyed by the hash of the lockfiles
+type DependencyCache struct {
+	// Name the name of the PersistentVolumeClaim
+	Name         string
+	Profile      string
+	Size         string
+	StorageClass string
+	// AccessMode the access mode of the volume created, ReadWriteOnce by default
+	AccessMode string
+	// Lockfiles the files of the project path hashed into the cache key
+	Lockfiles []string
+	// SizeLimit the KiB of the cache entries, the least recently used entries are evicted beyond
+	SizeLimit int64
+}
+
+// NewDependencyCache the cache volume of the profile and the project by the scope, nil if the profile cache nothing
+func NewDependencyCache(scope string, profile *Profile, gitURL, size, storageClass string) (*DependencyCache, error) {
+	if len(profile.CachePaths) == 0 {
+		return nil, nil
+	}
+	if profile.CacheSize != "" {
+		size = profile.CacheSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil || quantity.Sign() <= 0 {
+		return nil, fmt.Errorf("illegal dependency cache size (%s)", size)
+	}
+	name := fmt.Sprintf("yce-cloud-extensions-cache-%s", profile.Name)
+	switch scope {
+	case CacheScopeProfile:
+	case CacheScopeProject:
+		sum := sha256.Sum256([]byte(strings.TrimSuffix(strings.TrimSpace(gitURL), ".git")))
+		name = fmt.Sprintf("%s-%x", name, sum[:5])
+	default:
+		return nil, fmt.Errorf("dependency cache scope %s not supported", scope)
+	}
+	return &DependencyCache{
+		Name:         name,
+		Profile:      profile.Name,
+		Size:         quantity.String(),
+		StorageClass: storageClass,
+		AccessMode:   CacheReadWriteOnce,
+		Lockfiles:    profile.Lockfiles,
+		SizeLimit:    quantity.Value() / 1024 * dependencyCacheUsage / 100,
+	}, nil
+}
+
+// SetAccessMode the access mode of the volume, ReadWriteOnce|ReadWriteMany
+func (d *DependencyCache) SetAccessMode(mode string) error {
+	switch mode {
+	case CacheReadWriteOnce, CacheReadWriteMany:
+		d.AccessMode = mode
+		return nil
+	}
+	return fmt.Errorf("dependency cache access mode %s not supported", mode)
+}
+
+// LockfileList the lockfiles separated by space for the task param
+func (d *DependencyCache) LockfileList() string { return strings.Join(d.Lockfiles, " ") }
+
+// evictDependencyCaches the volumes of the least recently used caches deleted until the total size is under the limit,
+// the volume used within the min idle is kept even though over the limit
+func evictDependencyCaches(items []unstructured.Unstructured, total int64, now time.Time) []string {
+	type volume struct {
+		name     string
+		size     int64
+		lastUsed time.Time
+	}
+	volumes := make([]volume, 0, len(items))
+	for _, item := range items {
+		if item.GetDeletionTimestamp() != nil {
+			continue
+		}
+		lastUsed := item.GetCreationTimestamp().Time
+		if value, err := time.Parse(time.RFC3339, item.GetAnnotations()[LastUsedAnnotation]); err == nil {
+			lastUsed = value
+		}
+		storage, _, _ := unstructured.NestedString(item.Object, "spec", "resources", "requests", "storage")
+		quantity, err := resource.ParseQuantity(storage)
+		if err != nil {
+			continue
+		}
+		volumes = append(volumes, volume{name: item.GetName(), size: quantity.Value(), lastUsed: lastUsed})
+	}
+	sort.SliceStable(volumes, func(i, j int) bool { return volumes[i].lastUsed.After(volumes[j].lastUsed) })
+
+	result := make([]string, 0)
+	var used int64
+	for _, item := range volumes {
+		used += item.size
+		if used > total && now.Sub(item.lastUsed) >= dependencyCacheMinIdle {
+			result = append(result, item.name)
+			used -= item.size
+		}
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package ci
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewDependencyCache(t *testing.T) {
+	profile := NewProfiles().Get("java-maven")
+	cache, err := NewDependencyCache(CacheScopeProject, profile, "http://git.ym/devops/mall.git", "5Gi", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cache.Name, "yce-cloud-extensions-cache-java-maven-") || cache.Size != "5Gi" || cache.LockfileList() != "pom.xml" {
+		t.Fatalf("unexpected dependency cache %v", cache)
+	}
+	if cache.SizeLimit != 5*1024*1024*dependencyCacheUsage/100 {
+		t.Fatalf("unexpected size limit %d", cache.SizeLimit)
+	}
+	other, _ := NewDependencyCache(CacheScopeProject, profile, "http://git.ym/devops/order", "5Gi", "")
+	same, _ := NewDependencyCache(CacheScopeProject, profile, "http://git.ym/devops/mall", "5Gi", "")
+	if other.Name == cache.Name || same.Name != cache.Name {
+		t.Fatalf("expected the cache of the project, got %s %s %s", cache.Name, other.Name, same.Name)
+	}
+
+	cache, err = NewDependencyCache(CacheScopeProfile, &Profile{Name: "go", CachePaths: []string{"/go/pkg/mod"}, CacheSize: "20Gi"}, "http://git.ym/devops/mall.git", "5Gi", "fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Name != "yce-cloud-extensions-cache-go" || cache.Size != "20Gi" || cache.StorageClass != "fast" {
+		t.Fatalf("unexpected profile dependency cache %v", cache)
+	}
+
+	if cache, err := NewDependencyCache(CacheScopeProject, NewProfiles().Get(DefaultProfile), "http://git.ym/devops/mall.git", "5Gi", ""); err != nil || cache != nil {
+		t.Fatalf("expected no cache of the profile without cache paths, got %v (%v)", cache, err)
+	}
+	if _, err := NewDependencyCache("branch", profile, "http://git.ym/devops/mall.git", "5Gi", ""); err == nil {
+		t.Fatal("expected error of the scope not supported")
+	}
+	if _, err := NewDependencyCache(CacheScopeProject, profile, "http://git.ym/devops/mall.git", "0", ""); err == nil {
+		t.Fatal("expected error of the illegal size")
+	}
+}
+
+func TestEvictDependencyCaches(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	volume := func(name, size string, lastUsed time.Time) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"storage": size}}},
+		}}
+		obj.SetName(name)
+		obj.SetAnnotations(map[string]string{LastUsedAnnotation: lastUsed.Format(time.RFC3339)})
+		return obj
+	}
+	deleting := volume("deleting", "10Gi", now.Add(-48*time.Hour))
+	deleting.SetDeletionTimestamp(&metav1.Time{Time: now})
+	items := []unstructured.Unstructured{
+		volume("old", "10Gi", now.Add(-72*time.Hour)),
+		volume("recent", "10Gi", now.Add(-time.Minute)),
+		volume("idle", "10Gi", now.Add(-24*time.Hour)),
+		volume("running", "10Gi", now.Add(-30*time.Minute)),
+		deleting,
+	}
+	evicted := evictDependencyCaches(items, 15*1024*1024*1024, now)
+	if !reflect.DeepEqual(evicted, []string{"idle", "old"}) {
+		t.Fatalf("expected the least recently used idle caches evicted, got %v", evicted)
+	}
+	if evicted := evictDependencyCaches(items, 100*1024*1024*1024, now); len(evicted) != 0 {
+		t.Fatalf("expected nothing evicted under the total size, got %v", evicted)
+	}
+}
+
+func TestDependencyCacheConstructor(t *testing.T) {
+	cache, err := NewDependencyCache(CacheScopeProfile, NewProfiles().Get("node"), "", "5Gi", "fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := services.Render(&params{Namespace: "test", DependencyCache: cache, LastUsed: "2021-03-01T12:00:00Z"}, dependencyCacheTpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetLabels()[DependencyCacheLabel] != "true" || obj.GetAnnotations()[LastUsedAnnotation] != "2021-03-01T12:00:00Z" {
+		t.Fatalf("unexpected dependency cache metadata %v", obj.Object["metadata"])
+	}
+	if class, _, _ := unstructured.NestedString(obj.Object, "spec", "storageClassName"); class != "fast" {
+		t.Fatalf("unexpected storage class %s", class)
+	}
+	if modes, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "accessModes"); !reflect.DeepEqual(modes, []string{CacheReadWriteOnce}) {
+		t.Fatalf("expected the ReadWriteOnce volume by default, got %v", modes)
+	}
+	if err := cache.SetAccessMode("ReadOnlyMany"); err == nil {
+		t.Fatal("expected error of the access mode not supported")
+	}
+	if err := cache.SetAccessMode(CacheReadWriteMany); err != nil {
+		t.Fatal(err)
+	}
+	if obj, err = services.Render(&params{Namespace: "test", DependencyCache: cache, LastUsed: "2021-03-01T12:00:00Z"}, dependencyCacheTpl); err != nil {
+		t.Fatal(err)
+	}
+	if modes, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "accessModes"); !reflect.DeepEqual(modes, []string{CacheReadWriteMany}) {
+		t.Fatalf("expected the ReadWriteMany volume, got %v", modes)
+	}
+
+	obj, err = services.Render(&params{
+		Namespace:       "test",
+		Name:            "test-run",
+		PipelineName:    "test-pipeline",
+		DependencyCache: cache,
+		TektonVersion:   "v1",
+	}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	runParams, _, _ := unstructured.NestedSlice(obj.Object, "spec", "params")
+	for _, param := range runParams {
+		values[param.(map[string]interface{})["name"].(string)] = param.(map[string]interface{})["value"]
+	}
+	if values["cache_lockfiles"] != "package-lock.json yarn.lock pnpm-lock.yaml" || values["cache_size_limit"] != "4718592" {
+		t.Fatalf("unexpected dependency cache params %v", values)
+	}
+	workspaces, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	claim, _, _ := unstructured.NestedString(workspaces[len(workspaces)-1].(map[string]interface{}), "persistentVolumeClaim", "claimName")
+	if claim != cache.Name {
+		t.Fatalf("expected the dependency cache bound, got %v", workspaces)
+	}
+
+	obj, err = services.Render(&params{Namespace: "test", Name: "test-pipeline", TaskName: "test-task", TektonVersion: "v1"}, pipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+	bindings, _, _ := unstructured.NestedSlice(tasks[0].(map[string]interface{}), "workspaces")
+	if bindings[len(bindings)-1].(map[string]interface{})["workspace"] != dependencyCacheWorkspace {
+		t.Fatalf("expected the dependency cache workspace bound to the task, got %v", bindings)
+	}
+}
@@ -0,0 +1,169 @@
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// the api of the git host compare the commits
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+const (
+	// githubMaxCompareFiles the github compare api list 300 files at most, the files beyond are unknown
+	githubMaxCompareFiles = 300
+	gitApiTimeout         = 30 * time.Second
+)
+
+// ParseGitProviders parse the api provider of the git hosts, e.g. "git.ym=gitlab,github.com=github"
+func ParseGitProviders(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal git provider (%s)", item)
+		}
+		switch kv[1] {
+		case GitHub, GitLab:
+		default:
+			return nil, fmt.Errorf("git provider %s not supported", kv[1])
+		}
+		result[strings.ToLower(kv[0])] = kv[1]
+	}
+	return result, nil
+}
+
+// gitProvider the api provider of the host, github.com is github and the others gitlab if not set
+func gitProvider(providers map[string]string, host string) string {
+	if provider, exist := providers[host]; exist {
+		return provider
+	}
+	if host == "github.com" {
+		return GitHub
+	}
+	return GitLab
+}
+
+// gitCompare list the changed files between the commits through the api of the git provider
+type gitCompare struct {
+	provider string
+	remote   *gitRemote
+	token    string
+	client   *resty.Client
+}
+
+// newGitCompare the token is the password of the git account, the ssh remote use the https api of the host
+func newGitCompare(provider string, remote *gitRemote, token string) *gitCompare {
+	return &gitCompare{
+		provider: provider,
+		remote:   apiRemote(remote),
+		token:    token,
+		client:   resty.New().SetTimeout(gitApiTimeout),
+	}
+}
+
+// apiRemote the http remote of the git url, the ssh port is not the port of the api
+func apiRemote(remote *gitRemote) *gitRemote {
+	if !remote.SSH {
+		return remote
+	}
+	host := remote.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return &gitRemote{Scheme: "https", Host: host, Path: remote.Path}
+}
+
+// changedFiles the files added, modified, deleted or renamed from the commit to the commit
+func (g *gitCompare) changedFiles(ctx context.Context, from, to string) ([]string, error) {
+	if g.provider == GitHub {
+		return g.github(ctx, from, to)
+	}
+	return g.gitlab(ctx, from, to)
+}
+
+func (g *gitCompare) github(ctx context.Context, from, to string) ([]string, error) {
+	api := fmt.Sprintf("%s://%s/api/v3", g.remote.Scheme, g.remote.Host)
+	if g.remote.Host == "github.com" {
+		api = "https://api.github.com"
+	}
+	request := g.client.NewRequest().SetContext(ctx).SetHeader("Accept", "application/vnd.github.v3+json")
+	if g.token != "" {
+		request.SetAuthToken(g.token)
+	}
+	response, err := request.Get(fmt.Sprintf("%s/repos/%s/compare/%s...%s", api, g.remote.Path, from, to))
+	if err != nil {
+		return nil, fmt.Errorf("compare %s commits error (%s)", g.remote.Path, err)
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("compare %s commits response code (%d)", g.remote.Path, response.StatusCode())
+	}
+	compare := &struct {
+		Files []struct {
+			Filename         string `json:"filename"`
+			PreviousFilename string `json:"previous_filename"`
+		} `json:"files"`
+	}{}
+	if err := json.Unmarshal(response.Body(), compare); err != nil {
+		return nil, fmt.Errorf("illegal compare response of %s", g.remote.Path)
+	}
+	if len(compare.Files) >= githubMaxCompareFiles {
+		return nil, fmt.Errorf("compare %s commits changed too many files", g.remote.Path)
+	}
+	files := make([]string, 0, len(compare.Files))
+	for _, file := range compare.Files {
+		files = append(files, file.Filename)
+		if file.PreviousFilename != "" {
+			files = append(files, file.PreviousFilename)
+		}
+	}
+	return files, nil
+}
+
+func (g *gitCompare) gitlab(ctx context.Context, from, to string) ([]string, error) {
+	request := g.client.NewRequest().
+		SetContext(ctx).
+		SetQueryParams(map[string]string{"from": from, "to": to})
+	if g.token != "" {
+		request.SetHeader("PRIVATE-TOKEN", g.token)
+	}
+	response, err := request.Get(fmt.Sprintf("%s://%s/api/v4/projects/%s/repository/compare",
+		g.remote.Scheme, g.remote.Host, url.PathEscape(g.remote.Path)))
+	if err != nil {
+		return nil, fmt.Errorf("compare %s commits error (%s)", g.remote.Path, err)
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("compare %s commits response code (%d)", g.remote.Path, response.StatusCode())
+	}
+	compare := &struct {
+		Diffs []struct {
+			OldPath string `json:"old_path"`
+			NewPath string `json:"new_path"`
+		} `json:"diffs"`
+	}{}
+	if err := json.Unmarshal(response.Body(), compare); err != nil {
+		return nil, fmt.Errorf("illegal compare response of %s", g.remote.Path)
+	}
+	files := make([]string, 0, len(compare.Diffs))
+	for _, diff := range compare.Diffs {
+		files = append(files, diff.NewPath)
+		if diff.OldPath != "" && diff.OldPath != diff.NewPath {
+			files = append(files, diff.OldPath)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,32 @@
+package ci
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the labels of the built image, the image of the commit built with the same labels is not rebuilt
+const (
+	CommitLabel      = "yce-cloud-extensions.commit"
+	ProjectPathLabel = "yce-cloud-extensions.project-path"
+	ProjectFileLabel = "yce-cloud-extensions.project-file"
+)
+
+// buildLabels the labels of the image built of the commit, the project path and the project file of the request
+func buildLabels(commitID, projectPath, projectFile string) map[string]string {
+	return map[string]string{
+		CommitLabel:      commitID,
+		ProjectPathLabel: projectPath,
+		ProjectFileLabel: projectFile,
+	}
+}
+
+// labelPairs the KEY=VALUE of the labels in the key order
+func labelPairs(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
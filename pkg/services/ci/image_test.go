@@ -0,0 +1,24 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilderLabels(t *testing.T) {
+	pairs := labelPairs(buildLabels("b8f3c2a1", "service-a", "Dockerfile"))
+	expected := []string{
+		"yce-cloud-extensions.commit=b8f3c2a1",
+		"yce-cloud-extensions.project-file=Dockerfile",
+		"yce-cloud-extensions.project-path=service-a",
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Fatalf("expected label pairs %v, got %v", expected, pairs)
+	}
+	for name, prefix := range map[string]string{Kaniko: "--label=", BuildKit: "--opt=label:", Buildah: "--label="} {
+		builder, _ := GetBuilder(name)
+		if args := builder.Labels(pairs[:1]); len(args) != 1 || args[0] != prefix+pairs[0] {
+			t.Fatalf("unexpected %s label args %v", name, args)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ci
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
+)
+
+// imagesWorkspaceSize the size of the source workspace shared by the image builds if -workspace-size not set,
+// the emptyDir of a task pod can't be shared
+const imagesWorkspaceSize = "1Gi"
+
+// ImageBuild a sub-project image of the monorepo pipeline
+type ImageBuild struct {
+	Index int
+	// ProjectName the image name, the base of the project path
+	ProjectName string
+	ProjectPath string
+	ProjectFile string
+	DestRepoUrl string
+	// Labels the image labels, BuildArgs the build args and the labels formatted by the builder
+	Labels    map[string]string
+	BuildArgs []string
+}
+
+// TaskName the pipeline task build the image, e.g. build-image-0
+func (i *ImageBuild) TaskName() string {
+	return fmt.Sprintf("build-image-%d", i.Index)
+}
+
+// ScanTaskName the pipeline task scan the pushed image, e.g. scan-image-0
+func (i *ImageBuild) ScanTaskName() string {
+	return fmt.Sprintf("%s-image-%d", ScanTask, i.Index)
+}
+
+// SignTaskName the pipeline task sign the pushed image, e.g. sign-image-0
+func (i *ImageBuild) SignTaskName() string {
+	return fmt.Sprintf("%s-image-%d", SignTask, i.Index)
+}
+
+// SBOMTaskName the pipeline task attach the sbom to the pushed image, e.g. sbom-image-0
+func (i *ImageBuild) SBOMTaskName() string {
+	return fmt.Sprintf("%s-image-%d", SBOMTask, i.Index)
+}
+
+// SBOMResult the pipeline result of the sbom artifact reference
+func (i *ImageBuild) SBOMResult() string {
+	return fmt.Sprintf("%s-%s", i.TaskName(), sbomResult)
+}
+
+// DigestResult the pipeline result of the pushed image digest
+func (i *ImageBuild) DigestResult() string {
+	return fmt.Sprintf("%s-image_digest", i.TaskName())
+}
+
+// TagsResult the pipeline result of the pushed tags
+func (i *ImageBuild) TagsResult() string {
+	return fmt.Sprintf("%s-tags", i.TaskName())
+}
+
+// SubDir the sub_dir param checked by the checkdocker step
+func (i *ImageBuild) SubDir() string {
+	if i.ProjectPath == "" {
+		return "*"
+	}
+	return i.ProjectPath
+}
+
+// imageName the image of the sub-project is named by the base of the project path, the project of the root
+func imageName(projectPath, project string) string {
+	projectPath = strings.Trim(strings.TrimSpace(projectPath), "/")
+	if projectPath == "" || projectPath == "." {
+		return project
+	}
+	return strings.ToLower(path.Base(projectPath))
+}
+
+// NewImageBuilds the images of the request in order, the project file default to the dockerfile
+// of the project path, the image pushed to the same repository twice is rejected
+func NewImageBuilds(images []v1.CIImage, project, output, dockerfile, commitID string) ([]*ImageBuild, error) {
+	seen := make(map[string]struct{})
+	result := make([]*ImageBuild, 0, len(images))
+	for index, image := range images {
+		build := &ImageBuild{
+			Index:       index,
+			ProjectName: imageName(image.ProjectPath, project),
+			ProjectPath: strings.Trim(strings.TrimSpace(image.ProjectPath), "/"),
+			ProjectFile: strings.TrimSpace(image.ProjectFile),
+			DestRepoUrl: strings.TrimSpace(image.Output),
+		}
+		if build.ProjectFile == "" {
+			build.ProjectFile = path.Join(build.ProjectPath, dockerfile)
+		}
+		if build.DestRepoUrl == "" {
+			build.DestRepoUrl = output
+		}
+		ref := registry.NewImageRef(build.DestRepoUrl, build.ProjectName, "")
+		repository := fmt.Sprintf("%s/%s", ref.Host, ref.Repository)
+		if _, exist := seen[repository]; exist {
+			return nil, fmt.Errorf("image %s of project path %s duplicated", repository, image.ProjectPath)
+		}
+		seen[repository] = struct{}{}
+		build.Labels = buildLabels(commitID, build.ProjectPath, build.ProjectFile)
+		result = append(result, build)
+	}
+	return result, nil
+}
+
+// imageResults the result of each image of the finished pipelineRun, the image without
+// digest was not pushed and take the ack state of the pipelineRun. the images resolved
+// before the build, e.g. unchanged, are not built by the pipelineRun
+func imageResults(pipelineRunJSON string, images []v1.CIImage, notPushed string) []v1.CIImage {
+	result := make([]v1.CIImage, 0, len(images))
+	index := 0
+	for _, image := range images {
+		if image.AckState != "" {
+			result = append(result, image)
+			continue
+		}
+		build := &ImageBuild{Index: index}
+		index++
+		image.ImageDigest = pipelineRunResult(pipelineRunJSON, build.DigestResult())
+		image.Tags = strings.Fields(pipelineRunResult(pipelineRunJSON, build.TagsResult()))
+		image.SBOM = pipelineRunResult(pipelineRunJSON, build.SBOMResult())
+		image.AckState = v1.SuccessState
+		if image.ImageDigest == "" {
+			image.AckState, image.Tags, image.SBOM = notPushed, nil, ""
+		}
+		result = append(result, image)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewImageBuilds(t *testing.T) {
+	images := []v1.CIImage{
+		{ProjectPath: "services/order/"},
+		{ProjectPath: "services/Payment", ProjectFile: "build/payment.Dockerfile", Output: "harbor.ym/payment"},
+		{ProjectPath: ""},
+	}
+	builds, err := NewImageBuilds(images, "mall", "harbor.ym/devops", "Dockerfile", "b8f3c2a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ImageBuild{
+		{Index: 0, ProjectName: "order", ProjectPath: "services/order", ProjectFile: "services/order/Dockerfile", DestRepoUrl: "harbor.ym/devops"},
+		{Index: 1, ProjectName: "payment", ProjectPath: "services/Payment", ProjectFile: "build/payment.Dockerfile", DestRepoUrl: "harbor.ym/payment"},
+		{Index: 2, ProjectName: "mall", ProjectPath: "", ProjectFile: "Dockerfile", DestRepoUrl: "harbor.ym/devops"},
+	}
+	for index, build := range builds {
+		labels := build.Labels
+		build.Labels = nil
+		if !reflect.DeepEqual(*build, expected[index]) {
+			t.Fatalf("expected image build %v, got %v", expected[index], *build)
+		}
+		if labels[ProjectPathLabel] != build.ProjectPath || labels[ProjectFileLabel] != build.ProjectFile || labels[CommitLabel] != "b8f3c2a1" {
+			t.Fatalf("unexpected labels %v", labels)
+		}
+	}
+	if builds[2].SubDir() != "*" || builds[1].TaskName() != "build-image-1" || builds[1].DigestResult() != "build-image-1-image_digest" {
+		t.Fatalf("unexpected image build names of %v", builds)
+	}
+
+	// the images of the same name pushed to the same repository
+	if _, err := NewImageBuilds([]v1.CIImage{{ProjectPath: "a/api"}, {ProjectPath: "b/api"}}, "mall", "harbor.ym/devops", "Dockerfile", ""); err == nil {
+		t.Fatal("expected error of the duplicated images")
+	}
+	if _, err := NewImageBuilds([]v1.CIImage{{ProjectPath: "a/api"}, {ProjectPath: "b/api", Output: "harbor.ym/b"}}, "mall", "harbor.ym/devops", "Dockerfile", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageResults(t *testing.T) {
+	pipelineRunJSON := `{"status":{"results":[
+		{"name":"build-image-0-image_digest","value":"sha256:a"},
+		{"name":"build-image-0-tags","value":"b8f3c2a1 latest"}
+	]}}`
+	images := []v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}
+	results := imageResults(pipelineRunJSON, images, v1.FailState)
+	expected := []v1.CIImage{
+		{ProjectPath: "order", AckState: v1.SuccessState, ImageDigest: "sha256:a", Tags: []string{"b8f3c2a1", "latest"}},
+		{ProjectPath: "payment", AckState: v1.FailState},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected image results %v, got %v", expected, results)
+	}
+}
+
+func TestImagesPipelineV1Constructor(t *testing.T) {
+	builds, err := NewImageBuilds([]v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}, "mall", "harbor.ym/devops", "Dockerfile", "b8f3c2a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := services.Render(&params{
+		Namespace:        "test",
+		Name:             "test-pipeline",
+		TaskName:         "test-task",
+		Images:           builds,
+		GitCloneTaskName: services.GitCloneTaskName,
+		TektonVersion:    "v1",
+	}, imagesPipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+	names := make([]string, 0)
+	for _, task := range tasks[1:] {
+		names = append(names, task.(map[string]interface{})["name"].(string))
+		if runAfter, _, _ := unstructured.NestedStringSlice(task.(map[string]interface{}), "runAfter"); !reflect.DeepEqual(runAfter, []string{"clone"}) {
+			t.Fatalf("expected the image task run after the clone, got %v", runAfter)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"build-image-0", "build-image-1"}) {
+		t.Fatalf("unexpected image tasks %v", names)
+	}
+	results, _, _ := unstructured.NestedSlice(obj.Object, "spec", "results")
+	if len(results) != 5 || results[3].(map[string]interface{})["value"] != "$(tasks.build-image-1.results.image_digest)" {
+		t.Fatalf("unexpected pipeline results %v", results)
+	}
+
+	builds[1].BuildArgs = []string{"--label=yce-cloud-extensions.project-path=payment"}
+	obj, err = services.Render(&params{
+		Namespace:     "test",
+		Name:          "test-run",
+		PipelineName:  "test-pipeline",
+		Images:        builds,
+		TektonVersion: "v1",
+	}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	runParams, _, _ := unstructured.NestedSlice(obj.Object, "spec", "params")
+	for _, param := range runParams {
+		values[param.(map[string]interface{})["name"].(string)] = param.(map[string]interface{})["value"]
+	}
+	if values["project_name_1"] != "payment" || values["dockerfile_1"] != "payment/Dockerfile" || values["sub_dir_0"] != "order" {
+		t.Fatalf("unexpected image params %v", values)
+	}
+	if !reflect.DeepEqual(values["build_args_1"], []interface{}{"--label=yce-cloud-extensions.project-path=payment"}) {
+		t.Fatalf("unexpected image build args %v", values["build_args_1"])
+	}
+
+	p := &params{Namespace: "test", Name: services.GitCloneTaskName, TektonVersion: "v1"}
+	if _, err := services.Render(p, gitCloneTaskV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,149 @@
+package ci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// BuildRecord the last successful build of the image of a project path, stored in the configmap
+// of -path-filter keyed by the project path of the branch built into the output
+type BuildRecord struct {
+	GitURL      string   `json:"gitUrl"`
+	Branch      string   `json:"branch"`
+	ProjectPath string   `json:"projectPath"`
+	ProjectFile string   `json:"projectFile"`
+	Output      string   `json:"output"`
+	CommitID    string   `json:"commitId"`
+	ImageDigest string   `json:"imageDigest"`
+	Tags        []string `json:"tags"`
+}
+
+// Key the configmap key of the record
+func (r *BuildRecord) Key() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{r.GitURL, r.Branch, r.ProjectPath, r.ProjectFile, r.Output}, "\n")))
+	return fmt.Sprintf("%x", sum[:10])
+}
+
+// BuildRecordsFromConfigMap the records of the configmap by the key, the illegal one is ignored
+func BuildRecordsFromConfigMap(obj *unstructured.Unstructured) map[string]*BuildRecord {
+	result := make(map[string]*BuildRecord)
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	for key, value := range data {
+		record := &BuildRecord{}
+		if err := json.Unmarshal([]byte(value), record); err != nil {
+			continue
+		}
+		result[key] = record
+	}
+	return result
+}
+
+// ciBuildRecords the records of the ci result, a record per image of the monorepo build in order
+func ciBuildRecords(ci *v1.CI) []*BuildRecord {
+	record := func(projectPath, projectFile, output string) *BuildRecord {
+		return &BuildRecord{
+			GitURL:      stringValue(ci.Spec.GitURL),
+			Branch:      stringValue(ci.Spec.Branch),
+			ProjectPath: strings.Trim(strings.TrimSpace(projectPath), "/"),
+			ProjectFile: strings.TrimSpace(projectFile),
+			Output:      strings.TrimSpace(output),
+			CommitID:    stringValue(ci.Spec.CommitID),
+		}
+	}
+	if len(ci.Spec.Images) == 0 {
+		result := record(ci.Spec.ProjectPath, ci.Spec.ProjectFile, stringValue(ci.Spec.Output))
+		result.ImageDigest, result.Tags = ci.Spec.ImageDigest, ci.Spec.Tags
+		return []*BuildRecord{result}
+	}
+	result := make([]*BuildRecord, 0, len(ci.Spec.Images))
+	for _, image := range ci.Spec.Images {
+		item := record(image.ProjectPath, image.ProjectFile, image.Output)
+		if image.AckState == v1.SuccessState {
+			item.ImageDigest, item.Tags = image.ImageDigest, image.Tags
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// splitPaths the comma separated paths
+func splitPaths(s string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// watchPaths the project path, the dockerfile and the watch paths rebuild the image if changed
+func watchPaths(projectPath, projectFile string, extra ...[]string) []string {
+	result := []string{projectPath, projectFile}
+	for _, paths := range extra {
+		result = append(result, paths...)
+	}
+	return result
+}
+
+// pathsChanged any of the files under the paths, the empty path is the root of the repository
+func pathsChanged(files, paths []string) bool {
+	for _, watched := range paths {
+		watched = path.Clean(strings.Trim(strings.TrimSpace(watched), "/"))
+		if watched == "." {
+			if len(files) > 0 {
+				return true
+			}
+			continue
+		}
+		for _, file := range files {
+			if file == watched || strings.HasPrefix(file, watched+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changeSet the files changed since the commits of the records, compared once per commit
+type changeSet struct {
+	commitID string
+	compare  func(from, to string) ([]string, error)
+	files    map[string][]string
+}
+
+func newChangeSet(commitID string, compare func(from, to string) ([]string, error)) *changeSet {
+	return &changeSet{commitID: commitID, compare: compare, files: make(map[string][]string)}
+}
+
+// unchanged nothing under the paths changed since the successful build of the record
+func (c *changeSet) unchanged(record *BuildRecord, paths []string) (bool, error) {
+	if record == nil || record.CommitID == "" || record.ImageDigest == "" {
+		return false, nil
+	}
+	if record.CommitID == c.commitID {
+		return true, nil
+	}
+	files, exist := c.files[record.CommitID]
+	if !exist {
+		var err error
+		if files, err = c.compare(record.CommitID, c.commitID); err != nil {
+			return false, err
+		}
+		c.files[record.CommitID] = files
+	}
+	return !pathsChanged(files, paths), nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
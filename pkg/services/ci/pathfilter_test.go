@@ -0,0 +1,208 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPathsChanged(t *testing.T) {
+	files := []string{"services/order/main.go", "libs/common/log.go", "README.md"}
+	for _, tc := range []struct {
+		paths    []string
+		expected bool
+	}{
+		{[]string{"services/order"}, true},
+		{[]string{"services/order/"}, true},
+		{[]string{"services/payment", "services/payment/Dockerfile"}, false},
+		{[]string{"services/payment", "libs/common"}, true},
+		{[]string{"services/ord"}, false},
+		{[]string{"README.md"}, true},
+		{[]string{""}, true},
+	} {
+		if changed := pathsChanged(files, tc.paths); changed != tc.expected {
+			t.Fatalf("expected changed %v of %v, got %v", tc.expected, tc.paths, changed)
+		}
+	}
+	if pathsChanged(nil, []string{""}) {
+		t.Fatal("expected the root unchanged without changed files")
+	}
+}
+
+func TestChangeSet(t *testing.T) {
+	compared := 0
+	changes := newChangeSet("c3", func(from, to string) ([]string, error) {
+		compared++
+		if from == "bad" {
+			return nil, fmt.Errorf("unknown commit %s", from)
+		}
+		return []string{"services/order/main.go"}, nil
+	})
+	record := &BuildRecord{CommitID: "c1", ImageDigest: "sha256:a"}
+	for path, expected := range map[string]bool{"services/order": false, "services/payment": true} {
+		unchanged, err := changes.unchanged(record, []string{path})
+		if err != nil || unchanged != expected {
+			t.Fatalf("expected %s unchanged %v, got %v (%v)", path, expected, unchanged, err)
+		}
+	}
+	if compared != 1 {
+		t.Fatalf("expected the commits compared once, got %d", compared)
+	}
+	if unchanged, _ := changes.unchanged(&BuildRecord{CommitID: "c3", ImageDigest: "sha256:a"}, []string{"services/order"}); !unchanged {
+		t.Fatal("expected the same commit unchanged")
+	}
+	for _, record := range []*BuildRecord{nil, {CommitID: "c1"}} {
+		if unchanged, _ := changes.unchanged(record, []string{"services/payment"}); unchanged {
+			t.Fatalf("expected the build without record rebuilt, got unchanged of %v", record)
+		}
+	}
+	if _, err := changes.unchanged(&BuildRecord{CommitID: "bad", ImageDigest: "sha256:a"}, nil); err == nil {
+		t.Fatal("expected error of the compare")
+	}
+}
+
+func TestCIBuildRecords(t *testing.T) {
+	gitUrl, branch, commitID, output := "http://git.ym/devops/mall.git", "master", "c3", "harbor.ym/devops"
+	ci := &v1.CI{Spec: v1.CISpec{
+		GitURL: &gitUrl, Branch: &branch, CommitID: &commitID, Output: &output,
+		ProjectPath: "/services/order/", ImageDigest: "sha256:a", Tags: []string{"c3"},
+	}}
+	records := ciBuildRecords(ci)
+	if len(records) != 1 || records[0].ProjectPath != "services/order" || records[0].ImageDigest != "sha256:a" {
+		t.Fatalf("unexpected build records %v", records)
+	}
+
+	ci.Spec.Images = []v1.CIImage{
+		{ProjectPath: "services/order", AckState: v1.SuccessState, ImageDigest: "sha256:a"},
+		{ProjectPath: "services/payment", AckState: v1.FailState},
+	}
+	records = ciBuildRecords(ci)
+	if len(records) != 2 || records[0].ImageDigest != "sha256:a" || records[1].ImageDigest != "" {
+		t.Fatalf("unexpected image build records %v", records)
+	}
+	if records[0].Key() != ciBuildRecords(ci)[0].Key() || records[0].Key() == records[1].Key() {
+		t.Fatal("expected the record key of the project path")
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{
+		records[0].Key(): `{"projectPath":"services/order","commitId":"c3","imageDigest":"sha256:a"}`,
+		"illegal":        "{",
+	}}}
+	stored := BuildRecordsFromConfigMap(obj)
+	if len(stored) != 1 || stored[records[0].Key()].CommitID != "c3" {
+		t.Fatalf("unexpected stored build records %v", stored)
+	}
+}
+
+func TestImageResultsResolved(t *testing.T) {
+	pipelineRunJSON := `{"status":{"results":[{"name":"build-image-0-image_digest","value":"sha256:b"}]}}`
+	images := []v1.CIImage{
+		{ProjectPath: "order", AckState: v1.SuccessState, ImageDigest: "sha256:a"},
+		{ProjectPath: "payment"},
+	}
+	results := imageResults(pipelineRunJSON, images, v1.SuccessState)
+	if results[0].ImageDigest != "sha256:a" || results[1].ImageDigest != "sha256:b" {
+		t.Fatalf("expected the unchanged image kept and the built image of the first task, got %v", results)
+	}
+
+	ci := &v1.CI{Spec: v1.CISpec{Images: images}}
+	setBuiltImages(ci, []v1.CIImage{{AckState: v1.SuccessState, ImageDigest: "sha256:c"}})
+	if ci.Spec.Images[0].ImageDigest != "sha256:a" || ci.Spec.Images[1].ImageDigest != "sha256:c" || !ci.Spec.Done {
+		t.Fatalf("expected the reused image of the unresolved image, got %v", ci.Spec.Images)
+	}
+}
+
+func TestGitCompare(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch {
+		case r.URL.EscapedPath() == "/api/v4/projects/devops%2Fmall/repository/compare":
+			if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"diffs":[{"old_path":"a/old.go","new_path":"a/new.go"},{"old_path":"b/main.go","new_path":"b/main.go"}]}`)
+		case r.URL.Path == "/api/v3/repos/devops/mall/compare/c1...c3":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"files":[{"filename":"a/new.go","previous_filename":"a/old.go"},{"filename":"b/main.go"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	remote, err := parseGitURL(server.URL + "/devops/mall.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a/new.go", "a/old.go", "b/main.go"}
+	for _, provider := range []string{GitLab, GitHub} {
+		files, err := newGitCompare(provider, remote, "secret").changedFiles(context.Background(), "c1", "c3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Fatalf("expected %s changed files %v, got %v", provider, expected, files)
+		}
+		if _, err := newGitCompare(provider, remote, "wrong").changedFiles(context.Background(), "c1", "c3"); err == nil {
+			t.Fatalf("expected %s error of the wrong token", provider)
+		}
+	}
+	if requests[0] != "/api/v4/projects/devops%2Fmall/repository/compare?from=c1&to=c3" {
+		t.Fatalf("unexpected gitlab request %s", requests[0])
+	}
+}
+
+func TestGitProviders(t *testing.T) {
+	providers, err := ParseGitProviders("git.ym=gitlab, GHE.example.com=github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, expected := range map[string]string{"git.ym": GitLab, "ghe.example.com": GitHub, "github.com": GitHub, "other.ym": GitLab} {
+		if provider := gitProvider(providers, host); provider != expected {
+			t.Fatalf("expected provider of %s %s, got %s", host, expected, provider)
+		}
+	}
+	if _, err := ParseGitProviders("git.ym=gitea"); err == nil {
+		t.Fatal("expected error of the provider not supported")
+	}
+	if remote := apiRemote(&gitRemote{Scheme: "ssh", Host: "git.ym:2222", Path: "devops/mall", SSH: true}); remote.Host != "git.ym" || remote.Scheme != "https" {
+		t.Fatalf("unexpected api remote %v", remote)
+	}
+}
+
+func TestRecordBuildsConflict(t *testing.T) {
+	records := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"other": "{}"}}}
+	records.SetName(services.BuildRecordsName)
+	drs := fake.NewDataSource().Add(k8s.ConfigMap, records)
+	drs.Conflicts = 2
+	c := &Service{IDataSource: drs}
+
+	pathFilter := services.PathFilter
+	defer func() { services.PathFilter = pathFilter }()
+	services.PathFilter = true
+	gitURL, branch, commitID := "http://git.ym/devops/app.git", "master", "b8f3c2a1"
+	ci := &v1.CI{Spec: v1.CISpec{GitURL: &gitURL, Branch: &branch, CommitID: &commitID, ImageDigest: "sha256:abc"}}
+	c.recordBuilds(context.Background(), ci)
+
+	if drs.Conflicts != 0 || len(drs.Applied) != 1 {
+		t.Fatalf("expected the records saved after the conflicts, got %d updates", len(drs.Applied))
+	}
+	saved := BuildRecordsFromConfigMap(drs.Object(k8s.ConfigMap, services.BuildRecordsName))
+	if _, exist := saved["other"]; !exist || saved[ciBuildRecords(ci)[0].Key()] == nil {
+		t.Fatalf("expected the records merged, got %v", saved)
+	}
+}
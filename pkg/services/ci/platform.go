@@ -0,0 +1,69 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var platformRegexp = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9]+(/[a-z0-9]+)?$`)
+
+// Platform the target platform of a multi-arch build, e.g. linux/arm64/v8
+type Platform struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Arch, p.Variant)
+	}
+	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+}
+
+// Slug the platform used in the pipeline task name and the image tag, e.g. linux-arm64-v8
+func (p Platform) Slug() string {
+	return strings.Replace(p.String(), "/", "-", -1)
+}
+
+// TaskName the pipeline task build the image of the platform
+func (p Platform) TaskName() string {
+	return fmt.Sprintf("build-%s", p.Slug())
+}
+
+// ParsePlatforms parse, deduplicate and sort the platforms of the ci request
+func ParsePlatforms(items []string) ([]Platform, error) {
+	seen := make(map[string]struct{})
+	result := make([]Platform, 0)
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if !platformRegexp.MatchString(item) {
+			return nil, fmt.Errorf("illegal platform (%s), expect os/arch[/variant]", item)
+		}
+		if _, exist := seen[item]; exist {
+			continue
+		}
+		seen[item] = struct{}{}
+		parts := strings.Split(item, "/")
+		platform := Platform{OS: parts[0], Arch: parts[1]}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		result = append(result, platform)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result, nil
+}
+
+func platformsSlug(platforms []Platform) string {
+	slugs := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		slugs = append(slugs, platform.Slug())
+	}
+	return strings.Join(slugs, "-")
+}
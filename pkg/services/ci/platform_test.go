@@ -0,0 +1,90 @@
+package ci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	platforms, err := ParsePlatforms([]string{"linux/arm64", " linux/amd64", "linux/arm64", "linux/arm/v7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if platformsSlug(platforms) != "linux-amd64-linux-arm-v7-linux-arm64" {
+		t.Fatalf("unexpected platforms %v", platforms)
+	}
+	if platforms[1].Variant != "v7" || platforms[1].TaskName() != "build-linux-arm-v7" {
+		t.Fatalf("unexpected platform %v", platforms[1])
+	}
+	if _, err := ParsePlatforms([]string{"arm64"}); err == nil {
+		t.Fatal("expect illegal platform error")
+	}
+}
+
+func TestMultiArchPipelineRender(t *testing.T) {
+	platforms, _ := ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	obj, err := services.Render(&params{
+		Namespace:        "test",
+		Name:             "test",
+		TaskName:         "yce-cloud-extensions-task",
+		Platforms:        platforms,
+		ManifestTaskName: services.ManifestTaskName,
+		TektonVersion:    "v1",
+	}, multiArchPipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+	if len(tasks) != 3 {
+		t.Fatalf("expect a task per platform and the manifest task, got %v", tasks)
+	}
+	manifest := tasks[2].(map[string]interface{})
+	manifestParams, _, _ := unstructured.NestedSlice(manifest, "params")
+	images := manifestParams[1].(map[string]interface{})["value"].(string)
+	if len(strings.Fields(images)) != 2 || !strings.Contains(images, "-linux-arm64@$(tasks.build-linux-arm64.results.image_digest)") {
+		t.Fatalf("unexpected manifest images (%s)", images)
+	}
+	results, _, _ := unstructured.NestedSlice(obj.Object, "spec", "results")
+	if results[1].(map[string]interface{})["value"] != "$(tasks.manifest.results.image_digest)" {
+		t.Fatalf("expect the image index digest result, got %v", results)
+	}
+
+	if _, err := services.Render(&params{Namespace: "test", Name: "test", TektonVersion: "v1"}, manifestTaskV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiArchPipelineRunRender(t *testing.T) {
+	platforms, _ := ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	for version, field := range map[string]string{"v1": "podTemplate", "v1beta1": "taskPodTemplate"} {
+		obj, err := services.Render(&params{Namespace: "test", Name: "test", Platforms: platforms, TektonVersion: version}, pipelineRunV1Tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		specs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "taskRunSpecs")
+		if len(specs) != 2 {
+			t.Fatalf("expect a taskRunSpec per platform, got %v", specs)
+		}
+		arch, _, _ := unstructured.NestedString(specs[1].(map[string]interface{}), field, "nodeSelector", "kubernetes.io/arch")
+		if arch != "arm64" {
+			t.Fatalf("expect %s arm64 nodeSelector on %s, got %v", field, version, specs[1])
+		}
+	}
+}
+
+func TestPipelineRunResult(t *testing.T) {
+	v1 := `{"status":{"results":[{"name":"commit","value":"abc"},{"name":"image_digest","value":"sha256:1234\n"}]}}`
+	if digest := pipelineRunResult(v1, "image_digest"); digest != "sha256:1234" {
+		t.Fatalf("unexpected digest %s", digest)
+	}
+	v1beta1 := `{"status":{"pipelineResults":[{"name":"image_digest","value":"sha256:5678"}]}}`
+	if digest := pipelineRunResult(v1beta1, "image_digest"); digest != "sha256:5678" {
+		t.Fatalf("unexpected digest %s", digest)
+	}
+	if digest := pipelineRunResult(`{"status":{}}`, "image_digest"); digest != "" {
+		t.Fatalf("unexpected digest %s", digest)
+	}
+}
@@ -0,0 +1,289 @@
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultProfile the profile used when the code type has no profile registered
+const DefaultProfile = "default"
+
+var profileNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Profile describe how to build a language, the Task of the profile is rendered from it.
+// e.g.
+//
+//	name: go
+//	dockerfile: Dockerfile
+//	layerCache: true
+//	cachePaths: ["/go/pkg/mod"]
+//	lockfiles: ["go.sum"]
+//	cacheSize: 10Gi
+//	sbom: spdx
+//	preBuild:
+//	  - name: test
+//	    image: golang:1.15
+//	    script: go test ./...
+type Profile struct {
+	Name string `json:"name"`
+	// Builder the image builder of the profile, use -builder if not set
+	Builder string `json:"builder,omitempty"`
+	// BuilderImage the image of the profile builder, use the builder default image if not set
+	BuilderImage string `json:"builderImage,omitempty"`
+	// Dockerfile the Dockerfile used when the ci request not specify one
+	Dockerfile string `json:"dockerfile,omitempty"`
+	// LayerCache push and pull the image layer cache of the -cache-repo
+	LayerCache bool `json:"layerCache,omitempty"`
+	// CachePaths the dependency directories mounted into the pre-build and build steps
+	CachePaths []string `json:"cachePaths,omitempty"`
+	// Lockfiles the files of the project path hashed into the key of the -dependency-cache
+	Lockfiles []string `json:"lockfiles,omitempty"`
+	// CacheSize the volume size of the -dependency-cache, use -dependency-cache-size if not set
+	CacheSize string `json:"cacheSize,omitempty"`
+	// SBOM the format of the software bill of materials attached to the pushed image spdx|cyclonedx, none if not set
+	SBOM string `json:"sbom,omitempty"`
+	// PreBuild the steps run in the source directory before the image build
+	PreBuild []Step `json:"preBuild,omitempty"`
+}
+
+type Step struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Script string `json:"script"`
+}
+
+// the steps rendered by the task template
+var reservedStepNames = []string{"git-clone", "checkdocker", "cache-restore", "building", "cache-save", "tagging"}
+
+func (p *Profile) validate() error {
+	if !profileNameRegexp.MatchString(p.Name) {
+		return fmt.Errorf("illegal profile name (%s)", p.Name)
+	}
+	if p.Builder != "" {
+		if _, err := GetBuilder(p.Builder); err != nil {
+			return fmt.Errorf("profile %s %s", p.Name, err)
+		}
+	}
+	steps := make(map[string]struct{})
+	for _, step := range p.PreBuild {
+		if step.Name == "" || step.Image == "" {
+			return fmt.Errorf("profile %s pre-build step name and image are required", p.Name)
+		}
+		if !profileNameRegexp.MatchString(step.Name) {
+			return fmt.Errorf("profile %s illegal pre-build step name (%s)", p.Name, step.Name)
+		}
+		for _, reserved := range reservedStepNames {
+			if step.Name == reserved {
+				return fmt.Errorf("profile %s pre-build step name (%s) is reserved", p.Name, step.Name)
+			}
+		}
+		if _, exist := steps[step.Name]; exist {
+			return fmt.Errorf("profile %s duplicate pre-build step (%s)", p.Name, step.Name)
+		}
+		steps[step.Name] = struct{}{}
+	}
+	for _, path := range p.CachePaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("profile %s cache path must be absolute (%s)", p.Name, path)
+		}
+	}
+	for _, lockfile := range p.Lockfiles {
+		if lockfile == "" || filepath.IsAbs(lockfile) || strings.HasPrefix(filepath.Clean(lockfile), "..") {
+			return fmt.Errorf("profile %s lockfile must be relative to the project path (%s)", p.Name, lockfile)
+		}
+	}
+	if _, err := GetSBOMFormat(p.SBOM); err != nil {
+		return fmt.Errorf("profile %s %s", p.Name, err)
+	}
+	if p.CacheSize != "" {
+		if _, err := resource.ParseQuantity(p.CacheSize); err != nil {
+			return fmt.Errorf("profile %s illegal cache size (%s)", p.Name, p.CacheSize)
+		}
+	}
+	return nil
+}
+
+func (p *Profile) TaskName() string { return resourceName(p.Name, Kaniko, "task") }
+
+func (p *Profile) PipelineName() string { return resourceName(p.Name, Kaniko, "pipeline") }
+
+func (p *Profile) PipelineGraphName() string { return resourceName(p.Name, Kaniko, "graph") }
+
+// the profiles work without any configure, the configured profile with the same name replace it
+var builtinProfiles = []*Profile{
+	{Name: DefaultProfile, Dockerfile: "Dockerfile", LayerCache: true},
+	{Name: "java-maven", Dockerfile: "Dockerfile", CachePaths: []string{"/root/.m2"},
+		Lockfiles: []string{"pom.xml"}},
+	{Name: "java-gradle", Dockerfile: "Dockerfile", LayerCache: true, CachePaths: []string{"/root/.gradle"},
+		Lockfiles: []string{"build.gradle", "build.gradle.kts", "gradle.lockfile"}},
+	{Name: "go", Dockerfile: "Dockerfile", LayerCache: true, CachePaths: []string{"/go/pkg/mod", "/root/.cache/go-build"},
+		Lockfiles: []string{"go.sum"}},
+	{Name: "node", Dockerfile: "Dockerfile", LayerCache: true, CachePaths: []string{"/root/.npm", "/usr/local/share/.cache/yarn"},
+		Lockfiles: []string{"package-lock.json", "yarn.lock", "pnpm-lock.yaml"}},
+	{Name: "python", Dockerfile: "Dockerfile", LayerCache: true, CachePaths: []string{"/root/.cache/pip"},
+		Lockfiles: []string{"requirements.txt", "poetry.lock", "Pipfile.lock"}},
+	{Name: "dotnet", Dockerfile: "Dockerfile", LayerCache: true, CachePaths: []string{"/root/.nuget/packages"},
+		Lockfiles: []string{"packages.lock.json"}},
+	{Name: "static", Dockerfile: "Dockerfile", LayerCache: true},
+}
+
+// Profiles the build profile registry indexed by name
+type Profiles map[string]*Profile
+
+func NewProfiles() Profiles {
+	profiles := make(Profiles)
+	if err := profiles.Merge(builtinProfiles); err != nil {
+		panic(err)
+	}
+	return profiles
+}
+
+// Merge validate and add the profiles, replace the exist profile with the same name
+func (ps Profiles) Merge(profiles []*Profile) error {
+	for _, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return err
+		}
+	}
+	for _, profile := range profiles {
+		ps[profile.Name] = profile
+	}
+	return nil
+}
+
+// With return a copy of the registry merged the profiles
+func (ps Profiles) With(profiles []*Profile) (Profiles, error) {
+	result := make(Profiles, len(ps)+len(profiles))
+	for name, profile := range ps {
+		result[name] = profile
+	}
+	if err := result.Merge(profiles); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get the profile of the code type, the default profile if not registered
+func (ps Profiles) Get(codeType string) *Profile {
+	if profile, exist := ps[codeType]; exist {
+		return profile
+	}
+	return ps[DefaultProfile]
+}
+
+func (ps Profiles) Names() []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseProfiles parse a profile or a list of profiles in yaml or json,
+// the name is required unless the fallback name is given
+func ParseProfiles(data []byte, name string) ([]*Profile, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	profiles := make([]*Profile, 0)
+	if err := yaml.UnmarshalStrict(data, &profiles); err != nil {
+		profiles = profiles[:0]
+		profile := &Profile{}
+		if err := yaml.UnmarshalStrict(data, profile); err != nil {
+			return nil, err
+		}
+		if profile.Name == "" {
+			profile.Name = name
+		}
+		profiles = append(profiles, profile)
+	}
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profile name is required")
+		}
+	}
+	return profiles, nil
+}
+
+func isProfileFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func profileFileName(name string) string {
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+// LoadProfiles load the profiles from a file, or the yaml and json files of a directory
+func LoadProfiles(path string) ([]*Profile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || !isProfileFile(entry.Name()) {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	result := make([]*Profile, 0)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		profiles, err := ParseProfiles(data, profileFileName(file))
+		if err != nil {
+			return nil, fmt.Errorf("parse profile file %s error (%s)", file, err)
+		}
+		result = append(result, profiles...)
+	}
+	return result, nil
+}
+
+// ProfilesFromConfigMap each data key of the configmap is a profile file, e.g. go.yaml
+func ProfilesFromConfigMap(obj *unstructured.Unstructured) ([]*Profile, error) {
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*Profile, 0)
+	for _, key := range keys {
+		profiles, err := ParseProfiles([]byte(data[key]), profileFileName(key))
+		if err != nil {
+			return nil, fmt.Errorf("parse profile %s error (%s)", key, err)
+		}
+		result = append(result, profiles...)
+	}
+	return result, nil
+}
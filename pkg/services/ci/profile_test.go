@@ -0,0 +1,115 @@
+package ci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestProfilesGet(t *testing.T) {
+	profiles := NewProfiles()
+	if profile := profiles.Get("java-maven"); profile.TaskName() != "yce-cloud-extensions-java-maven-task" || profile.LayerCache {
+		t.Fatalf("unexpected java-maven profile %v", profile)
+	}
+	if profile := profiles.Get("unknown"); profile.Name != DefaultProfile || profile.TaskName() != "yce-cloud-extensions-task" {
+		t.Fatalf("expect default profile, got %v", profile)
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := ParseProfiles([]byte(`
+---
+dockerfile: Dockerfile.rust
+cachePaths: ["/usr/local/cargo/registry"]
+preBuild:
+  - name: test
+    image: rust:1.48
+    script: cargo test
+`), "rust")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || profiles[0].Name != "rust" || profiles[0].PreBuild[0].Image != "rust:1.48" {
+		t.Fatalf("unexpected profiles %v", profiles)
+	}
+
+	profiles, err = ParseProfiles([]byte(`[{"name":"go","layerCache":true},{"name":"node"}]`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || !profiles[0].LayerCache {
+		t.Fatalf("unexpected profiles %v", profiles)
+	}
+
+	if _, err := ParseProfiles([]byte(`{"name":"go","builderName":"kaniko"}`), ""); err == nil {
+		t.Fatal("expect unknown field error")
+	}
+}
+
+func TestProfilesValidate(t *testing.T) {
+	for _, profile := range []*Profile{
+		{Name: "Go"},
+		{Name: "go", PreBuild: []Step{{Name: "building", Image: "golang"}}},
+		{Name: "go", PreBuild: []Step{{Name: "test"}}},
+		{Name: "go", PreBuild: []Step{{Name: "test", Image: "golang"}, {Name: "test", Image: "golang"}}},
+		{Name: "go", CachePaths: []string{"go/pkg"}},
+		{Name: "go", Builder: "docker"},
+		{Name: "go", Lockfiles: []string{"../go.sum"}},
+		{Name: "go", CacheSize: "10G of cache"},
+	} {
+		if err := NewProfiles().Merge([]*Profile{profile}); err == nil {
+			t.Fatalf("expect illegal profile %v", profile)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.yaml"), []byte("builderImage: gcr.io/kaniko-project/executor:v1.3.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a profile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	items, err := LoadProfiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := NewProfiles()
+	if err := profiles.Merge(items); err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Get("go").BuilderImage != "gcr.io/kaniko-project/executor:v1.3.0" {
+		t.Fatalf("expect file profile override the builtin, got %v", profiles.Get("go"))
+	}
+}
+
+func TestProfilesFromConfigMap(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"data": map[string]interface{}{
+			"php.yaml": "dockerfile: Dockerfile.php\n",
+		},
+	}}
+	items, err := ProfilesFromConfigMap(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := NewProfiles().With(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Get("php").Dockerfile != "Dockerfile.php" {
+		t.Fatalf("expect configmap profile, got %v", profiles.Get("php"))
+	}
+	if _, exist := NewProfiles()["php"]; exist {
+		t.Fatal("expect With not modify the registry")
+	}
+}
@@ -0,0 +1,169 @@
+package ci
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
+)
+
+// anyLimitKey the limit of the keys not listed
+const anyLimitKey = "*"
+
+// ConcurrencyLimits the running builds limit of the project or the git host, 0 is unlimited
+type ConcurrencyLimits map[string]int
+
+// ParseConcurrencyLimits parse the limits e.g. "*=2,project-a=4"
+func ParseConcurrencyLimits(s string) (ConcurrencyLimits, error) {
+	result := make(ConcurrencyLimits)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal concurrency limit (%s)", item)
+		}
+		limit, err := strconv.Atoi(kv[1])
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("illegal concurrency limit (%s)", item)
+		}
+		result[kv[0]] = limit
+	}
+	return result, nil
+}
+
+// Limit the limit of the key, the * limit if the key not listed
+func (l ConcurrencyLimits) Limit(key string) int {
+	if limit, exist := l[key]; exist {
+		return limit
+	}
+	return l[anyLimitKey]
+}
+
+// Limits the build concurrency limits, the request over any of the limits is queued
+type Limits struct {
+	Max      int
+	Projects ConcurrencyLimits
+	GitHosts ConcurrencyLimits
+}
+
+// queueItem the schedule state of a not done ci request
+type queueItem struct {
+	Name        string
+	Project     string
+	GitHost     string
+	Priority    int32
+	RequestTime time.Time
+	// Branch the requests of the same project and branch, Serial the request wait for the
+	// running one of the Branch by the queue supersede policy
+	Branch string
+	Serial bool
+}
+
+func newQueueItem(ci *v1.CI) *queueItem {
+	item := &queueItem{Name: ci.GetName(), Priority: ci.Spec.Priority, RequestTime: ci.GetCreationTimestamp().Time, Branch: ci.GetName()}
+	if branch := ci.GetLabels()[BranchLabel]; branch != "" {
+		item.Branch = branch
+	}
+	if requestTime, err := time.Parse(time.RFC3339Nano, ci.Spec.RequestTime); err == nil {
+		item.RequestTime = requestTime
+	}
+	if ci.Spec.GitURL != nil {
+		item.Project, _ = tools.ExtractProject(*ci.Spec.GitURL)
+		if remote, err := parseGitURL(*ci.Spec.GitURL); err == nil {
+			item.GitHost = remote.Host
+		}
+	}
+	return item
+}
+
+// retryBackoff the delay of the retry after the failed attempts, doubled by each attempt up to the max
+func retryBackoff(attempts int32, backoff, max time.Duration) time.Duration {
+	delay := backoff
+	for i := int32(1); i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+type buildCounter struct {
+	total    int
+	projects map[string]int
+	hosts    map[string]int
+	branches map[string]int
+}
+
+func newBuildCounter(items []*queueItem) *buildCounter {
+	counter := &buildCounter{projects: make(map[string]int), hosts: make(map[string]int), branches: make(map[string]int)}
+	for _, item := range items {
+		counter.add(item)
+	}
+	return counter
+}
+
+func (b *buildCounter) add(item *queueItem) {
+	b.total++
+	b.projects[item.Project]++
+	b.hosts[item.GitHost]++
+	b.branches[item.Branch]++
+}
+
+func (l *Limits) allow(counter *buildCounter, item *queueItem) bool {
+	under := func(limit, count int) bool { return limit == 0 || count < limit }
+	if item.Serial && counter.branches[item.Branch] > 0 {
+		return false
+	}
+	return under(l.Max, counter.total) &&
+		under(l.Projects.Limit(item.Project), counter.projects[item.Project]) &&
+		under(l.GitHosts.Limit(item.GitHost), counter.hosts[item.GitHost])
+}
+
+// schedule split the pending requests into the admitted ones could run under the limits and the
+// queued ones in order. the higher priority go first, then the project with fewer running and
+// queued-ahead builds so a busy project can't starve the others, then the earlier request
+func (l *Limits) schedule(running, pending []*queueItem) (admitted, queued []*queueItem) {
+	ahead := make(map[string]int)
+	for _, item := range running {
+		ahead[item.Project]++
+	}
+	rest := append([]*queueItem{}, pending...)
+	sort.SliceStable(rest, func(i, j int) bool {
+		if !rest[i].RequestTime.Equal(rest[j].RequestTime) {
+			return rest[i].RequestTime.Before(rest[j].RequestTime)
+		}
+		return rest[i].Name < rest[j].Name
+	})
+	ordered := make([]*queueItem, 0, len(rest))
+	for len(rest) > 0 {
+		next := 0
+		for i, item := range rest[1:] {
+			best := rest[next]
+			if item.Priority > best.Priority || (item.Priority == best.Priority && ahead[item.Project] < ahead[best.Project]) {
+				next = i + 1
+			}
+		}
+		ahead[rest[next].Project]++
+		ordered = append(ordered, rest[next])
+		rest = append(rest[:next], rest[next+1:]...)
+	}
+
+	counter := newBuildCounter(running)
+	for _, item := range ordered {
+		if l.allow(counter, item) {
+			counter.add(item)
+			admitted = append(admitted, item)
+			continue
+		}
+		queued = append(queued, item)
+	}
+	return admitted, queued
+}
@@ -0,0 +1,199 @@
+package ci
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseConcurrencyLimits(t *testing.T) {
+	limits, err := ParseConcurrencyLimits("*=2, project-a=4,project-b=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]int{"project-a": 4, "project-b": 0, "project-c": 2} {
+		if limits.Limit(key) != expected {
+			t.Fatalf("expected limit of %s %d, got %d", key, expected, limits.Limit(key))
+		}
+	}
+	if limits, _ := ParseConcurrencyLimits(""); limits.Limit("project-a") != 0 {
+		t.Fatal("expected unlimited without limits")
+	}
+	for _, s := range []string{"project-a", "=1", "project-a=x", "project-a=-1"} {
+		if _, err := ParseConcurrencyLimits(s); err == nil {
+			t.Fatalf("expected error of %s", s)
+		}
+	}
+}
+
+func TestNewQueueItem(t *testing.T) {
+	gitURL := "git@git.ym:ops/Demo_App.git"
+	ci := &v1.CI{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-app-master", CreationTimestamp: metav1.NewTime(time.Unix(100, 0))},
+		Spec:       v1.CISpec{GitURL: &gitURL, Priority: 3},
+	}
+	item := newQueueItem(ci)
+	if item.Project != "demo-app" || item.GitHost != "git.ym" || item.Priority != 3 || !item.RequestTime.Equal(time.Unix(100, 0)) {
+		t.Fatalf("unexpected queue item %+v", item)
+	}
+
+	ci.Spec.RequestTime = time.Unix(200, 5).Format(time.RFC3339Nano)
+	if item := newQueueItem(ci); !item.RequestTime.Equal(time.Unix(200, 5)) {
+		t.Fatalf("expected request time of the spec, got %s", item.RequestTime)
+	}
+}
+
+func queueNames(items []*queueItem) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func queueItemAt(name, project string, second int64) *queueItem {
+	return &queueItem{Name: name, Project: project, GitHost: "git.ym", RequestTime: time.Unix(second, 0)}
+}
+
+func TestScheduleUnlimited(t *testing.T) {
+	limits := &Limits{}
+	pending := []*queueItem{queueItemAt("b", "p", 2), queueItemAt("a", "p", 1)}
+	admitted, queued := limits.schedule(nil, pending)
+	if !reflect.DeepEqual(queueNames(admitted), []string{"a", "b"}) || len(queued) != 0 {
+		t.Fatalf("expected all admitted, got %v queued %v", queueNames(admitted), queueNames(queued))
+	}
+}
+
+func TestScheduleLimits(t *testing.T) {
+	limits := &Limits{
+		Max:      3,
+		Projects: ConcurrencyLimits{anyLimitKey: 1, "big": 2},
+		GitHosts: ConcurrencyLimits{"github.com": 1},
+	}
+	running := []*queueItem{queueItemAt("big-1", "big", 0)}
+	github := queueItemAt("gh-1", "gh", 3)
+	github.GitHost = "github.com"
+	github2 := queueItemAt("gh2-1", "gh2", 4)
+	github2.GitHost = "github.com"
+	pending := []*queueItem{
+		queueItemAt("big-2", "big", 1),
+		queueItemAt("big-3", "big", 2),
+		github,
+		github2,
+		queueItemAt("small-1", "small", 5),
+	}
+	admitted, queued := limits.schedule(running, pending)
+	// small and the github projects have no running build, they are ordered ahead of big-2 and big-3,
+	// gh2-1 is over the github.com limit, small-1 reach the global limit
+	if !reflect.DeepEqual(queueNames(admitted), []string{"gh-1", "small-1"}) {
+		t.Fatalf("unexpected admitted %v", queueNames(admitted))
+	}
+	if !reflect.DeepEqual(queueNames(queued), []string{"gh2-1", "big-2", "big-3"}) {
+		t.Fatalf("unexpected queue %v", queueNames(queued))
+	}
+}
+
+func TestScheduleFairness(t *testing.T) {
+	limits := &Limits{Max: 1}
+	running := []*queueItem{queueItemAt("a-0", "a", 0)}
+	pending := []*queueItem{
+		queueItemAt("a-1", "a", 1),
+		queueItemAt("a-2", "a", 2),
+		queueItemAt("a-3", "a", 3),
+		queueItemAt("b-1", "b", 4),
+		queueItemAt("c-1", "c", 5),
+		queueItemAt("b-2", "b", 6),
+	}
+	admitted, queued := limits.schedule(running, pending)
+	if len(admitted) != 0 {
+		t.Fatalf("expected no admitted over the global limit, got %v", queueNames(admitted))
+	}
+	// the projects take turns, the busy project a can't push back b and c
+	expected := []string{"b-1", "c-1", "a-1", "b-2", "a-2", "a-3"}
+	if !reflect.DeepEqual(queueNames(queued), expected) {
+		t.Fatalf("expected queue %v, got %v", expected, queueNames(queued))
+	}
+}
+
+func TestSchedulePriority(t *testing.T) {
+	limits := &Limits{Max: 1}
+	urgent := queueItemAt("a-2", "a", 2)
+	urgent.Priority = 10
+	pending := []*queueItem{queueItemAt("b-1", "b", 1), urgent, queueItemAt("c-1", "c", 3)}
+	admitted, queued := limits.schedule(nil, pending)
+	if !reflect.DeepEqual(queueNames(admitted), []string{"a-2"}) || !reflect.DeepEqual(queueNames(queued), []string{"b-1", "c-1"}) {
+		t.Fatalf("expected the higher priority admitted first, got %v queued %v", queueNames(admitted), queueNames(queued))
+	}
+}
+
+func TestScheduleBuildAttempts(t *testing.T) {
+	gitURL := "http://git.ym/devops/app.git"
+	// the build of the request without the commit always fails
+	ci := &v1.CI{Spec: v1.CISpec{GitURL: &gitURL}}
+	ci.SetName("app-master")
+	obj, err := tools.InstanceToUnstructured(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drs := fake.NewDataSource().Add(k8s.CI, obj)
+	supersede, _ := NewSupersedePolicies(SupersedeCancel, "")
+	c := &Service{IDataSource: drs, limits: &Limits{}, supersede: supersede, retryC: make(chan struct{}, 1)}
+	defer c.stopRetry()
+
+	attempts, backoff, maxBackoff := services.BuildAttempts, services.BuildRetryBackoff, services.MaxBuildRetryBackoff
+	defer func() {
+		services.BuildAttempts, services.BuildRetryBackoff, services.MaxBuildRetryBackoff = attempts, backoff, maxBackoff
+	}()
+	services.BuildAttempts, services.BuildRetryBackoff, services.MaxBuildRetryBackoff = 2, time.Hour, 2*time.Hour
+	scheduled := func() *v1.CI {
+		if err := c.scheduleCI(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ci := &v1.CI{}
+		if err := tools.UnstructuredObjectToInstanceObj(drs.Object(k8s.CI, "app-master"), ci); err != nil {
+			t.Fatal(err)
+		}
+		return ci
+	}
+	ci = scheduled()
+	if next, err := time.Parse(time.RFC3339Nano, ci.Spec.NextAttemptTime); ci.Spec.Done || ci.Spec.BuildAttempts != 1 ||
+		err != nil || time.Until(next) < 59*time.Minute || c.retryTimer == nil {
+		t.Fatalf("expected the failed build retried after the backoff, got %v", ci.Spec)
+	}
+	applied := len(drs.Applied)
+	if scheduled(); len(drs.Applied) != applied {
+		t.Fatal("expected the failed ci not built again before the backoff")
+	}
+
+	// the backoff expired
+	ci.Spec.NextAttemptTime = time.Now().Add(-time.Second).Format(time.RFC3339Nano)
+	if obj, err = tools.InstanceToUnstructured(ci); err != nil {
+		t.Fatal(err)
+	}
+	drs.Add(k8s.CI, obj)
+	ci = scheduled()
+	if !ci.Spec.Done || len(ci.Spec.AckStates) != 1 || ci.Spec.AckStates[0] != v1.FailState ||
+		ci.Spec.Diagnosis == nil || ci.Spec.Diagnosis.Reason != buildAttemptsReason {
+		t.Fatalf("expected the ci failed after the attempts, got %v", ci.Spec)
+	}
+	applied = len(drs.Applied)
+	if scheduled(); len(drs.Applied) != applied {
+		t.Fatal("expected the failed ci not scheduled again")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempts, expected := range map[int32]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 4: 80 * time.Second, 10: 5 * time.Minute} {
+		if delay := retryBackoff(attempts, 10*time.Second, 5*time.Minute); delay != expected {
+			t.Fatalf("expected the backoff %s of %d attempts, got %s", expected, attempts, delay)
+		}
+	}
+}
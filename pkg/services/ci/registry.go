@@ -0,0 +1,14 @@
+package ci
+
+import "fmt"
+
+// the docker config.json of the registry credentials mounted to the PipelineRun
+const (
+	dockerConfigSecretSuffix = "docker-config"
+	// dockerConfigWorkspace the workspace bound to the docker config.json of the PipelineRun
+	dockerConfigWorkspace = "docker-config"
+)
+
+func dockerConfigSecretName(pipelineRunName string) string {
+	return fmt.Sprintf("%s-%s", pipelineRunName, dockerConfigSecretSuffix)
+}
@@ -0,0 +1,20 @@
+package ci
+
+import (
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDockerConfigWorkspace(t *testing.T) {
+	obj, err := services.Render(&params{Namespace: "test", Name: "test", DockerConfigName: dockerConfigSecretName("test"), TektonVersion: "v1"}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaces, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	items, _, _ := unstructured.NestedSlice(workspaces[len(workspaces)-1].(map[string]interface{}), "secret", "items")
+	if len(items) != 1 || items[0].(map[string]interface{})["path"] != "config.json" {
+		t.Fatalf("expect the docker config.json mounted, got %v", workspaces)
+	}
+}
@@ -0,0 +1,48 @@
+package ci
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// SBOMTask the pipeline task attach the sbom to the pushed image, the image of the monorepo by sbom-image-<index>
+	SBOMTask = "sbom"
+	// sbomResult the pipeline result of the sbom artifact reference
+	sbomResult = "sbom"
+)
+
+// SBOMFormat the syft output and the oci artifact type of the sbom attached to the image
+type SBOMFormat struct {
+	Output       string
+	ArtifactType string
+}
+
+// sbomFormats the sbom formats of the build profile
+var sbomFormats = map[string]*SBOMFormat{
+	"spdx":      {Output: "spdx-json", ArtifactType: "application/spdx+json"},
+	"cyclonedx": {Output: "cyclonedx-json", ArtifactType: "application/vnd.cyclonedx+json"},
+}
+
+// GetSBOMFormat the sbom format of the build profile, nil if not set
+func GetSBOMFormat(name string) (*SBOMFormat, error) {
+	if name == "" {
+		return nil, nil
+	}
+	format, exist := sbomFormats[strings.ToLower(name)]
+	if !exist {
+		return nil, fmt.Errorf("illegal sbom format (%s), expect one of %s", name, strings.Join(SBOMFormatNames(), ","))
+	}
+	return format, nil
+}
+
+// SBOMFormatNames the sorted names of the sbom formats
+func SBOMFormatNames() []string {
+	names := make([]string, 0, len(sbomFormats))
+	for name := range sbomFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
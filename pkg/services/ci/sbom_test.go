@@ -0,0 +1,86 @@
+package ci
+
+import (
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGetSBOMFormat(t *testing.T) {
+	format, err := GetSBOMFormat("CycloneDX")
+	if err != nil || format.Output != "cyclonedx-json" || format.ArtifactType != "application/vnd.cyclonedx+json" {
+		t.Fatalf("unexpected format %v (%v)", format, err)
+	}
+	if format, err := GetSBOMFormat(""); format != nil || err != nil {
+		t.Fatalf("expect no sbom if not set, got %v (%v)", format, err)
+	}
+	profile := &Profile{Name: "go", SBOM: "syft"}
+	if err := profile.validate(); err == nil {
+		t.Fatal("expect illegal sbom format error")
+	}
+}
+
+func TestSBOMPipelineRender(t *testing.T) {
+	pipelineTask := func(obj *unstructured.Unstructured, name string) map[string]interface{} {
+		tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+		for _, task := range tasks {
+			if task.(map[string]interface{})["name"] == name {
+				return task.(map[string]interface{})
+			}
+		}
+		return nil
+	}
+	pipelineResult := func(obj *unstructured.Unstructured, name string) interface{} {
+		results, _, _ := unstructured.NestedSlice(obj.Object, "spec", "results")
+		for _, result := range results {
+			if result.(map[string]interface{})["name"] == name {
+				return result.(map[string]interface{})["value"]
+			}
+		}
+		return nil
+	}
+
+	format, _ := GetSBOMFormat("spdx")
+	p := &params{Namespace: "test", Name: "test", TaskName: "yce-cloud-extensions-go-task", TektonVersion: "v1"}
+	obj, err := services.Render(p, pipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineTask(obj, SBOMTask) != nil || pipelineResult(obj, sbomResult) != nil {
+		t.Fatal("unexpected sbom task without the sbom of the profile")
+	}
+	p.SBOMTaskName, p.SBOM = services.SBOMTaskName, format
+	if obj, err = services.Render(p, pipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	task := pipelineTask(obj, SBOMTask)
+	taskParams, _, _ := unstructured.NestedSlice(task, "params")
+	if taskParams[0].(map[string]interface{})["value"] != "$(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.yce-cloud-extensions-go-task.results.image_digest)" ||
+		taskParams[1].(map[string]interface{})["value"] != "spdx-json" || taskParams[2].(map[string]interface{})["value"] != "application/spdx+json" {
+		t.Fatalf("unexpected sbom task params %v", taskParams)
+	}
+	if pipelineResult(obj, sbomResult) != "$(tasks.sbom.results.sbom)" {
+		t.Fatal("expect the sbom pipeline result")
+	}
+
+	builds, _ := NewImageBuilds([]v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}, "mall", "harbor.ym/devops", "Dockerfile", "b8f3c2a1")
+	p.Images, p.GitCloneTaskName = builds, services.GitCloneTaskName
+	if obj, err = services.Render(p, imagesPipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	if pipelineTask(obj, "sbom-image-1") == nil || pipelineResult(obj, "build-image-1-sbom") != "$(tasks.sbom-image-1.results.sbom)" {
+		t.Fatalf("expect the sbom task and result of each image")
+	}
+
+	pipelineRun := `{"status":{"results":[{"name":"build-image-0-image_digest","value":"sha256:1234"},{"name":"build-image-0-sbom","value":"harbor.ym/devops/order@sha256:5678"}]}}`
+	images := imageResults(pipelineRun, []v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}, v1.FailState)
+	if images[0].SBOM != "harbor.ym/devops/order@sha256:5678" || images[1].SBOM != "" {
+		t.Fatalf("unexpected image sbom %v", images)
+	}
+
+	if _, err := services.Render(&params{Namespace: "test", Name: services.SBOMTaskName, TektonVersion: "v1"}, sbomTaskV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+}
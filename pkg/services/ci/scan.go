@@ -0,0 +1,170 @@
+package ci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// ScanTask the pipeline task scan the pushed image, the image of the monorepo is scanned by scan-image-<index>
+	ScanTask = "scan"
+	// scanResult the task result of the vulnerability counts, e.g. CRITICAL=0 HIGH=2 MEDIUM=5 LOW=9 UNKNOWN=0
+	scanResult = "vulnerabilities"
+	// scanRetainedResult the task result of the image exceeding the threshold failed to be deleted, true or false
+	scanRetainedResult = "retained"
+	// scanRetainedCategory the diagnosis of the image exceeding the threshold left in the registry
+	scanRetainedCategory = "vulnerable-image-retained"
+)
+
+// severities the severities of the scanner report, ordered from the most severe
+var severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// ScanThreshold the max vulnerabilities of the severities, the scan fails when any is exceeded
+type ScanThreshold map[string]int32
+
+// ParseScanThreshold parse the -scan-threshold, e.g. CRITICAL=0,HIGH=10
+func ParseScanThreshold(s string) (ScanThreshold, error) {
+	result := make(ScanThreshold)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("illegal scan threshold (%s)", item)
+		}
+		severity := strings.ToUpper(strings.TrimSpace(kv[0]))
+		if !validSeverity(severity) {
+			return nil, fmt.Errorf("illegal scan threshold severity (%s), expect one of %s", kv[0], strings.Join(severities, ","))
+		}
+		max, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 32)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("illegal scan threshold of %s (%s)", severity, kv[1])
+		}
+		result[severity] = int32(max)
+	}
+	return result, nil
+}
+
+// String the threshold passed to the scan task, ordered by the severity e.g. CRITICAL=0 HIGH=10
+func (t ScanThreshold) String() string {
+	items := make([]string, 0, len(t))
+	for _, severity := range severities {
+		if max, exist := t[severity]; exist {
+			items = append(items, fmt.Sprintf("%s=%d", severity, max))
+		}
+	}
+	return strings.Join(items, " ")
+}
+
+// Exceeded the severities of the summary exceed the threshold
+func (t ScanThreshold) Exceeded(summary *v1.ScanSummary) []string {
+	result := make([]string, 0)
+	counts := summaryCounts(summary)
+	for _, severity := range severities {
+		if max, exist := t[severity]; exist && counts[severity] > max {
+			result = append(result, severity)
+		}
+	}
+	return result
+}
+
+// ParseScanResult the vulnerability counts of the scan task result
+func ParseScanResult(value string) (*v1.ScanSummary, error) {
+	summary := &v1.ScanSummary{}
+	counts := map[string]*int32{
+		"CRITICAL": &summary.Critical,
+		"HIGH":     &summary.High,
+		"MEDIUM":   &summary.Medium,
+		"LOW":      &summary.Low,
+		"UNKNOWN":  &summary.Unknown,
+	}
+	for _, item := range strings.Fields(value) {
+		kv := strings.SplitN(item, "=", 2)
+		count, exist := counts[kv[0]]
+		if len(kv) != 2 || !exist {
+			return nil, fmt.Errorf("illegal scan result (%s)", item)
+		}
+		value, err := strconv.ParseInt(kv[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("illegal scan result (%s)", item)
+		}
+		*count = int32(value)
+	}
+	return summary, nil
+}
+
+// ScanSummary the vulnerabilities of the scan taskRuns of the pipelineRun summed up, nil if not scanned
+func ScanSummary(taskRuns []unstructured.Unstructured, threshold ScanThreshold) *v1.ScanSummary {
+	var result *v1.ScanSummary
+	for _, taskRun := range taskRuns {
+		task := taskRun.GetLabels()[services.PipelineTaskLabel]
+		if task != ScanTask && !strings.HasPrefix(task, ScanTask+"-") {
+			continue
+		}
+		value := taskRunResult(&taskRun, scanResult)
+		if value == "" {
+			continue
+		}
+		summary, err := ParseScanResult(value)
+		if err != nil {
+			continue
+		}
+		if result == nil {
+			result = &v1.ScanSummary{}
+		}
+		result.Critical += summary.Critical
+		result.High += summary.High
+		result.Medium += summary.Medium
+		result.Low += summary.Low
+		result.Unknown += summary.Unknown
+		result.Retained = result.Retained || taskRunResult(&taskRun, scanRetainedResult) == "true"
+	}
+	if result != nil {
+		result.Threshold = threshold.String()
+		result.Passed = len(threshold.Exceeded(result)) == 0
+	}
+	return result
+}
+
+func summaryCounts(summary *v1.ScanSummary) map[string]int32 {
+	return map[string]int32{
+		"CRITICAL": summary.Critical,
+		"HIGH":     summary.High,
+		"MEDIUM":   summary.Medium,
+		"LOW":      summary.Low,
+		"UNKNOWN":  summary.Unknown,
+	}
+}
+
+func validSeverity(severity string) bool {
+	for _, item := range severities {
+		if item == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// taskRunResult the result of the taskRun, status.results on tekton v1, status.taskResults before
+func taskRunResult(taskRun *unstructured.Unstructured, name string) string {
+	for _, path := range []string{"results", "taskResults"} {
+		results, _, _ := unstructured.NestedSlice(taskRun.Object, "status", path)
+		for _, result := range results {
+			value, ok := result.(map[string]interface{})
+			if !ok || value["name"] != name {
+				continue
+			}
+			if s, ok := value["value"].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	}
+	return ""
+}
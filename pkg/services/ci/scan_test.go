@@ -0,0 +1,153 @@
+package ci
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseScanThreshold(t *testing.T) {
+	threshold, err := ParseScanThreshold(" high=10, CRITICAL=0,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold.String() != "CRITICAL=0 HIGH=10" {
+		t.Fatalf("unexpected threshold %s", threshold)
+	}
+	if exceeded := threshold.Exceeded(&v1.ScanSummary{Critical: 1, High: 10, Low: 100}); !reflect.DeepEqual(exceeded, []string{"CRITICAL"}) {
+		t.Fatalf("unexpected exceeded %v", exceeded)
+	}
+	if empty, err := ParseScanThreshold(""); err != nil || len(empty.Exceeded(&v1.ScanSummary{Critical: 1})) != 0 {
+		t.Fatalf("expect the empty threshold report only (%v)", err)
+	}
+	for _, s := range []string{"SEVERE=1", "HIGH", "HIGH=-1", "HIGH=a"} {
+		if _, err := ParseScanThreshold(s); err == nil {
+			t.Fatalf("expect illegal threshold error of %s", s)
+		}
+	}
+}
+
+func TestScanSummary(t *testing.T) {
+	taskRun := func(task, path, value string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				path: []interface{}{map[string]interface{}{"name": scanResult, "value": value}},
+			},
+		}}
+		obj.SetLabels(map[string]string{services.PipelineTaskLabel: task})
+		return obj
+	}
+	threshold, _ := ParseScanThreshold("CRITICAL=0")
+	items := []unstructured.Unstructured{
+		taskRun("build-image-0", "results", "CRITICAL=9"),
+		taskRun("scan-image-0", "results", "CRITICAL=0 HIGH=2 MEDIUM=5 LOW=9 UNKNOWN=0"),
+		taskRun("scan-image-1", "taskResults", "CRITICAL=1 HIGH=1 MEDIUM=0 LOW=0 UNKNOWN=1\n"),
+	}
+	// the image exceeding the threshold failed to be deleted
+	results, _, _ := unstructured.NestedSlice(items[2].Object, "status", "taskResults")
+	_ = unstructured.SetNestedSlice(items[2].Object, append(results, map[string]interface{}{"name": scanRetainedResult, "value": "true"}), "status", "taskResults")
+	expected := &v1.ScanSummary{Critical: 1, High: 3, Medium: 5, Low: 9, Unknown: 1, Threshold: "CRITICAL=0", Passed: false, Retained: true}
+	if summary := ScanSummary(items, threshold); !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, summary)
+	}
+	if summary := ScanSummary(items[:1], threshold); summary != nil {
+		t.Fatalf("expect no summary without the scan task, got %+v", summary)
+	}
+	if _, err := ParseScanResult("CRITICAL=1 SEVERE=2"); err == nil {
+		t.Fatal("expect illegal scan result error")
+	}
+}
+
+func TestScanPipelineRender(t *testing.T) {
+	scanTask := func(obj *unstructured.Unstructured, name string) map[string]interface{} {
+		tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+		for _, task := range tasks {
+			if task.(map[string]interface{})["name"] == name {
+				return task.(map[string]interface{})
+			}
+		}
+		return nil
+	}
+	taskParam := func(task map[string]interface{}, name string) interface{} {
+		values, _, _ := unstructured.NestedSlice(task, "params")
+		for _, value := range values {
+			if value.(map[string]interface{})["name"] == name {
+				return value.(map[string]interface{})["value"]
+			}
+		}
+		return nil
+	}
+
+	p := &params{Namespace: "test", Name: "test", TaskName: "yce-cloud-extensions-task", TektonVersion: "v1"}
+	obj, err := services.Render(p, pipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanTask(obj, ScanTask) != nil {
+		t.Fatal("unexpected scan task without the image scan")
+	}
+	p.ScanTaskName = services.ScanTaskName
+	if obj, err = services.Render(p, pipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	task := scanTask(obj, ScanTask)
+	if taskParam(task, "image") != "$(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.yce-cloud-extensions-task.results.image_digest)" {
+		t.Fatalf("unexpected scan task %v", task)
+	}
+
+	platforms, _ := ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	p.Platforms, p.ManifestTaskName = platforms, services.ManifestTaskName
+	if obj, err = services.Render(p, multiArchPipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	if task := scanTask(obj, ScanTask); taskParam(task, "image") != "$(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.manifest.results.image_digest)" {
+		t.Fatalf("expect the image index scanned, got %v", task)
+	}
+
+	builds, _ := NewImageBuilds([]v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}, "mall", "harbor.ym/devops", "Dockerfile", "b8f3c2a1")
+	p.Platforms, p.Images, p.GitCloneTaskName = nil, builds, services.GitCloneTaskName
+	if obj, err = services.Render(p, imagesPipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	task = scanTask(obj, "scan-image-1")
+	if taskParam(task, "image") != "$(params.dest_repo_url_1)/$(params.project_name_1):$(params.project_version)@$(tasks.build-image-1.results.image_digest)" {
+		t.Fatalf("unexpected scan task of the image %v", task)
+	}
+	if ref, _, _ := unstructured.NestedString(task, "taskRef", "name"); ref != services.ScanTaskName {
+		t.Fatalf("unexpected scan task ref %s", ref)
+	}
+
+	if taskParam(task, "scan_delete_image") != "$(params.scan_delete_image)" {
+		t.Fatalf("expect the delete image passed to the scan task, got %v", task)
+	}
+
+	obj, err = services.Render(&params{Namespace: "test", Name: "test-run", PipelineName: "test", ScanImage: "aquasec/trivy:0.45.1", ScanThreshold: "CRITICAL=0 HIGH=10", ScanDeleteImage: "ghcr.io/oras-project/oras:v1.1.0", TektonVersion: "v1"}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runParams, _, _ := unstructured.NestedSlice(obj.Object, "spec", "params")
+	if taskParam(map[string]interface{}{"params": runParams}, "scan_threshold") != "CRITICAL=0 HIGH=10" ||
+		taskParam(map[string]interface{}{"params": runParams}, "scan_delete_image") != "ghcr.io/oras-project/oras:v1.1.0" {
+		t.Fatalf("unexpected pipelineRun params %v", runParams)
+	}
+
+	obj, err = services.Render(&params{Namespace: "test", Name: services.ScanTaskName, TektonVersion: "v1"}, scanTaskV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the severity line of each vulnerability is counted, the image exceeding the threshold is deleted by the gate
+	steps, _, _ := unstructured.NestedSlice(obj.Object, "spec", "steps")
+	if script := steps[0].(map[string]interface{})["script"].(string); !strings.Contains(script, "{{ range .Vulnerabilities }}{{ println .Severity }}{{ end }}") ||
+		!strings.Contains(script, `grep -cx "$severity"`) {
+		t.Fatalf("expect the vulnerabilities counted by the trivy template, got %s", script)
+	}
+	if gate := steps[len(steps)-1].(map[string]interface{}); gate["image"] != "$(params.scan_delete_image)" ||
+		!strings.Contains(gate["script"].(string), `if ! oras manifest delete --insecure --force $config "$(params.image)"; then`) ||
+		!strings.Contains(gate["script"].(string), `printf "true" > "$(results.retained.path)"`) {
+		t.Fatalf("expect the gate delete the image exceeding the threshold, got %v", gate)
+	}
+}
@@ -1,24 +1,34 @@
 package ci
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
+	"github.com/laik/yce-cloud-extensions/pkg/credentials"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/registry"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/diagnosis"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
 	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/retry"
 )
 
 var _ services.IService = &Service{}
@@ -28,37 +38,166 @@ type Service struct {
 	datasource.IDataSource
 	lastPRVersion string
 	lastCIVersion string
+	lastTRVersion string
+	// profiles the builtin and the -build-profile-path profiles
+	profiles Profiles
+	// projectBuilders the builder of the project by -project-builders
+	projectBuilders map[string]string
+	// tagStrategies the -tag-strategies, projectTagStrategies the -project-tag-strategies
+	tagStrategies        []string
+	projectTagStrategies map[string][]string
+	// credentials the git and the registry account of the -credentials-provider
+	credentials credentials.Provider
+	// limits the build concurrency limits, the request over the limits is queued
+	limits *Limits
+	// supersede the policy of the request superseded by a newer commit of the same branch
+	supersede *SupersedePolicies
+	// gitProviders the api provider of the git hosts by -git-providers
+	gitProviders map[string]string
+	// buildPod the build pod settings of the flags, the defaults of the -build-pod-configmap
+	buildPod *v1.BuildPod
+	// diagnoser classify the failure of the failed build
+	diagnoser *diagnosis.Diagnoser
+	// scanThreshold the max vulnerabilities of the scanned images by -scan-threshold
+	scanThreshold ScanThreshold
+	// retryC schedule the requests again when the retry backoff of the failed ones expires
+	retryC     chan struct{}
+	retryMu    sync.Mutex
+	retryTimer *time.Timer
 }
 
-func NewService(cfg *configure.InstallConfigure, drs datasource.IDataSource) services.IService {
+// NewService the ci service, the error of the flags can't be degraded e.g. the -scan-threshold gate fails the startup
+func NewService(cfg *configure.InstallConfigure, drs datasource.IDataSource) (services.IService, error) {
+	profiles := NewProfiles()
+	if services.BuildProfilePath != "" {
+		items, err := LoadProfiles(services.BuildProfilePath)
+		if err == nil {
+			err = profiles.Merge(items)
+		}
+		if err != nil {
+			fmt.Printf("%s service ci load build profiles from %s error (%s)\n", common.ERROR, services.BuildProfilePath, err)
+		}
+	}
+	fmt.Printf("%s service ci build profiles %s\n", common.INFO, strings.Join(profiles.Names(), ","))
+
+	projectBuilders, err := ParseProjectBuilders(services.ProjectBuilders)
+	if err != nil {
+		fmt.Printf("%s service ci parse project builders error (%s)\n", common.ERROR, err)
+	}
+	tagStrategies, err := ParseTagStrategies(services.TagStrategies)
+	if err != nil {
+		fmt.Printf("%s service ci parse tag strategies error (%s)\n", common.ERROR, err)
+		tagStrategies = []string{TagSHA}
+	}
+	projectTagStrategies, err := ParseProjectTagStrategies(services.ProjectTagStrategies)
+	if err != nil {
+		fmt.Printf("%s service ci parse project tag strategies error (%s)\n", common.ERROR, err)
+	}
+	provider, err := services.NewCredentialsProvider(drs)
+	if err != nil {
+		fmt.Printf("%s service ci load credentials provider error (%s)\n", common.ERROR, err)
+	}
+	limits := &Limits{Max: services.MaxConcurrentBuilds}
+	if limits.Projects, err = ParseConcurrencyLimits(services.ProjectMaxConcurrentBuilds); err != nil {
+		fmt.Printf("%s service ci parse project concurrency limits error (%s)\n", common.ERROR, err)
+	}
+	if limits.GitHosts, err = ParseConcurrencyLimits(services.GitHostMaxConcurrentBuilds); err != nil {
+		fmt.Printf("%s service ci parse git host concurrency limits error (%s)\n", common.ERROR, err)
+	}
+	supersede, err := NewSupersedePolicies(services.SupersedePolicy, services.ProjectSupersedePolicies)
+	if err != nil {
+		fmt.Printf("%s service ci parse supersede policies error (%s)\n", common.ERROR, err)
+	}
+	gitProviders, err := ParseGitProviders(services.GitProviders)
+	if err != nil {
+		fmt.Printf("%s service ci parse git providers error (%s)\n", common.ERROR, err)
+	}
+	scanThreshold, err := ParseScanThreshold(services.ScanThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("service ci parse scan threshold error (%s)", err)
+	}
+	buildPod := &v1.BuildPod{
+		Timeout:          services.BuildTimeout.String(),
+		CPURequests:      services.BuildCPURequests,
+		CPULimit:         services.BuildCPULimit,
+		MEMRequests:      services.BuildMEMRequests,
+		MEMLimit:         services.BuildMEMLimit,
+		RuntimeClassName: services.BuildRuntimeClass,
+	}
+	if buildPod.NodeSelector, err = ParseNodeSelector(services.BuildNodeSelector); err == nil {
+		err = validateBuildPod(buildPod)
+	}
+	if err != nil {
+		fmt.Printf("%s service ci parse build pod flags error (%s)\n", common.ERROR, err)
+		buildPod = &v1.BuildPod{}
+	}
+
 	return &Service{
 		InstallConfigure: cfg,
 		IDataSource:      drs,
 		lastPRVersion:    "0",
 		lastCIVersion:    "0",
-	}
+		lastTRVersion:    "0",
+		profiles:         profiles,
+		projectBuilders:  projectBuilders,
+
+		tagStrategies:        tagStrategies,
+		projectTagStrategies: projectTagStrategies,
+		credentials:          provider,
+		limits:               limits,
+		supersede:            supersede,
+		gitProviders:         gitProviders,
+		buildPod:             buildPod,
+		diagnoser:            diagnosis.NewDiagnoser(cfg, drs),
+		scanThreshold:        scanThreshold,
+		retryC:               make(chan struct{}, 1),
+	}, nil
 }
 
-func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
-	pipelineRunChan, err := c.Watch(common.YceCloudExtensionsOps, k8s.PipelineRun, c.lastPRVersion, 0, nil)
+func (c *Service) Start(ctx context.Context, errC chan<- error) {
+	go credentials.Watch(ctx, c.credentials, []string{credentials.Git}, services.CredentialsReloadInterval,
+		func(name string, _ *credentials.Credential) { c.reloadCredential(ctx, name) })
+
+	if services.DependencyCache && services.DependencyCacheTotalSize != "" {
+		total, err := resource.ParseQuantity(services.DependencyCacheTotalSize)
+		if err != nil {
+			fmt.Printf("%s service ci illegal dependency cache total size (%s)\n", common.ERROR, services.DependencyCacheTotalSize)
+		} else {
+			go c.collectDependencyCaches(ctx, total.Value())
+		}
+	}
+
+	pipelineRunChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, c.lastPRVersion, 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch pipelineRun error (%s)\n", common.ERROR, err)
 		errC <- err
 	}
 
-	ciChan, err := c.Watch(common.YceCloudExtensionsOps, k8s.CI, c.lastCIVersion, 0, nil)
+	ciChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.CI, c.lastCIVersion, 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch pipelineRun error (%s)\n", common.ERROR, err)
 		errC <- err
 	}
 
+	// the taskRuns copy the ci label of the pipelineRun
+	taskRunChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.TaskRun, c.lastTRVersion, 0, CILabel)
+	if err != nil {
+		fmt.Printf("%s watch taskRun error (%s)\n", common.ERROR, err)
+		errC <- err
+	}
+
 	fmt.Printf("%s service ci start watch ci channel and pipeline run channel\n", common.INFO)
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s service ci service get stop order\n", common.INFO)
+			c.stopRetry()
 			return
+		case <-c.retryC:
+			if err := c.scheduleCI(ctx); err != nil {
+				fmt.Printf("%s service ci schedule the retried requests error (%s)\n", common.ERROR, err)
+			}
 		case pipelineRunEvent, ok := <-pipelineRunChan:
 			if !ok {
 				fmt.Printf("%s service ci pipeline run channel closed\n", common.ERROR)
@@ -68,7 +207,7 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 			if pipelineRunEvent.Type == watch.Deleted {
 				continue
 			}
-			if err := c.reconcilePipelineRun(pipelineRunEvent.Object); err != nil {
+			if err := c.reconcilePipelineRun(ctx, pipelineRunEvent.Object); err != nil {
 				fmt.Printf("%s service ci watch pipeline run channel recv handle error (%s)\n", common.ERROR, err)
 			}
 			// record watch version
@@ -79,31 +218,67 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 			}
 			c.lastPRVersion = result.String()
 
-		case ciEvent, ok := <-ciChan:
+		case taskRunEvent, ok := <-taskRunChan:
 			if !ok {
-				fmt.Printf("%s service ci channel closed\n", common.ERROR)
-				errC <- fmt.Errorf("service watch ci channel closed")
+				fmt.Printf("%s service ci task run channel closed\n", common.ERROR)
+				errC <- fmt.Errorf("service ci watch task run channel closed")
 				return
 			}
-			// ignore delete event
-			if ciEvent.Type == watch.Deleted {
+			if taskRunEvent.Type == watch.Deleted {
 				continue
 			}
+			if err := c.reconcileTaskRun(ctx, taskRunEvent.Object); err != nil {
+				fmt.Printf("%s service ci watch task run channel recv handle error (%s)\n", common.ERROR, err)
+			}
+			result, err := tools.GetObjectValue(taskRunEvent.Object, "metadata.resourceVersion")
+			if err != nil {
+				fmt.Printf("%s service ci watch taskrun resource version not found\n", common.ERROR)
+				continue
+			}
+			c.lastTRVersion = result.String()
 
+		case ciEvent, ok := <-ciChan:
+			if !ok {
+				fmt.Printf("%s service ci channel closed\n", common.ERROR)
+				errC <- fmt.Errorf("service watch ci channel closed")
+				return
+			}
 			ciObj := &v1.CI{}
 			if err := tools.RuntimeObjectToInstance(ciEvent.Object, ciObj); err != nil {
 				fmt.Printf("%s service ci channel recv object can't not convert to ci object (%s)\n", common.ERROR, err)
 				continue
 			}
 
-			if err := c.reconcileCI(ciObj); err != nil {
-				fmt.Printf("%s service ci channel reconcil object (%s) error (%s)\n", common.ERROR, ciObj.GetName(), err)
+			reconcileCtx := common.WithRequestRef(ctx, ciObj.Spec.FlowId, ciObj.Spec.StepName, ciObj.Spec.UUID)
+			// the request created before the finalizer is cleaned up after deleted
+			if ciEvent.Type == watch.Deleted || ciObj.GetDeletionTimestamp() != nil {
+				if err := c.finalizeCI(reconcileCtx, ciObj); err != nil {
+					common.Printf(reconcileCtx, common.ERROR, "service ci finalize (%s) error (%s)\n", ciObj.GetName(), err)
+				}
+				continue
+			}
+			if err := c.reconcileCI(reconcileCtx, ciObj); err != nil {
+				common.Printf(reconcileCtx, common.ERROR, "service ci channel reconcil object (%s) error (%s)\n", ciObj.GetName(), err)
 			}
 			c.lastCIVersion = ciObj.GetResourceVersion()
 		}
 	}
 }
 
+// reloadCredential update the tekton secret of the loaded or rotated credential
+func (c *Service) reloadCredential(ctx context.Context, name string) {
+	var err error
+	switch name {
+	case credentials.Git:
+		_, err = c.checkAndRecreateGitConfig(ctx)
+	}
+	if err != nil {
+		fmt.Printf("%s service ci reload %s credential error (%s)\n", common.ERROR, name, err)
+		return
+	}
+	fmt.Printf("%s service ci reload %s credential\n", common.INFO, name)
+}
+
 type condition struct {
 	LastTransitionTime string `json:"lastTransitionTime"`
 	Message            string `json:"message"`
@@ -112,7 +287,7 @@ type condition struct {
 	Type               string `json:"type"`
 }
 
-func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
+func (c *Service) reconcilePipelineRun(ctx context.Context, runtimeObject runtime.Object) error {
 	pipelineRunJSON, err := json.Marshal(runtimeObject)
 	if err != nil {
 		return err
@@ -141,7 +316,12 @@ func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
 		return nil
 	}
 
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.CI, pipelineRunName)
+	// the pipelineRun created before the ci label is named by the ci
+	ciName := gjson.Get(pipelineRunJSONString, fmt.Sprintf("metadata.labels.%s", CILabel)).String()
+	if ciName == "" {
+		ciName = pipelineRunName
+	}
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.CI, ciName)
 	if err != nil {
 		return fmt.Errorf("get ci %s", err)
 	}
@@ -149,416 +329,686 @@ func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
 	if err := tools.UnstructuredObjectToInstanceObj(obj, ci); err != nil {
 		return err
 	}
+	// the run of the superseded commit don't report to the newer request,
+	// the run created before the ci label has no pipelineRun recorded
+	if ci.Spec.PipelineRun != pipelineRunName && (ci.Spec.PipelineRun != "" || ciName != pipelineRunName) {
+		return nil
+	}
+	// the done request has responded, e.g. cancelled by the supersede policy while the run is stopping
+	if ci.Spec.Done {
+		return nil
+	}
 
 	ci.Spec.AckStates = ci.Spec.AckStates[:0]
 	switch {
 	case conditions[0].Reason == succeeded && conditions[0].Status == "True" && conditions[0].Type == succeeded: // successed
 		ci.Spec.Done = true
 		ci.Spec.AckStates = append(ci.Spec.AckStates, v1.SuccessState)
-	case conditions[0].Reason == failed && conditions[0].Status == "False" && conditions[0].Type == succeeded: // failed
+		ci.Spec.Diagnosis = nil
+		ci.Spec.ImageDigest = pipelineRunResult(pipelineRunJSONString, "image_digest")
+		ci.Spec.Tags = strings.Fields(pipelineRunResult(pipelineRunJSONString, "tags"))
+		ci.Spec.SBOM = pipelineRunResult(pipelineRunJSONString, sbomResult)
+		if len(ci.Spec.Tags) == 0 {
+			// the legacy task push the project version only
+			if version := gjson.Get(pipelineRunJSONString, `spec.params.#(name=="project_version").value`).String(); version != "" {
+				ci.Spec.Tags = []string{version}
+			}
+		}
+	case (conditions[0].Reason == failed || diagnosis.TimeoutReason(conditions[0].Reason)) && conditions[0].Status == "False" && conditions[0].Type == succeeded: // failed
 		ci.Spec.Done = true
 		ci.Spec.AckStates = append(ci.Spec.AckStates, v1.FailState)
+		if ci.Spec.Diagnosis == nil {
+			ci.Spec.Diagnosis = c.diagnoser.Diagnose(ctx, pipelineRunName, conditions[0].Reason, conditions[0].Message)
+		}
+	case cancelledReason(conditions[0].Reason) && conditions[0].Status == "False" && conditions[0].Type == succeeded: // cancelled
+		ci.Spec.Done = true
+		ci.Spec.AckStates = append(ci.Spec.AckStates, v1.CancelledState)
+	}
+	// the result of each image of the monorepo build
+	if ci.Spec.Done && len(ci.Spec.AckStates) > 0 && len(ci.Spec.Images) > 0 {
+		ci.Spec.Images = imageResults(pipelineRunJSONString, ci.Spec.Images, ci.Spec.AckStates[0])
+	}
+	// the vulnerabilities of the scanned images, the run failed by the threshold has them too
+	if ci.Spec.Done && services.ImageScan && !c.legacy() && ci.Spec.Scan == nil {
+		taskRuns, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.TaskRun, "", 0, 0, fmt.Sprintf("%s=%s", services.PipelineRunLabel, pipelineRunName))
+		if err != nil {
+			common.Printf(ctx, common.WARN, "list the scan taskRuns of %s error (%s)\n", pipelineRunName, err)
+		} else {
+			ci.Spec.Scan = ScanSummary(taskRuns.Items, c.scanThreshold)
+		}
+		// the image exceeding the threshold left in the registry must not be deployed
+		if ci.Spec.Scan != nil && ci.Spec.Scan.Retained {
+			if ci.Spec.Diagnosis == nil {
+				ci.Spec.Diagnosis = &v1.Diagnosis{}
+			}
+			ci.Spec.Diagnosis.Category = scanRetainedCategory
+			ci.Spec.Diagnosis.Summary = "the image exceeding the scan threshold failed to be deleted from the registry, delete it before any deploy"
+		}
 	}
 
-	ciUnstructured, err := tools.InstanceToUnstructured(ci)
-	if err != nil {
+	if err := c.updateCI(ctx, ci); err != nil {
 		return err
 	}
-	if _, _, err := c.Apply(common.YceCloudExtensionsOps, k8s.CI, pipelineRunName, ciUnstructured, false); err != nil {
-		return err
+	if ci.Spec.Done && len(ci.Spec.AckStates) > 0 && ci.Spec.AckStates[0] == v1.SuccessState {
+		c.recordBuilds(ctx, ci)
 	}
 
-	return nil
-}
-
-// Generator Tekton Task/Pipeline/PipelineResource/PipelineRun/Config...
-func (c *Service) reconcileCI(ci *v1.CI) error {
+	// the finished build release the concurrency for the queued requests
 	if ci.Spec.Done {
-		return nil
-	}
-	projectName, err := tools.ExtractProject(*ci.Spec.GitURL)
-	if err != nil {
-		return fmt.Errorf("illegal project name extract from git url (%s)", *ci.Spec.GitURL)
+		return c.scheduleCI(ctx)
 	}
+	return nil
+}
 
-	// Check Secret Config install
-	_, err = c.checkAndRecreateGitConfig()
-	if err != nil {
-		return fmt.Errorf("reconcile ci check and recreate config error (%s)", err)
+// reconcileTaskRun record the steps of the taskRun in the ci of the running pipelineRun
+func (c *Service) reconcileTaskRun(ctx context.Context, runtimeObject runtime.Object) error {
+	taskRun, ok := runtimeObject.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("taskRun runtime object (%T) not unstructured", runtimeObject)
 	}
-	// Check Secret Config install
-	_, err = c.checkAndRecreateRegistryConfig()
-	if err != nil {
-		return fmt.Errorf("reconcile ci check and recreate config error (%s)", err)
+	ciName := taskRun.GetLabels()[CILabel]
+	pipelineRunName, steps := services.TaskRunSteps(taskRun)
+	if ciName == "" || len(steps) == 0 {
+		return nil
 	}
-
-	prName := pipelineRunName(ci.ObjectMeta.Name)
-
-	// first create pipelineResource with pipelineRun same name
-	obj, err := c.checkAndRecreatePipelineResource(prName, *ci.Spec.GitURL, *ci.Spec.Branch)
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.CI, ciName)
 	if err != nil {
-		return err
-	}
-
-	// Check codeType
-	if ci.Spec.CodeType == "java-maven" {
-		err = c.reconcileJavaCI(ci, projectName)
-		if err != nil {
-			return err
-		} else {
+		if errors.IsNotFound(err) {
 			return nil
 		}
+		return fmt.Errorf("get ci %s", err)
 	}
-
-	// check and reconcile task normal
-	if _, err = c.checkAndRecreateTask(); err != nil {
+	ci := &v1.CI{}
+	if err := tools.UnstructuredObjectToInstanceObj(obj, ci); err != nil {
 		return err
 	}
-
-	// check and reconcile pipeline graph
-	_, err = c.checkAndRecreateGraph(services.PipelineGraphName)
-	if err != nil {
-		return err
+	// the done request has responded, the run of the superseded commit don't report to the newer request
+	if ci.Spec.Done || ci.Spec.PipelineRun != pipelineRunName {
+		return nil
 	}
-	// check and reconcile pipeline
-	if _, err := c.checkAndRecreatePipeline(); err != nil {
-		return err
+	merged := services.MergeSteps(ci.Spec.Steps, steps)
+	if reflect.DeepEqual(merged, ci.Spec.Steps) {
+		return nil
 	}
+	ci.Spec.Steps = merged
+	return c.updateCI(ctx, ci)
+}
 
-	// check and reconcile pipelineRun graph
-	pipelineRunGraphName := fmt.Sprintf("%s-%s", services.PipelineGraphName, prName)
-	pipelineRunGraph, err := c.checkAndRecreateGraph(pipelineRunGraphName)
+func (c *Service) updateCI(ctx context.Context, ci *v1.CI) error {
+	ciUnstructured, err := tools.InstanceToUnstructured(ci)
 	if err != nil {
 		return err
 	}
-
-	// check and reconcile pipelineRun
-	obj, err = c.checkAndRecreatePipelineRun(
-		prName,
-		projectName,
-		*ci.Spec.CommitID,
-		pipelineRunGraphName,
-		prName,
-		*ci.Spec.Output,
-		pipelineRunGraph,
-		ci.Spec.CodeType,
-		ci.Spec.ProjectPath,
-		ci.Spec.ProjectFile,
-	)
-	if err != nil {
+	if _, _, err := c.Apply(ctx, common.YceCloudExtensionsOps, k8s.CI, ci.GetName(), ciUnstructured, false); err != nil {
 		return err
 	}
-
-	_ = obj
 	return nil
 }
 
-func (c *Service) reconcileJavaCI(ci *v1.CI, projectName string) error {
-	prName := pipelineRunName(ci.ObjectMeta.Name)
-	if len(prName) > 62 {
-		prName = prName[len(prName)-62:]
+// cancelledReason the reason of the cancelled pipelineRun, PipelineRunCancelled before tekton v1
+func cancelledReason(reason string) bool {
+	switch reason {
+	case "Cancelled", "PipelineRunCancelled", "CancelledRunFinally", "StoppedRunFinally":
+		return true
 	}
-	// check and reconcile task normal
-	if _, err := c.checkAndRecreateJavaTask(); err != nil {
-		return err
+	return false
+}
+
+// pipelineRunResult the result of the pipelineRun, status.results on tekton v1, status.pipelineResults before
+func pipelineRunResult(pipelineRunJSON, name string) string {
+	for _, path := range []string{"status.results", "status.pipelineResults"} {
+		result := gjson.Get(pipelineRunJSON, fmt.Sprintf(`%s.#(name=="%s").value`, path, name))
+		if result.Exists() {
+			return strings.TrimSpace(result.String())
+		}
 	}
+	return ""
+}
 
-	// check and reconcile pipeline graph
-	_, err := c.checkAndRecreateJavaGraph(services.JavaPipelineGraphName)
+// finalizeCI cancel the running pipelineRun of the deleted request, delete the tekton objects of its runs
+// and release the finalizer, the deleted request release the concurrency for the queued requests
+func (c *Service) finalizeCI(ctx context.Context, ci *v1.CI) error {
+	list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, "", 0, 0, fmt.Sprintf("%s=%s", CILabel, ci.GetName()))
 	if err != nil {
-		return err
+		return fmt.Errorf("list ci %s pipelineRuns error (%s)", ci.GetName(), err)
 	}
-	// check and reconcile pipeline
-	if _, err := c.checkAndRecreateJavaPipeline(); err != nil {
-		return err
+	// the pipelineRun created before the ci label is named by the ci
+	names := map[string]struct{}{ci.GetName(): {}}
+	if ci.Spec.PipelineRun != "" {
+		names[ci.Spec.PipelineRun] = struct{}{}
 	}
-
-	// check and reconcile pipelineRun graph
-	pipelineRunGraphName := fmt.Sprintf("%s-%s", services.JavaPipelineGraphName, prName)
-	pipelineRunGraph, err := c.checkAndRecreateJavaGraph(pipelineRunGraphName)
-	if err != nil {
-		return err
+	for _, item := range list.Items {
+		names[item.GetName()] = struct{}{}
 	}
-
-	// check and reconcile pipelineRun
-	_, err = c.checkAndRecreateJavaPipelineRun(
-		prName,
-		projectName,
-		*ci.Spec.CommitID,
-		pipelineRunGraphName,
-		prName,
-		*ci.Spec.Output,
-		pipelineRunGraph,
-		ci.Spec.CodeType,
-		ci.Spec.ProjectPath,
-		ci.Spec.ProjectFile,
-	)
-	if err != nil {
-		return err
+	for name := range names {
+		if err := CancelPipelineRun(ctx, c, name); err != nil {
+			return err
+		}
+		if err := services.DeletePipelineRun(ctx, c, name, c.legacy()); err != nil {
+			return err
+		}
 	}
-
-	return nil
+	if services.HasFinalizer(ci.ObjectMeta) {
+		if err := services.RemoveFinalizer(ctx, c, k8s.CI, ci.GetName()); err != nil {
+			return err
+		}
+		common.Printf(ctx, common.INFO, "service ci (%s) deleted with the pipelineRuns cleaned up\n", ci.GetName())
+		return nil
+	}
+	return c.scheduleCI(ctx)
 }
 
-func (c *Service) checkAndRecreateJavaTask() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.Task, services.JavaTaskName)
-	taskParams := params{
-		Namespace: common.YceCloudExtensionsOps,
-		Name:      services.JavaTaskName,
+func (c *Service) reconcileCI(ctx context.Context, ci *v1.CI) error {
+	if ci.Spec.Done || ci.Spec.Phase == v1.RunningPhase {
+		return nil
 	}
-	defaultTask, err := services.Render(taskParams, javaTaskTpl)
+	return c.scheduleCI(ctx)
+}
+
+// scheduleCI build the pending ci requests under the concurrency limits, the others are queued
+// with the position recorded in the ci
+func (c *Service) scheduleCI(ctx context.Context) error {
+	list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.CI, "", 0, 0, nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("list ci error (%s)", err)
+	}
+	pendingCIs := make(map[string]*v1.CI)
+	running, pending := make([]*queueItem, 0), make([]*queueItem, 0)
+	// the failed request waits for the retry backoff, the earliest one is scheduled by the timer
+	var retryAt time.Time
+	due := func(next time.Time) {
+		if retryAt.IsZero() || next.Before(retryAt) {
+			retryAt = next
+		}
 	}
-	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.JavaTaskName, defaultTask, false)
-		if err != nil {
-			return nil, err
+	for _, item := range list.Items {
+		value := item
+		ci := &v1.CI{}
+		if err := tools.UnstructuredObjectToInstanceObj(&value, ci); err != nil {
+			fmt.Printf("%s service ci schedule convert ci %s error (%s)\n", common.WARN, value.GetName(), err)
+			continue
+		}
+		// the deleted request is cancelled by the finalizer
+		if ci.Spec.Done || ci.GetDeletionTimestamp() != nil {
+			continue
+		}
+		item := newQueueItem(ci)
+		item.Serial = c.supersede.Policy(item.Project) == SupersedeQueue
+		if ci.Spec.Phase == v1.RunningPhase {
+			running = append(running, item)
+			continue
+		}
+		if next, err := time.Parse(time.RFC3339Nano, ci.Spec.NextAttemptTime); err == nil && next.After(time.Now()) {
+			due(next)
+			continue
+		}
+		pendingCIs[ci.GetName()] = ci
+		pending = append(pending, item)
+	}
+
+	admitted, queued := c.limits.schedule(running, pending)
+	// the request finished without build, e.g. the image is built already, release the concurrency
+	reschedule := false
+	for _, item := range admitted {
+		ci := pendingCIs[item.Name]
+		buildCtx := common.WithRequestRef(ctx, ci.Spec.FlowId, ci.Spec.StepName, ci.Spec.UUID)
+		if err := c.build(buildCtx, ci); err != nil {
+			if rejected, ok := err.(*rejectedError); ok {
+				c.rejectCI(buildCtx, ci, &v1.Diagnosis{Category: rejectedCategory, Summary: rejected.Error(), Reason: rejectedReason})
+				reschedule = true
+				continue
+			}
+			// the request failed to build is retried after the backoff, done with the FAIL state after the attempts
+			ci.Spec.BuildAttempts++
+			common.Printf(buildCtx, common.ERROR, "service ci build (%s) attempt %d error (%s)\n", ci.GetName(), ci.Spec.BuildAttempts, err)
+			if services.BuildAttempts > 0 && ci.Spec.BuildAttempts >= int32(services.BuildAttempts) {
+				c.rejectCI(buildCtx, ci, &v1.Diagnosis{
+					Category: buildErrorCategory,
+					Summary:  fmt.Sprintf("build failed after %d attempts (%s)", ci.Spec.BuildAttempts, err),
+					Reason:   buildAttemptsReason,
+				})
+				reschedule = true
+				continue
+			}
+			next := time.Now().Add(retryBackoff(ci.Spec.BuildAttempts, services.BuildRetryBackoff, services.MaxBuildRetryBackoff))
+			ci.Spec.NextAttemptTime = next.Format(time.RFC3339Nano)
+			if err := c.updateCI(buildCtx, ci); err != nil {
+				common.Printf(buildCtx, common.ERROR, "service ci update (%s) build attempts error (%s)\n", ci.GetName(), err)
+				continue
+			}
+			due(next)
+			continue
+		}
+		ci.Spec.Phase, ci.Spec.QueuePosition, ci.Spec.NextAttemptTime = v1.RunningPhase, 0, ""
+		if err := c.updateCI(buildCtx, ci); err != nil {
+			common.Printf(buildCtx, common.ERROR, "service ci update (%s) phase error (%s)\n", ci.GetName(), err)
+			continue
+		}
+		reschedule = reschedule || ci.Spec.Done
+	}
+	if reschedule {
+		return c.scheduleCI(ctx)
+	}
+	if !retryAt.IsZero() {
+		c.scheduleRetry(time.Until(retryAt))
+	}
+	for index, item := range queued {
+		ci := pendingCIs[item.Name]
+		position := int32(index + 1)
+		if ci.Spec.Phase == v1.QueuedPhase && ci.Spec.QueuePosition == position {
+			continue
+		}
+		queueCtx := common.WithRequestRef(ctx, ci.Spec.FlowId, ci.Spec.StepName, ci.Spec.UUID)
+		common.Printf(queueCtx, common.INFO, "service ci (%s) queued at position %d\n", ci.GetName(), position)
+		ci.Spec.Phase, ci.Spec.QueuePosition = v1.QueuedPhase, position
+		if err := c.updateCI(queueCtx, ci); err != nil {
+			common.Printf(queueCtx, common.ERROR, "service ci update (%s) queue position error (%s)\n", ci.GetName(), err)
 		}
-		return obj, nil
 	}
+	return nil
+}
 
-	if !tools.CompareSpecByUnstructured(defaultTask, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.JavaTaskName, defaultTask, false)
-		if err != nil {
-			return nil, err
+// scheduleRetry schedule the requests again after the delay instead of the watch event of the failed
+// request updated by itself, the earlier timer is replaced
+func (c *Service) scheduleRetry(delay time.Duration) {
+	c.stopRetry()
+	c.retryMu.Lock()
+	defer c.retryMu.Unlock()
+	c.retryTimer = time.AfterFunc(delay, func() {
+		select {
+		case c.retryC <- struct{}{}:
+		default:
 		}
+	})
+}
+
+func (c *Service) stopRetry() {
+	c.retryMu.Lock()
+	defer c.retryMu.Unlock()
+	if c.retryTimer != nil {
+		c.retryTimer.Stop()
+		c.retryTimer = nil
 	}
-	return obj, nil
 }
 
-func (c *Service) checkAndRecreateJavaGraph(name string) (*unstructured.Unstructured, error) {
-	graphParams := params{
-		Namespace: common.YceCloudExtensionsOps,
-		Name:      name,
+// the diagnosis of the request rejected before the build and the request failed to build after the attempts
+const (
+	rejectedCategory    = "request-rejected"
+	rejectedReason      = "RequestRejected"
+	buildErrorCategory  = "build-error"
+	buildAttemptsReason = "BuildAttemptsExceeded"
+)
+
+// rejectedError the request can't be built as requested, the ci is done with the FAIL state instead of retried
+type rejectedError struct {
+	reason string
+}
+
+func (e *rejectedError) Error() string { return e.reason }
+
+func rejectf(format string, args ...interface{}) error {
+	return &rejectedError{reason: fmt.Sprintf(format, args...)}
+}
+
+// legacyFeature the feature of the build the legacy tekton can't run
+type legacyFeature struct {
+	Name string
+	// Used the feature used by the request or the flags
+	Used bool
+	// Required the request can't be built without the feature, otherwise the feature is dropped from the build
+	Required bool
+}
+
+// checkLegacyFeatures reject the request of the required features, the names of the dropped optional ones are returned
+func checkLegacyFeatures(features []legacyFeature) ([]string, error) {
+	required, dropped := make([]string, 0), make([]string, 0)
+	for _, feature := range features {
+		switch {
+		case !feature.Used:
+		case feature.Required:
+			required = append(required, feature.Name)
+		default:
+			dropped = append(dropped, feature.Name)
+		}
 	}
-	obj, err := services.Render(graphParams, javaGraphTpl)
-	if err != nil {
-		return nil, err
+	if len(required) > 0 {
+		return nil, rejectf("%s not supported by tekton %s", strings.Join(required, ", "), services.TektonLegacyVersion)
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, name, obj, false)
-	if err != nil {
-		return nil, err
+	return dropped, nil
+}
+
+// rejectCI done the request not built with the FAIL state and the diagnosis, the request leaves the queue
+func (c *Service) rejectCI(ctx context.Context, ci *v1.CI, diagnosis *v1.Diagnosis) {
+	common.Printf(ctx, common.WARN, "service ci reject (%s): %s\n", ci.GetName(), diagnosis.Summary)
+	ci.Spec.Done, ci.Spec.QueuePosition = true, 0
+	ci.Spec.AckStates = []string{v1.FailState}
+	ci.Spec.Diagnosis = diagnosis
+	if err := c.updateCI(ctx, ci); err != nil {
+		common.Printf(ctx, common.ERROR, "service ci update the rejected (%s) error (%s)\n", ci.GetName(), err)
 	}
-	return obj, nil
 }
 
-func (c *Service) checkAndRecreateJavaPipeline() (*unstructured.Unstructured, error) {
-	getObj, err := c.Get(common.YceCloudExtensionsOps, k8s.Pipeline, services.JavaTaskName)
-	pipelineParams := params{
-		Namespace:     common.YceCloudExtensionsOps,
-		Name:          services.JavaPipelineName,
-		PipelineGraph: services.JavaPipelineGraphName,
-		TaskName:      services.JavaTaskName,
+// build generate Tekton Task/Pipeline/PipelineResource/PipelineRun/Config...
+func (c *Service) build(ctx context.Context, ci *v1.CI) error {
+	if ci.Spec.CommitID == nil || ci.Spec.Branch == nil {
+		return fmt.Errorf("ci commit id and branch are required")
 	}
-	obj, err := services.Render(pipelineParams, javaPipelineTpl)
+	projectName, err := tools.ExtractProject(*ci.Spec.GitURL)
 	if err != nil {
-		return nil, err
-	}
-
-	if errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.JavaPipelineName, obj, false)
-		if err != nil {
-			return nil, err
-		}
-		return obj, nil
+		return fmt.Errorf("illegal project name extract from git url (%s)", *ci.Spec.GitURL)
 	}
 
+	// Check Secret Config install
+	_, err = c.checkAndRecreateGitConfig(ctx)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("reconcile ci check and recreate config error (%s)", err)
 	}
 
-	if !tools.CompareSpecByUnstructured(obj, getObj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.JavaPipelineName, obj, false)
-		if err != nil {
-			return nil, err
+	prName := pipelineRunName(ci.ObjectMeta.Name, *ci.Spec.CommitID)
+	// the objects of the run are deleted with the ci request
+	owner := services.OwnerOf(ci.TypeMeta, ci.ObjectMeta)
+
+	// first create pipelineResource with pipelineRun same name, the newer tekton clone the source in the task
+	if c.legacy() {
+		if _, err := c.checkAndRecreatePipelineResource(ctx, prName, *ci.Spec.GitURL, *ci.Spec.Branch, owner); err != nil {
+			return err
 		}
 	}
 
-	return obj, nil
-}
-
-func (c *Service) checkAndRecreateJavaPipelineRun(
-	name,
-	projectName,
-	projectVersion,
-	pipelineRunGraphName,
-	pipelineResourceName,
-	outputUrl string,
-	pipelineRunGraph *unstructured.Unstructured,
-	codeType string,
-	projectPath string,
-	projectFile string,
-
-) (*unstructured.Unstructured, error) {
-	_outputUrl := services.DestRepoUrl
-	if outputUrl != "" {
-		_outputUrl = outputUrl
+	// the task of the code type rendered from the build profile and the builder
+	profile, err := c.profile(ctx, ci.Spec.CodeType)
+	if err != nil {
+		return err
 	}
-	if codeType == "" {
-		codeType = "none"
+	builder, err := GetBuilder(selectBuilder(ci.Spec.Builder, c.projectBuilders[projectName], profile.Builder, services.Builder))
+	if err != nil {
+		return err
 	}
-	if strings.Trim(projectFile, " ") == "" || projectFile == "" {
-		projectFile = `Dockerfile`
+	platforms, err := ParsePlatforms(ci.Spec.Platforms)
+	if err != nil {
+		return err
 	}
-	if strings.Trim(projectPath, " ") == "" || projectPath == "" {
-		projectPath = `"*"`
+	strategies, exist := c.projectTagStrategies[projectName]
+	if !exist {
+		strategies = c.tagStrategies
 	}
-	pipelineRunParams := params{
-		Namespace:            common.YceCloudExtensionsOps,
-		Name:                 name,
-		PipelineName:         services.JavaPipelineName,
-		PipelineGraph:        services.JavaPipelineGraphName,
-		PipelineRunGraph:     pipelineRunGraphName,
-		PipelineResourceName: pipelineResourceName,
-		ProjectName:          projectName,
-		ProjectVersion:       projectVersion,
-		BuildToolImage:       services.BuildToolImage,
-		CheckDockerFile:      services.CheckDockerFile,
-		DestRepoUrl:          _outputUrl,
-		CodeType:             codeType,
-		ProjectPath:          projectPath,
-		ProjectFile:          projectFile,
+	tagging := NewTagging(strategies, *ci.Spec.CommitID, *ci.Spec.Branch, services.DefaultBranch, time.Now())
+	buildArgs, err := buildArgPairs(ci.Spec.BuildArgs)
+	if err != nil {
+		return rejectf("%s", err)
+	}
+	if err := validateBuildSecrets(ci.Spec.BuildSecrets); err != nil {
+		return rejectf("%s", err)
 	}
-	defaultObj, err := services.Render(pipelineRunParams, javaPipelineRunTpl)
+	if len(ci.Spec.BuildSecrets) > 0 && !builder.MountSecrets() {
+		return rejectf("build secrets not supported by the builder %s", builder.Name())
+	}
+	outputUrl := services.DestRepoUrl
+	if ci.Spec.Output != nil && *ci.Spec.Output != "" {
+		outputUrl = *ci.Spec.Output
+	}
+	pod, err := c.podSettings(ctx, projectName, ci.Spec.Pod)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	stepResources := pod.CPURequests != "" || pod.CPULimit != "" || pod.MEMRequests != "" || pod.MEMLimit != ""
+
+	// the request of the features the legacy tekton can't run is rejected, the optional ones are built without
+	if c.legacy() {
+		dropped, err := checkLegacyFeatures([]legacyFeature{
+			{Name: "images build", Used: len(ci.Spec.Images) > 0, Required: true},
+			{Name: "build args", Used: len(buildArgs) > 0, Required: true},
+			{Name: "build secrets", Used: len(ci.Spec.BuildSecrets) > 0, Required: true},
+			{Name: "sbom", Used: profile.SBOM != "", Required: true},
+			{Name: "image scan", Used: services.ImageScan, Required: true},
+			{Name: "image sign", Used: services.ImageSign, Required: true},
+			{Name: "multi-arch build", Used: len(platforms) > 0},
+			{Name: "tagging", Used: len(tagging.Extra()) > 0 || tagging.Semver},
+			{Name: "dependency cache", Used: services.DependencyCache && len(profile.CachePaths) > 0},
+			{Name: "step resources", Used: stepResources},
+		})
+		if err != nil {
+			return err
+		}
+		if len(dropped) > 0 {
+			common.Printf(ctx, common.WARN, "%s not supported by tekton %s, build without them\n", strings.Join(dropped, ", "), services.TektonLegacyVersion)
+		}
+		platforms, stepResources = nil, false
+		pod.CPURequests, pod.CPULimit, pod.MEMRequests, pod.MEMLimit = "", "", "", ""
+	}
+	if stepResources {
+		if apiFields, err := c.tektonAPIFields(ctx); err != nil {
+			return err
+		} else if !stepResourcesEnabled(apiFields) {
+			common.Printf(ctx, common.WARN, "step resources not enabled by the tekton enable-api-fields %s, build without them\n", apiFields)
+			pod.CPURequests, pod.CPULimit, pod.MEMRequests, pod.MEMLimit = "", "", "", ""
+		}
+	}
+	labels := buildLabels(*ci.Spec.CommitID, ci.Spec.ProjectPath, ci.Spec.ProjectFile)
+	branchName := ci.GetName()
+	if branch := ci.GetLabels()[BranchLabel]; branch != "" {
+		branchName = branch
+	}
+	plan := &plan{
+		CIName:       ci.GetName(),
+		BranchName:   branchName,
+		Owner:        owner,
+		Profile:      profile,
+		Builder:      builder,
+		Platforms:    platforms,
+		Tagging:      tagging,
+		BuildArgs:    buildArgs,
+		Labels:       labelPairs(labels),
+		BuildSecrets: ci.Spec.BuildSecrets,
+		Pod:          pod,
+	}
+
+	// the sub-projects of the monorepo share the clone of a pipelineRun
+	if len(ci.Spec.Images) > 0 {
+		if len(platforms) > 0 {
+			return rejectf("multi-arch build of the images not supported")
+		}
+		if plan.Images, err = NewImageBuilds(ci.Spec.Images, projectName, outputUrl, plan.Dockerfile, *ci.Spec.CommitID); err != nil {
+			return err
+		}
+		for _, image := range plan.Images {
+			image.BuildArgs = append(builder.BuildArgs(buildArgs), builder.Labels(labelPairs(image.Labels))...)
+		}
 	}
 
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			// create pipelineRun
-			obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
-			if err != nil {
-				return nil, err
-			}
-			goto OWNER_REF
+	// the project paths unchanged since the last successful build report the image of it
+	if services.PathFilter && !ci.Spec.Force && !c.legacy() {
+		done, err := c.filterUnchanged(ctx, ci, plan)
+		if err != nil {
+			common.Printf(ctx, common.WARN, "filter the unchanged project paths error (%s), build all\n", err)
+		}
+		if done {
+			c.recordBuilds(ctx, ci)
+			return nil
 		}
-		return nil, err
 	}
 
-	err = c.Delete(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
-	if err != nil {
-		return nil, err
+	// the images built of the commit are reused unless forced, the labels are not built by the legacy task
+	if services.SkipExistingImage && !ci.Spec.Force && !c.legacy() {
+		checks := []*imageCheck{{Ref: registry.NewImageRef(outputUrl, projectName, tagging.Primary()), Labels: labels}}
+		if len(plan.Images) > 0 {
+			checks = checks[:0]
+			for _, image := range plan.Images {
+				checks = append(checks, &imageCheck{Ref: registry.NewImageRef(image.DestRepoUrl, image.ProjectName, tagging.Primary()), Labels: image.Labels})
+			}
+		}
+		images, err := c.reuseBuiltImages(ctx, checks, tagging)
+		if err != nil {
+			common.Printf(ctx, common.WARN, "check the built image error (%s), rebuild\n", err)
+		}
+		if images != nil {
+			setBuiltImages(ci, images)
+			c.recordBuilds(ctx, ci)
+			return nil
+		}
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
-	if err != nil {
-		return nil, err
+
+	// the dependency caches of the profile restored from the volume of the project or the profile
+	if services.DependencyCache && len(profile.CachePaths) > 0 && !c.legacy() {
+		switch {
+		case len(plan.Platforms) > 0:
+			common.Printf(ctx, common.WARN, "dependency cache of the multi-arch build not supported, build without it\n")
+		default:
+			if plan.DependencyCache, err = c.checkAndRecreateDependencyCache(ctx, profile, *ci.Spec.GitURL); err != nil {
+				common.Printf(ctx, common.WARN, "check the dependency cache error (%s), build without it\n", err)
+			}
+		}
 	}
-	pipelineRunGraph, err = c.checkAndRecreateJavaGraph(pipelineRunGraph.GetName())
-	if err != nil {
-		return nil, err
+
+	// the sbom of the build profile attached to the pushed images
+	if profile.SBOM != "" {
+		if plan.SBOM, err = GetSBOMFormat(profile.SBOM); err != nil {
+			return err
+		}
 	}
 
-OWNER_REF:
-	// reset graph owner
-	pipelineRunGraphBytes, err := pipelineRunGraph.MarshalJSON()
+	// the pushed images are scanned by the scan task of the pipeline
+	plan.Scan = services.ImageScan
+	// the pushed images are signed by the key of the -sign-key-secret
+	plan.Sign = services.ImageSign
+
+	// the credentials of the build attached to the service account of the pipelineRun
+	plan.GitCredentialName, err = c.checkAndRecreateGitCredential(ctx, prName, *ci.Spec.GitURL)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	pipelineRunGraphObj, err := tools.SetObjectOwner(pipelineRunGraphBytes, obj.GetAPIVersion(), obj.GetKind(), obj.GetName(), string(obj.GetUID()))
+	plan.DockerConfigName, err = c.checkAndRecreateDockerConfig(ctx, prName, plan.registryHosts(outputUrl))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	plan.ServiceAccountName = prName
+	if _, err := c.checkAndRecreateServiceAccount(ctx, plan.ServiceAccountName, []string{plan.GitCredentialName, plan.DockerConfigName}); err != nil {
+		return err
 	}
 
-	pipelineRunGraphObj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, pipelineRunGraphName, pipelineRunGraphObj, false)
-	if err != nil {
-		return nil, err
+	// copy the build secrets, the values never go through the PipelineRun params
+	if len(plan.BuildSecrets) > 0 {
+		plan.BuildSecretName = buildSecretName(prName)
+		if _, err := c.checkAndRecreateBuildSecret(ctx, plan.BuildSecretName, plan.BuildSecrets); err != nil {
+			return err
+		}
 	}
 
-	return obj, err
-}
+	// check and reconcile task normal
+	if _, err = c.checkAndRecreateTask(ctx, plan); err != nil {
+		return err
+	}
 
-func (c *Service) checkAndRecreateRegistryConfig() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName)
+	// check and reconcile the task push the image index
+	if len(plan.Platforms) > 0 {
+		if _, err = c.checkAndRecreateSharedTask(ctx, services.ManifestTaskName, manifestTaskV1Tpl); err != nil {
+			return err
+		}
+	}
 
-	configParams := params{
-		Namespace:        common.YceCloudExtensionsOps,
-		Name:             services.TektonDockerConfigName,
-		RegistryRepoUrl:  services.ConfigRegistryUrl,
-		RegistryUsername: base64.StdEncoding.EncodeToString([]byte(services.ConfigRegistryUserName)),
-		RegistryPassword: base64.StdEncoding.EncodeToString([]byte(services.ConfigRegistryPassword)),
+	// check and reconcile the task attach the sbom to the pushed images
+	if plan.SBOM != nil {
+		if _, err = c.checkAndRecreateSharedTask(ctx, services.SBOMTaskName, sbomTaskV1Tpl); err != nil {
+			return err
+		}
 	}
-	defaultConfig, err := services.Render(configParams, configRegistryTpl)
-	if err != nil {
-		return nil, err
+
+	// check and reconcile the task scan the pushed images
+	if plan.Scan {
+		if _, err = c.checkAndRecreateSharedTask(ctx, services.ScanTaskName, scanTaskV1Tpl); err != nil {
+			return err
+		}
 	}
-	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
-		if err != nil {
-			return nil, err
+
+	// check and reconcile the task sign the pushed images
+	if plan.Sign {
+		if _, err = c.checkAndRecreateSharedTask(ctx, services.SignTaskName, signTaskV1Tpl); err != nil {
+			return err
 		}
-		return obj, nil
 	}
 
-	if !tools.CompareSpecByUnstructured(defaultConfig, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
-		if err != nil {
-			return nil, err
+	// check and reconcile the task clone the source of the images
+	if len(plan.Images) > 0 {
+		if _, err = c.checkAndRecreateSharedTask(ctx, services.GitCloneTaskName, gitCloneTaskV1Tpl); err != nil {
+			return err
 		}
 	}
 
-	serverAccount, err := c.Get(common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
+	// check and reconcile pipeline graph
+	_, err = c.checkAndRecreateGraph(ctx, plan.PipelineGraphName(), plan.TaskName())
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// check and reconcile pipeline
+	if _, err := c.checkAndRecreatePipeline(ctx, plan); err != nil {
+		return err
 	}
 
-	serviceAccountBytes, err := serverAccount.MarshalJSON()
+	// check and reconcile pipelineRun graph
+	pipelineRunGraphName := fmt.Sprintf("%s-%s", plan.PipelineGraphName(), prName)
+	pipelineRunGraph, err := c.checkAndRecreateGraph(ctx, pipelineRunGraphName, plan.TaskName())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	secretsPath := "secrets"
 
-	var newValue = make([]string, 0)
-	gjson.Get(string(serviceAccountBytes), secretsPath).
-		ForEach(
-			func(_, v gjson.Result) bool {
-				newValue = append(newValue, v.String())
-				return true
-			})
-
-	if len(newValue) < 1 {
-		return nil, fmt.Errorf("get secrets not value")
+	// check and reconcile pipelineRun
+	obj, err := c.checkAndRecreatePipelineRun(
+		ctx,
+		plan,
+		prName,
+		projectName,
+		*ci.Spec.CommitID,
+		pipelineRunGraphName,
+		prName,
+		outputUrl,
+		pipelineRunGraph,
+		ci.Spec.CodeType,
+		ci.Spec.ProjectPath,
+		ci.Spec.ProjectFile,
+		*ci.Spec.GitURL,
+		*ci.Spec.Branch,
+	)
+	if err != nil {
+		return err
 	}
 
-	if !tools.ContainStringItem(newValue, services.TektonDockerConfigName) {
-		newValue = append(newValue, services.TektonDockerConfigName)
-		newServiceAccountString, err := sjson.Set(string(serviceAccountBytes), secretsPath, newValue)
-		if err != nil {
-			return nil, err
-		}
-		serviceAccount := &unstructured.Unstructured{}
-		if err := serviceAccount.UnmarshalJSON([]byte(newServiceAccountString)); err != nil {
-			return nil, err
-		}
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
-		if err != nil {
-			return nil, err
+	// the service account and the secrets of the pipelineRun are deleted with it
+	owned := map[string]string{plan.ServiceAccountName: k8s.ServiceAccount, plan.DockerConfigName: k8s.TektonConfig}
+	if plan.BuildSecretName != "" {
+		owned[plan.BuildSecretName] = k8s.TektonConfig
+	}
+	if plan.GitCredentialName == gitCredentialSecretName(prName) {
+		owned[plan.GitCredentialName] = k8s.TektonConfig
+	}
+	for name, resource := range owned {
+		if err := c.setPipelineRunOwner(ctx, resource, name, obj); err != nil {
+			return err
 		}
-		return obj, nil
 	}
-
-	return obj, nil
+	ci.Spec.PipelineRun, ci.Spec.Steps, ci.Spec.Diagnosis, ci.Spec.Scan, ci.Spec.SBOM = prName, nil, nil, nil, ""
+	return nil
 }
 
-func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName)
+func (c *Service) checkAndRecreateGitConfig(ctx context.Context) (*unstructured.Unstructured, error) {
+	username, password, err := credentials.Account(ctx, c.credentials, credentials.Git)
+	if err != nil {
+		return nil, fmt.Errorf("load git credential error (%s)", err)
+	}
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName)
 
 	configParams := params{
 		Namespace:    common.YceCloudExtensionsOps,
 		Name:         services.TektonGitConfigName,
 		ConfigGitUrl: services.ConfigGitUrl,
-		GitUsername:  base64.StdEncoding.EncodeToString([]byte(services.ConfigGitUser)),
-		GitPassword:  base64.StdEncoding.EncodeToString([]byte(services.ConfigGitPassword)),
+		GitUsername:  base64.StdEncoding.EncodeToString([]byte(username)),
+		GitPassword:  base64.StdEncoding.EncodeToString([]byte(password)),
 	}
 	defaultConfig, err := services.Render(configParams, configGitTpl)
 	if err != nil {
 		return nil, err
 	}
 	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
@@ -566,67 +1016,33 @@ func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error
 	}
 
 	if !tools.CompareSpecByUnstructured(defaultConfig, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	serverAccount, err := c.Get(common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
-	if err != nil {
-		return nil, err
-	}
-
-	serviceAccountBytes, err := serverAccount.MarshalJSON()
-	if err != nil {
-		return nil, err
-	}
-	secretsPath := "secrets"
-
-	var newValue = make([]string, 0)
-	gjson.Get(string(serviceAccountBytes), secretsPath).
-		ForEach(
-			func(_, v gjson.Result) bool {
-				newValue = append(newValue, v.String())
-				return true
-			})
-
-	if len(newValue) < 1 {
-		return nil, fmt.Errorf("get secrets not value")
-	}
-
-	if !tools.ContainStringItem(newValue, services.TektonGitConfigName) {
-		newValue = append(newValue, services.TektonGitConfigName)
-		newServiceAccountString, err := sjson.Set(string(serviceAccountBytes), secretsPath, newValue)
-		if err != nil {
-			return nil, err
-		}
-		serviceAccount := &unstructured.Unstructured{}
-		if err := serviceAccount.UnmarshalJSON([]byte(newServiceAccountString)); err != nil {
-			return nil, err
-		}
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
-		return obj, nil
 	}
 
+	// the secret is attached to the service account of the pipelineRun without matched git credential
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.Task, services.TaskName)
+func (c *Service) checkAndRecreateTask(ctx context.Context, plan *plan) (*unstructured.Unstructured, error) {
+	taskName := plan.TaskName()
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.Task, taskName)
 	taskParams := params{
-		Namespace: common.YceCloudExtensionsOps,
-		Name:      services.TaskName,
+		Namespace:     common.YceCloudExtensionsOps,
+		Name:          taskName,
+		CachePaths:    plan.CachePaths,
+		PreBuild:      plan.PreBuild,
+		BuildStep:     plan.Builder.Step(c.buildOptions(plan)),
+		TektonVersion: services.TektonVersion(c.ResourceLister),
 	}
-	defaultTask, err := services.Render(taskParams, taskTpl)
+	defaultTask, err := services.Render(taskParams, c.template(taskTpl, taskV1Tpl))
 	if err != nil {
 		return nil, err
 	}
 	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.TaskName, defaultTask, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Task, taskName, defaultTask, false)
 		if err != nil {
 			return nil, err
 		}
@@ -634,7 +1050,7 @@ func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
 	}
 
 	if !tools.CompareSpecByUnstructured(defaultTask, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.TaskName, defaultTask, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Task, taskName, defaultTask, false)
 		if err != nil {
 			return nil, err
 		}
@@ -642,21 +1058,43 @@ func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error) {
-	getObj, err := c.Get(common.YceCloudExtensionsOps, k8s.Pipeline, services.TaskName)
+func (c *Service) checkAndRecreatePipeline(ctx context.Context, plan *plan) (*unstructured.Unstructured, error) {
+	pipelineName := plan.PipelineName()
+	getObj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, pipelineName)
 	pipelineParams := params{
-		Namespace:     common.YceCloudExtensionsOps,
-		Name:          services.PipelineName,
-		PipelineGraph: services.PipelineGraphName,
-		TaskName:      services.TaskName,
+		Namespace:        common.YceCloudExtensionsOps,
+		Name:             pipelineName,
+		PipelineGraph:    plan.PipelineGraphName(),
+		TaskName:         plan.TaskName(),
+		Platforms:        plan.Platforms,
+		ManifestTaskName: services.ManifestTaskName,
+		Images:           plan.Images,
+		GitCloneTaskName: services.GitCloneTaskName,
+		TektonVersion:    services.TektonVersion(c.ResourceLister),
+	}
+	if plan.SBOM != nil {
+		pipelineParams.SBOMTaskName, pipelineParams.SBOM = services.SBOMTaskName, plan.SBOM
+	}
+	if plan.Scan {
+		pipelineParams.ScanTaskName = services.ScanTaskName
+	}
+	if plan.Sign {
+		pipelineParams.SignTaskName = services.SignTaskName
 	}
-	obj, err := services.Render(pipelineParams, pipelineTpl)
+	tpl := c.template(pipelineTpl, pipelineV1Tpl)
+	switch {
+	case len(plan.Images) > 0:
+		tpl = imagesPipelineV1Tpl
+	case len(plan.Platforms) > 0:
+		tpl = multiArchPipelineV1Tpl
+	}
+	obj, err := services.Render(pipelineParams, tpl)
 	if err != nil {
 		return nil, err
 	}
 
 	if errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.PipelineName, obj, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, pipelineName, obj, false)
 		if err != nil {
 			return nil, err
 		}
@@ -668,7 +1106,7 @@ func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error)
 	}
 
 	if !tools.CompareSpecByUnstructured(obj, getObj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.PipelineName, obj, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, pipelineName, obj, false)
 		if err != nil {
 			return nil, err
 		}
@@ -678,9 +1116,11 @@ func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error)
 }
 
 func (c *Service) checkAndRecreatePipelineRun(
+	ctx context.Context,
+	plan *plan,
 	name,
 	projectName,
-	projectVersion,
+	commitID,
 	pipelineRunGraphName,
 	pipelineResourceName,
 	outputUrl string,
@@ -688,6 +1128,8 @@ func (c *Service) checkAndRecreatePipelineRun(
 	codeType string,
 	projectPath string,
 	projectFile string,
+	gitUrl string,
+	branch string,
 
 ) (*unstructured.Unstructured, error) {
 	_outputUrl := services.DestRepoUrl
@@ -698,37 +1140,82 @@ func (c *Service) checkAndRecreatePipelineRun(
 		codeType = "none"
 	}
 	if strings.Trim(projectFile, " ") == "" || projectFile == "" {
-		projectFile = `Dockerfile`
+		projectFile = plan.Dockerfile
 	}
 	if strings.Trim(projectPath, " ") == "" || projectPath == "" {
 		projectPath = `"*"`
 	}
+	// the platform tasks run on the nodes of different arch, can't share a ReadWriteOnce volume
+	workspaceSize := services.WorkspaceSize
+	if len(plan.Platforms) > 0 {
+		workspaceSize = ""
+	}
+	// the image tasks share the clone of the volume
+	if len(plan.Images) > 0 && workspaceSize == "" {
+		workspaceSize = imagesWorkspaceSize
+	}
 	pipelineRunParams := params{
 		Namespace:            common.YceCloudExtensionsOps,
 		Name:                 name,
-		PipelineName:         services.PipelineName,
-		PipelineGraph:        services.PipelineGraphName,
+		PipelineName:         plan.PipelineName(),
+		PipelineGraph:        plan.PipelineGraphName(),
 		PipelineRunGraph:     pipelineRunGraphName,
 		PipelineResourceName: pipelineResourceName,
+		CIName:               plan.CIName,
+		BranchName:           plan.BranchName,
+		ServiceAccountName:   plan.ServiceAccountName,
+		DockerConfigName:     plan.DockerConfigName,
 		ProjectName:          projectName,
-		ProjectVersion:       projectVersion,
-		BuildToolImage:       services.BuildToolImage,
+		ProjectVersion:       plan.Tagging.Primary(),
+		BuildToolImage:       plan.BuilderImage(),
+		CheckDockerFile:      services.CheckDockerFile,
 		DestRepoUrl:          _outputUrl,
 		CacheRepoUrl:         services.CacheRepoUrl,
 		CodeType:             codeType,
 		ProjectPath:          projectPath,
 		ProjectFile:          projectFile,
-	}
-	defaultObj, err := services.Render(pipelineRunParams, pipelineRunTpl)
+		GitUrl:               gitUrl,
+		Branch:               branch,
+		CommitID:             commitID,
+		GitCloneImage:        services.GitCloneImage,
+		WorkspaceSize:        workspaceSize,
+		Platforms:            plan.Platforms,
+		ManifestToolImage:    services.ManifestToolImage,
+		Tags:                 strings.Join(plan.Tagging.Extra(), " "),
+		SemverTag:            plan.Tagging.Semver,
+		BuildArgs:            append(plan.Builder.BuildArgs(plan.BuildArgs), plan.Builder.Labels(plan.Labels)...),
+		BuildSecretName:      plan.BuildSecretName,
+		Images:               plan.Images,
+		DependencyCache:      plan.DependencyCache,
+		Timeout:              podTimeout(plan.Pod),
+		PodTemplate:          podTemplate(plan.Pod),
+		NodeSelector:         plan.Pod.NodeSelector,
+		StepResources:        stepResources(plan.Pod),
+		ResourceSteps:        resourceSteps(plan.PreBuild),
+		BuildTaskNames:       plan.BuildTaskNames(),
+		TektonVersion:        services.TektonVersion(c.ResourceLister),
+	}
+	if plan.SBOM != nil {
+		pipelineRunParams.SBOMToolImage, pipelineRunParams.SBOMPushImage = services.SBOMToolImage, services.SBOMPushImage
+	}
+	if plan.Scan {
+		pipelineRunParams.ScanImage, pipelineRunParams.ScanThreshold = services.ScanImage, c.scanThreshold.String()
+		pipelineRunParams.ScanDeleteImage = services.ScanDeleteImage
+	}
+	if plan.Sign {
+		pipelineRunParams.SignImage, pipelineRunParams.SignKeySecret = services.SignImage, services.SignKeySecret
+	}
+	defaultObj, err := services.Render(pipelineRunParams, c.template(pipelineRunTpl, pipelineRunV1Tpl))
 	if err != nil {
 		return nil, err
 	}
+	services.SetOwner(defaultObj, plan.Owner)
 
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// create pipelineRun
-			obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
+			obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
 			if err != nil {
 				return nil, err
 			}
@@ -737,15 +1224,15 @@ func (c *Service) checkAndRecreatePipelineRun(
 		return nil, err
 	}
 
-	err = c.Delete(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	err = c.Delete(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
 	if err != nil {
 		return nil, err
 	}
-	pipelineRunGraph, err = c.checkAndRecreateGraph(pipelineRunGraph.GetName())
+	pipelineRunGraph, err = c.checkAndRecreateGraph(ctx, pipelineRunGraph.GetName(), plan.TaskName())
 	if err != nil {
 		return nil, err
 	}
@@ -762,7 +1249,7 @@ OWNER_REF:
 		return nil, err
 	}
 
-	pipelineRunGraphObj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, pipelineRunGraphName, pipelineRunGraphObj, false)
+	pipelineRunGraphObj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonGraph, pipelineRunGraphName, pipelineRunGraphObj, false)
 	if err != nil {
 		return nil, err
 	}
@@ -770,23 +1257,506 @@ OWNER_REF:
 	return obj, err
 }
 
-func (c *Service) checkAndRecreateGraph(name string) (*unstructured.Unstructured, error) {
+func (c *Service) checkAndRecreateBuildSecret(ctx context.Context, name string, secrets []v1.BuildSecret) (*unstructured.Unstructured, error) {
+	data, err := buildSecretData(secrets, func(secretName string) (*unstructured.Unstructured, error) {
+		return c.Get(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, secretName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	secretParams := params{
+		Namespace:  common.YceCloudExtensionsOps,
+		Name:       name,
+		SecretData: data,
+	}
+	obj, err := services.Render(secretParams, secretTpl)
+	if err != nil {
+		return nil, fmt.Errorf("render build secret %s error", name)
+	}
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, name, obj, false)
+	if err != nil {
+		return nil, fmt.Errorf("apply build secret %s error", name)
+	}
+	return obj, nil
+}
+
+func (c *Service) setPipelineRunOwner(ctx context.Context, resource, name string, pipelineRun *unstructured.Unstructured) error {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, resource, name)
+	if err != nil {
+		return err
+	}
+	objBytes, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	obj, err = tools.SetObjectOwner(objBytes, pipelineRun.GetAPIVersion(), pipelineRun.GetKind(), pipelineRun.GetName(), string(pipelineRun.GetUID()))
+	if err != nil {
+		return err
+	}
+	if _, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, resource, name, obj, false); err != nil {
+		return fmt.Errorf("set %s %s owner error (%s)", resource, name, err)
+	}
+	return nil
+}
+
+// checkAndRecreateGitCredential copy the credential matched the git url for the pipelineRun,
+// return the global git config if no credential matched
+func (c *Service) checkAndRecreateGitCredential(ctx context.Context, prName, gitUrl string) (string, error) {
+	remote, err := parseGitURL(gitUrl)
+	if err != nil {
+		return "", err
+	}
+	list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, "", 0, 0, fmt.Sprintf("%s=true", GitCredentialLabel))
+	if err != nil {
+		return "", fmt.Errorf("list git credentials error (%s)", err)
+	}
+	credential := matchGitCredential(GitCredentialsFromSecrets(list.Items), remote)
+	if credential == nil {
+		return services.TektonGitConfigName, nil
+	}
+
+	data := make(map[string]string, len(credential.Data)+1)
+	for key, value := range credential.Data {
+		data[key] = value
+	}
+	secretType := basicAuthSecretType
+	if credential.SSH {
+		secretType = sshAuthSecretType
+		if !credential.HasKnownHosts() {
+			knownHosts, err := gitKnownHosts()
+			if err != nil {
+				return "", err
+			}
+			if knownHosts == "" {
+				common.Printf(ctx, common.WARN, "git credential %s has no known_hosts, the host key of %s is not verified\n", credential.SecretName, remote.Host)
+			} else {
+				data[knownHostsKey] = base64.StdEncoding.EncodeToString([]byte(knownHosts))
+			}
+		}
+	}
+
+	name := gitCredentialSecretName(prName)
+	obj, err := services.Render(params{
+		Namespace:        common.YceCloudExtensionsOps,
+		Name:             name,
+		SecretType:       secretType,
+		SecretData:       data,
+		GitCredentialUrl: remote.TektonURL(),
+	}, gitCredentialTpl)
+	if err != nil {
+		return "", fmt.Errorf("render git credential %s error", name)
+	}
+	if _, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, name, obj, false); err != nil {
+		return "", fmt.Errorf("apply git credential %s error", name)
+	}
+	return name, nil
+}
+
+// checkAndRecreateDockerConfig generate the docker config.json of the registries the pipelineRun push to,
+// the credential of the registry secrets first, then the registry account of the -credentials-provider
+func (c *Service) checkAndRecreateDockerConfig(ctx context.Context, prName string, hosts []string) (string, error) {
+	matched, missing, err := c.registryCredentials(ctx, hosts)
+	if err != nil {
+		return "", err
+	}
+	for _, host := range missing {
+		common.Printf(ctx, common.WARN, "registry %s has no credential, push anonymously\n", host)
+	}
+	configJSON, err := registry.DockerConfigJSON(matched)
+	if err != nil {
+		return "", err
+	}
+
+	name := dockerConfigSecretName(prName)
+	obj, err := services.Render(params{
+		Namespace:  common.YceCloudExtensionsOps,
+		Name:       name,
+		SecretType: registry.DockerConfigJSONSecretType,
+		SecretData: map[string]string{registry.DockerConfigJSONKey: base64.StdEncoding.EncodeToString(configJSON)},
+	}, secretTpl)
+	if err != nil {
+		return "", fmt.Errorf("render docker config %s error", name)
+	}
+	if _, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, name, obj, false); err != nil {
+		return "", fmt.Errorf("apply docker config %s error", name)
+	}
+	return name, nil
+}
+
+// imageCheck the image checked built of the commit with the labels
+type imageCheck struct {
+	Ref    *registry.ImageRef
+	Labels map[string]string
+}
+
+// reuseBuiltImages the result of each image if all the images were built with the labels, the extra tags
+// are added to them, nil if any image is not built
+func (c *Service) reuseBuiltImages(ctx context.Context, checks []*imageCheck, tagging *Tagging) ([]v1.CIImage, error) {
+	hosts := make([]string, 0, len(checks))
+	for _, check := range checks {
+		hosts = append(hosts, check.Ref.Host)
+	}
+	matched, _, err := c.registryCredentials(ctx, hosts)
+	if err != nil {
+		return nil, err
+	}
+	type built struct {
+		client    *registry.Client
+		body      []byte
+		mediaType string
+		digest    string
+	}
+	found := make([]*built, 0, len(checks))
+	for _, check := range checks {
+		var credential *registry.Credential
+		for _, item := range matched {
+			if item.Host == check.Ref.Host {
+				credential = item
+				break
+			}
+		}
+		client := registry.NewClient(credential, services.InsecureRegistryHosts())
+		body, mediaType, digest, err := client.BuiltImage(ctx, check.Ref, check.Labels)
+		if err != nil || digest == "" {
+			return nil, err
+		}
+		found = append(found, &built{client: client, body: body, mediaType: mediaType, digest: digest})
+	}
+
+	results := make([]v1.CIImage, 0, len(checks))
+	for index, check := range checks {
+		image := found[index]
+		tags := []string{check.Ref.Tag}
+		for _, tag := range tagging.Extra() {
+			if err := image.client.PutManifest(ctx, check.Ref, tag, image.body, image.mediaType); err != nil {
+				common.Printf(ctx, common.WARN, "tag the built image %s error (%s)\n", tag, err)
+				continue
+			}
+			tags = append(tags, tag)
+		}
+		common.Printf(ctx, common.INFO, "image %s@%s already built, skip the build\n", check.Ref, image.digest)
+		results = append(results, v1.CIImage{AckState: v1.SuccessState, ImageDigest: image.digest, Tags: tags})
+	}
+	return results, nil
+}
+
+// setBuiltImages finish the ci with the results of the reused images in the order of the checks,
+// the images resolved before, e.g. unchanged, are not checked
+func setBuiltImages(ci *v1.CI, images []v1.CIImage) {
+	ci.Spec.Done = true
+	ci.Spec.AckStates = []string{v1.SuccessState}
+	if len(ci.Spec.Images) == 0 {
+		ci.Spec.ImageDigest, ci.Spec.Tags = images[0].ImageDigest, images[0].Tags
+		return
+	}
+	for index := range ci.Spec.Images {
+		if ci.Spec.Images[index].AckState != "" {
+			continue
+		}
+		ci.Spec.Images[index].AckState = images[0].AckState
+		ci.Spec.Images[index].ImageDigest = images[0].ImageDigest
+		ci.Spec.Images[index].Tags = images[0].Tags
+		images = images[1:]
+	}
+}
+
+// filterUnchanged report the image of the last successful build for the project paths unchanged since it,
+// the unchanged images of the monorepo build are dropped from the plan, return true if nothing left to build
+func (c *Service) filterUnchanged(ctx context.Context, ci *v1.CI, plan *plan) (bool, error) {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.BuildRecordsName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get build records error (%s)", err)
+	}
+	records := BuildRecordsFromConfigMap(obj)
+	remote, err := parseGitURL(*ci.Spec.GitURL)
+	if err != nil {
+		return false, err
+	}
+	token, err := c.gitToken(ctx, remote)
+	if err != nil {
+		return false, err
+	}
+	// the ssh key can't call the git provider api, the repository cloned by ssh needs a basic-auth credential of the host
+	if token == "" && remote.SSH {
+		common.Printf(ctx, common.WARN, "no api token of the ssh repository %s/%s, build without the path filter\n", remote.Host, remote.Path)
+		return false, nil
+	}
+	compare := newGitCompare(gitProvider(c.gitProviders, remote.Host), remote, token)
+	changes := newChangeSet(*ci.Spec.CommitID, func(from, to string) ([]string, error) {
+		return compare.changedFiles(ctx, from, to)
+	})
+	globalPaths := splitPaths(services.WatchPaths)
+	targets := ciBuildRecords(ci)
+
+	if len(ci.Spec.Images) == 0 {
+		projectFile := ci.Spec.ProjectFile
+		if strings.TrimSpace(projectFile) == "" {
+			projectFile = plan.Dockerfile
+		}
+		record := records[targets[0].Key()]
+		unchanged, err := changes.unchanged(record, watchPaths(ci.Spec.ProjectPath, projectFile, ci.Spec.WatchPaths, globalPaths))
+		if err != nil || !unchanged {
+			return false, err
+		}
+		common.Printf(ctx, common.INFO, "project path %s unchanged since %s, skip the build\n", ci.Spec.ProjectPath, record.CommitID)
+		ci.Spec.Done = true
+		ci.Spec.AckStates = []string{v1.SuccessState}
+		ci.Spec.ImageDigest, ci.Spec.Tags = record.ImageDigest, record.Tags
+		return true, nil
+	}
+
+	unchanged := make(map[int]*BuildRecord)
+	for index, image := range plan.Images {
+		record := records[targets[index].Key()]
+		ok, err := changes.unchanged(record, watchPaths(image.ProjectPath, image.ProjectFile, ci.Spec.Images[index].WatchPaths, globalPaths))
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			unchanged[index] = record
+		}
+	}
+	kept := make([]*ImageBuild, 0, len(plan.Images))
+	for index, image := range plan.Images {
+		record, exist := unchanged[index]
+		if !exist {
+			image.Index = len(kept)
+			kept = append(kept, image)
+			continue
+		}
+		common.Printf(ctx, common.INFO, "project path %s unchanged since %s, skip the build\n", image.ProjectPath, record.CommitID)
+		ci.Spec.Images[index].AckState = v1.SuccessState
+		ci.Spec.Images[index].ImageDigest, ci.Spec.Images[index].Tags = record.ImageDigest, record.Tags
+	}
+	plan.Images = kept
+	if len(kept) > 0 {
+		return false, nil
+	}
+	ci.Spec.Done = true
+	ci.Spec.AckStates = []string{v1.SuccessState}
+	return true, nil
+}
+
+// recordBuilds save the successful builds of the ci as the last builds of the project paths,
+// the concurrent builds update the records too, the records are saved to the latest version
+func (c *Service) recordBuilds(ctx context.Context, ci *v1.CI) {
+	if !services.PathFilter {
+		return
+	}
+	err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		return c.saveBuildRecords(ctx, ci)
+	})
+	if err != nil {
+		common.Printf(ctx, common.WARN, "save build records error (%s)\n", err)
+	}
+}
+
+// saveBuildRecords merge the records of the ci into the build records read, the conflict error is returned
+// when the records changed since read, the already exists error when the records created since read
+func (c *Service) saveBuildRecords(ctx context.Context, ci *v1.CI) error {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.BuildRecordsName)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("get build records error (%s)", err)
+	}
+	create := err != nil
+	if create {
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetName(services.BuildRecordsName)
+		obj.SetNamespace(common.YceCloudExtensionsOps)
+	}
+	for _, record := range ciBuildRecords(ci) {
+		if record.ImageDigest == "" {
+			continue
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		if err := unstructured.SetNestedField(obj.Object, string(data), "data", record.Key()); err != nil {
+			return fmt.Errorf("set build record error (%s)", err)
+		}
+	}
+	if create {
+		_, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.BuildRecordsName, obj, false)
+		return err
+	}
+	_, err = c.Update(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, obj)
+	return err
+}
+
+// gitToken the password of the basic-auth git credential matched the repository, the git account
+// of the -credentials-provider if no credential matched
+func (c *Service) gitToken(ctx context.Context, remote *gitRemote) (string, error) {
+	list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, "", 0, 0, fmt.Sprintf("%s=true", GitCredentialLabel))
+	if err != nil {
+		return "", fmt.Errorf("list git credentials error (%s)", err)
+	}
+	if credential := matchGitCredential(GitCredentialsFromSecrets(list.Items), apiRemote(remote)); credential != nil {
+		password, err := base64.StdEncoding.DecodeString(credential.Data["password"])
+		if err != nil {
+			return "", fmt.Errorf("illegal git credential %s", credential.SecretName)
+		}
+		return string(password), nil
+	}
+	_, password, err := credentials.Account(ctx, c.credentials, credentials.Git)
+	if err != nil {
+		return "", fmt.Errorf("load git credential error (%s)", err)
+	}
+	return password, nil
+}
+
+// registryCredentials the credentials of the hosts, the registry secrets first, then the registry
+// account of the -credentials-provider, the hosts without credential are returned as missing
+func (c *Service) registryCredentials(ctx context.Context, hosts []string) ([]*registry.Credential, []string, error) {
+	return registry.LoadCredentials(ctx, c.IDataSource, c.credentials, services.ConfigRegistryUrl, hosts)
+}
+
+// gitKnownHosts the -git-known-hosts file, read on each build so the updated file take effect
+func gitKnownHosts() (string, error) {
+	if services.GitKnownHosts == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(services.GitKnownHosts)
+	if err != nil {
+		return "", fmt.Errorf("read git known hosts error (%s)", err)
+	}
+	return string(data), nil
+}
+
+// checkAndRecreateServiceAccount the service account of the pipelineRun attached the credentials of the build only,
+// the concurrent builds never share the mutated default service account. The secrets of the existing service
+// account are replaced by the desired secrets, the rotated or removed credentials never stay attached
+func (c *Service) checkAndRecreateServiceAccount(ctx context.Context, name string, secrets []string) (*unstructured.Unstructured, error) {
+	obj, err := services.Render(params{
+		Namespace:             common.YceCloudExtensionsOps,
+		Name:                  name,
+		ServiceAccountSecrets: secrets,
+	}, serviceAccountTpl)
+	if err != nil {
+		return nil, err
+	}
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.ServiceAccount, name, obj, false)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// checkAndRecreateDependencyCache the cache volume of the build marked used, created if not exist
+func (c *Service) checkAndRecreateDependencyCache(ctx context.Context, profile *Profile, gitUrl string) (*DependencyCache, error) {
+	cache, err := NewDependencyCache(services.DependencyCacheScope, profile, gitUrl, services.DependencyCacheSize, services.DependencyCacheStorageClass)
+	if err != nil || cache == nil {
+		return nil, err
+	}
+	if err := cache.SetAccessMode(services.DependencyCacheAccessMode); err != nil {
+		return nil, err
+	}
+	lastUsed := time.Now().UTC().Format(time.RFC3339)
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.PersistentVolumeClaim, cache.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		// the pod of the volume being deleted can't be scheduled
+		if obj.GetDeletionTimestamp() != nil {
+			return nil, fmt.Errorf("dependency cache %s is being deleted", cache.Name)
+		}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[LastUsedAnnotation] = lastUsed
+		obj.SetAnnotations(annotations)
+	} else {
+		obj, err = services.Render(params{
+			Namespace:       common.YceCloudExtensionsOps,
+			DependencyCache: cache,
+			LastUsed:        lastUsed,
+		}, dependencyCacheTpl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PersistentVolumeClaim, cache.Name, obj, false); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// collectDependencyCaches delete the least recently used cache volumes over the -dependency-cache-total-size
+func (c *Service) collectDependencyCaches(ctx context.Context, total int64) {
+	ticker := time.NewTicker(dependencyCacheGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.PersistentVolumeClaim, "", 0, 0, fmt.Sprintf("%s=true", DependencyCacheLabel))
+		if err != nil {
+			fmt.Printf("%s service ci list dependency caches error (%s)\n", common.ERROR, err)
+			continue
+		}
+		for _, name := range evictDependencyCaches(list.Items, total, time.Now()) {
+			if err := c.Delete(ctx, common.YceCloudExtensionsOps, k8s.PersistentVolumeClaim, name); err != nil && !errors.IsNotFound(err) {
+				fmt.Printf("%s service ci delete dependency cache %s error (%s)\n", common.ERROR, name, err)
+				continue
+			}
+			fmt.Printf("%s service ci delete the least recently used dependency cache %s\n", common.INFO, name)
+		}
+	}
+}
+
+// checkAndRecreateSharedTask the task of the template shared by the pipelines, e.g. the manifest task
+func (c *Service) checkAndRecreateSharedTask(ctx context.Context, name, tpl string) (*unstructured.Unstructured, error) {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.Task, name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	taskParams := params{
+		Namespace:     common.YceCloudExtensionsOps,
+		Name:          name,
+		TektonVersion: services.TektonVersion(c.ResourceLister),
+	}
+	defaultTask, err := services.Render(taskParams, tpl)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil || !tools.CompareSpecByUnstructured(defaultTask, obj) {
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Task, name, defaultTask, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+func (c *Service) checkAndRecreateGraph(ctx context.Context, name, taskName string) (*unstructured.Unstructured, error) {
 	graphParams := params{
 		Namespace: common.YceCloudExtensionsOps,
 		Name:      name,
+		TaskName:  taskName,
 	}
 	obj, err := services.Render(graphParams, graphTpl)
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, name, obj, false)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonGraph, name, obj, false)
 	if err != nil {
 		return nil, err
 	}
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreatePipelineResource(name, gitUrl, branch string) (*unstructured.Unstructured, error) {
+func (c *Service) checkAndRecreatePipelineResource(ctx context.Context, name, gitUrl, branch string, owner *metav1.OwnerReference) (*unstructured.Unstructured, error) {
 	pipelineResourceParams := params{
 		Namespace: common.YceCloudExtensionsOps,
 		Name:      name,
@@ -797,15 +1767,99 @@ func (c *Service) checkAndRecreatePipelineResource(name, gitUrl, branch string)
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineResource, name, obj, false)
+	services.SetOwner(obj, owner)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineResource, name, obj, false)
 	if err != nil {
 		return nil, err
 	}
 	return obj, nil
 }
 
-func pipelineRunName(name string) string {
-	return strings.Replace(
-		strings.Replace(strings.ToLower(
-			name), "_", "-", -1), ".", "-", -1)
+// profile the build profile of the code type, the profiles of the configmap
+// are read on each reconcile so the change take effect without restart
+func (c *Service) profile(ctx context.Context, codeType string) (*Profile, error) {
+	profiles := c.profiles
+	if services.BuildProfileConfigMap != "" {
+		obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.BuildProfileConfigMap)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("get build profile configmap %s error (%s)", services.BuildProfileConfigMap, err)
+		}
+		if err == nil {
+			items, err := ProfilesFromConfigMap(obj)
+			if err != nil {
+				return nil, fmt.Errorf("illegal build profile configmap %s (%s)", services.BuildProfileConfigMap, err)
+			}
+			if profiles, err = profiles.With(items); err != nil {
+				return nil, fmt.Errorf("illegal build profile configmap %s (%s)", services.BuildProfileConfigMap, err)
+			}
+		}
+	}
+	return profiles.Get(codeType), nil
+}
+
+// podSettings the build pod settings of the request over the project over the default of the
+// -build-pod-configmap over the flags, the configmap is read on each reconcile like the profiles
+func (c *Service) podSettings(ctx context.Context, projectName string, request *v1.BuildPod) (*v1.BuildPod, error) {
+	if request != nil {
+		if err := validateRequestPod(request); err != nil {
+			return nil, rejectf("illegal build pod of the request (%s)", err)
+		}
+	}
+	pods := make(map[string]*v1.BuildPod)
+	if services.BuildPodConfigMap != "" {
+		obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, services.BuildPodConfigMap)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("get build pod configmap %s error (%s)", services.BuildPodConfigMap, err)
+		}
+		if err == nil {
+			if pods, err = BuildPodsFromConfigMap(obj); err != nil {
+				return nil, fmt.Errorf("illegal build pod configmap %s (%s)", services.BuildPodConfigMap, err)
+			}
+		}
+	}
+	return mergeBuildPods(c.buildPod, pods[DefaultBuildPod], pods[projectName], request), nil
+}
+
+// tektonAPIFields the enable-api-fields of the tekton feature-flags configmap, stable if not set
+func (c *Service) tektonAPIFields(ctx context.Context) (string, error) {
+	obj, err := c.Get(ctx, services.TektonNamespace, k8s.ConfigMap, tektonFeatureFlags)
+	if err != nil && !errors.IsNotFound(err) {
+		return "", fmt.Errorf("get tekton feature flags error (%s)", err)
+	}
+	if err != nil {
+		return "stable", nil
+	}
+	apiFields, _, _ := unstructured.NestedString(obj.Object, "data", "enable-api-fields")
+	if apiFields == "" {
+		return "stable", nil
+	}
+	return apiFields, nil
+}
+
+// buildOptions the source directory and result of the task written for the served tekton version
+func (c *Service) buildOptions(plan *plan) BuildOptions {
+	if c.legacy() {
+		return BuildOptions{Context: "/workspace/git", LayerCache: plan.LayerCache, DockerConfig: "/tekton/home/.docker"}
+	}
+	return BuildOptions{
+		Context:      "$(workspaces.source.path)/git",
+		DockerConfig: fmt.Sprintf("$(workspaces.%s.path)", dockerConfigWorkspace),
+		DigestFile:   "$(results.image_digest.path)",
+		LayerCache:   plan.LayerCache,
+		BuildArgs:    true,
+		SecretsDir:   fmt.Sprintf("$(workspaces.%s.path)", buildSecretsWorkspace),
+	}
+}
+
+// legacy the cluster served tekton v1alpha1 with PipelineResource
+func (c *Service) legacy() bool {
+	return services.TektonVersion(c.ResourceLister) == services.TektonLegacyVersion
+}
+
+// template pick the template written for the served tekton version
+func (c *Service) template(legacyTpl, tpl string) string {
+	if c.legacy() {
+		return legacyTpl
+	}
+	return tpl
 }
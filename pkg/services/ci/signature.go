@@ -0,0 +1,4 @@
+package ci
+
+// SignTask the pipeline task sign the pushed image
+const SignTask = "sign"
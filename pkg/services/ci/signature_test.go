@@ -0,0 +1,87 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSignPipelineRender(t *testing.T) {
+	pipelineTask := func(obj *unstructured.Unstructured, name string) map[string]interface{} {
+		tasks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tasks")
+		for _, task := range tasks {
+			if task.(map[string]interface{})["name"] == name {
+				return task.(map[string]interface{})
+			}
+		}
+		return nil
+	}
+
+	p := &params{Namespace: "test", Name: "test", TaskName: "yce-cloud-extensions-task", TektonVersion: "v1"}
+	obj, err := services.Render(p, pipelineV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineTask(obj, SignTask) != nil {
+		t.Fatal("unexpected sign task without the image sign")
+	}
+	p.SignTaskName = services.SignTaskName
+	if obj, err = services.Render(p, pipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	if task := pipelineTask(obj, SignTask); task == nil || task["runAfter"] != nil {
+		t.Fatalf("unexpected sign task %v", task)
+	}
+	// the image is signed after the scan gate
+	p.ScanTaskName = services.ScanTaskName
+	if obj, err = services.Render(p, pipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	if runAfter, _, _ := unstructured.NestedStringSlice(pipelineTask(obj, SignTask), "runAfter"); !reflect.DeepEqual(runAfter, []string{ScanTask}) {
+		t.Fatalf("expected the sign task run after the scan, got %v", runAfter)
+	}
+
+	platforms, _ := ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	p.Platforms, p.ManifestTaskName = platforms, services.ManifestTaskName
+	if obj, err = services.Render(p, multiArchPipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	if pipelineTask(obj, SignTask) == nil {
+		t.Fatal("expected the image index signed")
+	}
+
+	builds, _ := NewImageBuilds([]v1.CIImage{{ProjectPath: "order"}, {ProjectPath: "payment"}}, "mall", "harbor.ym/devops", "Dockerfile", "b8f3c2a1")
+	p.Platforms, p.Images, p.GitCloneTaskName = nil, builds, services.GitCloneTaskName
+	if obj, err = services.Render(p, imagesPipelineV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+	task := pipelineTask(obj, "sign-image-1")
+	if runAfter, _, _ := unstructured.NestedStringSlice(task, "runAfter"); !reflect.DeepEqual(runAfter, []string{"scan-image-1"}) {
+		t.Fatalf("unexpected sign task of the image %v", task)
+	}
+	if ref, _, _ := unstructured.NestedString(task, "taskRef", "name"); ref != services.SignTaskName {
+		t.Fatalf("unexpected sign task ref %s", ref)
+	}
+
+	obj, err = services.Render(&params{Namespace: "test", Name: "test-run", PipelineName: "test", SignImage: "gcr.io/projectsigstore/cosign:v2.2.0", SignKeySecret: "cosign", TektonVersion: "v1"}, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaces, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	found := false
+	for _, workspace := range workspaces {
+		if secretName, _, _ := unstructured.NestedString(workspace.(map[string]interface{}), "secret", "secretName"); secretName == "cosign" {
+			found = workspace.(map[string]interface{})["name"] == "sign-key"
+		}
+	}
+	if !found {
+		t.Fatalf("expected the key secret bound to the sign-key workspace, got %v", workspaces)
+	}
+
+	if _, err := services.Render(&params{Namespace: "test", Name: services.SignTaskName, TektonVersion: "v1"}, signTaskV1Tpl); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// the policy of the ci request superseded by a newer commit of the same project and branch
+const (
+	// SupersedeCancel cancel the older request and its pipelineRun
+	SupersedeCancel = "cancel"
+	// SupersedeQueue let the older request finish, the newer one is queued until then
+	SupersedeQueue = "queue"
+	// SupersedeParallel run both requests under distinct names
+	SupersedeParallel = "parallel"
+)
+
+const (
+	// CILabel the ci request of the pipelineRun
+	CILabel = "yce-cloud-extensions/ci"
+	// BranchLabel the base name {project}-{branch} shared by the ci requests of the same project and branch
+	BranchLabel = "yce-cloud-extensions/branch"
+	// shortCommitLength the commit id length in the name of the pipelineRun and the superseding request
+	shortCommitLength = 8
+	// maxNameLength the name of the pipelineRun is copied into the labels by tekton
+	maxNameLength = 63
+)
+
+func validateSupersedePolicy(policy string) error {
+	switch policy {
+	case SupersedeCancel, SupersedeQueue, SupersedeParallel:
+		return nil
+	}
+	return fmt.Errorf("supersede policy %s not supported", policy)
+}
+
+// SupersedePolicies the -supersede-policy and the policy of the project by -project-supersede-policies
+type SupersedePolicies struct {
+	Default  string
+	Projects map[string]string
+}
+
+// NewSupersedePolicies parse the policies, e.g. "project-a=queue,project-b=parallel"
+func NewSupersedePolicies(policy, projects string) (*SupersedePolicies, error) {
+	result := &SupersedePolicies{Default: SupersedeCancel, Projects: make(map[string]string)}
+	if err := validateSupersedePolicy(policy); err != nil {
+		return result, err
+	}
+	result.Default = policy
+	for _, item := range strings.Split(projects, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return result, fmt.Errorf("illegal project supersede policy (%s)", item)
+		}
+		if err := validateSupersedePolicy(kv[1]); err != nil {
+			return result, err
+		}
+		result.Projects[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+// Policy the supersede policy of the project
+func (s *SupersedePolicies) Policy(project string) string {
+	if policy, exist := s.Projects[project]; exist {
+		return policy
+	}
+	return s.Default
+}
+
+// ShortCommit the leading characters of the commit id used in the names
+func ShortCommit(commitID string) string {
+	commitID = strings.ToLower(strings.TrimSpace(commitID))
+	if len(commitID) > shortCommitLength {
+		commitID = commitID[:shortCommitLength]
+	}
+	return commitID
+}
+
+// pipelineRunName the pipelineRun of the ci request is named by the commit,
+// so the run of the superseded commit is kept rather than recreated. The ci
+// named by the commit already, e.g. by the queue policy, is not suffixed again
+func pipelineRunName(name, commitID string) string {
+	name = strings.Replace(
+		strings.Replace(strings.ToLower(
+			name), "_", "-", -1), ".", "-", -1)
+	suffix := ShortCommit(commitID)
+	if suffix == "" {
+		return name
+	}
+	suffix = "-" + suffix
+	if strings.HasSuffix(name, suffix) {
+		return name
+	}
+	if len(name)+len(suffix) > maxNameLength {
+		name = strings.TrimLeft(name[len(name)+len(suffix)-maxNameLength:], "-")
+	}
+	return name + suffix
+}
+
+// CancelPipelineRun request tekton to cancel the running pipelineRun, the finished or deleted one is ignored
+func CancelPipelineRun(ctx context.Context, drs datasource.IDataSource, name string) error {
+	obj, err := drs.Get(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("get pipelineRun %s error (%s)", name, err)
+	}
+	if _, exist, _ := unstructured.NestedString(obj.Object, "status", "completionTime"); exist {
+		return nil
+	}
+	// tekton v1 renamed the PipelineRunCancelled status
+	status := "PipelineRunCancelled"
+	if obj.GetAPIVersion() == "tekton.dev/v1" {
+		status = "Cancelled"
+	}
+	if err := unstructured.SetNestedField(obj.Object, status, "spec", "status"); err != nil {
+		return err
+	}
+	if _, _, err := drs.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name, obj, false); err != nil {
+		return fmt.Errorf("cancel pipelineRun %s error (%s)", name, err)
+	}
+	return nil
+}
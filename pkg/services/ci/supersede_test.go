@@ -0,0 +1,137 @@
+package ci
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSupersedePolicies(t *testing.T) {
+	policies, err := NewSupersedePolicies(SupersedeQueue, "project-a=parallel, project-b=cancel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for project, expected := range map[string]string{"project-a": SupersedeParallel, "project-b": SupersedeCancel, "project-c": SupersedeQueue} {
+		if policies.Policy(project) != expected {
+			t.Fatalf("expected policy of %s %s, got %s", project, expected, policies.Policy(project))
+		}
+	}
+	if policies, err := NewSupersedePolicies("restart", ""); err == nil || policies.Policy("project-a") != SupersedeCancel {
+		t.Fatal("expected error and the cancel policy of the illegal policy")
+	}
+	for _, s := range []string{"project-a", "project-a=restart"} {
+		if _, err := NewSupersedePolicies(SupersedeCancel, s); err == nil {
+			t.Fatalf("expected error of %s", s)
+		}
+	}
+}
+
+func TestPipelineRunName(t *testing.T) {
+	if name := pipelineRunName("Demo_App.master", "B8F3C2A1D4E5"); name != "demo-app-master-b8f3c2a1" {
+		t.Fatalf("unexpected pipelineRun name %s", name)
+	}
+	if name := pipelineRunName("demo-app-master", ""); name != "demo-app-master" {
+		t.Fatalf("expected the ci name without commit, got %s", name)
+	}
+	if name := pipelineRunName("demo-app-master-b8f3c2a1", "b8f3c2a1d4e5"); name != "demo-app-master-b8f3c2a1" {
+		t.Fatalf("expected the ci named by the commit not suffixed again, got %s", name)
+	}
+	long := strings.Repeat("a", 40) + "-" + strings.Repeat("b", 21)
+	name := pipelineRunName(long, "b8f3c2a1d4e5")
+	if len(name) > maxNameLength || !strings.HasSuffix(name, "-b8f3c2a1") || strings.HasPrefix(name, "-") {
+		t.Fatalf("unexpected trimmed pipelineRun name %s", name)
+	}
+}
+
+func TestScheduleSerialBranch(t *testing.T) {
+	limits := &Limits{}
+	running := queueItemAt("app-master", "app", 0)
+	running.Branch = "app-master"
+	newer := queueItemAt("app-master-b8f3c2a1", "app", 1)
+	newer.Branch, newer.Serial = "app-master", true
+	parallel := queueItemAt("app-dev-c1d2e3f4", "app", 2)
+	parallel.Branch = "app-dev"
+	admitted, queued := limits.schedule([]*queueItem{running}, []*queueItem{newer, parallel})
+	if !reflect.DeepEqual(queueNames(admitted), []string{"app-dev-c1d2e3f4"}) || !reflect.DeepEqual(queueNames(queued), []string{"app-master-b8f3c2a1"}) {
+		t.Fatalf("expected the newer request of the branch queued, got %v queued %v", queueNames(admitted), queueNames(queued))
+	}
+
+	admitted, queued = limits.schedule(nil, []*queueItem{newer})
+	if len(admitted) != 1 || len(queued) != 0 {
+		t.Fatalf("expected the newer request admitted after the older one finished, got %v", queueNames(queued))
+	}
+}
+
+func TestCancelPipelineRun(t *testing.T) {
+	pipelineRun := func(name, apiVersion string, completed bool) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+		obj.SetName(name)
+		obj.SetAPIVersion(apiVersion)
+		if completed {
+			_ = unstructured.SetNestedField(obj.Object, "2021-01-01T00:00:00Z", "status", "completionTime")
+		}
+		return obj
+	}
+	drs := fake.NewDataSource().Add(k8s.PipelineRun,
+		pipelineRun("v1-run", "tekton.dev/v1", false),
+		pipelineRun("legacy-run", "tekton.dev/v1alpha1", false),
+		pipelineRun("done-run", "tekton.dev/v1", true),
+	)
+	for _, name := range []string{"v1-run", "legacy-run", "done-run", "deleted-run"} {
+		if err := CancelPipelineRun(context.Background(), drs, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(drs.Applied) != 2 {
+		t.Fatalf("expected the running pipelineRuns cancelled only, got %d", len(drs.Applied))
+	}
+	for index, expected := range []string{"Cancelled", "PipelineRunCancelled"} {
+		if status, _, _ := unstructured.NestedString(drs.Applied[index].Object, "spec", "status"); status != expected {
+			t.Fatalf("expected spec.status %s, got %s", expected, status)
+		}
+	}
+}
+
+func TestCancelledCIPipelineRunStopping(t *testing.T) {
+	ci := &v1.CI{Spec: v1.CISpec{Done: true, AckStates: []string{v1.CancelledState}, PipelineRun: "demo-master-b8f3c2a1"}}
+	ci.SetName("demo-master")
+	obj, err := tools.InstanceToUnstructured(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drs := fake.NewDataSource().Add(k8s.CI, obj)
+	c := &Service{IDataSource: drs}
+
+	run := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Succeeded", "status": "Unknown", "reason": "Running"},
+		}},
+	}}
+	run.SetName("demo-master-b8f3c2a1")
+	run.SetLabels(map[string]string{CILabel: "demo-master"})
+	if err := c.reconcilePipelineRun(context.Background(), run); err != nil {
+		t.Fatal(err)
+	}
+	if len(drs.Applied) != 0 {
+		t.Fatalf("expected the cancelled ci not updated by the stopping run, got %v", drs.Applied)
+	}
+}
+
+func TestPipelineRunCILabel(t *testing.T) {
+	p := &params{Namespace: "test", Name: "demo-master-b8f3c2a1", PipelineName: "test-pipeline", CIName: "demo-master", TektonVersion: "v1"}
+	obj, err := services.Render(p, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetLabels()[CILabel] != "demo-master" {
+		t.Fatalf("expected the ci label, got %v", obj.GetLabels())
+	}
+}
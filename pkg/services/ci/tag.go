@@ -0,0 +1,137 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// the image tagging strategies
+const (
+	TagSHA       = "sha"        // the commit id
+	TagBranchSHA = "branch-sha" // e.g. master-1a2b3c4d
+	TagSemver    = "semver"     // the semver git tag point at the commit, the leading v is trimmed
+	TagTimestamp = "timestamp"  // the build time in UTC, e.g. 20210102150405
+	TagLatest    = "latest"     // only on the -default-branch
+)
+
+var (
+	tagStrategies    = []string{TagSHA, TagBranchSHA, TagSemver, TagTimestamp, TagLatest}
+	illegalTagRegexp = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// ParseTagStrategies parse the strategies joined by +, e.g. "branch-sha+latest"
+func ParseTagStrategies(s string) ([]string, error) {
+	result := make([]string, 0)
+	for _, item := range strings.Split(s, "+") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		supported := false
+		for _, strategy := range tagStrategies {
+			if item == strategy {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("tag strategy %s not supported, available %s", item, strings.Join(tagStrategies, ","))
+		}
+		result = append(result, item)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("tag strategy is required")
+	}
+	return result, nil
+}
+
+// ParseProjectTagStrategies parse the project strategies, e.g. "project-a=semver+latest,project-b=branch-sha"
+func ParseProjectTagStrategies(s string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal project tag strategy (%s)", item)
+		}
+		strategies, err := ParseTagStrategies(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		result[kv[0]] = strategies
+	}
+	return result, nil
+}
+
+// Tagging the tags pushed by a build, the semver tag is resolved from the git tags in the task
+type Tagging struct {
+	// Tags the first one is pushed by the builder, the others are added after the push
+	Tags   []string
+	Semver bool
+}
+
+// Primary the tag pushed by the builder
+func (t *Tagging) Primary() string { return t.Tags[0] }
+
+// Extra the tags added to the pushed image
+func (t *Tagging) Extra() []string { return t.Tags[1:] }
+
+// NewTagging compute the tags of the strategies, the commit tag is the primary one
+// when no strategy can be computed before the build, e.g. semver only
+func NewTagging(strategies []string, commitID, branch, defaultBranch string, now time.Time) *Tagging {
+	tagging := &Tagging{Tags: make([]string, 0)}
+	seen := make(map[string]struct{})
+	add := func(tag string) {
+		tag = sanitizeTag(tag)
+		if tag == "" {
+			return
+		}
+		if _, exist := seen[tag]; exist {
+			return
+		}
+		seen[tag] = struct{}{}
+		tagging.Tags = append(tagging.Tags, tag)
+	}
+
+	for _, strategy := range strategies {
+		switch strategy {
+		case TagSHA:
+			add(commitID)
+		case TagBranchSHA:
+			add(fmt.Sprintf("%s-%s", branch, shortSHA(commitID)))
+		case TagTimestamp:
+			add(now.UTC().Format("20060102150405"))
+		case TagLatest:
+			if branch == defaultBranch {
+				add(TagLatest)
+			}
+		case TagSemver:
+			tagging.Semver = true
+		}
+	}
+	if len(tagging.Tags) == 0 {
+		add(commitID)
+	}
+	return tagging
+}
+
+func shortSHA(commitID string) string {
+	if len(commitID) > 8 {
+		return commitID[:8]
+	}
+	return commitID
+}
+
+// sanitizeTag replace the character not allowed in the image tag, e.g. feature/login -> feature-login
+func sanitizeTag(tag string) string {
+	tag = strings.TrimLeft(illegalTagRegexp.ReplaceAllString(tag, "-"), ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
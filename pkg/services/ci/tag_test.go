@@ -0,0 +1,66 @@
+package ci
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTagStrategies(t *testing.T) {
+	strategies, err := ParseTagStrategies(" branch-sha + latest ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(strategies, []string{TagBranchSHA, TagLatest}) {
+		t.Fatalf("unexpected strategies %v", strategies)
+	}
+	if _, err := ParseTagStrategies(""); err == nil {
+		t.Fatal("expect empty strategies error")
+	}
+	if _, err := ParseTagStrategies("sha+nightly"); err == nil {
+		t.Fatal("expect unknown strategy error")
+	}
+}
+
+func TestParseProjectTagStrategies(t *testing.T) {
+	result, err := ParseProjectTagStrategies("project-a=semver+latest, project-b=branch-sha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"project-a": {TagSemver, TagLatest},
+		"project-b": {TagBranchSHA},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected project strategies %v", result)
+	}
+	if _, err := ParseProjectTagStrategies("project-a"); err == nil {
+		t.Fatal("expect illegal project strategy error")
+	}
+}
+
+func TestNewTagging(t *testing.T) {
+	commitID := "1a2b3c4d5e6f7a8b"
+	now := time.Date(2021, 1, 2, 15, 4, 5, 0, time.FixedZone("CST", 8*3600))
+
+	tagging := NewTagging([]string{TagBranchSHA, TagSHA, TagTimestamp, TagLatest}, commitID, "master", "master", now)
+	expected := []string{"master-1a2b3c4d", commitID, "20210102070405", "latest"}
+	if !reflect.DeepEqual(tagging.Tags, expected) {
+		t.Fatalf("unexpected tags %v", tagging.Tags)
+	}
+	if tagging.Primary() != "master-1a2b3c4d" || len(tagging.Extra()) != 3 {
+		t.Fatalf("unexpected primary %s extra %v", tagging.Primary(), tagging.Extra())
+	}
+
+	// latest only on the default branch, the branch is sanitized
+	tagging = NewTagging([]string{TagBranchSHA, TagLatest}, commitID, "feature/login", "master", now)
+	if !reflect.DeepEqual(tagging.Tags, []string{"feature-login-1a2b3c4d"}) {
+		t.Fatalf("unexpected tags %v", tagging.Tags)
+	}
+
+	// semver is resolved in the task, the commit is pushed by the builder
+	tagging = NewTagging([]string{TagSemver}, commitID, "master", "master", now)
+	if !tagging.Semver || !reflect.DeepEqual(tagging.Tags, []string{commitID}) {
+		t.Fatalf("unexpected tagging %+v", tagging)
+	}
+}
@@ -10,7 +10,7 @@ metadata:
     namespace: {{.Namespace}}
 spec:
   data: >-
-    {"nodes":[{"id":"1-1","x":20,"y":20,"role":0,"taskName":"yce-cloud-extensions-task","anchorPoints":[[0,0.5],[1,0.5]],"addnode":true,"subnode":true,"type":"pipeline-node","linkPoints":{"right":true,"left":true},"style":{}}],"edges":[],"combos":[],"groups":[]}
+    {"nodes":[{"id":"1-1","x":20,"y":20,"role":0,"taskName":"{{.TaskName}}","anchorPoints":[[0,0.5],[1,0.5]],"addnode":true,"subnode":true,"type":"pipeline-node","linkPoints":{"right":true,"left":true},"style":{}}],"edges":[],"combos":[],"groups":[]}
   width: 1629
   height: 592`
 
@@ -57,7 +57,7 @@ spec:
     - name: git-addr
       type: git
   tasks:
-    - name: yce-cloud-extensions-task
+    - name: {{.TaskName}}
       params:
         - name: project_name
           value: $(params.project_name)
@@ -90,7 +90,7 @@ kind: Task
 metadata:
   labels:
     namespace: {{.Namespace}}
-  name: yce-cloud-extensions-task
+  name: {{.Name}}
   namespace: {{.Namespace}}
 spec:
   params:
@@ -140,29 +140,71 @@ spec:
       image: $(params.check_docker_file)
       name: checkdocker
       resources: {}
-    - args:
-        - '--dockerfile=/workspace/git/$(params.dockerfile)'
-        - '--context=/workspace/git'
-        - '--insecure'
-        - '--force'
-        - '--destination=$(params.dest_repo_url)/$(params.project_name):$(params.project_version)'
-        - '--cache=true'
-        - '--skip-tls-verify'
-        - '--snapshotMode=time'
-        - '--cache-repo=$(params.cache_repo_url)/$(params.project_name)-cache'
-        - '--skip-unused-stages=true'
+{{- range .PreBuild}}
+    - name: {{.Name}}
+      image: {{printf "%q" .Image}}
+      workingDir: /workspace/git
+      script: {{printf "%q" .Script}}
+{{- if $.CachePaths}}
+      volumeMounts:
+{{- range $i, $path := $.CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
+{{- end}}
+    - name: building
+      image: $(params.build_tool_image)
+{{- with .BuildStep}}
+{{- if .Command}}
+      command:
+{{- range .Command}}
+        - {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- if .Args}}
+      args:
+{{- range .Args}}
+        - {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- if .Script}}
+      script: {{printf "%q" .Script}}
+{{- end}}
+{{- if or .RunAsUser .Unconfined}}
+      securityContext:
+{{- if .RunAsUser}}
+        runAsUser: {{.RunAsUser}}
+{{- end}}
+{{- if .Unconfined}}
+        seccompProfile:
+          type: Unconfined
+{{- end}}
+{{- end}}
+{{- end}}
       env:
         - name: "DOCKER_CONFIG"
           value: "/tekton/home/.docker"
-      image: $(params.build_tool_image)
-      name: building
-      resources: {}
-      command: []
-      script: ''
-      workingDir: ''
+{{- with .BuildStep}}
+{{- range .Env}}
+        - name: {{.Name}}
+          value: {{printf "%q" .Value}}
+{{- end}}
+{{- end}}
+{{- if .CachePaths}}
+      volumeMounts:
+{{- range $i, $path := .CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
   volumes:
     - emptyDir: {}
-      name: build-path`
+      name: build-path
+{{- range $i, $path := .CachePaths}}
+    - emptyDir: {}
+      name: cache-{{$i}}
+{{- end}}`
 
 	pipelineResourceTpl = `kind: PipelineResource
 apiVersion: tekton.dev/v1alpha1
@@ -189,6 +231,12 @@ metadata:
   labels:
     namespace: {{.Namespace}}
     tekton.dev/pipeline: {{.PipelineName}}
+{{- if .CIName }}
+    yce-cloud-extensions/ci: {{.CIName}}
+{{- end }}
+{{- if .BranchName }}
+    yce-cloud-extensions/branch: {{.BranchName}}
+{{- end }}
   name: {{.Name}}
   namespace: {{.Namespace}}
 spec:
@@ -217,8 +265,11 @@ spec:
     - name: git-addr
       resourceRef:
         name: {{.PipelineResourceName}}
-  serviceAccountName: default
-  timeout: 1h0m0s`
+  serviceAccountName: {{or .ServiceAccountName "default"}}
+{{- if .PodTemplate}}
+  podTemplate: {{.PodTemplate}}
+{{- end}}
+  timeout: {{or .Timeout "1h0m0s"}}`
 
 	configGitTpl = `apiVersion: v1
 data:
@@ -235,211 +286,70 @@ metadata:
   namespace: {{.Namespace}}
 type: kubernetes.io/basic-auth`
 
-	configRegistryTpl = `apiVersion: v1
+	// secretTpl the build secret and the docker config of a PipelineRun
+	secretTpl = `apiVersion: v1
 kind: Secret
 metadata:
   name: {{.Name}}
   namespace: {{.Namespace}}
   labels:
-    mount: '1'
-    tekton: '1'
-  annotations:
-    tekton.dev/docker-0: {{.RegistryRepoUrl}}
+    namespace: {{.Namespace}}
 data:
-  password: {{.RegistryPassword}}
-  username: {{.RegistryUsername}}
-type: kubernetes.io/basic-auth`
+{{- range $key, $value := .SecretData}}
+  {{printf "%q" $key}}: {{$value}}
+{{- end}}
+type: {{or .SecretType "Opaque"}}`
 
-	javaTaskTpl = `apiVersion: tekton.dev/v1alpha1
-kind: Task
+	// gitCredentialTpl the git credential of a PipelineRun, picked up by the tekton creds-init
+	gitCredentialTpl = `apiVersion: v1
+kind: Secret
 metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
   labels:
     namespace: {{.Namespace}}
-  name: yce-cloud-extensions-java-task
-  namespace: {{.Namespace}}
-spec:
-  params:
-    - default: none
-      name: project_name
-      type: string
-    - default: none
-      name: project_version
-      type: string
-    - default: 'yametech/kaniko:v1.3.0'
-      name: build_tool_image
-      type: string
-    - default: 'yametech/checkdocker:v0.1.3'
-      name: check_docker_file
-      type: string
-    - default: none
-      name: dest_repo_url
-      type: string
-    - default: none
-      name: code_type
-      type: string
-    - default: none
-      name: sub_dir
-      type: string
-    - default: "Dockerfile"
-      name: dockerfile
-      type: string
-  resources:
-    inputs:
-      - name: git
-        type: git
-    outputs: []
-  steps:
-    - args:
-        - '-url'
-        - /workspace/git
-        - '-codetype'
-        - $(params.code_type)
-        - '-path'
-        - $(params.sub_dir)
-      env:
-        - name: DOCKER_CONFIG
-          value: /tekton/home/.docker
-      image: $(params.check_docker_file)
-      name: checkdocker
-      resources: {}
-    - args:
-        - '--dockerfile=/workspace/git/$(params.dockerfile)'
-        - '--context=/workspace/git'
-        - '--insecure'
-        - '--force'
-        - '--destination=$(params.dest_repo_url)/$(params.project_name):$(params.project_version)'
-        - '--skip-tls-verify'
-        - '--skip-unused-stages=true'
-      env:
-        - name: "DOCKER_CONFIG"
-          value: "/tekton/home/.docker"
-      image: $(params.build_tool_image)
-      name: building
-      resources: {}
-      command: []
-      script: ''
-      workingDir: ''
-  volumes:
-    - emptyDir: {}
-      name: build-path`
+  annotations:
+    tekton.dev/git-0: {{printf "%q" .GitCredentialUrl}}
+data:
+{{- range $key, $value := .SecretData}}
+  {{printf "%q" $key}}: {{$value}}
+{{- end}}
+type: {{.SecretType}}`
 
-	javaGraphTpl = `kind: TektonGraph
-apiVersion: fuxi.nip.io/v1
+	// serviceAccountTpl the service account of a PipelineRun, only the credentials of the build attached
+	serviceAccountTpl = `apiVersion: v1
+kind: ServiceAccount
 metadata:
   name: {{.Name}}
   namespace: {{.Namespace}}
   labels:
     namespace: {{.Namespace}}
-spec:
-  data: >-
-    {"nodes":[{"id":"1-1","x":20,"y":20,"role":0,"taskName":"yce-cloud-extensions-java-task","anchorPoints":[[0,0.5],[1,0.5]],"addnode":true,"subnode":true,"type":"pipeline-node","linkPoints":{"right":true,"left":true},"style":{}}],"edges":[],"combos":[],"groups":[]}
-  width: 1629
-  height: 592`
+secrets:
+{{- range .ServiceAccountSecrets}}
+  - name: {{.}}
+{{- end}}`
 
-	javaPipelineTpl = `apiVersion: tekton.dev/v1alpha1
-kind: Pipeline
+	// dependencyCacheTpl the volume of the dependency caches bound to the builds of the project or the profile
+	dependencyCacheTpl = `apiVersion: v1
+kind: PersistentVolumeClaim
 metadata:
-  annotations:
-    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
-    namespace: {{.Namespace}}
-  labels:
-    namespace: {{.Namespace}}
-  name: {{.Name}}
+  name: {{.DependencyCache.Name}}
   namespace: {{.Namespace}}
-spec:
-  params:
-    - default: ''
-      name: project_name
-      type: string
-    - default: ''
-      name: project_version
-      type: string
-    - default: ''
-      name: build_tool_image
-      type: string
-    - default: ''
-      name: check_docker_file
-      type: string
-    - default: ''
-      name: dest_repo_url
-      type: string
-    - default: ''
-      name: code_type
-      type: string
-    - default: ''
-      name: sub_dir
-      type: string
-    - default: "Dockerfile"
-      name: dockerfile
-      type: string
-  resources:
-    - name: git-addr
-      type: git
-  tasks:
-    - name: yce-cloud-extensions-java-task
-      params:
-        - name: project_name
-          value: $(params.project_name)
-        - name: project_version
-          value: $(params.project_version)
-        - name: build_tool_image
-          value: $(params.build_tool_image)
-        - name: check_docker_file
-          value: $(params.check_docker_file)
-        - name: dest_repo_url
-          value: $(params.dest_repo_url)
-        - name: code_type
-          value: $(params.code_type)
-        - name: sub_dir
-          value: $(params.sub_dir)
-        - name: dockerfile
-          value: $(params.dockerfile)
-      resources:
-        inputs:
-          - name: git
-            resource: git-addr
-      taskRef:
-        kind: Task
-        name: {{.TaskName}}`
-
-	javaPipelineRunTpl = `apiVersion: tekton.dev/v1alpha1
-kind: PipelineRun
-metadata:
-  annotations:
-    fuxi.nip.io/run-tektongraphs: {{.PipelineRunGraph}}
-    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
-    namespace: {{.Namespace}}
   labels:
     namespace: {{.Namespace}}
-    tekton.dev/pipeline: {{.PipelineName}}
-  name: {{.Name}}
-  namespace: {{.Namespace}}
+    yce-cloud-extensions/dependency-cache: "true"
+    yce-cloud-extensions/cache-profile: {{.DependencyCache.Profile}}
+  annotations:
+    yce-cloud-extensions/last-used: {{printf "%q" .LastUsed}}
 spec:
-  params:
-    - name: project_name
-      value: {{.ProjectName}}
-    - name: project_version
-      value: {{.ProjectVersion}}
-    - name: build_tool_image
-      value: {{.BuildToolImage}}
-    - name: check_docker_file
-      value: {{.CheckDockerFile}}
-    - name: code_type
-      value: {{.CodeType}}
-    - name: dest_repo_url
-      value: {{.DestRepoUrl}}
-    - name: sub_dir
-      value: {{.ProjectPath}}
-    - name: dockerfile
-      value: {{.ProjectFile}}
-  pipelineRef:
-    name: {{.PipelineName}}
+  accessModes:
+    - {{.DependencyCache.AccessMode}}
+{{- if .DependencyCache.StorageClass}}
+  storageClassName: {{.DependencyCache.StorageClass}}
+{{- end}}
   resources:
-    - name: git-addr
-      resourceRef:
-        name: {{.PipelineResourceName}}
-  serviceAccountName: default
-  timeout: 1h0m0s`
+    requests:
+      storage: {{.DependencyCache.Size}}`
 )
 
 type params struct {
@@ -455,6 +365,8 @@ type params struct {
 	PipelineOrPipelineRunName string
 	Uid                       string
 	// pipelineRunTpl
+	CIName               string
+	BranchName           string
 	PipelineRunGraph     string
 	PipelineGraph        string
 	PipelineResourceName string
@@ -471,12 +383,67 @@ type params struct {
 	ConfigGitUrl string
 	GitUsername  string
 	GitPassword  string
-	// configRegistryTpl
-	RegistryRepoUrl  string
-	RegistryPassword string
-	RegistryUsername string
 
 	// 20201229 add dockerfile path and supported sub directory project
 	ProjectFile string
 	ProjectPath string
+
+	// taskTpl rendered from the build profile and the builder
+	CachePaths []string
+	PreBuild   []Step
+	BuildStep  *BuildStep
+	// multiArchPipelineV1Tpl && manifestTaskV1Tpl
+	Platforms         []Platform
+	ManifestTaskName  string
+	ManifestToolImage string
+	// the pipelines && pipelineRunV1Tpl the sbom task of the build profile if set, the format of the sbom
+	SBOMTaskName  string
+	SBOM          *SBOMFormat
+	SBOMToolImage string
+	SBOMPushImage string
+	// the pipelines && scanTaskV1Tpl && pipelineRunV1Tpl the scan task of the pushed images if set
+	ScanTaskName    string
+	ScanImage       string
+	ScanThreshold   string
+	ScanDeleteImage string
+	// the pipelines && signTaskV1Tpl && pipelineRunV1Tpl the sign task of the pushed images if set
+	SignTaskName  string
+	SignImage     string
+	SignKeySecret string
+	// imagesPipelineV1Tpl && pipelineRunV1Tpl the sub-project images of the monorepo
+	Images           []*ImageBuild
+	GitCloneTaskName string
+	// pipelineRunV1Tpl the tags added to the pushed image
+	Tags      string
+	SemverTag bool
+	// pipelineRunV1Tpl the build args formatted by the builder, the secret bound to the build-secrets workspace
+	BuildArgs       []string
+	BuildSecretName string
+	// secretTpl && gitCredentialTpl the base64 encoded data of the secret
+	SecretData map[string]string
+	SecretType string
+	// gitCredentialTpl the matched credential copied for the pipelineRun
+	GitCredentialUrl string
+	// pipelineRunV1Tpl the docker config.json bound to the docker-config workspace
+	DockerConfigName string
+	// serviceAccountTpl the secrets of the pipelineRun service account
+	ServiceAccountName    string
+	ServiceAccountSecrets []string
+	// pipelineRunTpl && pipelineRunV1Tpl the build pod settings, the json of the pod template and the step
+	// resources, the resources of the ResourceSteps are set on the BuildTaskNames of the pipeline
+	Timeout        string
+	PodTemplate    string
+	NodeSelector   map[string]string
+	StepResources  string
+	ResourceSteps  []string
+	BuildTaskNames []string
+	// dependencyCacheTpl && pipelineRunV1Tpl the volume bound to the dependency-cache workspace
+	DependencyCache *DependencyCache
+	LastUsed        string
+
+	// TektonVersion the served tekton.dev version, v1beta1 or v1 clone the source by git-clone step
+	TektonVersion string
+	CommitID      string
+	GitCloneImage string
+	WorkspaceSize string
 }
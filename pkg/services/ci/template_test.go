@@ -3,6 +3,7 @@ package ci
 import (
 	"github.com/laik/yce-cloud-extensions/pkg/services"
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"reflect"
 	"testing"
 	"text/template"
@@ -218,3 +219,106 @@ spec:
 		t.Fatal("expect not equal")
 	}
 }
+
+func TestPipelineRunV1Constructor(t *testing.T) {
+	p := &params{
+		Namespace:     "test",
+		Name:          "test-run",
+		PipelineName:  "test-pipeline",
+		GitUrl:        "https://github.com/laik/yce-cloud-extensions.git",
+		Branch:        "master",
+		CommitID:      "b8f3c2a",
+		TektonVersion: "v1",
+		WorkspaceSize: "1Gi",
+	}
+	obj, err := services.Render(p, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetAPIVersion() != "tekton.dev/v1" {
+		t.Fatalf("unexpected api version %s", obj.GetAPIVersion())
+	}
+	if sa, _, _ := unstructured.NestedString(obj.Object, "spec", "taskRunTemplate", "serviceAccountName"); sa != "default" {
+		t.Fatalf("expect taskRunTemplate service account, got %v", obj.Object["spec"])
+	}
+	if timeout, _, _ := unstructured.NestedString(obj.Object, "spec", "timeouts", "pipeline"); timeout != "1h0m0s" {
+		t.Fatalf("expect timeouts.pipeline, got %v", obj.Object["spec"])
+	}
+	workspaces, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	if len(workspaces) != 1 {
+		t.Fatalf("expect one workspace, got %v", workspaces)
+	}
+	storage, _, _ := unstructured.NestedString(workspaces[0].(map[string]interface{}),
+		"volumeClaimTemplate", "spec", "resources", "requests", "storage")
+	if storage != "1Gi" {
+		t.Fatalf("expect volumeClaimTemplate storage 1Gi, got %v", workspaces[0])
+	}
+
+	p.TektonVersion, p.WorkspaceSize = "v1beta1", ""
+	obj, err = services.Render(p, pipelineRunV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sa, _, _ := unstructured.NestedString(obj.Object, "spec", "serviceAccountName"); sa != "default" {
+		t.Fatalf("expect serviceAccountName on v1beta1, got %v", obj.Object["spec"])
+	}
+	workspaces, _, _ = unstructured.NestedSlice(obj.Object, "spec", "workspaces")
+	if _, exist := workspaces[0].(map[string]interface{})["emptyDir"]; !exist {
+		t.Fatalf("expect emptyDir workspace, got %v", workspaces[0])
+	}
+}
+
+func TestTaskV1Constructor(t *testing.T) {
+	profile := &Profile{
+		Name:       "go",
+		CachePaths: []string{"/go/pkg/mod"},
+		PreBuild:   []Step{{Name: "test", Image: "golang:1.15", Script: "go vet ./...\ngo test ./..."}},
+	}
+	obj, err := services.Render(&params{
+		Namespace:     "test",
+		Name:          profile.TaskName(),
+		CachePaths:    profile.CachePaths,
+		PreBuild:      profile.PreBuild,
+		BuildStep:     (&kaniko{}).Step(BuildOptions{Context: "$(workspaces.source.path)/git"}),
+		TektonVersion: "v1",
+	}, taskV1Tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, _, _ := unstructured.NestedSlice(obj.Object, "spec", "steps")
+	names := make([]string, 0)
+	for _, step := range steps {
+		names = append(names, step.(map[string]interface{})["name"].(string))
+	}
+	if !reflect.DeepEqual(names, []string{"git-clone", "checkdocker", "cache-restore", "test", "building", "cache-save", "tagging"}) {
+		t.Fatalf("unexpected steps %v", names)
+	}
+	if script := steps[3].(map[string]interface{})["script"]; script != "go vet ./...\ngo test ./..." {
+		t.Fatalf("unexpected pre-build script %v", script)
+	}
+	args, _, _ := unstructured.NestedStringSlice(steps[4].(map[string]interface{}), "args")
+	for _, arg := range args {
+		if arg == "--cache=true" {
+			t.Fatal("expect no layer cache")
+		}
+	}
+	volumes, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumes")
+	if len(volumes) != 1 {
+		t.Fatalf("expect the cache volume, got %v", volumes)
+	}
+
+	for _, tpl := range []string{taskTpl, taskV1Tpl} {
+		for _, builder := range BuilderNames() {
+			builder, _ := GetBuilder(builder)
+			p := &params{
+				Namespace:     "test",
+				Name:          "test",
+				BuildStep:     builder.Step(BuildOptions{Context: "/workspace/git", DigestFile: "/tekton/results/image_digest", LayerCache: true}),
+				TektonVersion: "v1beta1",
+			}
+			if _, err := services.Render(p, tpl); err != nil {
+				t.Fatalf("render %s task error (%s)", builder.Name(), err)
+			}
+		}
+	}
+}
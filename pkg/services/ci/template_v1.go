@@ -0,0 +1,1533 @@
+package ci
+
+// The templates for tekton.dev v1beta1 and v1, PipelineResource was removed
+// so the source is cloned by the git-clone step into the source workspace.
+const (
+	pipelineV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Pipeline
+metadata:
+  annotations:
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: ''
+      name: project_name
+      type: string
+    - default: ''
+      name: project_version
+      type: string
+    - default: ''
+      name: build_tool_image
+      type: string
+    - default: ''
+      name: check_docker_file
+      type: string
+    - default: ''
+      name: dest_repo_url
+      type: string
+    - default: ''
+      name: cache_repo_url
+      type: string
+    - default: ''
+      name: code_type
+      type: string
+    - default: ''
+      name: sub_dir
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - default: ''
+      name: git_url
+      type: string
+    - default: ''
+      name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: ''
+      name: git_clone_image
+      type: string
+    - default: ''
+      name: tags
+      type: string
+    - default: 'false'
+      name: semver_tag
+      type: string
+    - default: ''
+      name: manifest_tool_image
+      type: string
+    - default: []
+      name: build_args
+      type: array
+    - default: ''
+      name: cache_lockfiles
+      type: string
+    - default: '0'
+      name: cache_size_limit
+      type: string
+{{- if .SBOMTaskName}}
+    - default: ''
+      name: sbom_tool_image
+      type: string
+    - default: ''
+      name: sbom_push_image
+      type: string
+{{- end}}
+{{- if .ScanTaskName}}
+    - default: ''
+      name: scan_image
+      type: string
+    - default: ''
+      name: scan_threshold
+      type: string
+    - default: ''
+      name: scan_delete_image
+      type: string
+{{- end}}
+{{- if .SignTaskName}}
+    - default: ''
+      name: sign_image
+      type: string
+    - default: ''
+      name: sign_key_secret
+      type: string
+{{- end}}
+  workspaces:
+    - name: source
+    - name: build-secrets
+      optional: true
+    - name: docker-config
+      optional: true
+    - name: dependency-cache
+      optional: true
+{{- if .SignTaskName}}
+    - name: sign-key
+      optional: true
+{{- end}}
+  results:
+    - name: commit
+      value: $(tasks.{{.TaskName}}.results.commit)
+    - name: image_digest
+      value: $(tasks.{{.TaskName}}.results.image_digest)
+    - name: tags
+      value: $(tasks.{{.TaskName}}.results.tags)
+{{- if .SBOMTaskName}}
+    - name: sbom
+      value: $(tasks.sbom.results.sbom)
+{{- end}}
+  tasks:
+    - name: {{.TaskName}}
+      params:
+        - name: project_name
+          value: $(params.project_name)
+        - name: project_version
+          value: $(params.project_version)
+        - name: build_tool_image
+          value: $(params.build_tool_image)
+        - name: dest_repo_url
+          value: $(params.dest_repo_url)
+        - name: cache_repo_url
+          value: $(params.cache_repo_url)
+        - name: code_type
+          value: $(params.code_type)
+        - name: sub_dir
+          value: $(params.sub_dir)
+        - name: dockerfile
+          value: $(params.dockerfile)
+        - name: check_docker_file
+          value: $(params.check_docker_file)
+        - name: git_url
+          value: $(params.git_url)
+        - name: git_revision
+          value: $(params.git_revision)
+        - name: git_commit
+          value: $(params.git_commit)
+        - name: git_clone_image
+          value: $(params.git_clone_image)
+        - name: tags
+          value: $(params.tags)
+        - name: semver_tag
+          value: $(params.semver_tag)
+        - name: manifest_tool_image
+          value: $(params.manifest_tool_image)
+        - name: build_args
+          value:
+            - $(params.build_args[*])
+        - name: cache_lockfiles
+          value: $(params.cache_lockfiles)
+        - name: cache_size_limit
+          value: $(params.cache_size_limit)
+      workspaces:
+        - name: source
+          workspace: source
+        - name: build-secrets
+          workspace: build-secrets
+        - name: docker-config
+          workspace: docker-config
+        - name: dependency-cache
+          workspace: dependency-cache
+      taskRef:
+        kind: Task
+        name: {{.TaskName}}
+{{- if .SBOMTaskName}}
+    - name: sbom
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: format
+          value: {{.SBOM.Output}}
+        - name: artifact_type
+          value: {{.SBOM.ArtifactType}}
+        - name: sbom_tool_image
+          value: $(params.sbom_tool_image)
+        - name: sbom_push_image
+          value: $(params.sbom_push_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{.SBOMTaskName}}
+{{- end}}
+{{- if .ScanTaskName}}
+    - name: scan
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: scan_image
+          value: $(params.scan_image)
+        - name: scan_threshold
+          value: $(params.scan_threshold)
+        - name: scan_delete_image
+          value: $(params.scan_delete_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{.ScanTaskName}}
+{{- end}}
+{{- if .SignTaskName}}
+    - name: sign
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: sign_image
+          value: $(params.sign_image)
+        - name: sign_key_secret
+          value: $(params.sign_key_secret)
+{{- if .ScanTaskName}}
+      runAfter:
+        - scan
+{{- end}}
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+        - name: sign-key
+          workspace: sign-key
+      taskRef:
+        kind: Task
+        name: {{.SignTaskName}}
+{{- end}}`
+
+	// multiArchPipelineV1Tpl fan out a build task per platform, then push the image index
+	multiArchPipelineV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Pipeline
+metadata:
+  annotations:
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: ''
+      name: project_name
+      type: string
+    - default: ''
+      name: project_version
+      type: string
+    - default: ''
+      name: build_tool_image
+      type: string
+    - default: ''
+      name: check_docker_file
+      type: string
+    - default: ''
+      name: dest_repo_url
+      type: string
+    - default: ''
+      name: cache_repo_url
+      type: string
+    - default: ''
+      name: code_type
+      type: string
+    - default: ''
+      name: sub_dir
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - default: ''
+      name: git_url
+      type: string
+    - default: ''
+      name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: ''
+      name: git_clone_image
+      type: string
+    - default: ''
+      name: tags
+      type: string
+    - default: 'false'
+      name: semver_tag
+      type: string
+    - default: ''
+      name: manifest_tool_image
+      type: string
+    - default: []
+      name: build_args
+      type: array
+{{- if .SBOMTaskName}}
+    - default: ''
+      name: sbom_tool_image
+      type: string
+    - default: ''
+      name: sbom_push_image
+      type: string
+{{- end}}
+{{- if .ScanTaskName}}
+    - default: ''
+      name: scan_image
+      type: string
+    - default: ''
+      name: scan_threshold
+      type: string
+    - default: ''
+      name: scan_delete_image
+      type: string
+{{- end}}
+{{- if .SignTaskName}}
+    - default: ''
+      name: sign_image
+      type: string
+    - default: ''
+      name: sign_key_secret
+      type: string
+{{- end}}
+  workspaces:
+    - name: source
+    - name: build-secrets
+      optional: true
+    - name: docker-config
+      optional: true
+{{- if .SignTaskName}}
+    - name: sign-key
+      optional: true
+{{- end}}
+  results:
+    - name: commit
+      value: $(tasks.{{(index .Platforms 0).TaskName}}.results.commit)
+    - name: image_digest
+      value: $(tasks.manifest.results.image_digest)
+    - name: tags
+      value: $(tasks.manifest.results.tags)
+{{- if .SBOMTaskName}}
+    - name: sbom
+      value: $(tasks.sbom.results.sbom)
+{{- end}}
+  tasks:
+{{- range .Platforms}}
+    - name: {{.TaskName}}
+      params:
+        - name: project_name
+          value: $(params.project_name)
+        - name: project_version
+          value: $(params.project_version)-{{.Slug}}
+        - name: build_tool_image
+          value: $(params.build_tool_image)
+        - name: dest_repo_url
+          value: $(params.dest_repo_url)
+        - name: cache_repo_url
+          value: $(params.cache_repo_url)
+        - name: code_type
+          value: $(params.code_type)
+        - name: sub_dir
+          value: $(params.sub_dir)
+        - name: dockerfile
+          value: $(params.dockerfile)
+        - name: check_docker_file
+          value: $(params.check_docker_file)
+        - name: git_url
+          value: $(params.git_url)
+        - name: git_revision
+          value: $(params.git_revision)
+        - name: git_commit
+          value: $(params.git_commit)
+        - name: git_clone_image
+          value: $(params.git_clone_image)
+        - name: tags
+          value: ''
+        - name: semver_tag
+          value: 'false'
+        - name: manifest_tool_image
+          value: $(params.manifest_tool_image)
+        - name: build_args
+          value:
+            - $(params.build_args[*])
+      workspaces:
+        - name: source
+          workspace: source
+          subPath: {{.Slug}}
+        - name: build-secrets
+          workspace: build-secrets
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{$.TaskName}}
+{{- end}}
+    - name: manifest
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)
+        - name: images
+          value: "
+{{- range $i, $platform := .Platforms}}
+{{- if $i}} {{end}}$(params.dest_repo_url)/$(params.project_name):$(params.project_version)-{{$platform.Slug}}@$(tasks.{{$platform.TaskName}}.results.image_digest)
+{{- end}}"
+        - name: manifest_tool_image
+          value: $(params.manifest_tool_image)
+        - name: tags
+          value: $(params.tags)
+        - name: semver_tag
+          value: $(params.semver_tag)
+        - name: version
+          value: $(tasks.{{(index .Platforms 0).TaskName}}.results.version)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{.ManifestTaskName}}
+{{- if .SBOMTaskName}}
+    - name: sbom
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.manifest.results.image_digest)
+        - name: format
+          value: {{.SBOM.Output}}
+        - name: artifact_type
+          value: {{.SBOM.ArtifactType}}
+        - name: sbom_tool_image
+          value: $(params.sbom_tool_image)
+        - name: sbom_push_image
+          value: $(params.sbom_push_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{.SBOMTaskName}}
+{{- end}}
+{{- if .ScanTaskName}}
+    - name: scan
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.manifest.results.image_digest)
+        - name: scan_image
+          value: $(params.scan_image)
+        - name: scan_threshold
+          value: $(params.scan_threshold)
+        - name: scan_delete_image
+          value: $(params.scan_delete_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{.ScanTaskName}}
+{{- end}}
+{{- if .SignTaskName}}
+    - name: sign
+      params:
+        - name: image
+          value: $(params.dest_repo_url)/$(params.project_name):$(params.project_version)@$(tasks.manifest.results.image_digest)
+        - name: sign_image
+          value: $(params.sign_image)
+        - name: sign_key_secret
+          value: $(params.sign_key_secret)
+{{- if .ScanTaskName}}
+      runAfter:
+        - scan
+{{- end}}
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+        - name: sign-key
+          workspace: sign-key
+      taskRef:
+        kind: Task
+        name: {{.SignTaskName}}
+{{- end}}`
+
+	// imagesPipelineV1Tpl clone the monorepo once, then build the image of each sub-project in parallel
+	imagesPipelineV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Pipeline
+metadata:
+  annotations:
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: ''
+      name: project_name
+      type: string
+    - default: ''
+      name: project_version
+      type: string
+    - default: ''
+      name: build_tool_image
+      type: string
+    - default: ''
+      name: check_docker_file
+      type: string
+    - default: ''
+      name: dest_repo_url
+      type: string
+    - default: ''
+      name: cache_repo_url
+      type: string
+    - default: ''
+      name: code_type
+      type: string
+    - default: ''
+      name: sub_dir
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - default: ''
+      name: git_url
+      type: string
+    - default: ''
+      name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: ''
+      name: git_clone_image
+      type: string
+    - default: ''
+      name: tags
+      type: string
+    - default: 'false'
+      name: semver_tag
+      type: string
+    - default: ''
+      name: manifest_tool_image
+      type: string
+    - default: []
+      name: build_args
+      type: array
+    - default: ''
+      name: cache_lockfiles
+      type: string
+    - default: '0'
+      name: cache_size_limit
+      type: string
+{{- range .Images}}
+    - default: ''
+      name: project_name_{{.Index}}
+      type: string
+    - default: ''
+      name: dest_repo_url_{{.Index}}
+      type: string
+    - default: ''
+      name: sub_dir_{{.Index}}
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile_{{.Index}}
+      type: string
+    - default: []
+      name: build_args_{{.Index}}
+      type: array
+{{- end}}
+{{- if .SBOMTaskName}}
+    - default: ''
+      name: sbom_tool_image
+      type: string
+    - default: ''
+      name: sbom_push_image
+      type: string
+{{- end}}
+{{- if .ScanTaskName}}
+    - default: ''
+      name: scan_image
+      type: string
+    - default: ''
+      name: scan_threshold
+      type: string
+    - default: ''
+      name: scan_delete_image
+      type: string
+{{- end}}
+{{- if .SignTaskName}}
+    - default: ''
+      name: sign_image
+      type: string
+    - default: ''
+      name: sign_key_secret
+      type: string
+{{- end}}
+  workspaces:
+    - name: source
+    - name: build-secrets
+      optional: true
+    - name: docker-config
+      optional: true
+    - name: dependency-cache
+      optional: true
+{{- if .SignTaskName}}
+    - name: sign-key
+      optional: true
+{{- end}}
+  results:
+    - name: commit
+      value: $(tasks.clone.results.commit)
+{{- range .Images}}
+    - name: {{.DigestResult}}
+      value: $(tasks.{{.TaskName}}.results.image_digest)
+    - name: {{.TagsResult}}
+      value: $(tasks.{{.TaskName}}.results.tags)
+{{- if $.SBOMTaskName}}
+    - name: {{.SBOMResult}}
+      value: $(tasks.{{.SBOMTaskName}}.results.sbom)
+{{- end}}
+{{- end}}
+  tasks:
+    - name: clone
+      params:
+        - name: git_url
+          value: $(params.git_url)
+        - name: git_revision
+          value: $(params.git_revision)
+        - name: git_commit
+          value: $(params.git_commit)
+        - name: git_clone_image
+          value: $(params.git_clone_image)
+      workspaces:
+        - name: source
+          workspace: source
+      taskRef:
+        kind: Task
+        name: {{.GitCloneTaskName}}
+{{- range .Images}}
+    - name: {{.TaskName}}
+      runAfter:
+        - clone
+      params:
+        - name: project_name
+          value: $(params.project_name_{{.Index}})
+        - name: project_version
+          value: $(params.project_version)
+        - name: build_tool_image
+          value: $(params.build_tool_image)
+        - name: dest_repo_url
+          value: $(params.dest_repo_url_{{.Index}})
+        - name: cache_repo_url
+          value: $(params.cache_repo_url)
+        - name: code_type
+          value: $(params.code_type)
+        - name: sub_dir
+          value: $(params.sub_dir_{{.Index}})
+        - name: dockerfile
+          value: $(params.dockerfile_{{.Index}})
+        - name: check_docker_file
+          value: $(params.check_docker_file)
+        - name: git_url
+          value: ''
+        - name: git_revision
+          value: $(params.git_revision)
+        - name: git_commit
+          value: $(params.git_commit)
+        - name: git_clone_image
+          value: $(params.git_clone_image)
+        - name: tags
+          value: $(params.tags)
+        - name: semver_tag
+          value: $(params.semver_tag)
+        - name: manifest_tool_image
+          value: $(params.manifest_tool_image)
+        - name: build_args
+          value:
+            - $(params.build_args_{{.Index}}[*])
+        - name: cache_lockfiles
+          value: $(params.cache_lockfiles)
+        - name: cache_size_limit
+          value: $(params.cache_size_limit)
+      workspaces:
+        - name: source
+          workspace: source
+        - name: build-secrets
+          workspace: build-secrets
+        - name: docker-config
+          workspace: docker-config
+        - name: dependency-cache
+          workspace: dependency-cache
+      taskRef:
+        kind: Task
+        name: {{$.TaskName}}
+{{- if $.SBOMTaskName}}
+    - name: {{.SBOMTaskName}}
+      params:
+        - name: image
+          value: $(params.dest_repo_url_{{.Index}})/$(params.project_name_{{.Index}}):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: format
+          value: {{$.SBOM.Output}}
+        - name: artifact_type
+          value: {{$.SBOM.ArtifactType}}
+        - name: sbom_tool_image
+          value: $(params.sbom_tool_image)
+        - name: sbom_push_image
+          value: $(params.sbom_push_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{$.SBOMTaskName}}
+{{- end}}
+{{- if $.ScanTaskName}}
+    - name: {{.ScanTaskName}}
+      params:
+        - name: image
+          value: $(params.dest_repo_url_{{.Index}})/$(params.project_name_{{.Index}}):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: scan_image
+          value: $(params.scan_image)
+        - name: scan_threshold
+          value: $(params.scan_threshold)
+        - name: scan_delete_image
+          value: $(params.scan_delete_image)
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+      taskRef:
+        kind: Task
+        name: {{$.ScanTaskName}}
+{{- end}}
+{{- if $.SignTaskName}}
+    - name: {{.SignTaskName}}
+      params:
+        - name: image
+          value: $(params.dest_repo_url_{{.Index}})/$(params.project_name_{{.Index}}):$(params.project_version)@$(tasks.{{.TaskName}}.results.image_digest)
+        - name: sign_image
+          value: $(params.sign_image)
+        - name: sign_key_secret
+          value: $(params.sign_key_secret)
+{{- if $.ScanTaskName}}
+      runAfter:
+        - {{.ScanTaskName}}
+{{- end}}
+      workspaces:
+        - name: docker-config
+          workspace: docker-config
+        - name: sign-key
+          workspace: sign-key
+      taskRef:
+        kind: Task
+        name: {{$.SignTaskName}}
+{{- end}}
+{{- end}}`
+
+	// gitCloneTaskV1Tpl clone the source into the workspace shared by the image builds
+	gitCloneTaskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - name: git_url
+      type: string
+    - name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: 'alpine/git:v2.30.2'
+      name: git_clone_image
+      type: string
+  workspaces:
+    - name: source
+  results:
+    - name: commit
+      description: the commit id of the cloned source
+  steps:
+    - name: git-clone
+      image: $(params.git_clone_image)
+      workingDir: $(workspaces.source.path)
+      env:
+        - name: HOME
+          value: /tekton/home
+      script: |
+        #!/bin/sh
+        set -e
+        rm -rf git
+        git clone --branch "$(params.git_revision)" "$(params.git_url)" git
+        cd git
+        if [ -n "$(params.git_commit)" ]; then
+          git checkout "$(params.git_commit)"
+        fi
+        printf "%s" "$(git rev-parse HEAD)" > "$(results.commit.path)"`
+
+	// manifestTaskV1Tpl push the OCI image index of the platform images
+	manifestTaskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - name: image
+      type: string
+    - description: the platform images separated by space
+      name: images
+      type: string
+    - default: 'gcr.io/go-containerregistry/crane:debug'
+      name: manifest_tool_image
+      type: string
+    - default: ''
+      description: the tags added to the image index, separated by space
+      name: tags
+      type: string
+    - default: 'false'
+      name: semver_tag
+      type: string
+    - default: ''
+      description: the semver git tag point at the commit
+      name: version
+      type: string
+  workspaces:
+    - description: the docker config.json of the registries
+      name: docker-config
+      optional: true
+      readOnly: true
+  results:
+    - name: image_digest
+      description: the digest of the pushed image index
+    - name: tags
+      description: the pushed tags separated by space
+  steps:
+    - name: manifest
+      image: $(params.manifest_tool_image)
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+      script: |
+        #!/busybox/sh
+        set -e
+        args=""
+        for image in $(params.images); do
+          args="$args --manifest $image"
+        done
+        crane index append --insecure --tag "$(params.image)" $args
+        crane digest --insecure "$(params.image)" | tr -d '\n' > "$(results.image_digest.path)"
+        tags="$(params.tags)"
+        if [ "$(params.semver_tag)" = "true" ] && [ -n "$(params.version)" ]; then
+          tags="$tags $(params.version)"
+        fi
+        for tag in $tags; do
+          crane tag --insecure "$(params.image)" "$tag"
+        done
+        image="$(params.image)"
+        printf "%s" "$(echo ${image##*:} $tags)" > "$(results.tags.path)"`
+
+	// sbomTaskV1Tpl generate the sbom of the pushed image and attach it to the image digest as an oci artifact,
+	// the referrers of the digest list the sbom, e.g. oras discover harbor.ym/devops/app@sha256:...
+	sbomTaskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - description: the pushed image referenced by the digest
+      name: image
+      type: string
+    - default: spdx-json
+      description: the syft output format spdx-json|cyclonedx-json
+      name: format
+      type: string
+    - default: application/spdx+json
+      description: the oci artifact type of the sbom
+      name: artifact_type
+      type: string
+    - default: 'anchore/syft:v0.98.0'
+      name: sbom_tool_image
+      type: string
+    - default: 'ghcr.io/oras-project/oras:v1.1.0'
+      name: sbom_push_image
+      type: string
+  workspaces:
+    - description: the docker config.json of the registries
+      name: docker-config
+      optional: true
+      readOnly: true
+  results:
+    - name: sbom
+      description: the reference of the sbom artifact attached to the image digest
+  volumes:
+    - emptyDir: {}
+      name: sbom
+  steps:
+    - name: generate
+      image: $(params.sbom_tool_image)
+      args:
+        - registry:$(params.image)
+        - --quiet
+        - --output
+        - $(params.format)=/sbom/sbom.json
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+        - name: SYFT_REGISTRY_INSECURE_SKIP_TLS_VERIFY
+          value: "true"
+      volumeMounts:
+        - mountPath: /sbom
+          name: sbom
+    - name: attach
+      image: $(params.sbom_push_image)
+      workingDir: /sbom
+      volumeMounts:
+        - mountPath: /sbom
+          name: sbom
+      script: |
+        #!/bin/sh
+        set -e
+        config=""
+        if [ -f "$(workspaces.docker-config.path)/config.json" ]; then
+          config="--registry-config $(workspaces.docker-config.path)/config.json"
+        fi
+        oras attach --insecure $config --artifact-type "$(params.artifact_type)" "$(params.image)" "sbom.json:$(params.artifact_type)" | tee /sbom/attach.log
+        image="$(params.image)"
+        digest=$(sed -n 's/^Digest: *//p' /sbom/attach.log | tr -d '\n')
+        printf "%s" "${image%@*}@$digest" > "$(results.sbom.path)"`
+
+	// scanTaskV1Tpl scan the vulnerabilities of the pushed image, count them by severity from the severity
+	// line of each vulnerability printed by the trivy template and fail when the threshold is exceeded, the
+	// counts are the result of the failed run too. The image exceeding the threshold is deleted by the digest,
+	// so all the tags pushed by the build are removed, the retained result is true if the delete failed
+	scanTaskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - description: the pushed image referenced by the digest
+      name: image
+      type: string
+    - default: 'aquasec/trivy:0.45.1'
+      name: scan_image
+      type: string
+    - default: ''
+      description: the max vulnerabilities of the severities separated by space, e.g. CRITICAL=0 HIGH=10
+      name: scan_threshold
+      type: string
+    - default: 'ghcr.io/oras-project/oras:v1.1.0'
+      description: the oras image delete the pushed image exceeding the threshold
+      name: scan_delete_image
+      type: string
+  workspaces:
+    - description: the docker config.json of the registries
+      name: docker-config
+      optional: true
+      readOnly: true
+  results:
+    - name: vulnerabilities
+      description: the vulnerability counts by severity, e.g. CRITICAL=0 HIGH=2 MEDIUM=5 LOW=9 UNKNOWN=0
+    - name: retained
+      description: the image exceeding the threshold failed to be deleted from the registry, true or false
+  steps:
+    - name: scan
+      image: $(params.scan_image)
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+        - name: TRIVY_CACHE_DIR
+          value: /tekton/home/.cache/trivy
+      script: |
+        #!/bin/sh
+        set -e
+        trivy image --quiet --no-progress --insecure --scanners vuln --format template \
+          --template '{{"{{ range . }}{{ range .Vulnerabilities }}{{ println .Severity }}{{ end }}{{ end }}"}}' \
+          --output /tekton/home/severities "$(params.image)"
+        summary=""
+        for severity in CRITICAL HIGH MEDIUM LOW UNKNOWN; do
+          count=$(grep -cx "$severity" /tekton/home/severities || true)
+          summary="$summary $severity=${count:-0}"
+        done
+        printf "%s" "${summary# }" > "$(results.vulnerabilities.path)"
+        echo "the vulnerabilities of $(params.image): ${summary# }"
+    - name: gate
+      image: $(params.scan_delete_image)
+      script: |
+        #!/bin/sh
+        printf "false" > "$(results.retained.path)"
+        exceeded=""
+        for limit in $(params.scan_threshold); do
+          severity="${limit%%=*}"
+          count=$(tr ' ' '\n' < "$(results.vulnerabilities.path)" | grep "^$severity=" | cut -d= -f2)
+          if [ "${count:-0}" -gt "${limit#*=}" ]; then
+            exceeded="$exceeded $severity=$count"
+          fi
+        done
+        if [ -n "$exceeded" ]; then
+          echo "the vulnerabilities$exceeded exceed the scan threshold $(params.scan_threshold)"
+          config=""
+          if [ -f "$(workspaces.docker-config.path)/config.json" ]; then
+            config="--registry-config $(workspaces.docker-config.path)/config.json"
+          fi
+          if ! oras manifest delete --insecure --force $config "$(params.image)"; then
+            printf "true" > "$(results.retained.path)"
+            echo "the image $(params.image) exceeding the scan threshold is not deleted from the registry"
+          fi
+          exit 1
+        fi`
+
+	// signTaskV1Tpl sign the pushed image digest by the cosign key of the sign-key workspace, the signature
+	// is pushed to the sha256-<digest>.sig tag of the repository without the transparency log
+	signTaskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - description: the pushed image referenced by the digest
+      name: image
+      type: string
+    - default: 'gcr.io/projectsigstore/cosign:v2.2.0'
+      name: sign_image
+      type: string
+    - default: 'yce-cloud-extensions-cosign'
+      description: the secret of the cosign.password of the key
+      name: sign_key_secret
+      type: string
+  workspaces:
+    - description: the docker config.json of the registries
+      name: docker-config
+      optional: true
+      readOnly: true
+    - description: the cosign.key of the signature
+      name: sign-key
+      readOnly: true
+  steps:
+    - name: sign
+      image: $(params.sign_image)
+      args:
+        - sign
+        - --key
+        - $(workspaces.sign-key.path)/cosign.key
+        - --tlog-upload=false
+        - --allow-insecure-registry
+        - --yes
+        - $(params.image)
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+        - name: COSIGN_PASSWORD
+          valueFrom:
+            secretKeyRef:
+              key: cosign.password
+              name: $(params.sign_key_secret)
+              optional: true`
+
+	taskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: none
+      name: project_name
+      type: string
+    - default: none
+      name: project_version
+      type: string
+    - default: 'registry-d.ym/devops/executor:v1.5.2'
+      name: build_tool_image
+      type: string
+    - default: 'yametech/checkdocker:v0.1.3'
+      name: check_docker_file
+      type: string
+    - default: none
+      name: dest_repo_url
+      type: string
+    - default: none
+      name: cache_repo_url
+      type: string
+    - default: none
+      name: code_type
+      type: string
+    - default: none
+      name: sub_dir
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - description: the source cloned by the git clone task is built if empty
+      name: git_url
+      type: string
+    - name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: 'alpine/git:v2.30.2'
+      name: git_clone_image
+      type: string
+    - default: ''
+      description: the tags added to the pushed image, separated by space
+      name: tags
+      type: string
+    - default: 'false'
+      description: add the semver git tag point at the commit
+      name: semver_tag
+      type: string
+    - default: 'gcr.io/go-containerregistry/crane:debug'
+      name: manifest_tool_image
+      type: string
+    - default: []
+      description: the build args formatted by the builder
+      name: build_args
+      type: array
+    - default: ''
+      description: the lockfiles of the project path hashed into the dependency cache key, separated by space
+      name: cache_lockfiles
+      type: string
+    - default: '0'
+      description: the KiB of the dependency cache entries, the least recently used are evicted beyond
+      name: cache_size_limit
+      type: string
+  workspaces:
+    - name: source
+    - description: the build secret files named by the id
+      name: build-secrets
+      optional: true
+      readOnly: true
+    - description: the docker config.json of the registries
+      name: docker-config
+      optional: true
+      readOnly: true
+    - description: the dependency caches keyed by the hash of the lockfiles
+      name: dependency-cache
+      optional: true
+  results:
+    - name: commit
+      description: the commit id of the source been built
+    - name: cache_key
+      description: the key of the dependency cache entry
+    - name: image_digest
+      description: the digest of the pushed image
+    - name: version
+      description: the semver git tag point at the commit
+    - name: tags
+      description: the pushed tags separated by space
+  steps:
+    - name: git-clone
+      image: $(params.git_clone_image)
+      workingDir: $(workspaces.source.path)
+      env:
+        - name: HOME
+          value: /tekton/home
+      script: |
+        #!/bin/sh
+        set -e
+        if [ -n "$(params.git_url)" ]; then
+          rm -rf git
+          git clone --branch "$(params.git_revision)" "$(params.git_url)" git
+          if [ -n "$(params.git_commit)" ]; then
+            git -C git checkout "$(params.git_commit)"
+          fi
+        fi
+        cd git
+        printf "%s" "$(git rev-parse HEAD)" > "$(results.commit.path)"
+        git describe --tags --exact-match 2>/dev/null | grep -E '^v?[0-9]+\.[0-9]+\.[0-9]+' | sed 's/^v//' | tr -d '\n' > "$(results.version.path)" || true
+    - args:
+        - '-url'
+        - $(workspaces.source.path)/git
+        - '-codetype'
+        - $(params.code_type)
+        - '-path'
+        - $(params.sub_dir)
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+      image: $(params.check_docker_file)
+      name: checkdocker
+{{- if .CachePaths}}
+    - name: cache-restore
+      image: $(params.git_clone_image)
+      workingDir: $(workspaces.source.path)/git
+      script: |
+        #!/bin/sh
+        set -e
+        if [ "$(workspaces.dependency-cache.bound)" != "true" ]; then
+          exit 0
+        fi
+        dir="$(params.sub_dir)"
+        case "$dir" in "*"|none) dir=. ;; esac
+        key=$(for file in $(params.cache_lockfiles); do
+          if [ -f "$dir/$file" ]; then sha256sum "$dir/$file"; fi
+        done | sha256sum | cut -c1-16)
+        printf "%s" "$key" > "$(results.cache_key.path)"
+        cache="$(workspaces.dependency-cache.path)"
+        entry="$cache/$key"
+        if [ ! -d "$entry" ]; then
+          entry=$(ls -dt "$cache"/*/ 2>/dev/null | head -n 1)
+        fi
+        if [ -z "$entry" ]; then
+          exit 0
+        fi
+        entry="${entry%/}"
+        touch "$entry"
+{{- range $i, $path := .CachePaths}}
+        if [ -d "$entry/{{$i}}" ]; then cp -a "$entry/{{$i}}/." {{printf "%q" $path}}/; fi
+{{- end}}
+      volumeMounts:
+{{- range $i, $path := .CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
+{{- range .PreBuild}}
+    - name: {{.Name}}
+      image: {{printf "%q" .Image}}
+      workingDir: $(workspaces.source.path)/git
+      script: {{printf "%q" .Script}}
+{{- if $.CachePaths}}
+      volumeMounts:
+{{- range $i, $path := $.CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
+{{- end}}
+    - name: building
+      image: $(params.build_tool_image)
+{{- with .BuildStep}}
+{{- if .Command}}
+      command:
+{{- range .Command}}
+        - {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- if .Args}}
+      args:
+{{- range .Args}}
+        - {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- if .Script}}
+      script: {{printf "%q" .Script}}
+{{- end}}
+{{- if or .RunAsUser .Unconfined}}
+      securityContext:
+{{- if .RunAsUser}}
+        runAsUser: {{.RunAsUser}}
+{{- end}}
+{{- if .Unconfined}}
+        seccompProfile:
+          type: Unconfined
+{{- end}}
+{{- end}}
+{{- end}}
+      env:
+        - name: "DOCKER_CONFIG"
+          value: "$(workspaces.docker-config.path)"
+{{- with .BuildStep}}
+{{- range .Env}}
+        - name: {{.Name}}
+          value: {{printf "%q" .Value}}
+{{- end}}
+{{- end}}
+{{- if .CachePaths}}
+      volumeMounts:
+{{- range $i, $path := .CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
+{{- if .CachePaths}}
+    - name: cache-save
+      image: $(params.git_clone_image)
+      script: |
+        #!/bin/sh
+        set -e
+        if [ "$(workspaces.dependency-cache.bound)" != "true" ]; then
+          exit 0
+        fi
+        cache="$(workspaces.dependency-cache.path)"
+        entry="$cache/$(cat "$(results.cache_key.path)")"
+        if [ ! -d "$entry" ]; then
+          saving="$cache/.saving-$(context.taskRun.name)"
+          rm -rf "$saving"
+{{- range $i, $path := .CachePaths}}
+          mkdir -p "$saving/{{$i}}" && cp -a {{printf "%q" $path}}/. "$saving/{{$i}}/"
+{{- end}}
+          if [ -d "$entry" ]; then rm -rf "$saving"; else mv "$saving" "$entry"; fi
+        fi
+        touch "$entry"
+        limit=$(params.cache_size_limit)
+        while [ "$limit" -gt 0 ] && [ "$(du -sk "$cache" | cut -f1)" -gt "$limit" ]; do
+          oldest=$(ls -dt "$cache"/*/ | tail -n 1)
+          if [ "${oldest%/}" = "$entry" ]; then
+            break
+          fi
+          rm -rf "${oldest%/}"
+        done
+      volumeMounts:
+{{- range $i, $path := .CachePaths}}
+        - name: cache-{{$i}}
+          mountPath: {{printf "%q" $path}}
+{{- end}}
+{{- end}}
+    - name: tagging
+      image: $(params.manifest_tool_image)
+      env:
+        - name: DOCKER_CONFIG
+          value: $(workspaces.docker-config.path)
+      script: |
+        #!/busybox/sh
+        set -e
+        tags="$(params.tags)"
+        if [ "$(params.semver_tag)" = "true" ] && [ -s "$(results.version.path)" ]; then
+          tags="$tags $(cat "$(results.version.path)")"
+        fi
+        image="$(params.dest_repo_url)/$(params.project_name)"
+        for tag in $tags; do
+          crane tag --insecure "$image:$(params.project_version)" "$tag"
+        done
+        printf "%s" "$(echo $(params.project_version) $tags)" > "$(results.tags.path)"
+{{- if .CachePaths}}
+  volumes:
+{{- range $i, $path := .CachePaths}}
+    - emptyDir: {}
+      name: cache-{{$i}}
+{{- end}}
+{{- end}}`
+
+	pipelineRunV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: PipelineRun
+metadata:
+  annotations:
+    fuxi.nip.io/run-tektongraphs: {{.PipelineRunGraph}}
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+    tekton.dev/pipeline: {{.PipelineName}}
+{{- if .CIName }}
+    yce-cloud-extensions/ci: {{.CIName}}
+{{- end }}
+{{- if .BranchName }}
+    yce-cloud-extensions/branch: {{.BranchName}}
+{{- end }}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - name: project_name
+      value: {{.ProjectName}}
+    - name: project_version
+      value: {{.ProjectVersion}}
+    - name: build_tool_image
+      value: {{.BuildToolImage}}
+    - name: check_docker_file
+      value: {{.CheckDockerFile}}
+    - name: code_type
+      value: {{.CodeType}}
+    - name: dest_repo_url
+      value: {{.DestRepoUrl}}
+    - name: cache_repo_url
+      value: {{.CacheRepoUrl}}
+    - name: sub_dir
+      value: {{.ProjectPath}}
+    - name: dockerfile
+      value: {{.ProjectFile}}
+    - name: git_url
+      value: "{{.GitUrl}}"
+    - name: git_revision
+      value: "{{.Branch}}"
+    - name: git_commit
+      value: "{{.CommitID}}"
+    - name: git_clone_image
+      value: {{.GitCloneImage}}
+    - name: tags
+      value: "{{.Tags}}"
+    - name: semver_tag
+      value: "{{.SemverTag}}"
+    - name: manifest_tool_image
+      value: {{.ManifestToolImage}}
+    - name: build_args
+      value: [{{range $i, $arg := .BuildArgs}}{{if $i}}, {{end}}{{printf "%q" $arg}}{{end}}]
+{{- if .SBOMToolImage}}
+    - name: sbom_tool_image
+      value: {{.SBOMToolImage}}
+    - name: sbom_push_image
+      value: {{.SBOMPushImage}}
+{{- end}}
+{{- if .ScanImage}}
+    - name: scan_image
+      value: {{.ScanImage}}
+    - name: scan_threshold
+      value: "{{.ScanThreshold}}"
+    - name: scan_delete_image
+      value: {{.ScanDeleteImage}}
+{{- end}}
+{{- if .SignKeySecret}}
+    - name: sign_image
+      value: {{.SignImage}}
+    - name: sign_key_secret
+      value: {{.SignKeySecret}}
+{{- end}}
+{{- with .DependencyCache}}
+    - name: cache_lockfiles
+      value: {{printf "%q" .LockfileList}}
+    - name: cache_size_limit
+      value: "{{.SizeLimit}}"
+{{- end}}
+{{- range .Images}}
+    - name: project_name_{{.Index}}
+      value: {{printf "%q" .ProjectName}}
+    - name: dest_repo_url_{{.Index}}
+      value: {{printf "%q" .DestRepoUrl}}
+    - name: sub_dir_{{.Index}}
+      value: {{printf "%q" .SubDir}}
+    - name: dockerfile_{{.Index}}
+      value: {{printf "%q" .ProjectFile}}
+    - name: build_args_{{.Index}}
+      value: [{{range $i, $arg := .BuildArgs}}{{if $i}}, {{end}}{{printf "%q" $arg}}{{end}}]
+{{- end}}
+  pipelineRef:
+    name: {{.PipelineName}}
+  workspaces:
+    - name: source
+{{- if .WorkspaceSize}}
+      volumeClaimTemplate:
+        spec:
+          accessModes:
+            - ReadWriteOnce
+          resources:
+            requests:
+              storage: {{.WorkspaceSize}}
+{{- else}}
+      emptyDir: {}
+{{- end}}
+{{- if .BuildSecretName}}
+    - name: build-secrets
+      secret:
+        secretName: {{.BuildSecretName}}
+{{- end}}
+{{- if .DockerConfigName}}
+    - name: docker-config
+      secret:
+        secretName: {{.DockerConfigName}}
+        items:
+          - key: .dockerconfigjson
+            path: config.json
+{{- end}}
+{{- with .DependencyCache}}
+    - name: dependency-cache
+      persistentVolumeClaim:
+        claimName: {{.Name}}
+{{- end}}
+{{- if .SignKeySecret}}
+    - name: sign-key
+      secret:
+        secretName: {{.SignKeySecret}}
+        items:
+          - key: cosign.key
+            path: cosign.key
+{{- end}}
+{{- if eq .TektonVersion "v1"}}
+  taskRunTemplate:
+    serviceAccountName: {{or .ServiceAccountName "default"}}
+{{- if .PodTemplate}}
+    podTemplate: {{.PodTemplate}}
+{{- end}}
+  timeouts:
+    pipeline: {{or .Timeout "1h0m0s"}}
+{{- else}}
+  serviceAccountName: {{or .ServiceAccountName "default"}}
+{{- if .PodTemplate}}
+  podTemplate: {{.PodTemplate}}
+{{- end}}
+  timeout: {{or .Timeout "1h0m0s"}}
+{{- end}}
+{{- if or .Platforms .StepResources}}
+  taskRunSpecs:
+{{- range .Platforms}}
+    - pipelineTaskName: {{.TaskName}}
+      {{if eq $.TektonVersion "v1"}}podTemplate{{else}}taskPodTemplate{{end}}:
+        nodeSelector:
+{{- range $key, $value := $.NodeSelector}}
+{{- if and (ne $key "kubernetes.io/os") (ne $key "kubernetes.io/arch")}}
+          {{printf "%q" $key}}: {{printf "%q" $value}}
+{{- end}}
+{{- end}}
+          kubernetes.io/os: {{.OS}}
+          kubernetes.io/arch: {{.Arch}}
+{{- if $.StepResources}}
+      {{if eq $.TektonVersion "v1"}}stepSpecs{{else}}stepOverrides{{end}}:
+{{- range $.ResourceSteps}}
+        - name: {{.}}
+          {{if eq $.TektonVersion "v1"}}computeResources{{else}}resources{{end}}: {{$.StepResources}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- if not .Platforms}}
+{{- range .BuildTaskNames}}
+    - pipelineTaskName: {{.}}
+      {{if eq $.TektonVersion "v1"}}stepSpecs{{else}}stepOverrides{{end}}:
+{{- range $.ResourceSteps}}
+        - name: {{.}}
+          {{if eq $.TektonVersion "v1"}}computeResources{{else}}resources{{end}}: {{$.StepResources}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}`
+)
@@ -1,11 +1,18 @@
 package services
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
+	"strings"
 	"text/template"
+	"time"
 
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/credentials"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
 )
@@ -16,11 +23,18 @@ const (
 	PipelineGraphName      = "yce-cloud-extensions-graph"
 	TektonGitConfigName    = "yce-cloud-extensions-git-config"
 	TektonDockerConfigName = "yce-cloud-extensions-docker-config"
-
-	// For java template
-	JavaTaskName          = "yce-cloud-extensions-java-task"
-	JavaPipelineGraphName = "yce-cloud-extensions-java-graph"
-	JavaPipelineName      = "yce-cloud-extensions-java-pipeline"
+	// ManifestTaskName the task push the image index of the multi-arch build
+	ManifestTaskName = "yce-cloud-extensions-manifest-task"
+	// SBOMTaskName the task attach the sbom to the pushed image
+	SBOMTaskName = "yce-cloud-extensions-sbom-task"
+	// ScanTaskName the task scan the vulnerabilities of the pushed image
+	ScanTaskName = "yce-cloud-extensions-scan-task"
+	// SignTaskName the task sign the pushed image by the cosign key
+	SignTaskName = "yce-cloud-extensions-sign-task"
+	// GitCloneTaskName the task clone the source shared by the image builds of the monorepo
+	GitCloneTaskName = "yce-cloud-extensions-git-clone-task"
+	// BuildRecordsName the configmap of the last successful build of each project path
+	BuildRecordsName = "yce-cloud-extensions-build-records"
 
 	// For Unit template
 	UnitTaskName          = "yce-cloud-extensions-unit-task"
@@ -31,37 +45,285 @@ const (
 	SonarTaskName          = "yce-cloud-extensions-sonar-task"
 	SonarPipelineGraphName = "yce-cloud-extensions-sonar-graph"
 	SonarPipelineName      = "yce-cloud-extensions-sonar-pipeline"
+
+	// TektonLegacyVersion the tekton api version with PipelineResource,
+	// the newer version clone the source into a workspace
+	TektonLegacyVersion = "v1alpha1"
 )
 
 var (
-	BuildToolImage = "yametech/kaniko:v0.24.0"
+	BuildToolImage  = "yametech/kaniko:v0.24.0"
 	CheckDockerFile = "yametech/checkdocker:v0.1.3"
-	DestRepoUrl    = "harbor.ym/yce-cloud-extensions"
-	CacheRepoUrl   = "harbor.ym/yce-cloud-extensions-repo-cache"
+	DestRepoUrl     = "harbor.ym/yce-cloud-extensions"
+	CacheRepoUrl    = "harbor.ym/yce-cloud-extensions-repo-cache"
+	GitCloneImage   = "alpine/git:v2.30.2"
+	// Builder the default image builder, ProjectBuilders the builder of the project e.g. "project-a=buildah"
+	Builder         = "kaniko"
+	ProjectBuilders = ""
+	BuildKitImage   = "moby/buildkit:v0.8.1-rootless"
+	BuildahImage    = "quay.io/buildah/stable:v1.29.0"
+	// ManifestToolImage the crane image push the image index of the multi-arch build and add the tags
+	ManifestToolImage = "gcr.io/go-containerregistry/crane:debug"
+	// TagStrategies the default image tag strategies joined by +, ProjectTagStrategies the strategies of
+	// the project e.g. "project-a=semver+latest", the latest tag is only pushed on the DefaultBranch
+	TagStrategies        = "sha"
+	ProjectTagStrategies = ""
+	DefaultBranch        = "master"
+	// WorkspaceSize the source workspace use a volumeClaimTemplate of the size, emptyDir if not set
+	WorkspaceSize = ""
+	// BuildProfilePath the build profile file or directory, BuildProfileConfigMap the configmap
+	// in the ops namespace, the later one override the profile with the same name
+	BuildProfilePath      = ""
+	BuildProfileConfigMap = "yce-cloud-extensions-build-profiles"
+	// MaxConcurrentBuilds the running builds limit, 0 is unlimited. ProjectMaxConcurrentBuilds and
+	// GitHostMaxConcurrentBuilds the limit of the project and the git host, e.g. "*=2,project-a=4",
+	// the * is the limit of the others, the request over the limit is queued
+	MaxConcurrentBuilds        = 0
+	ProjectMaxConcurrentBuilds = ""
+	GitHostMaxConcurrentBuilds = ""
+	// SupersedePolicy the policy of the running request superseded by a newer commit of the same branch
+	// cancel|queue|parallel, ProjectSupersedePolicies the policy of the project e.g. "project-a=queue"
+	SupersedePolicy          = "cancel"
+	ProjectSupersedePolicies = ""
+	// BuildAttempts the admitted request failed to create the build is done with the FAIL state after the attempts, 0 retry forever.
+	// BuildRetryBackoff the delay of the first retry, doubled by each failed attempt up to MaxBuildRetryBackoff
+	BuildAttempts        = 3
+	BuildRetryBackoff    = 10 * time.Second
+	MaxBuildRetryBackoff = 5 * time.Minute
+	// SkipExistingImage finish the ci without build when the image of the commit is built already,
+	// checked through the registry v2 api, the force request always build
+	SkipExistingImage = false
+	// InsecureRegistries the registry hosts served by http or the unverified https, e.g. harbor.ym,127.0.0.1:5000,
+	// the registry api of the other hosts and their token realms are verified https only
+	InsecureRegistries = ""
+	// PathFilter finish the ci without build when nothing under the project path and the watch paths changed
+	// since the last successful build, the changed files are compared through the git provider api
+	PathFilter = false
+	// WatchPaths the paths watched by all the projects, e.g. the shared libraries of the monorepo
+	WatchPaths = ""
+	// GitProviders the api of the git host github|gitlab, github.com is github and the others gitlab if not set
+	GitProviders = ""
+
+	// BuildTimeout the pipelineRun timeout, the build pod settings of the project and the request override the defaults
+	BuildTimeout = time.Hour
+	// BuildCPURequests the compute resources of the building and the pre-build steps, empty is not set
+	BuildCPURequests = ""
+	BuildCPULimit    = ""
+	BuildMEMRequests = ""
+	BuildMEMLimit    = ""
+	// BuildNodeSelector the node labels of the build pods, e.g. "node-role=build"
+	BuildNodeSelector = ""
+	BuildRuntimeClass = ""
+	// BuildPodConfigMap the build pod settings keyed by the project name, the "default" key apply to all projects
+	BuildPodConfigMap = "yce-cloud-extensions-build-pods"
+	// TektonNamespace the namespace of the tekton feature-flags, the step resources need the enable-api-fields alpha or beta
+	TektonNamespace = "tekton-pipelines"
+
+	// ImageScan scan the pushed images by the ScanImage, the run fails when the vulnerabilities exceed
+	// the ScanThreshold of the severities, e.g. "CRITICAL=0,HIGH=10", report only if the threshold not set.
+	// The image exceeding the threshold is deleted from the registry by the oras ScanDeleteImage
+	ImageScan       = false
+	ScanImage       = "aquasec/trivy:0.45.1"
+	ScanThreshold   = ""
+	ScanDeleteImage = "ghcr.io/oras-project/oras:v1.1.0"
+
+	// SBOMToolImage the syft image generate the sbom of the build profile, SBOMPushImage the oras image
+	// attach the sbom to the pushed image digest as an oci artifact
+	SBOMToolImage = "anchore/syft:v0.98.0"
+	SBOMPushImage = "ghcr.io/oras-project/oras:v1.1.0"
+
+	// ImageSign sign the pushed images by the SignImage with the cosign.key and the cosign.password of the
+	// SignKeySecret in the ops namespace, the signature is pushed beside the image in the cosign format
+	ImageSign     = false
+	SignImage     = "gcr.io/projectsigstore/cosign:v2.2.0"
+	SignKeySecret = "yce-cloud-extensions-cosign"
+	// VerifyImageSignature reject the cd of the image not signed by any public key of the SignPublicKeys
+	// configmap in the ops namespace, each value is a PEM encoded public key e.g. cosign.pub
+	VerifyImageSignature = false
+	SignPublicKeys       = "yce-cloud-extensions-cosign-public-keys"
 
-	// git server config
+	// DiagnosisConfigMap the configmap of the rules classify the failed builds before the builtin rules
+	DiagnosisConfigMap = "yce-cloud-extensions-diagnosis-rules"
+	// DiagnosisLogLines the last log lines of the failed step matched by the diagnosis rules
+	DiagnosisLogLines int64 = 50
+
+	// StepProgress push the progress of the running steps to the echoer
+	StepProgress = false
+
+	// GCInterval the interval of the completed runs collected by the retention policy, 0 disable the gc
+	GCInterval = 30 * time.Minute
+	// GCKeepRuns the newest runs of each project and branch kept
+	GCKeepRuns = 10
+	// GCMinAge the completed runs kept at least, GCFailedMinAge the failed runs kept at least
+	GCMinAge       = 24 * time.Hour
+	GCFailedMinAge = 7 * 24 * time.Hour
+
+	// DependencyCache mount the cache paths of the build profile from a PersistentVolumeClaim of the project or
+	// the profile by -dependency-cache-scope, the cache entries are keyed by the hash of the profile lockfiles
+	DependencyCache      = false
+	DependencyCacheScope = "project"
+	// DependencyCacheSize the volume size, the least recently used entries are evicted beyond 90% of it
+	DependencyCacheSize         = "5Gi"
+	DependencyCacheStorageClass = ""
+	// DependencyCacheAccessMode ReadWriteOnce|ReadWriteMany, the concurrent builds of the cache scope run on the different
+	// nodes require ReadWriteMany of the storage class, the ReadWriteOnce volume can't be mounted by the build pod on
+	// another node and the build waits until the running one finished. The existing volumes keep their access mode
+	DependencyCacheAccessMode = "ReadWriteOnce"
+	// DependencyCacheTotalSize the least recently used volumes are deleted beyond the total size, empty is unlimited
+	DependencyCacheTotalSize = ""
+
+	// git server config, the account flags are the fallback of the -credentials-provider
 	ConfigGitUrl      = "http://git.ym"
 	ConfigGitUser     = "yce-cloud-extensions" //"yce-cloud-extensions"
-	ConfigGitPassword = "admin12345!QAZ"       //"admin12345!QAZ"
+	ConfigGitPassword = ""
+	// GitKnownHosts the known_hosts file of the ssh git credential without known_hosts
+	GitKnownHosts = ""
 
 	ConfigRegistryUrl      = "http://harbor.ym"
 	ConfigRegistryUserName = "yce-cloud-extensions"
-	ConfigRegistryPassword = "admin12345!QAZ"
+	ConfigRegistryPassword = ""
+
+	// CredentialsProvider the backend of the git and registry credentials flag|file|env|secret|vault,
+	// the credential stored as <name>-username and <name>-password, e.g. git-username, registry-password
+	CredentialsProvider = "flag"
+	// CredentialsDir the directory of the file backend, e.g. the mounted Secret volume
+	CredentialsDir = "/etc/yce-cloud-extensions/credentials"
+	// CredentialsSecret the Secret of the ops namespace of the secret backend
+	CredentialsSecret = "yce-cloud-extensions-credentials"
+	// CredentialsEnvPrefix the environment variable prefix of the env backend, e.g. YCE_GIT_PASSWORD
+	CredentialsEnvPrefix = "YCE_"
+	// VaultAddr VaultPath VaultTokenFile the vault backend, the VAULT_TOKEN environment variable if no token file
+	VaultAddr      = "http://127.0.0.1:8200"
+	VaultPath      = "secret/data/yce-cloud-extensions"
+	VaultTokenFile = ""
+	// CredentialsReloadInterval check the rotated credentials and update the tekton secrets
+	CredentialsReloadInterval = time.Minute
 )
 
 func init() {
 	flag.StringVar(&ConfigGitUrl, "git-server", ConfigGitUrl, "-git-server http://git.ym")
 	flag.StringVar(&ConfigGitUser, "git-user", ConfigGitUser, "-git-user username")
-	flag.StringVar(&ConfigGitPassword, "git-password", ConfigGitPassword, "-git-password password")
+	flag.StringVar(&ConfigGitPassword, "git-password", ConfigGitPassword, "-git-password password, prefer the -credentials-provider")
+	flag.StringVar(&GitKnownHosts, "git-known-hosts", GitKnownHosts, "-git-known-hosts /etc/ssh/ssh_known_hosts")
 
 	flag.StringVar(&ConfigRegistryUrl, "registry-server", ConfigRegistryUrl, "-registry-server http://harbor.ym")
 	flag.StringVar(&ConfigRegistryUserName, "registry-user", ConfigRegistryUserName, "-registry-user username")
-	flag.StringVar(&ConfigRegistryPassword, "registry-password", ConfigRegistryPassword, "-registry-password password")
+	flag.StringVar(&ConfigRegistryPassword, "registry-password", ConfigRegistryPassword, "-registry-password password, prefer the -credentials-provider")
+
+	flag.StringVar(&CredentialsProvider, "credentials-provider", CredentialsProvider, "-credentials-provider flag|file|env|secret|vault")
+	flag.StringVar(&CredentialsDir, "credentials-dir", CredentialsDir, "-credentials-dir /etc/yce-cloud-extensions/credentials")
+	flag.StringVar(&CredentialsSecret, "credentials-secret", CredentialsSecret, "-credentials-secret yce-cloud-extensions-credentials")
+	flag.StringVar(&CredentialsEnvPrefix, "credentials-env-prefix", CredentialsEnvPrefix, "-credentials-env-prefix YCE_")
+	flag.StringVar(&VaultAddr, "vault-addr", VaultAddr, "-vault-addr http://127.0.0.1:8200")
+	flag.StringVar(&VaultPath, "vault-path", VaultPath, "-vault-path secret/data/yce-cloud-extensions")
+	flag.StringVar(&VaultTokenFile, "vault-token-file", VaultTokenFile, "-vault-token-file /var/run/secrets/vault/token")
+	flag.DurationVar(&CredentialsReloadInterval, "credentials-reload-interval", CredentialsReloadInterval, "-credentials-reload-interval 1m")
 
 	flag.StringVar(&BuildToolImage, "build-tool-image", BuildToolImage, "-build-tool-image yametech/kaniko:v0.24.0")
 	flag.StringVar(&CheckDockerFile, "check-docker-file", CheckDockerFile, "-check-docker-file yametech/checkdocker:v0.1.3")
 	flag.StringVar(&DestRepoUrl, "dest-repo", DestRepoUrl, "-dest-repo harbor.ym/yce-cloud-extensions")
 	flag.StringVar(&CacheRepoUrl, "cache-repo", CacheRepoUrl, "-cache-repo harbor.ym/yce-cloud-extensions-repo-cache")
+	flag.StringVar(&GitCloneImage, "git-clone-image", GitCloneImage, "-git-clone-image alpine/git:v2.30.2")
+	flag.StringVar(&Builder, "builder", Builder, "-builder kaniko|buildkit|buildah")
+	flag.StringVar(&ProjectBuilders, "project-builders", ProjectBuilders, "-project-builders project-a=buildah,project-b=buildkit")
+	flag.StringVar(&BuildKitImage, "buildkit-image", BuildKitImage, "-buildkit-image moby/buildkit:v0.8.1-rootless")
+	flag.StringVar(&BuildahImage, "buildah-image", BuildahImage, "-buildah-image quay.io/buildah/stable:v1.29.0")
+	flag.StringVar(&ManifestToolImage, "manifest-tool-image", ManifestToolImage, "-manifest-tool-image gcr.io/go-containerregistry/crane:debug")
+	flag.StringVar(&TagStrategies, "tag-strategies", TagStrategies, "-tag-strategies sha|branch-sha|semver|timestamp|latest, joined by +")
+	flag.StringVar(&ProjectTagStrategies, "project-tag-strategies", ProjectTagStrategies, "-project-tag-strategies project-a=semver+latest,project-b=branch-sha")
+	flag.StringVar(&DefaultBranch, "default-branch", DefaultBranch, "-default-branch master")
+	flag.StringVar(&WorkspaceSize, "workspace-size", WorkspaceSize, "-workspace-size 1Gi")
+	flag.StringVar(&BuildProfilePath, "build-profile-path", BuildProfilePath, "-build-profile-path /etc/build-profiles")
+	flag.StringVar(&BuildProfileConfigMap, "build-profile-configmap", BuildProfileConfigMap, "-build-profile-configmap yce-cloud-extensions-build-profiles")
+	flag.IntVar(&MaxConcurrentBuilds, "max-concurrent-builds", MaxConcurrentBuilds, "-max-concurrent-builds 10, 0 is unlimited")
+	flag.StringVar(&ProjectMaxConcurrentBuilds, "project-max-concurrent-builds", ProjectMaxConcurrentBuilds, "-project-max-concurrent-builds *=2,project-a=4")
+	flag.StringVar(&GitHostMaxConcurrentBuilds, "git-host-max-concurrent-builds", GitHostMaxConcurrentBuilds, "-git-host-max-concurrent-builds git.ym=8,github.com=2")
+	flag.StringVar(&SupersedePolicy, "supersede-policy", SupersedePolicy, "-supersede-policy cancel|queue|parallel")
+	flag.StringVar(&ProjectSupersedePolicies, "project-supersede-policies", ProjectSupersedePolicies, "-project-supersede-policies project-a=queue,project-b=parallel")
+	flag.IntVar(&BuildAttempts, "build-attempts", BuildAttempts, "-build-attempts 3, 0 is unlimited")
+	flag.DurationVar(&BuildRetryBackoff, "build-retry-backoff", BuildRetryBackoff, "-build-retry-backoff 10s")
+	flag.DurationVar(&MaxBuildRetryBackoff, "max-build-retry-backoff", MaxBuildRetryBackoff, "-max-build-retry-backoff 5m")
+	flag.BoolVar(&SkipExistingImage, "skip-existing-image", SkipExistingImage, "-skip-existing-image=true skip the build of the image built already")
+	flag.StringVar(&InsecureRegistries, "insecure-registries", InsecureRegistries, "-insecure-registries harbor.ym,127.0.0.1:5000")
+	flag.BoolVar(&PathFilter, "path-filter", PathFilter, "-path-filter=true skip the build of the project path unchanged since the last build")
+	flag.StringVar(&WatchPaths, "watch-paths", WatchPaths, "-watch-paths go.mod,libs/common")
+	flag.StringVar(&GitProviders, "git-providers", GitProviders, "-git-providers git.ym=gitlab,github.com=github")
+	flag.DurationVar(&BuildTimeout, "build-timeout", BuildTimeout, "-build-timeout 1h")
+	flag.StringVar(&BuildCPURequests, "build-cpu-requests", BuildCPURequests, "-build-cpu-requests 500m")
+	flag.StringVar(&BuildCPULimit, "build-cpu-limit", BuildCPULimit, "-build-cpu-limit 2")
+	flag.StringVar(&BuildMEMRequests, "build-mem-requests", BuildMEMRequests, "-build-mem-requests 1Gi")
+	flag.StringVar(&BuildMEMLimit, "build-mem-limit", BuildMEMLimit, "-build-mem-limit 4Gi")
+	flag.StringVar(&BuildNodeSelector, "build-node-selector", BuildNodeSelector, "-build-node-selector node-role=build")
+	flag.StringVar(&BuildRuntimeClass, "build-runtime-class", BuildRuntimeClass, "-build-runtime-class gvisor")
+	flag.StringVar(&BuildPodConfigMap, "build-pod-configmap", BuildPodConfigMap, "-build-pod-configmap yce-cloud-extensions-build-pods")
+	flag.StringVar(&TektonNamespace, "tekton-namespace", TektonNamespace, "-tekton-namespace tekton-pipelines")
+	flag.BoolVar(&ImageScan, "image-scan", ImageScan, "-image-scan=true")
+	flag.StringVar(&ScanImage, "scan-image", ScanImage, "-scan-image aquasec/trivy:0.45.1")
+	flag.StringVar(&ScanThreshold, "scan-threshold", ScanThreshold, "-scan-threshold CRITICAL=0,HIGH=10")
+	flag.StringVar(&ScanDeleteImage, "scan-delete-image", ScanDeleteImage, "-scan-delete-image ghcr.io/oras-project/oras:v1.1.0")
+	flag.StringVar(&SBOMToolImage, "sbom-tool-image", SBOMToolImage, "-sbom-tool-image anchore/syft:v0.98.0")
+	flag.StringVar(&SBOMPushImage, "sbom-push-image", SBOMPushImage, "-sbom-push-image ghcr.io/oras-project/oras:v1.1.0")
+	flag.BoolVar(&ImageSign, "image-sign", ImageSign, "-image-sign=true sign the pushed images by the cosign key")
+	flag.StringVar(&SignImage, "sign-image", SignImage, "-sign-image gcr.io/projectsigstore/cosign:v2.2.0")
+	flag.StringVar(&SignKeySecret, "sign-key-secret", SignKeySecret, "-sign-key-secret yce-cloud-extensions-cosign")
+	flag.BoolVar(&VerifyImageSignature, "verify-image-signature", VerifyImageSignature, "-verify-image-signature=true reject the cd of the image not signed")
+	flag.StringVar(&SignPublicKeys, "sign-public-keys", SignPublicKeys, "-sign-public-keys yce-cloud-extensions-cosign-public-keys")
+	flag.StringVar(&DiagnosisConfigMap, "diagnosis-configmap", DiagnosisConfigMap, "-diagnosis-configmap yce-cloud-extensions-diagnosis-rules")
+	flag.Int64Var(&DiagnosisLogLines, "diagnosis-log-lines", DiagnosisLogLines, "-diagnosis-log-lines 50")
+	flag.BoolVar(&StepProgress, "step-progress", StepProgress, "-step-progress=true push the progress of the running steps to the echoer")
+	flag.DurationVar(&GCInterval, "gc-interval", GCInterval, "-gc-interval 30m, 0 disable the gc")
+	flag.IntVar(&GCKeepRuns, "gc-keep-runs", GCKeepRuns, "-gc-keep-runs 10")
+	flag.DurationVar(&GCMinAge, "gc-min-age", GCMinAge, "-gc-min-age 24h")
+	flag.DurationVar(&GCFailedMinAge, "gc-failed-min-age", GCFailedMinAge, "-gc-failed-min-age 168h")
+	flag.BoolVar(&DependencyCache, "dependency-cache", DependencyCache, "-dependency-cache=true mount the dependency caches of the build profile from a volume")
+	flag.StringVar(&DependencyCacheScope, "dependency-cache-scope", DependencyCacheScope, "-dependency-cache-scope project|profile")
+	flag.StringVar(&DependencyCacheSize, "dependency-cache-size", DependencyCacheSize, "-dependency-cache-size 5Gi")
+	flag.StringVar(&DependencyCacheStorageClass, "dependency-cache-storage-class", DependencyCacheStorageClass, "-dependency-cache-storage-class standard")
+	flag.StringVar(&DependencyCacheAccessMode, "dependency-cache-access-mode", DependencyCacheAccessMode, "-dependency-cache-access-mode ReadWriteOnce|ReadWriteMany")
+	flag.StringVar(&DependencyCacheTotalSize, "dependency-cache-total-size", DependencyCacheTotalSize, "-dependency-cache-total-size 100Gi")
+}
+
+// NewCredentialsProvider the provider of the -credentials-provider, fall back to the account flags
+func NewCredentialsProvider(drs datasource.IDataSource) (credentials.Provider, error) {
+	flags := credentials.Static{
+		credentials.Git:      {Username: ConfigGitUser, Password: ConfigGitPassword},
+		credentials.Registry: {Username: ConfigRegistryUserName, Password: ConfigRegistryPassword},
+	}
+	var provider credentials.Provider
+	switch CredentialsProvider {
+	case "flag":
+		return flags, nil
+	case "file":
+		provider = &credentials.File{Dir: CredentialsDir}
+	case "env":
+		provider = &credentials.Env{Prefix: CredentialsEnvPrefix}
+	case "secret":
+		provider = &credentials.Secret{
+			Name: CredentialsSecret,
+			Getter: func(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+				return drs.Get(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, name)
+			},
+		}
+	case "vault":
+		provider = &credentials.Vault{Addr: VaultAddr, Path: VaultPath, TokenFile: VaultTokenFile}
+	default:
+		return flags, fmt.Errorf("credentials provider %s not supported", CredentialsProvider)
+	}
+	return credentials.Chain{provider, flags}, nil
+}
+
+// InsecureRegistryHosts the hosts of the -insecure-registries
+func InsecureRegistryHosts() []string {
+	return strings.Split(InsecureRegistries, ",")
+}
+
+// TektonVersion the tekton.dev api version served by the cluster
+func TektonVersion(lister k8s.ResourceLister) string {
+	gvr, err := lister.GetGvr(k8s.PipelineRun)
+	if err != nil {
+		return TektonLegacyVersion
+	}
+	return gvr.Version
 }
 
 var _ io.Writer = &Output{}
@@ -0,0 +1,347 @@
+package diagnosis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/configure"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Unknown the category of the failure matched no rule
+const Unknown = "unknown"
+
+// TimeoutReason the reason of the pipelineRun failed by the timeout, PipelineRunTimeout before tekton v1
+func TimeoutReason(reason string) bool {
+	return reason == "PipelineRunTimeout"
+}
+
+// Rule classify the failure matched any of the reasons or the patterns
+type Rule struct {
+	// Category the name of the rule, the rule of the configmap replace the builtin of the same category
+	Category string `json:"category"`
+	// Summary the human-readable summary of the failure
+	Summary string `json:"summary"`
+	// Reasons the termination reasons of the failed step, the taskRun, the pipelineRun or the pod events, e.g. OOMKilled
+	Reasons []string `json:"reasons,omitempty"`
+	// Patterns the regular expressions matched the log lines of the failed step, the messages and the pod events
+	Patterns []string `json:"patterns,omitempty"`
+
+	expressions []*regexp.Regexp
+}
+
+// builtinRules the reasons are matched before the patterns, the timeout and the out of memory first
+var builtinRules = []Rule{
+	{
+		Category: "timeout",
+		Summary:  "the build exceeded the timeout of the pipelineRun",
+		Reasons:  []string{"PipelineRunTimeout", "TaskRunTimeout", "DeadlineExceeded"},
+	},
+	{
+		Category: "oom-killed",
+		Summary:  "the step was killed out of memory, raise the memory limit of the build pod",
+		Reasons:  []string{"OOMKilled"},
+	},
+	{
+		Category: "vulnerability-threshold",
+		Summary:  "the vulnerabilities of the pushed image exceed the scan threshold",
+		Patterns: []string{`exceed the scan threshold`},
+	},
+	{
+		Category: "dockerfile-not-found",
+		Summary:  "the dockerfile of the project path was not found",
+		Patterns: []string{
+			`(?i)dockerfile.*(no such file|not found|does not exist)`,
+			`(?i)failed to read dockerfile`,
+			`(?i)unable to prepare context`,
+		},
+	},
+	{
+		Category: "registry-auth",
+		Summary:  "the registry denied the access, check the registry credential",
+		Patterns: []string{
+			`(?i)unauthorized`,
+			`(?i)authentication required`,
+			`(?i)denied: requested access`,
+			`(?i)insufficient_scope`,
+		},
+	},
+	{
+		Category: "dependency-resolution",
+		Summary:  "the dependencies of the project could not be resolved",
+		Patterns: []string{
+			`(?i)could not resolve (dependencies|all (files|dependencies))`,
+			`(?i)npm ERR! code (E404|ERESOLVE|ETARGET)`,
+			`(?i)cannot find module providing package`,
+			`(?i)no matching distribution found`,
+			`(?i)unable to resolve dependency`,
+		},
+	},
+}
+
+func (r *Rule) compile() error {
+	if r.Summary == "" {
+		return fmt.Errorf("summary is required")
+	}
+	if len(r.Reasons) == 0 && len(r.Patterns) == 0 {
+		return fmt.Errorf("reasons or patterns are required")
+	}
+	r.expressions = make([]*regexp.Regexp, 0, len(r.Patterns))
+	for _, pattern := range r.Patterns {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("illegal pattern (%s)", pattern)
+		}
+		r.expressions = append(r.expressions, expression)
+	}
+	return nil
+}
+
+func (r *Rule) match(reasons, lines []string) bool {
+	for _, reason := range reasons {
+		for _, expected := range r.Reasons {
+			if reason != "" && strings.EqualFold(reason, expected) {
+				return true
+			}
+		}
+	}
+	for _, line := range lines {
+		for _, expression := range r.expressions {
+			if expression.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RulesFromConfigMap each data key of the configmap is the category, the value is the yaml of the rule, e.g.
+//
+//	summary: the private maven repository is unreachable
+//	patterns:
+//	  - 'Could not transfer artifact .* from/to nexus'
+func RulesFromConfigMap(obj *unstructured.Unstructured) ([]Rule, error) {
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]string, 0, len(data))
+	for category := range data {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	result := make([]Rule, 0, len(data))
+	for _, category := range categories {
+		rule := Rule{}
+		if err := yaml.UnmarshalStrict([]byte(data[category]), &rule); err != nil {
+			return nil, fmt.Errorf("parse diagnosis rule %s error (%s)", category, err)
+		}
+		rule.Category = category
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("diagnosis rule %s %s", category, err)
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// withRules the rules of the configmap matched before the builtin rules, replace the builtin of the same category
+func withRules(rules []Rule) []Rule {
+	result := append(make([]Rule, 0, len(rules)+len(builtinRules)), rules...)
+	configured := make(map[string]bool)
+	for _, rule := range rules {
+		configured[rule.Category] = true
+	}
+	for _, rule := range builtinRules {
+		if configured[rule.Category] {
+			continue
+		}
+		_ = rule.compile()
+		result = append(result, rule)
+	}
+	return result
+}
+
+// Classify the category and the summary of the first rule matched the reasons or the lines
+func Classify(rules []Rule, reasons, lines []string) (string, string) {
+	for _, rule := range rules {
+		if rule.match(reasons, lines) {
+			return rule.Category, rule.Summary
+		}
+	}
+	return Unknown, "the failure matched no diagnosis rule"
+}
+
+// Diagnoser classify the failure of the pipelineRun by the failed taskRun, the log lines
+// of the failed step and the events of the pod
+type Diagnoser struct {
+	datasource.IDataSource
+	// Clientset read the logs and the events of the pod, the failure is classified without them if nil
+	Clientset kubernetes.Interface
+	// ConfigMap the rules of the configmap read on each diagnosis
+	ConfigMap string
+	// LogLines the last lines of the log of the failed step matched by the rules
+	LogLines int64
+}
+
+// NewDiagnoser the diagnoser of the -diagnosis-* flags
+func NewDiagnoser(cfg *configure.InstallConfigure, drs datasource.IDataSource) *Diagnoser {
+	diagnoser := &Diagnoser{
+		IDataSource: drs,
+		ConfigMap:   services.DiagnosisConfigMap,
+		LogLines:    services.DiagnosisLogLines,
+	}
+	if cfg != nil && cfg.Clientset != nil {
+		diagnoser.Clientset = cfg.Clientset
+	}
+	return diagnoser
+}
+
+// Diagnose classify the failure of the pipelineRun of the reason and the message, the logs and the events
+// are only matched by the rules, the summary never contain them as they may print the secrets
+func (d *Diagnoser) Diagnose(ctx context.Context, pipelineRunName, reason, message string) *v1.Diagnosis {
+	configured, err := d.rules(ctx)
+	if err != nil {
+		common.Printf(ctx, common.WARN, "diagnosis %s with the builtin rules, %s\n", pipelineRunName, err)
+	}
+	rules := withRules(configured)
+
+	result := &v1.Diagnosis{Reason: reason}
+	reasons, lines := []string{reason}, []string{message}
+	list, err := d.List(ctx, common.YceCloudExtensionsOps, k8s.TaskRun, "", 0, 0, fmt.Sprintf("%s=%s", services.PipelineRunLabel, pipelineRunName))
+	if err != nil {
+		common.Printf(ctx, common.WARN, "diagnosis %s list taskRuns error (%s)\n", pipelineRunName, err)
+	}
+	if taskRun := failedTaskRun(list); taskRun != nil {
+		taskReason, taskMessage := succeededCondition(taskRun)
+		reasons, lines = append(reasons, taskReason), append(lines, taskMessage)
+		result.Reason = taskReason
+		_, steps := services.TaskRunSteps(taskRun)
+		for _, step := range steps {
+			if step.State != v1.FailState {
+				continue
+			}
+			result.Task, result.Step, result.ExitCode = step.Task, step.Name, step.ExitCode
+			if step.Reason != "" {
+				result.Reason = step.Reason
+			}
+			reasons, lines = append(reasons, step.Reason), append(lines, step.Message)
+			break
+		}
+		podName, _, _ := unstructured.NestedString(taskRun.Object, "status", "podName")
+		podReasons, podLines := d.inspectPod(ctx, podName, result.Step)
+		reasons, lines = append(reasons, podReasons...), append(lines, podLines...)
+	}
+
+	result.Category, result.Summary = Classify(rules, reasons, lines)
+	if result.Step != "" {
+		result.Summary = fmt.Sprintf("%s, step %s of task %s exited %d (%s)", result.Summary, result.Step, result.Task, result.ExitCode, result.Reason)
+	} else if result.Reason != "" {
+		result.Summary = fmt.Sprintf("%s (%s)", result.Summary, result.Reason)
+	}
+	return result
+}
+
+func (d *Diagnoser) rules(ctx context.Context) ([]Rule, error) {
+	if d.ConfigMap == "" {
+		return nil, nil
+	}
+	obj, err := d.Get(ctx, common.YceCloudExtensionsOps, k8s.ConfigMap, d.ConfigMap)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get diagnosis configmap %s error (%s)", d.ConfigMap, err)
+	}
+	rules, err := RulesFromConfigMap(obj)
+	if err != nil {
+		return nil, fmt.Errorf("illegal diagnosis configmap %s (%s)", d.ConfigMap, err)
+	}
+	return rules, nil
+}
+
+// inspectPod the reasons of the warning events of the pod and the last log lines of the failed step with the messages of the events
+func (d *Diagnoser) inspectPod(ctx context.Context, podName, step string) ([]string, []string) {
+	reasons, lines := make([]string, 0), make([]string, 0)
+	if d.Clientset == nil || podName == "" {
+		return reasons, lines
+	}
+	events, err := d.Clientset.CoreV1().Events(common.YceCloudExtensionsOps).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.name=%s", podName),
+	})
+	if err != nil {
+		common.Printf(ctx, common.WARN, "diagnosis list pod %s events error (%s)\n", podName, err)
+	} else {
+		for _, event := range events.Items {
+			if event.Type != corev1.EventTypeWarning {
+				continue
+			}
+			reasons, lines = append(reasons, event.Reason), append(lines, event.Message)
+		}
+	}
+	if step == "" || d.LogLines <= 0 {
+		return reasons, lines
+	}
+	logLines := d.LogLines
+	stream, err := d.Clientset.CoreV1().Pods(common.YceCloudExtensionsOps).GetLogs(podName, &corev1.PodLogOptions{
+		Container: "step-" + step,
+		TailLines: &logLines,
+	}).Stream(ctx)
+	if err != nil {
+		common.Printf(ctx, common.WARN, "diagnosis read pod %s step %s log error (%s)\n", podName, step, err)
+		return reasons, lines
+	}
+	defer stream.Close()
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return reasons, lines
+}
+
+// failedTaskRun the first failed taskRun of the pipelineRun
+func failedTaskRun(list *unstructured.UnstructuredList) *unstructured.Unstructured {
+	if list == nil {
+		return nil
+	}
+	for index := range list.Items {
+		item := &list.Items[index]
+		conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+		for _, condition := range conditions {
+			value, ok := condition.(map[string]interface{})
+			if ok && value["type"] == "Succeeded" && value["status"] == "False" {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func succeededCondition(item *unstructured.Unstructured) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, condition := range conditions {
+		value, ok := condition.(map[string]interface{})
+		if !ok || value["type"] != "Succeeded" {
+			continue
+		}
+		reason, _ := value["reason"].(string)
+		message, _ := value["message"].(string)
+		return reason, message
+	}
+	return "", ""
+}
@@ -0,0 +1,141 @@
+package diagnosis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const failedTaskRunYAML = `
+metadata:
+  name: demo-master-build
+  labels:
+    tekton.dev/pipelineRun: demo-master
+status:
+  podName: demo-master-build-pod
+  conditions:
+  - type: Succeeded
+    status: "False"
+    reason: Failed
+    message: '"step-build" exited with code 1'
+  steps:
+  - name: clone
+    container: step-clone
+    terminated:
+      exitCode: 0
+      reason: Completed
+  - name: build
+    container: step-build
+    terminated:
+      exitCode: 1
+      reason: Error
+`
+
+func taskRun(t *testing.T, data string) *unstructured.Unstructured {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func TestClassify(t *testing.T) {
+	rules := withRules(nil)
+	cases := []struct {
+		reasons, lines []string
+		expected       string
+	}{
+		{[]string{"PipelineRunTimeout"}, nil, "timeout"},
+		{[]string{"Error", "OOMKilled"}, nil, "oom-killed"},
+		{nil, []string{"error: failed to read dockerfile: open /workspace/Dockerfile: no such file or directory"}, "dockerfile-not-found"},
+		{nil, []string{"error pushing image: UNAUTHORIZED: authentication required"}, "registry-auth"},
+		{nil, []string{"npm ERR! code ERESOLVE"}, "dependency-resolution"},
+		{[]string{"Error"}, []string{"exit status 2"}, Unknown},
+	}
+	for _, c := range cases {
+		if category, _ := Classify(rules, c.reasons, c.lines); category != c.expected {
+			t.Fatalf("expected %s of %v %v, got %s", c.expected, c.reasons, c.lines, category)
+		}
+	}
+}
+
+func TestRulesFromConfigMap(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"data": map[string]interface{}{
+			"nexus-unreachable": "summary: the nexus is unreachable\npatterns:\n- 'Could not transfer artifact .* from/to nexus'\n",
+			"registry-auth":     "summary: the harbor robot account expired\npatterns:\n- 'unauthorized'\n",
+		},
+	}}
+	rules, err := RulesFromConfigMap(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules = withRules(rules)
+	category, summary := Classify(rules, nil, []string{"Could not transfer artifact a:b:1.0 from/to nexus (http://nexus)"})
+	if category != "nexus-unreachable" || summary != "the nexus is unreachable" {
+		t.Fatalf("unexpected %s %s", category, summary)
+	}
+	if _, summary := Classify(rules, nil, []string{"unauthorized"}); summary != "the harbor robot account expired" {
+		t.Fatalf("expected the builtin rule replaced, got %s", summary)
+	}
+	if _, summary := Classify(rules, []string{"OOMKilled"}, nil); !strings.Contains(summary, "memory") {
+		t.Fatalf("expected the builtin rules kept, got %s", summary)
+	}
+
+	for _, value := range []string{"patterns:\n- 'x'\n", "summary: x\npatterns:\n- '('\n", "summary: x\n", "summary: x\nunknown: y\n"} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"illegal": value}}}
+		if _, err := RulesFromConfigMap(obj); err == nil {
+			t.Fatalf("expected error of %q", value)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "demo-master-build-pod.1", Namespace: common.YceCloudExtensionsOps},
+		InvolvedObject: corev1.ObjectReference{Name: "demo-master-build-pod"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "Failed",
+		Message:        "Failed to pull image: unauthorized",
+	})
+	diagnoser := &Diagnoser{
+		IDataSource: fake.NewDataSource().Add(k8s.TaskRun, taskRun(t, failedTaskRunYAML)),
+		Clientset:   clientset,
+		ConfigMap:   "yce-cloud-extensions-diagnosis-rules",
+		LogLines:    50,
+	}
+	result := diagnoser.Diagnose(context.Background(), "demo-master", "Failed", "Tasks Completed: 1 (Failed: 1, Cancelled 0), Skipped: 0")
+	if result.Category != "registry-auth" || result.Task != "demo-master-build" || result.Step != "build" || result.ExitCode != 1 || result.Reason != "Error" {
+		t.Fatalf("unexpected diagnosis %+v", result)
+	}
+	if strings.Contains(result.Summary, "Failed to pull image") {
+		t.Fatalf("expected no events and logs in the summary, got %s", result.Summary)
+	}
+
+	// the configmap rules are matched first
+	rules := &unstructured.Unstructured{Object: map[string]interface{}{
+		"data": map[string]interface{}{"build-error": "summary: the build exited\nreasons:\n- Error\n"},
+	}}
+	rules.SetName("yce-cloud-extensions-diagnosis-rules")
+	drs := fake.NewDataSource().Add(k8s.ConfigMap, rules).Add(k8s.TaskRun, taskRun(t, failedTaskRunYAML))
+	diagnoser = &Diagnoser{IDataSource: drs, ConfigMap: "yce-cloud-extensions-diagnosis-rules"}
+	if result := diagnoser.Diagnose(context.Background(), "demo-master", "Failed", ""); result.Category != "build-error" {
+		t.Fatalf("unexpected diagnosis %+v", result)
+	}
+
+	// the pipelineRun timeout without the failed taskRun
+	diagnoser = &Diagnoser{IDataSource: fake.NewDataSource()}
+	result = diagnoser.Diagnose(context.Background(), "demo-master", "PipelineRunTimeout", "")
+	if result.Category != "timeout" || result.Reason != "PipelineRunTimeout" || result.Step != "" {
+		t.Fatalf("unexpected diagnosis %+v", result)
+	}
+}
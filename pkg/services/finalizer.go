@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// Finalizer the ci, unit and sonar requests are removed after the tekton objects of their runs cleaned up
+	Finalizer = "yce-cloud-extensions/cleanup"
+	// RunGraphAnnotation the tekton graph of the pipelineRun
+	RunGraphAnnotation = "fuxi.nip.io/run-tektongraphs"
+)
+
+// HasFinalizer the request wait for the cleanup before removed
+func HasFinalizer(objectMeta metav1.ObjectMeta) bool {
+	for _, finalizer := range objectMeta.Finalizers {
+		if finalizer == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveFinalizer release the request deleted, the other finalizers are kept
+func RemoveFinalizer(ctx context.Context, drs datasource.IDataSource, resource, name string) error {
+	obj, err := drs.Get(ctx, common.YceCloudExtensionsOps, resource, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("get %s %s error (%s)", resource, name, err)
+	}
+	finalizers := make([]string, 0)
+	for _, finalizer := range obj.GetFinalizers() {
+		if finalizer != Finalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if len(finalizers) == len(obj.GetFinalizers()) {
+		return nil
+	}
+	// the empty finalizers replace the ones of the request
+	obj.SetFinalizers(finalizers)
+	if _, _, err := drs.Apply(ctx, common.YceCloudExtensionsOps, resource, name, obj, false); err != nil {
+		return fmt.Errorf("remove %s %s finalizer error (%s)", resource, name, err)
+	}
+	return nil
+}
+
+// OwnerOf the reference of the request own the tekton objects of its runs, nil if the request not created yet
+func OwnerOf(typeMeta metav1.TypeMeta, objectMeta metav1.ObjectMeta) *metav1.OwnerReference {
+	if objectMeta.UID == "" || typeMeta.Kind == "" {
+		return nil
+	}
+	return &metav1.OwnerReference{
+		APIVersion: typeMeta.APIVersion,
+		Kind:       typeMeta.Kind,
+		Name:       objectMeta.Name,
+		UID:        objectMeta.UID,
+	}
+}
+
+// SetOwner the object is deleted by the kubernetes gc with the owner
+func SetOwner(obj *unstructured.Unstructured, owner *metav1.OwnerReference) {
+	if owner == nil {
+		return
+	}
+	obj.SetOwnerReferences([]metav1.OwnerReference{*owner})
+}
+
+// DeletePipelineRun delete the pipelineRun with its graph and the pipelineResource of the legacy tekton,
+// the taskRuns and the pods are deleted with the pipelineRun by the kubernetes gc
+func DeletePipelineRun(ctx context.Context, drs datasource.IDataSource, name string, legacy bool) error {
+	graphName := fmt.Sprintf("%s-%s", PipelineGraphName, name)
+	obj, err := drs.Get(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	switch {
+	case err == nil:
+		if value := obj.GetAnnotations()[RunGraphAnnotation]; value != "" {
+			graphName = value
+		}
+	case !errors.IsNotFound(err):
+		return fmt.Errorf("get pipelineRun %s error (%s)", name, err)
+	}
+	objects := [][2]string{{k8s.PipelineRun, name}, {k8s.TektonGraph, graphName}}
+	if legacy {
+		objects = append(objects, [2]string{k8s.PipelineResource, name})
+	}
+	for _, item := range objects {
+		if err := drs.Delete(ctx, common.YceCloudExtensionsOps, item[0], item[1]); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete %s %s error (%s)", item[0], item[1], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRemoveFinalizer(t *testing.T) {
+	ci := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	ci.SetName("demo-master")
+	ci.SetFinalizers([]string{Finalizer, "other"})
+	drs := fake.NewDataSource().Add(k8s.CI, ci)
+	if err := RemoveFinalizer(context.Background(), drs, k8s.CI, "demo-master"); err != nil {
+		t.Fatal(err)
+	}
+	if len(drs.Applied) != 1 || !reflect.DeepEqual(drs.Applied[0].GetFinalizers(), []string{"other"}) {
+		t.Fatalf("expected the other finalizer kept, got %v", drs.Applied)
+	}
+	// the released or deleted request is not updated
+	for _, name := range []string{"demo-master", "demo-dev"} {
+		if err := RemoveFinalizer(context.Background(), drs, k8s.CI, name); err != nil || len(drs.Applied) != 1 {
+			t.Fatalf("unexpected update of %s (%v)", name, err)
+		}
+	}
+}
+
+func TestDeletePipelineRun(t *testing.T) {
+	pipelineRun := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	pipelineRun.SetName("demo-master")
+	pipelineRun.SetAnnotations(map[string]string{RunGraphAnnotation: "run-graph"})
+	named := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetName(name)
+		return obj
+	}
+	drs := fake.NewDataSource().
+		Add(k8s.PipelineRun, pipelineRun).
+		Add(k8s.TektonGraph, named("run-graph")).
+		Add(k8s.PipelineResource, named("demo-master"))
+	if err := DeletePipelineRun(context.Background(), drs, "demo-master", false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(drs.Deleted, []string{k8s.PipelineRun + "/demo-master", k8s.TektonGraph + "/run-graph"}) {
+		t.Fatalf("unexpected deleted %v", drs.Deleted)
+	}
+	if err := DeletePipelineRun(context.Background(), drs, "demo-dev", true); err != nil {
+		t.Fatalf("expected the not found objects ignored, got %s", err)
+	}
+}
+
+func TestOwnerOf(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	SetOwner(obj, OwnerOf(metav1.TypeMeta{Kind: "CI"}, metav1.ObjectMeta{Name: "demo-master"}))
+	if len(obj.GetOwnerReferences()) != 0 {
+		t.Fatal("expected no owner of the request not created")
+	}
+	SetOwner(obj, OwnerOf(metav1.TypeMeta{APIVersion: "yamecloud.io/v1", Kind: "CI"}, metav1.ObjectMeta{Name: "demo-master", UID: "abc"}))
+	if owners := obj.GetOwnerReferences(); len(owners) != 1 || owners[0].Name != "demo-master" || owners[0].UID != "abc" {
+		t.Fatalf("unexpected owners %v", owners)
+	}
+}
@@ -0,0 +1,242 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laik/yce-cloud-extensions/pkg/common"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/ci"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ProjectLabel the project of the unit and the sonar runs, a run per branch named by the request
+// so the runs of the project are retained as a group
+const ProjectLabel = "yce-cloud-extensions/project"
+
+// Policy the retention of the completed runs, a run is removed only when all the rules allow
+type Policy struct {
+	// KeepRuns the newest runs of each project and branch kept
+	KeepRuns int
+	// MinAge the completed runs kept at least since the completion
+	MinAge time.Duration
+	// FailedMinAge the failed runs kept at least since the completion
+	FailedMinAge time.Duration
+}
+
+// Report the objects removed by a collection
+type Report struct {
+	PipelineRuns      []string
+	PipelineResources []string
+	TektonGraphs      []string
+	Pods              []string
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("pipelineRuns [%s] pipelineResources [%s] tektonGraphs [%s] pods [%s]",
+		strings.Join(r.PipelineRuns, ","),
+		strings.Join(r.PipelineResources, ","),
+		strings.Join(r.TektonGraphs, ","),
+		strings.Join(r.Pods, ","),
+	)
+}
+
+// Collector remove the completed runs of a service over the retention policy with their graphs,
+// pipelineResources and pods, the runs of the service are selected by the label selector
+type Collector struct {
+	datasource.IDataSource
+	// Name the service of the runs in the log
+	Name string
+	// Selector the label selector of the runs and the pods of the service
+	Selector string
+	Policy   Policy
+	Interval time.Duration
+	// Legacy the tekton v1alpha1 create a pipelineResource named by the run
+	Legacy bool
+}
+
+// NewCollector the collector of the -gc-* flags
+func NewCollector(drs datasource.IDataSource, lister k8s.ResourceLister, name, selector string) *Collector {
+	return &Collector{
+		IDataSource: drs,
+		Name:        name,
+		Selector:    selector,
+		Policy: Policy{
+			KeepRuns:     services.GCKeepRuns,
+			MinAge:       services.GCMinAge,
+			FailedMinAge: services.GCFailedMinAge,
+		},
+		Interval: services.GCInterval,
+		Legacy:   services.TektonVersion(lister) == services.TektonLegacyVersion,
+	}
+}
+
+// Start collect on each interval until the ctx done, the zero interval disable the collector
+func (c *Collector) Start(ctx context.Context, _ chan<- error) {
+	if c.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := c.Collect(ctx)
+		if err != nil {
+			fmt.Printf("%s gc %s collect error (%s)\n", common.ERROR, c.Name, err)
+		}
+		if report != nil && len(report.PipelineRuns)+len(report.Pods) > 0 {
+			fmt.Printf("%s gc %s removed %s\n", common.INFO, c.Name, report)
+		}
+	}
+}
+
+// Collect remove the expired runs once, the removed objects are reported even though error
+func (c *Collector) Collect(ctx context.Context) (*Report, error) {
+	report := &Report{}
+	list, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, "", 0, 0, c.Selector)
+	if err != nil {
+		return report, fmt.Errorf("list pipelineRuns error (%s)", err)
+	}
+	remove := func(resource, name string, removed *[]string) error {
+		if name == "" {
+			return nil
+		}
+		if err := c.Delete(ctx, common.YceCloudExtensionsOps, resource, name); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("delete %s %s error (%s)", resource, name, err)
+		}
+		*removed = append(*removed, name)
+		return nil
+	}
+
+	exist := make(map[string]struct{})
+	for _, item := range list.Items {
+		exist[item.GetName()] = struct{}{}
+	}
+	for _, item := range ExpiredRuns(list.Items, c.Policy, time.Now()) {
+		// the taskRuns and the pods are deleted with the pipelineRun by the owner references
+		if err := remove(k8s.PipelineRun, item.GetName(), &report.PipelineRuns); err != nil {
+			return report, err
+		}
+		delete(exist, item.GetName())
+		if err := remove(k8s.TektonGraph, item.GetAnnotations()[services.RunGraphAnnotation], &report.TektonGraphs); err != nil {
+			return report, err
+		}
+		if c.Legacy {
+			if err := remove(k8s.PipelineResource, item.GetName(), &report.PipelineResources); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// the completed pods left by the runs deleted without cascading
+	pods, err := c.List(ctx, common.YceCloudExtensionsOps, k8s.Pod, "", 0, 0, strings.Join([]string{c.Selector, services.PipelineRunLabel}, ","))
+	if err != nil {
+		return report, fmt.Errorf("list pods error (%s)", err)
+	}
+	for _, item := range pods.Items {
+		if _, running := exist[item.GetLabels()[services.PipelineRunLabel]]; running || !podCompleted(&item) {
+			continue
+		}
+		if err := remove(k8s.Pod, item.GetName(), &report.Pods); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+type run struct {
+	item      unstructured.Unstructured
+	created   time.Time
+	completed time.Time
+	failed    bool
+}
+
+// ExpiredRuns the completed runs over the newest KeepRuns of the project and branch, completed
+// before the MinAge, the failed before the FailedMinAge. the running runs are never expired
+func ExpiredRuns(items []unstructured.Unstructured, policy Policy, now time.Time) []unstructured.Unstructured {
+	groups := make(map[string][]*run)
+	for _, item := range items {
+		group := runGroup(&item)
+		groups[group] = append(groups[group], newRun(item))
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]unstructured.Unstructured, 0)
+	for _, name := range names {
+		runs := groups[name]
+		sort.SliceStable(runs, func(i, j int) bool { return runs[i].created.After(runs[j].created) })
+		for index, item := range runs {
+			if index < policy.KeepRuns || item.completed.IsZero() {
+				continue
+			}
+			minAge := policy.MinAge
+			if item.failed && policy.FailedMinAge > minAge {
+				minAge = policy.FailedMinAge
+			}
+			if now.Sub(item.completed) < minAge {
+				continue
+			}
+			result = append(result, item.item)
+		}
+	}
+	return result
+}
+
+// runGroup the project and branch of the ci run, the ci request or the name of the run created before the branch label,
+// the project of the unit and the sonar run
+func runGroup(item *unstructured.Unstructured) string {
+	labels := item.GetLabels()
+	for _, label := range []string{ci.BranchLabel, ci.CILabel, ProjectLabel} {
+		if value := labels[label]; value != "" {
+			return value
+		}
+	}
+	return item.GetName()
+}
+
+func newRun(item unstructured.Unstructured) *run {
+	result := &run{item: item, created: item.GetCreationTimestamp().Time}
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, condition := range conditions {
+		value, ok := condition.(map[string]interface{})
+		if !ok || value["type"] != "Succeeded" {
+			continue
+		}
+		switch value["status"] {
+		case "True":
+		case "False":
+			result.failed = true
+		default:
+			return result
+		}
+		completionTime, _, _ := unstructured.NestedString(item.Object, "status", "completionTime")
+		if completed, err := time.Parse(time.RFC3339, completionTime); err == nil {
+			result.completed = completed
+		} else {
+			result.completed = result.created
+		}
+	}
+	return result
+}
+
+func podCompleted(item *unstructured.Unstructured) bool {
+	phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+	return phase == "Succeeded" || phase == "Failed"
+}
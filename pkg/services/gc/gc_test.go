@@ -0,0 +1,115 @@
+package gc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/fake"
+	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
+	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/ci"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var now = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func pipelineRun(name, branch string, age time.Duration, status string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{ci.BranchLabel: branch})
+	obj.SetAnnotations(map[string]string{services.RunGraphAnnotation: "graph-" + name})
+	obj.SetCreationTimestamp(metav1.NewTime(now.Add(-age - time.Hour)))
+	condition := map[string]interface{}{"type": "Succeeded", "status": status}
+	_ = unstructured.SetNestedSlice(obj.Object, []interface{}{condition}, "status", "conditions")
+	if status != "Unknown" {
+		_ = unstructured.SetNestedField(obj.Object, now.Add(-age).Format(time.RFC3339), "status", "completionTime")
+	}
+	return obj
+}
+
+func names(items []unstructured.Unstructured) []string {
+	result := make([]string, 0)
+	for _, item := range items {
+		result = append(result, item.GetName())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestExpiredRuns(t *testing.T) {
+	day := 24 * time.Hour
+	items := []unstructured.Unstructured{
+		pipelineRun("app-master-1", "app-master", 1*time.Minute, "True"),
+		pipelineRun("app-master-2", "app-master", 2*day, "True"),
+		pipelineRun("app-master-3", "app-master", 3*day, "Unknown"),
+		pipelineRun("app-master-4", "app-master", 4*day, "True"),
+		pipelineRun("app-master-5", "app-master", 5*day, "False"),
+		pipelineRun("app-master-6", "app-master", 10*day, "False"),
+		pipelineRun("app-master-7", "app-master", 6*time.Hour, "True"),
+		pipelineRun("app-dev-1", "app-dev", 30*day, "True"),
+	}
+	// the newest runs, the running, the recent completed and the failed within a week are kept
+	policy := Policy{KeepRuns: 2, MinAge: day, FailedMinAge: 7 * day}
+	expired := names(ExpiredRuns(items, policy, now))
+	if !reflect.DeepEqual(expired, []string{"app-master-2", "app-master-4", "app-master-6"}) {
+		t.Fatalf("unexpected expired runs %v", expired)
+	}
+	if expired := ExpiredRuns(items, Policy{KeepRuns: 10}, now); len(expired) != 0 {
+		t.Fatalf("expected the runs within keep runs kept, got %v", names(expired))
+	}
+}
+
+func TestExpiredProjectRuns(t *testing.T) {
+	// the unit run of each branch is named by the request
+	items := make([]unstructured.Unstructured, 0)
+	for index, branch := range []string{"master", "dev", "feature-a"} {
+		item := pipelineRun("app-"+branch, "", time.Duration(index+1)*48*time.Hour, "True")
+		item.SetLabels(map[string]string{"tekton.dev/pipeline": services.UnitPipelineName, ProjectLabel: "app"})
+		items = append(items, item)
+	}
+	expired := names(ExpiredRuns(items, Policy{KeepRuns: 1, MinAge: 24 * time.Hour}, now))
+	if !reflect.DeepEqual(expired, []string{"app-dev", "app-feature-a"}) {
+		t.Fatalf("expected the older runs of the project expired, got %v", expired)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	pod := func(name, pipelineRun, phase string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetName(name)
+		obj.SetLabels(map[string]string{ci.CILabel: "app-master", services.PipelineRunLabel: pipelineRun})
+		_ = unstructured.SetNestedField(obj.Object, phase, "status", "phase")
+		return obj
+	}
+	run := func(name string, age time.Duration) *unstructured.Unstructured {
+		obj := pipelineRun(name, "app-master", age, "True")
+		obj.SetLabels(map[string]string{ci.BranchLabel: "app-master", ci.CILabel: "app-master"})
+		return &obj
+	}
+	graph := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	graph.SetName("graph-app-master-2")
+	drs := fake.NewDataSource().
+		Add(k8s.PipelineRun, run("app-master-1", time.Minute), run("app-master-2", 48*time.Hour)).
+		Add(k8s.TektonGraph, graph).
+		Add(k8s.Pod, pod("app-master-1-pod", "app-master-1", "Succeeded"), pod("app-master-0-pod", "app-master-0", "Succeeded"), pod("app-master-9-pod", "app-master-9", "Running"))
+	collector := &Collector{IDataSource: drs, Name: "ci", Selector: ci.CILabel, Policy: Policy{KeepRuns: 1, MinAge: time.Hour}, Legacy: true}
+	report, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		PipelineRuns: []string{"app-master-2"},
+		TektonGraphs: []string{"graph-app-master-2"},
+		Pods:         []string{"app-master-0-pod"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("unexpected report %s", report)
+	}
+	if len(drs.Deleted) != 3 {
+		t.Fatalf("unexpected deleted %v", drs.Deleted)
+	}
+}
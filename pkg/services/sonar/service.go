@@ -1,21 +1,26 @@
 package sonar
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 
 	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
 	"github.com/laik/yce-cloud-extensions/pkg/common"
 	"github.com/laik/yce-cloud-extensions/pkg/configure"
+	"github.com/laik/yce-cloud-extensions/pkg/credentials"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource"
 	"github.com/laik/yce-cloud-extensions/pkg/datasource/k8s"
 	"github.com/laik/yce-cloud-extensions/pkg/services"
+	"github.com/laik/yce-cloud-extensions/pkg/services/diagnosis"
 	"github.com/laik/yce-cloud-extensions/pkg/utils/tools"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
@@ -28,35 +33,57 @@ type Service struct {
 	datasource.IDataSource
 	lastPRVersion   string
 	lastSONARVersion string
+	lastTRVersion    string
+	// credentials the git and the registry account of the -credentials-provider
+	credentials credentials.Provider
+	// diagnoser classify the failure of the failed sonar
+	diagnoser *diagnosis.Diagnoser
 }
 
 func NewService(cfg *configure.InstallConfigure, drs datasource.IDataSource) services.IService {
+	provider, err := services.NewCredentialsProvider(drs)
+	if err != nil {
+		fmt.Printf("%s service sonar load credentials provider error (%s)\n", common.ERROR, err)
+	}
 	return &Service{
 		InstallConfigure: cfg,
 		IDataSource:      drs,
+		credentials:      provider,
+		diagnoser:        diagnosis.NewDiagnoser(cfg, drs),
 		lastPRVersion:    "0",
 		lastSONARVersion:  "0",
+		lastTRVersion:    "0",
 	}
 }
 
-func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
-	pipelineRunChan, err := c.Watch(common.YceCloudExtensionsOps, k8s.PipelineRun, c.lastPRVersion, 0, nil)
+func (c *Service) Start(ctx context.Context, errC chan<- error) {
+	go credentials.Watch(ctx, c.credentials, []string{credentials.Git, credentials.Registry}, services.CredentialsReloadInterval,
+		func(name string, _ *credentials.Credential) { c.reloadCredential(ctx, name) })
+
+	pipelineRunChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, c.lastPRVersion, 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch pipelineRun error (%s)\n", common.ERROR, err)
 		errC <- err
 	}
 
-	unitChan, err := c.Watch(common.YceCloudExtensionsOps, k8s.SONAR, c.lastSONARVersion, 0, nil)
+	unitChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.SONAR, c.lastSONARVersion, 0, nil)
 	if err != nil {
 		fmt.Printf("%s watch pipelineRun error (%s)\n", common.ERROR, err)
 		errC <- err
 	}
 
+	// the taskRuns copy the pipeline label of the pipelineRun
+	taskRunChan, err := c.Watch(ctx, common.YceCloudExtensionsOps, k8s.TaskRun, c.lastTRVersion, 0, "tekton.dev/pipeline="+services.SonarPipelineName)
+	if err != nil {
+		fmt.Printf("%s watch taskRun error (%s)\n", common.ERROR, err)
+		errC <- err
+	}
+
 	fmt.Printf("%s service sonar start watch sonar channel and pipeline run channel\n", common.INFO)
 
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			fmt.Printf("%s service sonar service get stop order\n", common.INFO)
 			return
 		case pipelineRunEvent, ok := <-pipelineRunChan:
@@ -68,7 +95,7 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 			if pipelineRunEvent.Type == watch.Deleted {
 				continue
 			}
-			if err := c.reconcilePipelineRun(pipelineRunEvent.Object); err != nil {
+			if err := c.reconcilePipelineRun(ctx, pipelineRunEvent.Object); err != nil {
 				fmt.Printf("%s service sonar watch pipeline run channel recv handle error (%s)\n", common.ERROR, err)
 			}
 			// record watch version
@@ -79,31 +106,69 @@ func (c *Service) Start(stop <-chan struct{}, errC chan<- error) {
 			}
 			c.lastPRVersion = result.String()
 
-		case unitEvent, ok := <-unitChan:
+		case taskRunEvent, ok := <-taskRunChan:
 			if !ok {
-				fmt.Printf("%s service sonar channel closed\n", common.ERROR)
-				errC <- fmt.Errorf("service watch sonar channel closed")
+				fmt.Printf("%s service sonar task run channel closed\n", common.ERROR)
+				errC <- fmt.Errorf("service sonar watch task run channel closed")
 				return
 			}
-			// ignore delete event
-			if unitEvent.Type == watch.Deleted {
+			if taskRunEvent.Type == watch.Deleted {
 				continue
 			}
+			if err := c.reconcileTaskRun(ctx, taskRunEvent.Object); err != nil {
+				fmt.Printf("%s service sonar watch task run channel recv handle error (%s)\n", common.ERROR, err)
+			}
+			result, err := tools.GetObjectValue(taskRunEvent.Object, "metadata.resourceVersion")
+			if err != nil {
+				fmt.Printf("%s service sonar watch taskrun resource version not found\n", common.ERROR)
+				continue
+			}
+			c.lastTRVersion = result.String()
 
+		case unitEvent, ok := <-unitChan:
+			if !ok {
+				fmt.Printf("%s service sonar channel closed\n", common.ERROR)
+				errC <- fmt.Errorf("service watch sonar channel closed")
+				return
+			}
 			sonarObj := &v1.Sonar{}
 			if err := tools.RuntimeObjectToInstance(unitEvent.Object, sonarObj); err != nil {
 				fmt.Printf("%s service sonar channel recv object can't not convert to sonar object (%s)\n", common.ERROR, err)
 				continue
 			}
 
-			if err := c.reconcileSonar(sonarObj); err != nil {
-				fmt.Printf("%s service sonar channel reconcil object (%s) error (%s)\n", common.ERROR, sonarObj.GetName(), err)
+			reconcileCtx := common.WithRequestRef(ctx, sonarObj.Spec.FlowId, sonarObj.Spec.StepName, sonarObj.Spec.UUID)
+			// the request created before the finalizer is cleaned up after deleted
+			if unitEvent.Type == watch.Deleted || sonarObj.GetDeletionTimestamp() != nil {
+				if err := c.finalizeSonar(reconcileCtx, sonarObj); err != nil {
+					common.Printf(reconcileCtx, common.ERROR, "service sonar finalize (%s) error (%s)\n", sonarObj.GetName(), err)
+				}
+				continue
+			}
+			if err := c.reconcileSonar(reconcileCtx, sonarObj); err != nil {
+				common.Printf(reconcileCtx, common.ERROR, "service sonar channel reconcil object (%s) error (%s)\n", sonarObj.GetName(), err)
 			}
 			c.lastSONARVersion = sonarObj.GetResourceVersion()
 		}
 	}
 }
 
+// reloadCredential update the tekton secret of the loaded or rotated credential
+func (c *Service) reloadCredential(ctx context.Context, name string) {
+	var err error
+	switch name {
+	case credentials.Git:
+		_, err = c.checkAndRecreateGitConfig(ctx)
+	case credentials.Registry:
+		_, err = c.checkAndRecreateRegistryConfig(ctx)
+	}
+	if err != nil {
+		fmt.Printf("%s service sonar reload %s credential error (%s)\n", common.ERROR, name, err)
+		return
+	}
+	fmt.Printf("%s service sonar reload %s credential\n", common.INFO, name)
+}
+
 type condition struct {
 	LastTransitionTime string `json:"lastTransitionTime"`
 	Message            string `json:"message"`
@@ -112,7 +177,7 @@ type condition struct {
 	Type               string `json:"type"`
 }
 
-func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
+func (c *Service) reconcilePipelineRun(ctx context.Context, runtimeObject runtime.Object) error {
 	pipelineRunJSON, err := json.Marshal(runtimeObject)
 	if err != nil {
 		return err
@@ -141,7 +206,7 @@ func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
 		return nil
 	}
 
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName)
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName)
 	if err != nil {
 		return fmt.Errorf("get sonar %s", err)
 	}
@@ -155,24 +220,82 @@ func (c *Service) reconcilePipelineRun(runtimeObject runtime.Object) error {
 	case conditions[0].Reason == succeeded && conditions[0].Status == "True" && conditions[0].Type == succeeded: // successed
 		sonar.Spec.Done = true
 		sonar.Spec.AckStates = append(sonar.Spec.AckStates, v1.SuccessState)
-	case conditions[0].Reason == failed && conditions[0].Status == "False" && conditions[0].Type == succeeded: // failed
+		sonar.Spec.Diagnosis = nil
+	case (conditions[0].Reason == failed || diagnosis.TimeoutReason(conditions[0].Reason)) && conditions[0].Status == "False" && conditions[0].Type == succeeded: // failed
 		sonar.Spec.Done = true
 		sonar.Spec.AckStates = append(sonar.Spec.AckStates, v1.FailState)
+		if sonar.Spec.Diagnosis == nil {
+			sonar.Spec.Diagnosis = c.diagnoser.Diagnose(ctx, pipelineRunName, conditions[0].Reason, conditions[0].Message)
+		}
 	}
 
 	ciUnstructured, err := tools.InstanceToUnstructured(sonar)
 	if err != nil {
 		return err
 	}
-	if _, _, err := c.Apply(common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName, ciUnstructured, false); err != nil {
+	if _, _, err := c.Apply(ctx, common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName, ciUnstructured, false); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// reconcileTaskRun record the steps of the taskRun in the sonar of the running pipelineRun, named by the sonar
+func (c *Service) reconcileTaskRun(ctx context.Context, runtimeObject runtime.Object) error {
+	taskRun, ok := runtimeObject.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("taskRun runtime object (%T) not unstructured", runtimeObject)
+	}
+	pipelineRunName, steps := services.TaskRunSteps(taskRun)
+	if pipelineRunName == "" || len(steps) == 0 {
+		return nil
+	}
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("get sonar %s", err)
+	}
+	sonar := &v1.Sonar{}
+	if err := tools.UnstructuredObjectToInstanceObj(obj, sonar); err != nil {
+		return err
+	}
+	if sonar.Spec.Done {
+		return nil
+	}
+	merged := services.MergeSteps(sonar.Spec.Steps, steps)
+	if reflect.DeepEqual(merged, sonar.Spec.Steps) {
+		return nil
+	}
+	sonar.Spec.Steps = merged
+	sonarUnstructured, err := tools.InstanceToUnstructured(sonar)
+	if err != nil {
+		return err
+	}
+	if _, _, err := c.Apply(ctx, common.YceCloudExtensionsOps, k8s.SONAR, pipelineRunName, sonarUnstructured, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// finalizeSonar delete the tekton objects of the deleted request and release the finalizer
+func (c *Service) finalizeSonar(ctx context.Context, sonar *v1.Sonar) error {
+	if err := services.DeletePipelineRun(ctx, c, pipelineRunName(sonar.ObjectMeta.Name), c.legacy()); err != nil {
+		return err
+	}
+	if !services.HasFinalizer(sonar.ObjectMeta) {
+		return nil
+	}
+	if err := services.RemoveFinalizer(ctx, c, k8s.SONAR, sonar.GetName()); err != nil {
+		return err
+	}
+	common.Printf(ctx, common.INFO, "service sonar (%s) deleted with the pipelineRun cleaned up\n", sonar.GetName())
+	return nil
+}
+
 // Generator Tekton Task/Pipeline/PipelineResource/PipelineRun/Config...
-func (c *Service) reconcileSonar(sonar *v1.Sonar) error {
+func (c *Service) reconcileSonar(ctx context.Context, sonar *v1.Sonar) error {
 	if sonar.Spec.Done {
 		return nil
 	}
@@ -182,54 +305,61 @@ func (c *Service) reconcileSonar(sonar *v1.Sonar) error {
 	}
 
 	// Check Secret Config install
-	_, err = c.checkAndRecreateGitConfig()
+	_, err = c.checkAndRecreateGitConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("reconcile unit check and recreate config error (%s)", err)
 	}
 	// Check Secret Config install
-	_, err = c.checkAndRecreateRegistryConfig()
+	_, err = c.checkAndRecreateRegistryConfig(ctx)
 	if err != nil {
 		return fmt.Errorf("reconcile unit check and recreate config error (%s)", err)
 	}
 
 	prName := pipelineRunName(sonar.ObjectMeta.Name)
+	// the objects of the run are deleted with the sonar request
+	owner := services.OwnerOf(sonar.TypeMeta, sonar.ObjectMeta)
 
-	// first create pipelineResource with pipelineRun same name
-	obj, err := c.checkAndRecreatePipelineResource(prName, *sonar.Spec.GitURL, *sonar.Spec.Branch)
-	if err != nil {
-		return err
+	// first create pipelineResource with pipelineRun same name, the newer tekton clone the source in the task
+	if c.legacy() {
+		if _, err := c.checkAndRecreatePipelineResource(ctx, prName, *sonar.Spec.GitURL, *sonar.Spec.Branch, owner); err != nil {
+			return err
+		}
 	}
 
 	// check and reconcile task normal
-	if _, err = c.checkAndRecreateTask(); err != nil {
+	if _, err = c.checkAndRecreateTask(ctx); err != nil {
 		return err
 	}
 
 	// check and reconcile pipeline graph
-	_, err = c.checkAndRecreateGraph(services.SonarPipelineGraphName)
+	_, err = c.checkAndRecreateGraph(ctx, services.SonarPipelineGraphName)
 	if err != nil {
 		return err
 	}
 	// check and reconcile pipeline
-	if _, err := c.checkAndRecreatePipeline(); err != nil {
+	if _, err := c.checkAndRecreatePipeline(ctx); err != nil {
 		return err
 	}
 
 	// check and reconcile pipelineRun graph
 	pipelineRunGraphName := fmt.Sprintf("%s-%s", services.PipelineGraphName, prName)
-	pipelineRunGraph, err := c.checkAndRecreateGraph(pipelineRunGraphName)
+	pipelineRunGraph, err := c.checkAndRecreateGraph(ctx, pipelineRunGraphName)
 	if err != nil {
 		return err
 	}
 
 	// check and reconcile pipelineRun
-	obj, err = c.checkAndRecreatePipelineRun(
+	obj, err := c.checkAndRecreatePipelineRun(
+		ctx,
 		prName,
 		projectName,
 		pipelineRunGraphName,
 		prName,
 		pipelineRunGraph,
 		*sonar.Spec.Language,
+		*sonar.Spec.GitURL,
+		*sonar.Spec.Branch,
+		owner,
 	)
 	if err != nil {
 		return err
@@ -239,22 +369,26 @@ func (c *Service) reconcileSonar(sonar *v1.Sonar) error {
 	return nil
 }
 
-func (c *Service) checkAndRecreateRegistryConfig() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName)
+func (c *Service) checkAndRecreateRegistryConfig(ctx context.Context) (*unstructured.Unstructured, error) {
+	username, password, err := credentials.Account(ctx, c.credentials, credentials.Registry)
+	if err != nil {
+		return nil, fmt.Errorf("load registry credential error (%s)", err)
+	}
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName)
 
 	configParams := params{
 		Namespace:        common.YceCloudExtensionsOps,
 		Name:             services.TektonDockerConfigName,
 		RegistryRepoUrl:  services.ConfigRegistryUrl,
-		RegistryUsername: base64.StdEncoding.EncodeToString([]byte(services.ConfigRegistryUserName)),
-		RegistryPassword: base64.StdEncoding.EncodeToString([]byte(services.ConfigRegistryPassword)),
+		RegistryUsername: base64.StdEncoding.EncodeToString([]byte(username)),
+		RegistryPassword: base64.StdEncoding.EncodeToString([]byte(password)),
 	}
 	defaultConfig, err := services.Render(configParams, configRegistryTpl)
 	if err != nil {
 		return nil, err
 	}
 	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
@@ -262,13 +396,13 @@ func (c *Service) checkAndRecreateRegistryConfig() (*unstructured.Unstructured,
 	}
 
 	if !tools.CompareSpecByUnstructured(defaultConfig, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonDockerConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	serverAccount, err := c.Get(common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
+	serverAccount, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
 	if err != nil {
 		return nil, err
 	}
@@ -301,7 +435,7 @@ func (c *Service) checkAndRecreateRegistryConfig() (*unstructured.Unstructured,
 		if err := serviceAccount.UnmarshalJSON([]byte(newServiceAccountString)); err != nil {
 			return nil, err
 		}
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
 		if err != nil {
 			return nil, err
 		}
@@ -311,22 +445,26 @@ func (c *Service) checkAndRecreateRegistryConfig() (*unstructured.Unstructured,
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName)
+func (c *Service) checkAndRecreateGitConfig(ctx context.Context) (*unstructured.Unstructured, error) {
+	username, password, err := credentials.Account(ctx, c.credentials, credentials.Git)
+	if err != nil {
+		return nil, fmt.Errorf("load git credential error (%s)", err)
+	}
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName)
 
 	configParams := params{
 		Namespace:    common.YceCloudExtensionsOps,
 		Name:         services.TektonGitConfigName,
 		ConfigGitUrl: services.ConfigGitUrl,
-		GitUsername:  base64.StdEncoding.EncodeToString([]byte(services.ConfigGitUser)),
-		GitPassword:  base64.StdEncoding.EncodeToString([]byte(services.ConfigGitPassword)),
+		GitUsername:  base64.StdEncoding.EncodeToString([]byte(username)),
+		GitPassword:  base64.StdEncoding.EncodeToString([]byte(password)),
 	}
 	defaultConfig, err := services.Render(configParams, configGitTpl)
 	if err != nil {
 		return nil, err
 	}
 	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
@@ -334,13 +472,13 @@ func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error
 	}
 
 	if !tools.CompareSpecByUnstructured(defaultConfig, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonConfig, services.TektonGitConfigName, defaultConfig, false)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	serverAccount, err := c.Get(common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
+	serverAccount, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.ServiceAccount, "default")
 	if err != nil {
 		return nil, err
 	}
@@ -373,7 +511,7 @@ func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error
 		if err := serviceAccount.UnmarshalJSON([]byte(newServiceAccountString)); err != nil {
 			return nil, err
 		}
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.ServiceAccount, serverAccount.GetName(), serviceAccount, false)
 		if err != nil {
 			return nil, err
 		}
@@ -383,18 +521,19 @@ func (c *Service) checkAndRecreateGitConfig() (*unstructured.Unstructured, error
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName)
+func (c *Service) checkAndRecreateTask(ctx context.Context) (*unstructured.Unstructured, error) {
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName)
 	taskParams := params{
-		Namespace: common.YceCloudExtensionsOps,
-		Name:      services.SonarTaskName,
+		Namespace:     common.YceCloudExtensionsOps,
+		Name:          services.SonarTaskName,
+		TektonVersion: services.TektonVersion(c.ResourceLister),
 	}
-	defaultTask, err := services.Render(taskParams, taskTpl)
+	defaultTask, err := services.Render(taskParams, c.template(taskTpl, taskV1Tpl))
 	if err != nil {
 		return nil, err
 	}
 	if !errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName, defaultTask, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName, defaultTask, false)
 		if err != nil {
 			return nil, err
 		}
@@ -402,7 +541,7 @@ func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
 	}
 
 	if !tools.CompareSpecByUnstructured(defaultTask, obj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName, defaultTask, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Task, services.SonarTaskName, defaultTask, false)
 		if err != nil {
 			return nil, err
 		}
@@ -410,21 +549,22 @@ func (c *Service) checkAndRecreateTask() (*unstructured.Unstructured, error) {
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error) {
-	getObj, err := c.Get(common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarTaskName)
+func (c *Service) checkAndRecreatePipeline(ctx context.Context) (*unstructured.Unstructured, error) {
+	getObj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarTaskName)
 	pipelineParams := params{
 		Namespace:     common.YceCloudExtensionsOps,
 		Name:          services.SonarPipelineName,
 		PipelineGraph: services.SonarPipelineGraphName,
 		TaskName:      services.SonarTaskName,
+		TektonVersion: services.TektonVersion(c.ResourceLister),
 	}
-	obj, err := services.Render(pipelineParams, pipelineTpl)
+	obj, err := services.Render(pipelineParams, c.template(pipelineTpl, pipelineV1Tpl))
 	if err != nil {
 		return nil, err
 	}
 
 	if errors.IsNotFound(err) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarPipelineName, obj, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarPipelineName, obj, false)
 		if err != nil {
 			return nil, err
 		}
@@ -436,7 +576,7 @@ func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error)
 	}
 
 	if !tools.CompareSpecByUnstructured(obj, getObj) {
-		obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarPipelineName, obj, false)
+		obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.Pipeline, services.SonarPipelineName, obj, false)
 		if err != nil {
 			return nil, err
 		}
@@ -446,13 +586,16 @@ func (c *Service) checkAndRecreatePipeline() (*unstructured.Unstructured, error)
 }
 
 func (c *Service) checkAndRecreatePipelineRun(
+	ctx context.Context,
 	name,
 	projectName,
 	pipelineRunGraphName,
 	pipelineResourceName string,
 	pipelineRunGraph *unstructured.Unstructured,
-	codeType string,
-
+	codeType,
+	gitUrl,
+	branch string,
+	owner *metav1.OwnerReference,
 ) (*unstructured.Unstructured, error) {
 	if codeType == "" {
 		codeType = "other"
@@ -470,17 +613,23 @@ func (c *Service) checkAndRecreatePipelineRun(
 		CacheRepoUrl:         services.CacheRepoUrl,
 		CodeType:             projectName,
 		Command:              projectName,
+		GitUrl:               gitUrl,
+		Branch:               branch,
+		GitCloneImage:        services.GitCloneImage,
+		WorkspaceSize:        services.WorkspaceSize,
+		TektonVersion:        services.TektonVersion(c.ResourceLister),
 	}
-	defaultObj, err := services.Render(pipelineRunParams, pipelineRunTpl)
+	defaultObj, err := services.Render(pipelineRunParams, c.template(pipelineRunTpl, pipelineRunV1Tpl))
 	if err != nil {
 		return nil, err
 	}
+	services.SetOwner(defaultObj, owner)
 
-	obj, err := c.Get(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	obj, err := c.Get(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// create pipelineRun
-			obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
+			obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
 			if err != nil {
 				return nil, err
 			}
@@ -489,15 +638,15 @@ func (c *Service) checkAndRecreatePipelineRun(
 		return nil, err
 	}
 
-	err = c.Delete(common.YceCloudExtensionsOps, k8s.PipelineRun, name)
+	err = c.Delete(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name)
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineRun, name, defaultObj, false)
 	if err != nil {
 		return nil, err
 	}
-	pipelineRunGraph, err = c.checkAndRecreateGraph(pipelineRunGraph.GetName())
+	pipelineRunGraph, err = c.checkAndRecreateGraph(ctx, pipelineRunGraph.GetName())
 	if err != nil {
 		return nil, err
 	}
@@ -514,7 +663,7 @@ OWNER_REF:
 		return nil, err
 	}
 
-	pipelineRunGraphObj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, pipelineRunGraphName, pipelineRunGraphObj, false)
+	pipelineRunGraphObj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonGraph, pipelineRunGraphName, pipelineRunGraphObj, false)
 	if err != nil {
 		return nil, err
 	}
@@ -522,7 +671,7 @@ OWNER_REF:
 	return obj, err
 }
 
-func (c *Service) checkAndRecreateGraph(name string) (*unstructured.Unstructured, error) {
+func (c *Service) checkAndRecreateGraph(ctx context.Context, name string) (*unstructured.Unstructured, error) {
 	graphParams := params{
 		Namespace: common.YceCloudExtensionsOps,
 		Name:      name,
@@ -531,14 +680,14 @@ func (c *Service) checkAndRecreateGraph(name string) (*unstructured.Unstructured
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.TektonGraph, name, obj, false)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.TektonGraph, name, obj, false)
 	if err != nil {
 		return nil, err
 	}
 	return obj, nil
 }
 
-func (c *Service) checkAndRecreatePipelineResource(name, gitUrl, branch string) (*unstructured.Unstructured, error) {
+func (c *Service) checkAndRecreatePipelineResource(ctx context.Context, name, gitUrl, branch string, owner *metav1.OwnerReference) (*unstructured.Unstructured, error) {
 	pipelineResourceParams := params{
 		Namespace: common.YceCloudExtensionsOps,
 		Name:      name,
@@ -549,13 +698,27 @@ func (c *Service) checkAndRecreatePipelineResource(name, gitUrl, branch string)
 	if err != nil {
 		return nil, err
 	}
-	obj, _, err = c.Apply(common.YceCloudExtensionsOps, k8s.PipelineResource, name, obj, false)
+	services.SetOwner(obj, owner)
+	obj, _, err = c.Apply(ctx, common.YceCloudExtensionsOps, k8s.PipelineResource, name, obj, false)
 	if err != nil {
 		return nil, err
 	}
 	return obj, nil
 }
 
+// legacy the cluster served tekton v1alpha1 with PipelineResource
+func (c *Service) legacy() bool {
+	return services.TektonVersion(c.ResourceLister) == services.TektonLegacyVersion
+}
+
+// template pick the template written for the served tekton version
+func (c *Service) template(legacyTpl, tpl string) string {
+	if c.legacy() {
+		return legacyTpl
+	}
+	return tpl
+}
+
 func pipelineRunName(name string) string {
 	return strings.Replace(
 		strings.Replace(strings.ToLower(
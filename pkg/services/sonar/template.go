@@ -174,6 +174,7 @@ metadata:
   labels:
     namespace: {{.Namespace}}
     tekton.dev/pipeline: {{.PipelineName}}
+    yce-cloud-extensions/project: {{.ProjectName}}
   name: {{.Name}}
   namespace: {{.Namespace}}
 spec:
@@ -259,4 +260,10 @@ type params struct {
 	RegistryPassword string
 	RegistryUsername string
 	Command          string
+
+	// TektonVersion the served tekton.dev version, v1beta1 or v1 clone the source by git-clone step
+	TektonVersion string
+	CommitID      string
+	GitCloneImage string
+	WorkspaceSize string
 }
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// PipelineRunLabel the pipelineRun of the taskRuns and the pods copied by tekton
+	PipelineRunLabel = "tekton.dev/pipelineRun"
+	// PipelineTaskLabel the pipeline task of the taskRun
+	PipelineTaskLabel = "tekton.dev/pipelineTask"
+)
+
+const (
+	// internalResultType the results of the termination message written by tekton itself, e.g. StartedAt
+	internalResultType = 3
+	// maxStepMessage the length of the termination message recorded
+	maxStepMessage = 512
+)
+
+// TaskRunSteps the pipelineRun of the taskRun and the states of its steps in the order of the task
+func TaskRunSteps(obj *unstructured.Unstructured) (string, []v1.StepState) {
+	task := obj.GetLabels()[PipelineTaskLabel]
+	if task == "" {
+		task = obj.GetName()
+	}
+	items, _, _ := unstructured.NestedSlice(obj.Object, "status", "steps")
+	steps := make([]v1.StepState, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		step := v1.StepState{Task: task, State: v1.WaitingState}
+		step.Name, _, _ = unstructured.NestedString(value, "name")
+		if running, exist, _ := unstructured.NestedMap(value, "running"); exist {
+			step.State = v1.RunningState
+			step.StartTime, _, _ = unstructured.NestedString(running, "startedAt")
+		}
+		if terminated, exist, _ := unstructured.NestedMap(value, "terminated"); exist {
+			// the exit code is int64 of the watch object, float64 of the json decoded
+			switch exitCode := terminated["exitCode"].(type) {
+			case int64:
+				step.ExitCode = int32(exitCode)
+			case float64:
+				step.ExitCode = int32(exitCode)
+			}
+			step.State = v1.SuccessState
+			if step.ExitCode != 0 {
+				step.State = v1.FailState
+			}
+			step.StartTime, _, _ = unstructured.NestedString(terminated, "startedAt")
+			step.FinishTime, _, _ = unstructured.NestedString(terminated, "finishedAt")
+			step.Reason, _, _ = unstructured.NestedString(terminated, "reason")
+			message, _, _ := unstructured.NestedString(terminated, "message")
+			step.Message = stepMessage(message)
+		}
+		steps = append(steps, step)
+	}
+	return obj.GetLabels()[PipelineRunLabel], steps
+}
+
+// MergeSteps replace the steps of the tasks of the taskSteps, the tasks keep the order first seen
+func MergeSteps(steps, taskSteps []v1.StepState) []v1.StepState {
+	replaced := make(map[string]bool)
+	for _, step := range taskSteps {
+		replaced[step.Task] = true
+	}
+	result := make([]v1.StepState, 0, len(steps)+len(taskSteps))
+	merged := make(map[string]bool)
+	for _, step := range steps {
+		if !replaced[step.Task] {
+			result = append(result, step)
+			continue
+		}
+		if merged[step.Task] {
+			continue
+		}
+		merged[step.Task] = true
+		for _, taskStep := range taskSteps {
+			if taskStep.Task == step.Task {
+				result = append(result, taskStep)
+			}
+		}
+	}
+	for _, step := range taskSteps {
+		if !merged[step.Task] {
+			result = append(result, step)
+		}
+	}
+	return result
+}
+
+// stepMessage the results of the termination message without the internal results of tekton
+func stepMessage(message string) string {
+	message = strings.TrimSpace(message)
+	results := make([]struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Type  int    `json:"type"`
+	}, 0)
+	if err := json.Unmarshal([]byte(message), &results); err == nil {
+		items := make([]string, 0, len(results))
+		for _, result := range results {
+			if result.Type == internalResultType {
+				continue
+			}
+			items = append(items, result.Key+"="+strings.TrimSpace(result.Value))
+		}
+		message = strings.Join(items, ",")
+	}
+	if len(message) > maxStepMessage {
+		message = message[:maxStepMessage]
+	}
+	return message
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/laik/yce-cloud-extensions/pkg/apis/yamecloud/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestTaskRunSteps(t *testing.T) {
+	taskRun := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(`
+metadata:
+  name: demo-master-b8f3c2a1-build
+  labels:
+    tekton.dev/pipelineRun: demo-master-b8f3c2a1
+    tekton.dev/pipelineTask: build
+status:
+  steps:
+    - name: checkdocker
+      terminated:
+        exitCode: 0
+        reason: Completed
+        startedAt: "2021-06-01T00:00:00Z"
+        finishedAt: "2021-06-01T00:00:01Z"
+        message: '[{"key":"StartedAt","value":"2021-06-01T00:00:00Z","type":3}]'
+    - name: building
+      terminated:
+        exitCode: 1
+        reason: Error
+        startedAt: "2021-06-01T00:00:01Z"
+        finishedAt: "2021-06-01T00:05:00Z"
+        message: '[{"key":"image_digest","value":"sha256:abc\n","type":1},{"key":"StartedAt","value":"2021-06-01T00:00:01Z","type":3}]'
+    - name: tagging
+      running:
+        startedAt: "2021-06-01T00:05:00Z"
+    - name: push
+      waiting:
+        reason: PodInitializing
+`), &taskRun.Object); err != nil {
+		t.Fatal(err)
+	}
+	pipelineRun, steps := TaskRunSteps(taskRun)
+	if pipelineRun != "demo-master-b8f3c2a1" {
+		t.Fatalf("unexpected pipelineRun %s", pipelineRun)
+	}
+	expected := []v1.StepState{
+		{Task: "build", Name: "checkdocker", State: v1.SuccessState, StartTime: "2021-06-01T00:00:00Z", FinishTime: "2021-06-01T00:00:01Z", Reason: "Completed"},
+		{Task: "build", Name: "building", State: v1.FailState, StartTime: "2021-06-01T00:00:01Z", FinishTime: "2021-06-01T00:05:00Z", ExitCode: 1, Reason: "Error", Message: "image_digest=sha256:abc"},
+		{Task: "build", Name: "tagging", State: v1.RunningState, StartTime: "2021-06-01T00:05:00Z"},
+		{Task: "build", Name: "push", State: v1.WaitingState},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("unexpected steps %v", steps)
+	}
+}
+
+func TestMergeSteps(t *testing.T) {
+	steps := []v1.StepState{
+		{Task: "git-clone", Name: "clone", State: v1.SuccessState},
+		{Task: "build-api", Name: "building", State: v1.RunningState},
+		{Task: "build-web", Name: "building", State: v1.RunningState},
+	}
+	merged := MergeSteps(steps, []v1.StepState{
+		{Task: "build-api", Name: "building", State: v1.SuccessState},
+		{Task: "build-api", Name: "tagging", State: v1.RunningState},
+	})
+	merged = MergeSteps(merged, []v1.StepState{{Task: "manifest", Name: "push", State: v1.WaitingState}})
+	names := make([]string, 0)
+	for _, step := range merged {
+		names = append(names, step.Task+"/"+step.Name+"/"+step.State)
+	}
+	expected := []string{
+		"git-clone/clone/SUCCESS",
+		"build-api/building/SUCCESS",
+		"build-api/tagging/RUNNING",
+		"build-web/building/RUNNING",
+		"manifest/push/WAITING",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("unexpected merged steps %v", names)
+	}
+}
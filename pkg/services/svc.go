@@ -1,5 +1,7 @@
 package services
 
+import "context"
+
 type IService interface {
-	Start(stop <-chan struct{}, errC chan<- error)
+	Start(ctx context.Context, errC chan<- error)
 }
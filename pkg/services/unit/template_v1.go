@@ -0,0 +1,233 @@
+package unit
+
+// The templates for tekton.dev v1beta1 and v1, PipelineResource was removed
+// so the source is cloned by the git-clone step into the source workspace.
+const (
+	pipelineV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Pipeline
+metadata:
+  annotations:
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: ''
+      name: project_name
+      type: string
+    - default: ''
+      name: build_tool_image
+      type: string
+    - default: ''
+      name: dest_repo_url
+      type: string
+    - default: ''
+      name: cache_repo_url
+      type: string
+    - default: ''
+      name: code_type
+      type: string
+    - default: ''
+      name: sub_dir
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - default: ''
+      name: command
+      type: string
+    - default: ''
+      name: git_url
+      type: string
+    - default: ''
+      name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: ''
+      name: git_clone_image
+      type: string
+  workspaces:
+    - name: source
+  tasks:
+    - name: yce-cloud-extensions-unit-task
+      params:
+        - name: project_name
+          value: $(params.project_name)
+        - name: build_tool_image
+          value: $(params.build_tool_image)
+        - name: dest_repo_url
+          value: $(params.dest_repo_url)
+        - name: cache_repo_url
+          value: $(params.cache_repo_url)
+        - name: code_type
+          value: $(params.code_type)
+        - name: dockerfile
+          value: $(params.dockerfile)
+        - name: command
+          value: $(params.command)
+        - name: git_url
+          value: $(params.git_url)
+        - name: git_revision
+          value: $(params.git_revision)
+        - name: git_commit
+          value: $(params.git_commit)
+        - name: git_clone_image
+          value: $(params.git_clone_image)
+      workspaces:
+        - name: source
+          workspace: source
+      taskRef:
+        kind: Task
+        name: {{.TaskName}}`
+
+	taskV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: Task
+metadata:
+  labels:
+    namespace: {{.Namespace}}
+  name: yce-cloud-extensions-unit-task
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - default: none
+      name: project_name
+      type: string
+    - default: 'yametech/kaniko:v1.3.0'
+      name: build_tool_image
+      type: string
+    - default: none
+      name: dest_repo_url
+      type: string
+    - default: none
+      name: cache_repo_url
+      type: string
+    - default: none
+      name: code_type
+      type: string
+    - default: "Dockerfile"
+      name: dockerfile
+      type: string
+    - default: none
+      name: command
+      type: string
+    - name: git_url
+      type: string
+    - name: git_revision
+      type: string
+    - default: ''
+      name: git_commit
+      type: string
+    - default: 'alpine/git:v2.30.2'
+      name: git_clone_image
+      type: string
+  workspaces:
+    - name: source
+  steps:
+    - name: git-clone
+      image: $(params.git_clone_image)
+      workingDir: $(workspaces.source.path)
+      env:
+        - name: HOME
+          value: /tekton/home
+      script: |
+        #!/bin/sh
+        set -e
+        rm -rf git
+        git clone --branch "$(params.git_revision)" "$(params.git_url)" git
+        if [ -n "$(params.git_commit)" ]; then
+          git -C git checkout "$(params.git_commit)"
+        fi
+    - args:
+        - '-url'
+        - $(workspaces.source.path)/git/
+        - '-codetype'
+        - $(params.code_type)
+        - '--unittest=true'
+        - 'command'
+        - $(params.command)
+      env:
+        - name: DOCKER_CONFIG
+          value: /tekton/home/.docker
+      image: 'yametech/checkdocker:v0.1.4'
+      name: step1
+    - args:
+        - '--dockerfile=$(workspaces.source.path)/git/Dockerfile-unittest'
+        - '--context=$(workspaces.source.path)/git'
+        - '--insecure'
+        - '--force'
+        - '--cache=true'
+        - '--no-push'
+        - '--skip-tls-verify-pull'
+        - '--insecure-pull'
+        - '--skip-tls-verify'
+        - '--cache-repo=$(params.cache_repo_url)/$(params.project_name)-cache'
+        - '--skip-unused-stages=true'
+      env:
+        - name: "DOCKER_CONFIG"
+          value: "/tekton/home/.docker"
+      image: $(params.build_tool_image)
+      name: step2`
+
+	pipelineRunV1Tpl = `apiVersion: tekton.dev/{{.TektonVersion}}
+kind: PipelineRun
+metadata:
+  annotations:
+    fuxi.nip.io/run-tektongraphs: {{.PipelineRunGraph}}
+    fuxi.nip.io/tektongraphs: {{.PipelineGraph}}
+    namespace: {{.Namespace}}
+  labels:
+    namespace: {{.Namespace}}
+    tekton.dev/pipeline: {{.PipelineName}}
+    yce-cloud-extensions/project: {{.ProjectName}}
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+  params:
+    - name: project_name
+      value: {{.ProjectName}}
+    - name: build_tool_image
+      value: {{.BuildToolImage}}
+    - name: code_type
+      value: {{.CodeType}}
+    - name: cache_repo_url
+      value: {{.CacheRepoUrl}}
+    - name: command
+      value: {{.Command}}
+    - name: git_url
+      value: "{{.GitUrl}}"
+    - name: git_revision
+      value: "{{.Branch}}"
+    - name: git_commit
+      value: "{{.CommitID}}"
+    - name: git_clone_image
+      value: {{.GitCloneImage}}
+  pipelineRef:
+    name: {{.PipelineName}}
+  workspaces:
+    - name: source
+{{- if .WorkspaceSize}}
+      volumeClaimTemplate:
+        spec:
+          accessModes:
+            - ReadWriteOnce
+          resources:
+            requests:
+              storage: {{.WorkspaceSize}}
+{{- else}}
+      emptyDir: {}
+{{- end}}
+{{- if eq .TektonVersion "v1"}}
+  taskRunTemplate:
+    serviceAccountName: default
+  timeouts:
+    pipeline: 1h0m0s
+{{- else}}
+  serviceAccountName: default
+  timeout: 1h0m0s
+{{- end}}`
+)
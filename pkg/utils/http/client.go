@@ -1,17 +1,23 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
+
 	"github.com/go-resty/resty/v2"
 )
 
+// defaultTimeout used when the ctx passed to Do has no deadline
+const defaultTimeout = 30 * time.Second
+
 var _ IClient = &client{}
 
 type IClient interface {
 	Post(url string) IClient
 	Params(key string, value interface{}) IClient
-	Do() error
+	Do(ctx context.Context) error
 }
 
 func NewIClient() IClient {
@@ -36,13 +42,19 @@ func (c *client) Params(key string, value interface{}) IClient {
 	return c
 }
 
-func (c *client) Do() error {
+func (c *client) Do(ctx context.Context) error {
 	body, err := json.Marshal(c.params)
 	if err != nil {
 		return err
 	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
 	response, err := resty.New().
 		NewRequest().
+		SetContext(ctx).
 		SetHeader("Accept", "application/json"). //default json
 		SetBody(body).
 		Post(c.url)
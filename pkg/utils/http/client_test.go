@@ -1,6 +1,9 @@
 package http
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 var _ IClient = &FakeClient{}
 
@@ -13,7 +16,7 @@ func (f *FakeClient) Params(key string, value interface{}) IClient {
 	f.params[key] = value
 	return f
 }
-func (f *FakeClient) Do() error {
+func (f *FakeClient) Do(ctx context.Context) error {
 	return nil
 }
 
@@ -31,7 +34,7 @@ func TestClient(t *testing.T) {
 	if err := client.Post(":8081").
 		Params("123", "xx").
 		Params("abc", "yy").
-		Do(); err != nil {
+		Do(context.Background()); err != nil {
 		t.Fatal("non expect error")
 	}
 